@@ -79,11 +79,15 @@ func init() {
 func runArchiveAnnotateCmd(cmd *cobra.Command, args []string) {
 	log := setupLogger(baseFlags)
 
-	err := AnnotateArchive(archAnnotateFlags.localPath,
-		archAnnotateFlags.archivePath)
+	report, err := makeReportConfig(0, 0)
 	if err != nil {
-		log.Error().Err(err).Msg("archive annotation failed")
-		os.Exit(1)
+		exitOnError(log, usageError(err), "invalid report options")
+	}
+
+	err = AnnotateArchive(archAnnotateFlags.localPath,
+		archAnnotateFlags.archivePath, report)
+	if err != nil {
+		exitOnError(log, err, "archive annotation failed")
 	}
 
 	log.Info().Str("path", archAnnotateFlags.localPath).
@@ -92,8 +96,9 @@ func runArchiveAnnotateCmd(cmd *cobra.Command, args []string) {
 }
 
 // AnnotateArchive creates or updates any remote annotation originating from
-// a file at localPath which is archived at archivePath.
-func AnnotateArchive(localPath string, archivePath string) (err error) { // NRV
+// a file at localPath which is archived at archivePath, as configured by rc.
+func AnnotateArchive(localPath string, archivePath string,
+	rc valet.ReportConfig) (err error) { // NRV
 	var fp valet.FilePath
 	fp, err = valet.NewFilePath(localPath)
 	if err != nil {
@@ -117,24 +122,24 @@ func AnnotateArchive(localPath string, archivePath string) (err error) { // NRV
 	cPool := ex.NewClientPool(ex.DefaultClientPoolParams, "--silent")
 
 	var client *ex.Client
-	if client, err = cPool.Get(); err != nil {
-		return
+	if client, err = valet.GetClient(cPool); err != nil {
+		return unreachableError(err)
 	}
 	defer func() {
 		err = utilities.CombineErrors(err, cPool.Return(client))
 	}()
 
 	obj := ex.NewDataObject(client, archivePath)
-	if err = valet.AddMinKNOWReportAnnotation(obj, report); err != nil {
+	if err = valet.AddMinKNOWReportAnnotation(obj, report, rc); err != nil {
 		return
 	}
 
-	if ok, err = valet.HasValidReportAnnotation(obj, report); err != nil {
+	if ok, err = valet.HasValidReportAnnotation(obj, report, rc); err != nil {
 		return
 	}
 	if !ok {
-		return errors.Errorf("metadata from MinNOW report file '%s' " +
-			"was not confirmed for '%s'", localPath, archivePath)
+		return processingError(errors.Errorf("metadata from MinNOW report "+
+			"file '%s' was not confirmed for '%s'", localPath, archivePath))
 	}
 
 	return nil
@@ -0,0 +1,156 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file archive_audit.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	ex "github.com/wtsi-npg/extendo/v2"
+	logs "github.com/wtsi-npg/logshim"
+
+	"github.com/wtsi-npg/valet/valet"
+)
+
+var archAuditFlags = &dataDirCliFlags{}
+
+var archiveAuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Check the integrity of archived data objects",
+	Long: `
+valet archive audit will list every data object in an archive collection and
+check that it has a checksum in the iRODS catalogue, of the format expected by
+the archive, and checksum metadata that match it. These are the data objects
+that valet trusts as archived when local files are deleted.
+
+The audit is made independently of whether the local files from which the data
+objects were archived are still present, although whether each is present under
+the root directory is reported. A data object that fails the audit and whose
+local file is absent may have been deleted without a sound archived copy.
+
+The audit is read-only. Each data object that fails is printed, followed by a
+summary, and valet will exit with a non-zero status if any failed.
+`,
+	Example: `
+valet archive audit --root /data \
+    --archive-root /seq/ont/gridion/gxb02004`,
+	Run: runArchiveAuditCmd,
+}
+
+func init() {
+	archiveAuditCmd.Flags().StringVarP(&archAuditFlags.localRoot,
+		"root", "r", "",
+		"the root directory from which the data were archived")
+
+	err := archiveAuditCmd.MarkFlagRequired("root")
+	if err != nil {
+		logs.GetLogger().Error().
+			Err(err).Msg("failed to mark --root required")
+		os.Exit(1)
+	}
+
+	archiveAuditCmd.Flags().StringVarP(&archAuditFlags.archiveRoot,
+		"archive-root", "a", "",
+		"the archive root collection to audit")
+
+	err = archiveAuditCmd.MarkFlagRequired("archive-root")
+	if err != nil {
+		logs.GetLogger().Error().
+			Err(err).Msg("failed to mark --archive-root required")
+		os.Exit(1)
+	}
+
+	archiveAuditCmd.Flags().StringVar(&archAuditFlags.remoteChecksum,
+		"remote-checksum", string(valet.MD5Checksum),
+		"the checksum algorithm used by the archive (md5 or sha256)")
+
+	archiveCmd.AddCommand(archiveAuditCmd)
+}
+
+func runArchiveAuditCmd(cmd *cobra.Command, args []string) {
+	log := setupLogger(baseFlags)
+
+	alg, err := valet.ParseChecksumAlgorithm(archAuditFlags.remoteChecksum)
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid --remote-checksum")
+	}
+
+	summary, err := AuditArchive(
+		archAuditFlags.localRoot,
+		archAuditFlags.archiveRoot,
+		alg,
+		baseFlags.maxProc)
+	if err != nil {
+		exitOnError(log, err, "archive audit failed")
+	}
+
+	PrintAuditSummary(os.Stdout, summary)
+
+	switch {
+	case len(summary.Suspect) > 0:
+		exitOnError(log, mismatchError(errors.Errorf("%d of %d data "+
+			"objects failed the audit", len(summary.Suspect),
+			summary.NumObjects)), "archive audit failed")
+	case summary.NumErrors > 0:
+		exitOnError(log, processingError(errors.Errorf("%d of %d data "+
+			"objects could not be audited", summary.NumErrors,
+			summary.NumObjects)), "archive audit failed")
+	}
+}
+
+// AuditArchive audits the data objects in the archive under archiveRoot,
+// which were archived from root, using up to maxProc clients.
+func AuditArchive(root string, archiveRoot string,
+	alg valet.ChecksumAlgorithm, maxProc int) (valet.AuditSummary, error) {
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	setupSignalHandler(cancel)
+
+	clientPool := ex.NewClientPool(ex.DefaultClientPoolParams, "--silent")
+	defer clientPool.Close()
+
+	if err := checkArchive(clientPool); err != nil {
+		return valet.AuditSummary{}, err
+	}
+
+	summary, err := valet.AuditArchive(cancelCtx, root, archiveRoot,
+		clientPool, alg, maxProc)
+	if err != nil {
+		return summary, processingError(err)
+	}
+
+	return summary, nil
+}
+
+// PrintAuditSummary writes summary to w, one line per data object that failed
+// the audit, followed by the totals.
+func PrintAuditSummary(w io.Writer, summary valet.AuditSummary) {
+	for _, result := range summary.Suspect {
+		_, _ = fmt.Fprintln(w, result)
+	}
+	_, _ = fmt.Fprintf(w, "%d data objects audited, %d failed (%d with "+
+		"local file absent), %d errors\n", summary.NumObjects,
+		len(summary.Suspect), summary.NumUnsafeDeletions(), summary.NumErrors)
+}
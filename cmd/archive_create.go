@@ -25,8 +25,11 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	ex "github.com/wtsi-npg/extendo/v2"
 	logs "github.com/wtsi-npg/logshim"
@@ -36,12 +39,63 @@ import (
 )
 
 type archiveParams struct {
-	deleteLocal   bool
-	dryRun        bool
-	exclude       []string
-	sweepInterval time.Duration
-	maxProc       int
-	cleanupDelay  time.Duration
+	deleteLocal    bool
+	dryRun         bool
+	dryRunVerify   bool
+	printPlan      bool
+	reportDels     bool
+	exclude        []string
+	selection      valet.Selection
+	report         valet.ReportConfig
+	matchExpr      valet.FilePredicate
+	pruneExpr      valet.FilePredicate
+	sweepInterval  time.Duration
+	sweepJitter    float64
+	watchGrace     time.Duration
+	stableSweep    bool
+	fullSweep      time.Duration
+	maxProc        int
+	chkWorkers     int
+	maxProcPerRun  int
+	maxBytes       int64
+	fileTimeout    time.Duration
+	cleanupDelay   time.Duration
+	cleanupSetting *valet.DurationSetting
+	reloadFile     string
+	healthAddr     string
+	startPaused    bool
+	window         *valet.WorkWindow
+	annotateOnly   bool
+	extChecksum    bool
+	forceArchive   bool
+	forceID        string
+	chkMetaOnly    bool
+	verifyComp     bool
+	provenance     bool
+	remoteChecksum valet.ChecksumAlgorithm
+	excludeOlder   time.Duration
+	sizeLimit      int64
+	excludeActive  bool
+	onlyOwnFiles   bool
+	activeWindow   time.Duration
+	minRunAge      time.Duration
+	onlyRuns       []string
+	metadata       []ex.AVU
+	acls           []ex.ACL
+	mirrorEmpty    bool
+	inheritNew     bool
+	preserveTimes  bool
+	skipHardLinks  bool
+	requireRepl    []string
+	events         *valet.EventPublisher
+	quarantine     *valet.Quarantine
+	maxErrors      uint64
+	quotaHold      time.Duration
+	quotaHoldMax   time.Duration
+	waitForRoot    time.Duration
+	mirrorRoots    []string
+	archiveEnvs    []string
+	bundle         valet.BundleParams
 }
 
 var archCreateFlags = &dataDirCliFlags{}
@@ -62,7 +116,55 @@ N.B. TMPDIR use
 
 TMPDIR is used by valet to compress files, after which they are moved into
 position using a rename operation. Renaming files will fail if attempted across
-filesystem boundaries.
+filesystem boundaries. TMPDIR is also used to stage bundles (see below).
+
+N.B. Bundling
+
+Directories matching the --bundle-dirs patterns may be archived as a single tar
+data object (a bundle), named (directory name).tar, rather than one data
+object per file. This is intended for directories containing many small files.
+The bundle contains a manifest of the checksums of its files.
+
+A directory is bundled once it has not been modified for the --bundle-settle
+period, if it contains no directories and contains at least --bundle-min-files
+files to archive, totalling no more than --bundle-max-size bytes. Otherwise
+its files are archived individually, once it has settled.
+
+N.B. External checksums
+
+With --external-checksum, valet will not create checksum files, but will wait
+for a separate valet checksum create process to do so. Files without a valid
+checksum file are not archived and are logged as waiting for a checksum.
+
+N.B. Checksum metadata only
+
+With --checksum-metadata-only, valet will remove the local checksum file of an
+archived file once it has confirmed that the checksum is recorded as metadata
+of the archived copy. Thereafter, a file without a checksum file is considered
+archived if its archived copy has the same size and checksum metadata matching
+its checksum in the archive, and the file has not been modified since it was
+archived. The local file is not read again, so a change to its content that
+preserves both its size and its modification time will not be detected. This
+is not trusted for deletion: with --delete-on-archive, checksum files are
+recreated and confirmed in full before any local file is removed. This option
+requires an MD5 archive and should not be used alongside valet checksum create
+on the same directory hierarchy, which would recreate the checksum files.
+
+N.B. Annotation only
+
+With --annotate-only, valet will only annotate the archive with the metadata
+from MinKNOW reports, for runs that have already been copied by other means.
+No files are compressed, checksummed, copied or deleted.
+
+N.B. Archiving by force
+
+With --force-archive, e.g. to recover from a corrupted archive, valet will
+archive every file again, overwriting any archived copy, after recalculating
+its checksum file. The recovery must be identified with --force-archive-id.
+Each data object archived by force is annotated with the ID, so that its file
+is archived by force only once for that recovery, even after a restart, unless
+it changes. No file is considered archived, to be marked or deleted, until its
+new copy has been made and verified.
 
 - Archiving files
   
@@ -76,7 +178,7 @@ filesystem boundaries.
 
   - Checksum file patterns supported
 
-    - (data file name).md5
+    - (data file name).md5 (see --checksum-suffix and --checksum-hidden)
 `,
 	Example: `
 valet archive create --root /data --exclude /data/custom \
@@ -97,9 +199,17 @@ func init() {
 		os.Exit(1)
 	}
 
-	archiveCreateCmd.Flags().StringVarP(&archCreateFlags.archiveRoot,
-		"archive-root", "a", "",
-		"the archive root collection")
+	archiveCreateCmd.Flags().StringArrayVarP(&archCreateFlags.archiveRoots,
+		"archive-root", "a", []string{},
+		"the archive root collection; if repeated, every file is archived "+
+			"to each root and is considered archived only once archived to "+
+			"all of them")
+
+	archiveCreateCmd.Flags().StringArrayVar(&archCreateFlags.archiveEnvs,
+		"archive-root-env", []string{},
+		"the iRODS environment file with which to connect to each "+
+			"--archive-root, repeated in the same order (by default, the "+
+			"iRODS environment of valet)")
 
 	err = archiveCreateCmd.MarkFlagRequired("archive-root")
 	if err != nil {
@@ -113,24 +223,285 @@ func init() {
 		fmt.Sprintf("directory sweep interval, minimum %s",
 			valet.MinSweepInterval))
 
-	archiveCreateCmd.Flags().BoolVar(&baseFlags.dryRun,
-		"dry-run", false,
-		"dry-run (make no changes)")
+	archiveCreateCmd.Flags().Float64Var(&archCreateFlags.sweepJitter,
+		"jitter", 0,
+		fmt.Sprintf("vary each sweep interval randomly by up to this "+
+			"fraction of it e.g. 0.1 for ±10%%, maximum %g", valet.MaxSweepJitter))
+
+	archiveCreateCmd.Flags().DurationVar(&archCreateFlags.fullSweep,
+		"full-sweep-interval", 0,
+		"make sweeps incremental, searching only directories changed since "+
+			"the previous sweep, with a full sweep at this interval "+
+			"(disabled by default)")
+
+	archiveCreateCmd.Flags().DurationVar(&archCreateFlags.watchGrace,
+		"watch-grace", 0,
+		"wait this long after a watched file is closed or moved into place "+
+			"and work on it only if it has not changed meanwhile "+
+			"(disabled by default)")
+
+	archiveCreateCmd.Flags().DurationVar(&archCreateFlags.waitForRoot,
+		"wait-for-root", 0,
+		"if the root directory does not exist, wait up to this long for it "+
+			"to be created before monitoring it, rather than failing "+
+			"(disabled by default)")
+
+	archiveCreateCmd.Flags().BoolVar(&archCreateFlags.stableSweep,
+		"require-stable-sweep", false,
+		"find files by sweeping only once they are unchanged in size and "+
+			"modification time since the previous sweep")
+
+	dryRunFlag := archiveCreateCmd.Flags().VarPF(dryRunValue{baseFlags},
+		"dry-run", "",
+		"dry-run (make no changes); with --dry-run=verify, consult the "+
+			"archive to report what would be done to each file")
+	dryRunFlag.NoOptDefVal = "true"
+
+	archiveCreateCmd.Flags().BoolVar(&baseFlags.printPlan,
+		"print-plan", false,
+		"print the work plan as JSON and exit, without doing any work")
+
+	archiveCreateCmd.Flags().DurationVar(&archCreateFlags.cleanupTemp,
+		"cleanup-temp-older-than", 0,
+		"on startup, remove valet temporary files that have not been "+
+			"modified for this long from the temp directory "+
+			"(disabled by default)")
 
 	archiveCreateCmd.Flags().StringArrayVar(&archCreateFlags.excludeDirs,
 		"exclude", []string{},
-		"patterns matching directories to prune "+
-			"from both monitoring and interval sweeps")
+		"glob patterns matching directories to prune "+
+			"from both monitoring and interval sweeps "+
+			"(** matches any number of directories)")
+
+	addPredicateExprFlags(archiveCreateCmd, archCreateFlags)
+
+	archiveCreateCmd.Flags().DurationVar(&archCreateFlags.excludeOlder,
+		"exclude-older-than", 0,
+		"prune directories marked as archived that have not been "+
+			"modified for this long (disabled by default)")
+
+	archiveCreateCmd.Flags().BoolVar(&archCreateFlags.excludeActive,
+		"exclude-active-run", false,
+		"exclude, in each experiment, the run directory modified most "+
+			"recently, if within --active-run-window, as the run that "+
+			"MinKNOW is probably still writing")
+
+	archiveCreateCmd.Flags().DurationVar(&archCreateFlags.activeWindow,
+		"active-run-window", valet.DefaultActiveRunWindow,
+		"the period within which a run directory must have been modified "+
+			"to be excluded by --exclude-active-run")
+
+	archiveCreateCmd.Flags().DurationVar(&archCreateFlags.minRunAge,
+		"min-run-age", 0,
+		"prune run directories containing anything modified more recently "+
+			"than this, until a later sweep (disabled by default)")
+
+	archiveCreateCmd.Flags().BoolVar(&archCreateFlags.onlyOwnFiles,
+		"only-own-files", false,
+		"match only files and directories owned by the user running valet, "+
+			"leaving those of other users alone")
+
+	archiveCreateCmd.Flags().Int64Var(&archCreateFlags.sizeLimit,
+		"size-limit", 0,
+		"skip, with a warning, any file of this size in bytes or larger, "+
+			"pending review (disabled by default)")
+
+	archiveCreateCmd.Flags().StringArrayVar(&archCreateFlags.onlyRuns,
+		"only-run", []string{},
+		"a MinKNOW run ID to restrict processing to; files in other runs "+
+			"are ignored (may be repeated)")
+
+	archiveCreateCmd.Flags().StringVar(&archCreateFlags.onlyRunsFile,
+		"only-runs-file", "",
+		"a file of MinKNOW run IDs, one per line, to restrict processing to")
+
+	archiveCreateCmd.Flags().StringArrayVar(&archCreateFlags.meta,
+		"meta", []string{},
+		"a key=value pair to add to every archived data object as metadata "+
+			"in the "+valet.UserNamespace+" namespace (may be repeated)")
+
+	archiveCreateCmd.Flags().StringVar(&archCreateFlags.metaFile,
+		"meta-file", "",
+		"a file of key=value pairs, one per line, to add as metadata to "+
+			"every archived data object")
+
+	archiveCreateCmd.Flags().StringArrayVar(&archCreateFlags.grants,
+		"grant", []string{},
+		"an ACL of the form group:level, or group#zone:level, to add to "+
+			"every archived data object and its parent collections below "+
+			"the archive root (may be repeated)")
+
+	archiveCreateCmd.Flags().StringArrayVar(&archCreateFlags.requireRepl,
+		"require-replica", []string{},
+		"a resource on which an archived data object must have a valid "+
+			"replica before its file is considered archived and may be "+
+			"deleted (repeat for the members of a resource group, any of "+
+			"which will do)")
+
+	archiveCreateCmd.Flags().BoolVar(&archCreateFlags.inheritNew,
+		"inherit-new-collections", false,
+		"enable inheritance on the collections created while archiving, "+
+			"leaving existing collections unchanged (requires ichmod)")
+
+	archiveCreateCmd.Flags().BoolVar(&archCreateFlags.preserveTimes,
+		"preserve-times", false,
+		"record the modification time of each archived file as "+
+			"valet:source_mtime metadata of its data object")
+
+	archiveCreateCmd.Flags().DurationVar(&archCreateFlags.quotaHold,
+		"quota-hold", valet.DefaultQuotaHoldMinDelay,
+		"when the archive's quota is exhausted, hold archiving for this "+
+			"long, doubling the hold each time it is still exhausted "+
+			"(0 to disable)")
+
+	archiveCreateCmd.Flags().DurationVar(&archCreateFlags.quotaHoldMax,
+		"quota-hold-max", valet.DefaultQuotaHoldMaxDelay,
+		"the maximum hold on archiving while the archive's quota is exhausted")
+
+	archiveCreateCmd.Flags().IntVar(&archCreateFlags.reportTries,
+		"report-parse-attempts", valet.DefaultReportParseAttempts,
+		"the number of attempts to parse a MinKNOW report that appears "+
+			"incomplete, as if still being written, before annotation fails")
+
+	archiveCreateCmd.Flags().DurationVar(&archCreateFlags.reportDelay,
+		"report-parse-delay", valet.DefaultReportParseDelay,
+		"the delay between attempts to parse an incomplete MinKNOW report")
+
+	archiveCreateCmd.Flags().BoolVar(&archCreateFlags.mirrorEmpty,
+		"mirror-empty-dirs", false,
+		"create an empty collection in the archive for each empty "+
+			"local directory")
+
+	archiveCreateCmd.Flags().BoolVar(&archCreateFlags.skipHardLinks,
+		"skip-hardlink-dupes", false,
+		"archive only the first path found for a file having several hard "+
+			"links, skipping its other paths")
+
+	archiveCreateCmd.Flags().Uint64Var(&archCreateFlags.maxErrors,
+		"max-errors", 0,
+		"abort, exiting with a non-zero status, once more than this many "+
+			"errors have occurred while working on files (0 for no limit)")
+
+	archiveCreateCmd.Flags().IntVar(&archCreateFlags.quarantineAfter,
+		"quarantine-after", 0,
+		"quarantine a file, so that it is no longer worked on, after this "+
+			"many consecutive failures (disabled by default)")
+
+	archiveCreateCmd.Flags().StringVar(&archCreateFlags.quarantineFile,
+		"quarantine-file", "",
+		"a file in which to keep the quarantined files, so that they remain "+
+			"quarantined after a restart")
+
+	archiveCreateCmd.Flags().BoolVar(&archCreateFlags.annotateOnly,
+		"annotate-only", false,
+		"only annotate the archive with metadata from MinKNOW reports "+
+			"that have already been archived; no files are copied")
+
+	archiveCreateCmd.Flags().BoolVar(&archCreateFlags.extChecksum,
+		"external-checksum", false,
+		"never create checksum files, but rely on a separate valet "+
+			"checksum create process; files are archived only once they "+
+			"have a valid checksum file")
+
+	archiveCreateCmd.Flags().BoolVar(&archCreateFlags.forceArchive,
+		"force-archive", false,
+		"archive every file again, overwriting any archived copy, after "+
+			"recalculating its checksum file, e.g. to recover from a "+
+			"corrupted archive")
+
+	archiveCreateCmd.Flags().StringVar(&archCreateFlags.forceID,
+		"force-archive-id", "",
+		"identify the recovery made with --force-archive; data objects "+
+			"archived by force are annotated with it, so that their files "+
+			"are not archived by force again for the same ID")
+
+	archiveCreateCmd.Flags().BoolVar(&archCreateFlags.chkMetaOnly,
+		"checksum-metadata-only", false,
+		"remove local checksum files once the checksum is confirmed as "+
+			"metadata of the archived copy, which is then trusted in their "+
+			"place")
+
+	archiveCreateCmd.Flags().BoolVar(&archCreateFlags.provenance,
+		"provenance", true,
+		"add metadata recording the host and valet version that archived "+
+			"each data object (disable with --provenance=false)")
+
+	archiveCreateCmd.Flags().BoolVar(&archCreateFlags.verifyComp,
+		"verify-compression", false,
+		"verify that each compressed file decompresses to the original "+
+			"content before it replaces the original")
 
 	archiveCreateCmd.Flags().BoolVar(&archCreateFlags.deleteLocal,
 		"delete-on-archive", false,
 		"delete local files on successful archiving")
 
+	archiveCreateCmd.Flags().BoolVar(&archCreateFlags.reportDels,
+		"report-deletions", false,
+		"make a dry run, as --dry-run=verify, printing only the paths of the "+
+			"files and directories that would be deleted with "+
+			"--delete-on-archive")
+
 	archiveCreateCmd.Flags().DurationVar(&archCreateFlags.cleanupDelay,
 		"cleanup", valet.DefaultCleanupDelay,
 		fmt.Sprintf("run directory cleanup delay, minimum %s",
 			valet.MinCleanupDelay))
 
+	archiveCreateCmd.Flags().StringVar(&archCreateFlags.reloadFile,
+		"reload-file", "",
+		"a JSON file of settings to reload on SIGHUP, without restarting: "+
+			"sweep_interval and cleanup_delay e.g. {\"sweep_interval\": \"10m\"}")
+
+	archiveCreateCmd.Flags().StringArrayVar(&archCreateFlags.bundleDirs,
+		"bundle-dirs", []string{},
+		"glob patterns matching directories to archive as single tar "+
+			"objects (** matches any number of directories)")
+
+	archiveCreateCmd.Flags().IntVar(&archCreateFlags.bundleMinFiles,
+		"bundle-min-files", valet.DefaultBundleMinFiles,
+		"the minimum number of files in a directory to bundle it")
+
+	archiveCreateCmd.Flags().Int64Var(&archCreateFlags.bundleMaxSize,
+		"bundle-max-size", valet.DefaultBundleMaxSize,
+		"the maximum total size in bytes of files in a directory to bundle it")
+
+	archiveCreateCmd.Flags().DurationVar(&archCreateFlags.bundleSettle,
+		"bundle-settle", valet.DefaultBundleSettleDelay,
+		"the time a directory must be unmodified before bundling it")
+
+	archiveCreateCmd.Flags().StringVar(&archCreateFlags.remoteChecksum,
+		"remote-checksum", string(valet.MD5Checksum),
+		"the checksum algorithm used by the archive (md5 or sha256)")
+
+	archiveCreateCmd.Flags().BoolVar(&archCreateFlags.startPaused,
+		"start-paused", false,
+		"start with processing paused; files are detected, but not worked "+
+			"on until resumed with SIGUSR2 (SIGUSR1 pauses again)")
+
+	archiveCreateCmd.Flags().StringVar(&archCreateFlags.archWindow,
+		"archive-window", "",
+		"a daily window HH:MM-HH:MM e.g. 20:00-06:00, outside which files "+
+			"are not compressed or archived, although they are still "+
+			"detected and checksummed (requires --archive-window-tz)")
+
+	archiveCreateCmd.Flags().StringVar(&archCreateFlags.archWindowTZ,
+		"archive-window-tz", "",
+		"the time zone of --archive-window e.g. Europe/London, UTC or Local")
+
+	archiveCreateCmd.Flags().StringVar(&archCreateFlags.mqURL,
+		"mq-url", "",
+		"the URL of a Kafka REST proxy to which to publish an event for "+
+			"each archived file e.g. http://kafka-rest:8082 "+
+			"(requires --mq-topic)")
+
+	archiveCreateCmd.Flags().StringVar(&archCreateFlags.mqTopic,
+		"mq-topic", "",
+		"the topic to which to publish archived file events")
+
+	archiveCreateCmd.Flags().StringVar(&archCreateFlags.healthAddr,
+		"health-addr", "",
+		"the address on which to serve /healthz and /readyz "+
+			"e.g. :8080 (disabled by default)")
+
 	archiveCmd.AddCommand(archiveCreateCmd)
 }
 
@@ -140,75 +511,646 @@ func runArchiveCreateCmd(cmd *cobra.Command, args []string) {
 	if archCreateFlags.sweepInterval < valet.MinSweepInterval {
 		log.Error().Msgf("invalid sweep interval %s (must be > %s)",
 			archCreateFlags.sweepInterval, valet.MinSweepInterval)
-		os.Exit(1)
+		os.Exit(ExitUsage)
+	}
+
+	if archCreateFlags.sweepJitter < 0 ||
+		archCreateFlags.sweepJitter > valet.MaxSweepJitter {
+		log.Error().Msgf("invalid sweep jitter %g (must be 0 to %g)",
+			archCreateFlags.sweepJitter, valet.MaxSweepJitter)
+		os.Exit(ExitUsage)
+	}
+
+	if archCreateFlags.watchGrace < 0 {
+		log.Error().Msgf("invalid watch grace period %s (must be >= 0)",
+			archCreateFlags.watchGrace)
+		os.Exit(ExitUsage)
 	}
 
 	if archCreateFlags.cleanupDelay < valet.MinCleanupDelay {
 		log.Error().Msgf("invalid cleanup delay %s (must be > %s)",
 			archCreateFlags.cleanupDelay, valet.MinCleanupDelay)
-		os.Exit(1)
+		os.Exit(ExitUsage)
+	}
+
+	if archCreateFlags.sizeLimit < 0 {
+		log.Error().Msgf("invalid size limit %d (must be >= 0)",
+			archCreateFlags.sizeLimit)
+		os.Exit(ExitUsage)
+	}
+
+	if archCreateFlags.excludeActive && archCreateFlags.activeWindow <= 0 {
+		log.Error().Msgf("invalid active run window %s (must be > 0)",
+			archCreateFlags.activeWindow)
+		os.Exit(ExitUsage)
+	}
+
+	if archCreateFlags.minRunAge < 0 {
+		log.Error().Msgf("invalid minimum run age %s (must be >= 0)",
+			archCreateFlags.minRunAge)
+		os.Exit(ExitUsage)
+	}
+
+	if baseFlags.dryRunVerify && archCreateFlags.annotateOnly {
+		log.Error().Msg("--dry-run=verify may not be used with " +
+			"--annotate-only")
+		os.Exit(ExitUsage)
+	}
+
+	if archCreateFlags.reportDels {
+		if archCreateFlags.annotateOnly {
+			log.Error().Msg("--report-deletions may not be used with " +
+				"--annotate-only")
+			os.Exit(ExitUsage)
+		}
+
+		// Deletion is previewed by a verifying dry run
+		baseFlags.dryRun, baseFlags.dryRunVerify = true, true
+		archCreateFlags.deleteLocal = true
+	}
+
+	if archCreateFlags.annotateOnly && (archCreateFlags.deleteLocal ||
+		len(archCreateFlags.bundleDirs) > 0) {
+		log.Error().Msg("--annotate-only may not be used with " +
+			"--delete-on-archive or --bundle-dirs")
+		os.Exit(ExitUsage)
+	}
+
+	// Runs already marked as archived would be pruned without being
+	// archived again
+	if archCreateFlags.forceArchive && (archCreateFlags.annotateOnly ||
+		archCreateFlags.extChecksum || len(archCreateFlags.bundleDirs) > 0 ||
+		archCreateFlags.excludeOlder > 0) {
+		log.Error().Msg("--force-archive may not be used with " +
+			"--annotate-only, --external-checksum, --bundle-dirs or " +
+			"--exclude-older-than")
+		os.Exit(ExitUsage)
+	}
+	if archCreateFlags.forceArchive &&
+		strings.TrimSpace(archCreateFlags.forceID) == "" {
+		log.Error().Msg("--force-archive requires --force-archive-id")
+		os.Exit(ExitUsage)
+	}
+	if archCreateFlags.forceArchive {
+		log.Warn().Str("id", archCreateFlags.forceID).
+			Msg("archiving every file by force, overwriting any " +
+				"archived copies")
+	}
+
+	if archCreateFlags.chkMetaOnly && (archCreateFlags.annotateOnly ||
+		archCreateFlags.extChecksum) {
+		log.Error().Msg("--checksum-metadata-only may not be used with " +
+			"--annotate-only or --external-checksum")
+		os.Exit(ExitUsage)
+	}
+
+	remoteChecksum, err := valet.ParseChecksumAlgorithm(
+		archCreateFlags.remoteChecksum)
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid --remote-checksum")
+	}
+
+	if archCreateFlags.chkMetaOnly && !remoteChecksum.IsMD5() {
+		log.Error().Msg("--checksum-metadata-only may only be used with " +
+			"--remote-checksum md5")
+		os.Exit(ExitUsage)
+	}
+
+	onlyRuns, err := readRunIDs(archCreateFlags)
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid --only-run")
+	}
+
+	metadata, err := readMetadata(archCreateFlags)
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid --meta")
+	}
+
+	acls, err := valet.ParseACLs(archCreateFlags.grants)
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid --grant")
 	}
 
-	err := CreateArchive(
+	report, err := makeReportConfig(archCreateFlags.reportTries,
+		archCreateFlags.reportDelay)
+	if err != nil {
+		exitOnError(log, usageError(err),
+			"invalid --report-parse-attempts or --report-parse-delay")
+	}
+
+	selection, err := makeSelection()
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid file selection options")
+	}
+
+	matchExpr, pruneExpr, err := parsePredicateExprs(archCreateFlags,
+		selection)
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid predicate expression")
+	}
+
+	events, err := newEventPublisher(archCreateFlags)
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid --mq-url or --mq-topic")
+	}
+
+	var window *valet.WorkWindow
+	if archCreateFlags.archWindow != "" {
+		if window, err = parseArchiveWindow(archCreateFlags); err != nil {
+			exitOnError(log, usageError(err), "invalid --archive-window")
+		}
+		log.Info().Str("window", window.String()).
+			Msg("compressing and archiving only within the archive window")
+	}
+
+	archiveRoot := archCreateFlags.archiveRoots[0]
+	mirrorRoots := archCreateFlags.archiveRoots[1:]
+	if len(mirrorRoots) > 0 && (archCreateFlags.annotateOnly ||
+		len(archCreateFlags.bundleDirs) > 0 ||
+		len(archCreateFlags.requireRepl) > 0) {
+		log.Error().Msg("--annotate-only, --bundle-dirs and " +
+			"--require-replica may only be used with one --archive-root")
+		os.Exit(ExitUsage)
+	}
+	if len(archCreateFlags.archiveEnvs) > 0 &&
+		len(archCreateFlags.archiveEnvs) != len(archCreateFlags.archiveRoots) {
+		log.Error().Msg("--archive-root-env must be given once for each " +
+			"--archive-root")
+		os.Exit(ExitUsage)
+	}
+
+	if archCreateFlags.reloadFile != "" {
+		if _, _, err = readReloadFile(archCreateFlags.reloadFile); err != nil {
+			exitOnError(log, usageError(err), "invalid --reload-file")
+		}
+	}
+
+	if !baseFlags.printPlan {
+		sweepTempFiles(archCreateFlags.cleanupTemp, baseFlags.dryRun)
+	}
+
+	stopTracing := startTracing(baseFlags)
+	defer stopTracing()
+
+	err = CreateArchive(
 		archCreateFlags.localRoot,
-		archCreateFlags.archiveRoot,
+		archiveRoot,
 		archiveParams{
-			dryRun:        baseFlags.dryRun,
-			maxProc:       baseFlags.maxProc,
-			exclude:       archiveExcludeDirs(archCreateFlags.localRoot, archCreateFlags),
-			sweepInterval: archCreateFlags.sweepInterval,
-			deleteLocal:   archCreateFlags.deleteLocal,
-			cleanupDelay:  archCreateFlags.cleanupDelay,
+			dryRun:         baseFlags.dryRun,
+			dryRunVerify:   baseFlags.dryRunVerify,
+			printPlan:      baseFlags.printPlan,
+			reportDels:     archCreateFlags.reportDels,
+			maxProc:        baseFlags.maxProc,
+			chkWorkers:     baseFlags.chkWorkers,
+			maxProcPerRun:  baseFlags.maxProcPerRun,
+			maxBytes:       baseFlags.maxBytes,
+			fileTimeout:    baseFlags.fileTimeout,
+			exclude:        archiveExcludeDirs(archCreateFlags.localRoot, archCreateFlags),
+			selection:      selection,
+			report:         report,
+			matchExpr:      matchExpr,
+			pruneExpr:      pruneExpr,
+			sweepInterval:  archCreateFlags.sweepInterval,
+			sweepJitter:    archCreateFlags.sweepJitter,
+			watchGrace:     archCreateFlags.watchGrace,
+			stableSweep:    archCreateFlags.stableSweep,
+			fullSweep:      archCreateFlags.fullSweep,
+			deleteLocal:    archCreateFlags.deleteLocal,
+			cleanupDelay:   archCreateFlags.cleanupDelay,
+			reloadFile:     archCreateFlags.reloadFile,
+			healthAddr:     archCreateFlags.healthAddr,
+			startPaused:    archCreateFlags.startPaused,
+			window:         window,
+			annotateOnly:   archCreateFlags.annotateOnly,
+			extChecksum:    archCreateFlags.extChecksum,
+			forceArchive:   archCreateFlags.forceArchive,
+			forceID:        archCreateFlags.forceID,
+			chkMetaOnly:    archCreateFlags.chkMetaOnly,
+			verifyComp:     archCreateFlags.verifyComp,
+			provenance:     archCreateFlags.provenance,
+			remoteChecksum: remoteChecksum,
+			excludeOlder:   archCreateFlags.excludeOlder,
+			sizeLimit:      archCreateFlags.sizeLimit,
+			excludeActive:  archCreateFlags.excludeActive,
+			onlyOwnFiles:   archCreateFlags.onlyOwnFiles,
+			activeWindow:   archCreateFlags.activeWindow,
+			minRunAge:      archCreateFlags.minRunAge,
+			onlyRuns:       onlyRuns,
+			metadata:       metadata,
+			acls:           acls,
+			mirrorEmpty:    archCreateFlags.mirrorEmpty,
+			inheritNew:     archCreateFlags.inheritNew,
+			preserveTimes:  archCreateFlags.preserveTimes,
+			skipHardLinks:  archCreateFlags.skipHardLinks,
+			requireRepl:    archCreateFlags.requireRepl,
+			events:         events,
+			quarantine:     newQuarantine(archCreateFlags),
+			maxErrors:      archCreateFlags.maxErrors,
+			quotaHold:      archCreateFlags.quotaHold,
+			quotaHoldMax:   archCreateFlags.quotaHoldMax,
+			waitForRoot:    archCreateFlags.waitForRoot,
+			mirrorRoots:    mirrorRoots,
+			archiveEnvs:    archCreateFlags.archiveEnvs,
+			bundle: valet.BundleParams{
+				Patterns:    archCreateFlags.bundleDirs,
+				MinFiles:    archCreateFlags.bundleMinFiles,
+				MaxSize:     archCreateFlags.bundleMaxSize,
+				SettleDelay: archCreateFlags.bundleSettle,
+			},
 		})
 
 	if err != nil {
-		log.Error().Err(err).Msg("archive creation failed")
-		os.Exit(1)
+		exitOnError(log, err, "archive creation failed")
 	}
 }
 
 // CreateArchive archives files found locally under root to remote archiveRoot,
-// preserving the relative directory hierarchy.
+// preserving the relative directory hierarchy. Files are also archived to any
+// params.mirrorRoots in the same way. Each archive root is reached through its
+// own client pool, connecting with its iRODS environment file in
+// params.archiveEnvs, if any.
 func CreateArchive(root string, archiveRoot string, params archiveParams) error {
-	log := logs.GetLogger()
-
 	cancelCtx, cancel := context.WithCancel(context.Background())
 	setupSignalHandler(cancel)
 
-	userPruneFn, err := valet.MakeGlobPruneFunc(params.exclude)
-	if err != nil {
-		log.Error().Err(err).Msg("error in default exclusion patterns")
-		os.Exit(1)
+	pause := valet.NewPause(params.startPaused)
+	setupPauseHandler(pause)
+
+	stats := valet.NewArchiveStats()
+
+	var hardLinks *valet.HardLinks
+	if params.skipHardLinks {
+		hardLinks = valet.NewHardLinks()
 	}
 
-	defaultPruneFn, err := valet.MakeDefaultPruneFunc(root)
-	if err != nil {
-		log.Error().Err(err).Msg("error in exclusion patterns")
-		os.Exit(1)
+	// The sweep interval and cleanup delay may be changed on SIGHUP
+	intervals := make(chan time.Duration, 1)
+	params.cleanupSetting = valet.NewDurationSetting(params.cleanupDelay)
+	if params.reloadFile != "" {
+		setupReloadHandler(params.reloadFile, intervals, params.cleanupSetting)
 	}
 
-	userCleanupFn := valet.MakeRequiresRemoval(params.cleanupDelay)
+	matchFn, pruneFn := archiveFilters(root, params)
+
+	envFile := func(i int) string {
+		if i < len(params.archiveEnvs) {
+			return params.archiveEnvs[i]
+		}
+		return ""
+	}
 
 	poolParams := ex.DefaultClientPoolParams
-	clientPool := ex.NewClientPool(poolParams, "--silent")
+	clientPool := valet.NewClientPool(poolParams, envFile(0), "--silent")
+
+	var mirrors []valet.RemoteRoot
+	for i, mirrorRoot := range params.mirrorRoots {
+		mirrors = append(mirrors, valet.RemoteRoot{
+			Base: mirrorRoot,
+			ClientPool: valet.NewClientPool(poolParams, envFile(i+1),
+				"--silent"),
+		})
+	}
+
+	var quotaHold *valet.QuotaHold
+	if params.quotaHold > 0 {
+		quotaHold = valet.NewQuotaHold(cancelCtx, params.quotaHold,
+			params.quotaHoldMax)
+	}
+
+	archParams := valet.ArchiveParams{
+		LocalBase:      root,
+		RemoteBase:     archiveRoot,
+		ClientPool:     clientPool,
+		DeleteLocal:    params.deleteLocal,
+		CleanupDelay:   params.cleanupDelay,
+		Bundle:         params.bundle,
+		Selection:      params.selection,
+		Report:         params.report,
+		RemoteChecksum: params.remoteChecksum,
+		Metadata:       params.metadata,
+		NoProvenance:   !params.provenance,
+		ACLs:           params.acls,
+		MirrorEmpty:    params.mirrorEmpty,
+		PreserveTimes:  params.preserveTimes,
+		Stats:          stats,
+		Events:         params.events,
+		RequireReplica: params.requireRepl,
+		Mirrors:        mirrors,
+		QuotaHold:      quotaHold,
+
+		ExternalChecksum:      params.extChecksum,
+		ForceArchive:          params.forceArchive,
+		ForceArchiveID:        params.forceID,
+		ChecksumMetadataOnly:  params.chkMetaOnly,
+		VerifyCompression:     params.verifyComp,
+		InheritNewCollections: params.inheritNew,
+		CleanupDelaySetting:   params.cleanupSetting,
+	}
 
 	var workPlan valet.WorkPlan
-	if params.dryRun {
+	var err error
+	if params.dryRun && !params.dryRunVerify {
 		workPlan = valet.DryRunWorkPlan()
 	} else {
-		workPlan = valet.ArchiveFilesWorkPlan(root, archiveRoot, clientPool,
-			params.deleteLocal, params.cleanupDelay)
-	}
-
-	return valet.ProcessFiles(cancelCtx, valet.ProcessParams{
-		Root: root,
-		MatchFunc: valet.Or(valet.RequiresCompression,
-			valet.RequiresCopying, userCleanupFn),
-		PruneFunc:     valet.Or(userPruneFn, defaultPruneFn),
-		Plan:          workPlan,
-		SweepInterval: params.sweepInterval,
-		MaxProc:       params.maxProc,
+		// Making the plan does not consult the archive. The archive may be
+		// briefly unreachable as valet starts, so this waits for it
+		if !params.printPlan {
+			if err = waitForArchive(cancelCtx, clientPool); err != nil {
+				return err
+			}
+			for _, mirror := range mirrors {
+				err = waitForArchive(cancelCtx, mirror.ClientPool)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		switch {
+		case params.dryRunVerify:
+			// The archive is consulted, but not changed
+			report := valet.LogDecisions
+			if params.reportDels {
+				report = valet.MakeDeletionReporter(os.Stdout)
+			}
+			workPlan, err = valet.VerifyArchiveWorkPlan(cancelCtx,
+				archParams, report)
+		case params.annotateOnly:
+			workPlan = valet.AnnotateOnlyWorkPlan(root, archiveRoot,
+				clientPool, params.report)
+		default:
+			workPlan, err = valet.ArchiveFilesWorkPlan(cancelCtx, archParams)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if params.printPlan {
+		return printWorkPlan(os.Stdout, workPlan)
+	}
+
+	health := startHealthServer(cancelCtx, params.healthAddr, clientPool)
+
+	err = valet.ProcessFiles(cancelCtx, valet.ProcessParams{
+		Root:             root,
+		MatchFunc:        matchFn,
+		PruneFunc:        pruneFn,
+		Plan:             workPlan,
+		SweepInterval:    params.sweepInterval,
+		SweepIntervals:   intervals,
+		SweepJitter:      params.sweepJitter,
+		WatchGrace:       params.watchGrace,
+		StableSweep:      params.stableSweep,
+		FullSweep:        params.fullSweep,
+		MaxProc:          params.maxProc,
+		ChecksumWorkers:  params.chkWorkers,
+		MaxProcPerRun:    params.maxProcPerRun,
+		MaxBytesInFlight: params.maxBytes,
+		FileTimeout:      params.fileTimeout,
+		Quarantine:       params.quarantine,
+		MaxErrors:        params.maxErrors,
+		WaitForRoot:      params.waitForRoot,
+		Pause:            pause,
+		Health:           health,
+		Window:           params.window,
+		HardLinks:        hardLinks,
 	})
+
+	// Archiving has finished, so give queued events a last chance to be sent
+	params.events.Close(eventDrainTimeout)
+
+	logs.GetLogger().Info().
+		Uint64("num_objects", stats.NumObjects()).
+		Uint64("num_bytes", stats.NumBytes()).
+		Msg("archived")
+
+	if err != nil {
+		return archivingError(err)
+	}
+
+	return nil
+}
+
+// eventDrainTimeout is the time allowed to publish queued archive events once
+// archiving has finished.
+const eventDrainTimeout = 30 * time.Second
+
+// newEventPublisher returns a publisher of archive events to the --mq-url and
+// --mq-topic of flags, or nil if there is no --mq-url.
+func newEventPublisher(flags *dataDirCliFlags) (*valet.EventPublisher, error) {
+	if flags.mqURL == "" {
+		if flags.mqTopic != "" {
+			return nil, errors.New("--mq-topic requires --mq-url")
+		}
+		return nil, nil
+	}
+
+	send, err := valet.MakeKafkaRESTSender(flags.mqURL, flags.mqTopic,
+		10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	return valet.NewEventPublisher(send, valet.DefaultEventBufferSize,
+		valet.DefaultEventMaxAttempts, valet.DefaultEventRetryDelay), nil
+}
+
+// parseArchiveWindow returns the archive window of flags. The time zone must
+// be given explicitly, so that the window is not silently interpreted in the
+// time zone of the host.
+func parseArchiveWindow(flags *dataDirCliFlags) (*valet.WorkWindow, error) {
+	if flags.archWindowTZ == "" {
+		return nil, errors.New("--archive-window-tz is required with " +
+			"--archive-window")
+	}
+
+	loc, err := time.LoadLocation(flags.archWindowTZ)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid --archive-window-tz")
+	}
+
+	return valet.ParseWorkWindow(flags.archWindow, loc)
+}
+
+// archiveFilters returns the predicates selecting the files under root to
+// archive and pruning the directories not to be archived.
+func archiveFilters(root string,
+	params archiveParams) (matchFn valet.FilePredicate,
+	pruneFn valet.FilePredicate) {
+	log := logs.GetLogger()
+
+	userPruneFn, err := valet.MakeGlobPruneFunc(params.exclude)
+	if err != nil {
+		exitOnError(log, usageError(err), "error in default exclusion patterns")
+	}
+
+	defaultPruneFn, err := valet.MakeDefaultPruneFunc(root)
+	if err != nil {
+		exitOnError(log, usageError(err), "error in exclusion patterns")
+	}
+
+	userCleanupFn := valet.MakeRequiresRemoval(params.cleanupDelay)
+	if params.cleanupSetting != nil {
+		userCleanupFn = valet.MakeRequiresRemovalSetting(params.cleanupSetting)
+	}
+
+	var bundleFn valet.FilePredicate = valet.IsFalse
+	if params.bundle.IsEnabled() {
+		if bundleFn, err = valet.MakeRequiresBundling(params.bundle,
+			params.selection); err != nil {
+			exitOnError(log, usageError(err), "error in bundling patterns")
+		}
+	}
+
+	// Run directories that are due to be removed are never pruned as archived,
+	// so that they can be found for removal
+	var keepFn valet.FilePredicate = valet.IsFalse
+	if params.deleteLocal {
+		keepFn = userCleanupFn
+	}
+	archivedPruneFn := valet.MakeArchivedPruneFunc(params.excludeOlder, keepFn)
+
+	// Run directories are matched to be marked archived and, if due, removed
+	matchFn = valet.And(valet.Not(valet.IsSpecial),
+		valet.Or(params.selection.RequiresCompression,
+			params.selection.RequiresCopying,
+			valet.IsMinKNOWRunDir, bundleFn))
+	pruneFn = valet.Or(userPruneFn, defaultPruneFn, archivedPruneFn)
+
+	// Empty directories are matched to be archived as empty collections
+	if params.mirrorEmpty {
+		matchFn = valet.Or(matchFn, valet.IsEmptyDir)
+	}
+
+	// Only reports, and run directories lacking them, are matched when only
+	// annotating
+	if params.annotateOnly {
+		matchFn = valet.And(valet.Not(valet.IsSpecial),
+			valet.Or(valet.RequiresAnnotation, valet.IsMinKNOWRunDir))
+	} else if params.extChecksum {
+		// Files are not matched until a separate process has made their
+		// checksum files
+		matchFn = valet.And(matchFn, valet.Not(params.selection.IsAwaitingChecksum))
+	}
+
+	if len(params.onlyRuns) > 0 {
+		matchFn = valet.And(matchFn, valet.MakeIsInRuns(params.onlyRuns))
+		pruneFn = valet.Or(pruneFn, valet.MakeRunsPruneFunc(params.onlyRuns))
+	}
+
+	// Nothing is done in the active run until MinKNOW has moved on from it
+	if params.excludeActive {
+		matchFn = valet.And(matchFn,
+			valet.Not(valet.MakeIsInActiveRun(params.activeWindow)))
+		pruneFn = valet.Or(pruneFn,
+			valet.MakeActiveRunPruneFunc(params.activeWindow))
+	}
+
+	// Run directories still being written are not entered until they age
+	if params.minRunAge > 0 {
+		pruneFn = valet.Or(pruneFn, valet.MakeRunAgePruneFunc(params.minRunAge))
+	}
+
+	// The files of other users, e.g. on a shared instrument, are left alone
+	if params.onlyOwnFiles {
+		matchFn = valet.And(matchFn, valet.IsOwnedByCurrentUser)
+	}
+
+	if params.matchExpr != nil {
+		matchFn = valet.And(matchFn, params.matchExpr)
+	}
+	if params.pruneExpr != nil {
+		pruneFn = valet.Or(pruneFn, valet.MakeExprPruneFunc(params.pruneExpr))
+	}
+
+	// Tested last, so that only files otherwise matched are warned about
+	if params.sizeLimit > 0 {
+		matchFn = valet.And(matchFn, valet.MakeIsSmallerThan(params.sizeLimit))
+	}
+
+	return
+}
+
+// addPredicateExprFlags adds to cmd the --match-expr and --prune-expr flags,
+// whose values are set in flags.
+func addPredicateExprFlags(cmd *cobra.Command, flags *dataDirCliFlags) {
+	cmd.Flags().StringVar(&flags.matchExpr,
+		"match-expr", "",
+		"a predicate expression e.g. 'IsFast5 or (IsFastq and IsCompressed)' "+
+			"which files must also satisfy to be worked on")
+
+	cmd.Flags().StringVar(&flags.pruneExpr,
+		"prune-expr", "",
+		"a predicate expression matching directories to prune "+
+			"e.g. 'IsRunArchivedMarked'")
+}
+
+// parsePredicateExprs returns the predicates given by the --match-expr and
+// --prune-expr flags, or nil for a flag not given. The predicates selecting
+// files for work are those of sel.
+func parsePredicateExprs(flags *dataDirCliFlags,
+	sel valet.Selection) (matchExpr valet.FilePredicate,
+	pruneExpr valet.FilePredicate, err error) {
+	if flags.matchExpr != "" {
+		if matchExpr, err = valet.ParsePredicateExpr(flags.matchExpr,
+			sel); err != nil {
+			return nil, nil, err
+		}
+	}
+	if flags.pruneExpr != "" {
+		if pruneExpr, err = valet.ParsePredicateExpr(flags.pruneExpr,
+			sel); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return matchExpr, pruneExpr, nil
+}
+
+// readRunIDs returns the run IDs given by the --only-run and --only-runs-file
+// flags. It returns an error if any is not a MinKNOW run ID.
+func readRunIDs(flags *dataDirCliFlags) ([]string, error) {
+	runIDs := append([]string{}, flags.onlyRuns...)
+
+	if flags.onlyRunsFile != "" {
+		content, err := os.ReadFile(flags.onlyRunsFile)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, line := range strings.Split(string(content), "\n") {
+			if id := strings.TrimSpace(line); id != "" {
+				runIDs = append(runIDs, id)
+			}
+		}
+	}
+
+	for _, id := range runIDs {
+		if !valet.IsMinKNOWRunID(id) {
+			return nil, errors.Errorf("'%s' is not a MinKNOW run ID", id)
+		}
+	}
+
+	return runIDs, nil
+}
+
+// readMetadata returns the metadata given by the --meta and --meta-file flags.
+func readMetadata(flags *dataDirCliFlags) ([]ex.AVU, error) {
+	avus, err := valet.ParseMetadata(flags.meta)
+	if err != nil {
+		return nil, err
+	}
+
+	if flags.metaFile != "" {
+		fileAVUs, ferr := valet.ReadMetadataFile(flags.metaFile)
+		if ferr != nil {
+			return nil, ferr
+		}
+		avus = append(avus, fileAVUs...)
+	}
+
+	return avus, nil
 }
 
 // Exclude TMPDIR if it has been set to be under the data root by the user
@@ -232,3 +1174,40 @@ func archiveExcludeDirs(root string, flags *dataDirCliFlags) []string {
 	}
 	return excludeDirs
 }
+
+// The value of --dry-run that makes a dry run consulting the archive.
+const dryRunVerifyMode = "verify"
+
+// dryRunValue is the value of the --dry-run flag which, as well as true or
+// false, may be "verify" to make a dry run that consults the archive.
+type dryRunValue struct {
+	flags *baseCliFlags
+}
+
+func (v dryRunValue) String() string {
+	if v.flags.dryRunVerify {
+		return dryRunVerifyMode
+	}
+
+	return strconv.FormatBool(v.flags.dryRun)
+}
+
+func (v dryRunValue) Set(s string) error {
+	if s == dryRunVerifyMode {
+		v.flags.dryRun, v.flags.dryRunVerify = true, true
+		return nil
+	}
+
+	dryRun, err := strconv.ParseBool(s)
+	if err != nil {
+		return errors.Errorf("invalid value '%s' (expected true, false or "+
+			"%s)", s, dryRunVerifyMode)
+	}
+	v.flags.dryRun, v.flags.dryRunVerify = dryRun, false
+
+	return nil
+}
+
+func (v dryRunValue) Type() string {
+	return "bool"
+}
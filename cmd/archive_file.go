@@ -0,0 +1,212 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file archive_file.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	ex "github.com/wtsi-npg/extendo/v2"
+	logs "github.com/wtsi-npg/logshim"
+
+	"github.com/wtsi-npg/valet/valet"
+)
+
+var archFileFlags = &dataDirCliFlags{}
+
+var archiveFileCmd = &cobra.Command{
+	Use:   "file",
+	Short: "Archive a single file end-to-end",
+	Long: `
+valet archive file will take a single file through the same archiving work plan
+as valet archive create, immediately and without sweeping or monitoring. Each
+step of the plan is evaluated in turn and its outcome printed: whether its work
+was done, skipped because the file did not need it, or failed. If valet
+compresses the file, its compressed version is then taken through the plan in
+the same way. This makes it useful as a smoke test of a new deployment.
+
+The file's path in the archive is its path relative to --root, beneath
+--archive-root. By default, --root is the directory containing the file.
+
+valet will exit with a non-zero status if any step fails.
+`,
+	Example: `
+valet archive file \
+    --path /data/66/DN585561I_A1/20190904_1514_GA20000_FAL01979_43578c8f/fastq_pass/reads1.fastq \
+    --root /data --archive-root /seq/ont/gridion/gxb02004 --delete-on-archive`,
+	Run: runArchiveFileCmd,
+}
+
+func init() {
+	archiveFileCmd.Flags().StringVarP(&archFileFlags.localPath,
+		"path", "p", "",
+		"the local path of the file to archive")
+
+	err := archiveFileCmd.MarkFlagRequired("path")
+	if err != nil {
+		logs.GetLogger().Error().
+			Err(err).Msg("failed to mark --path required")
+		os.Exit(1)
+	}
+
+	archiveFileCmd.Flags().StringVarP(&archFileFlags.localRoot,
+		"root", "r", "",
+		"the local root directory corresponding to the archive root "+
+			"(defaults to the directory containing the file)")
+
+	archiveFileCmd.Flags().StringVarP(&archFileFlags.archiveRoot,
+		"archive-root", "a", "",
+		"the archive root collection")
+
+	err = archiveFileCmd.MarkFlagRequired("archive-root")
+	if err != nil {
+		logs.GetLogger().Error().
+			Err(err).Msg("failed to mark --archive-root required")
+		os.Exit(1)
+	}
+
+	archiveFileCmd.Flags().BoolVar(&archFileFlags.deleteLocal,
+		"delete-on-archive", false,
+		"delete the local file on successful archiving")
+
+	archiveFileCmd.Flags().BoolVar(&archFileFlags.verifyComp,
+		"verify-compression", false,
+		"verify that the compressed file decompresses to the original "+
+			"content before it replaces the original")
+
+	archiveFileCmd.Flags().StringVar(&archFileFlags.remoteChecksum,
+		"remote-checksum", string(valet.MD5Checksum),
+		"the checksum algorithm used by the archive (md5 or sha256)")
+
+	archiveCmd.AddCommand(archiveFileCmd)
+}
+
+func runArchiveFileCmd(cmd *cobra.Command, args []string) {
+	log := setupLogger(baseFlags)
+
+	remoteChecksum, err := valet.ParseChecksumAlgorithm(
+		archFileFlags.remoteChecksum)
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid --remote-checksum")
+	}
+
+	selection, err := makeSelection()
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid file selection options")
+	}
+
+	report, err := makeReportConfig(0, 0)
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid report options")
+	}
+
+	root := archFileFlags.localRoot
+	if root == "" {
+		root = filepath.Dir(archFileFlags.localPath)
+	}
+
+	err = ArchiveFile(os.Stdout, archFileFlags.localPath, root,
+		archFileFlags.archiveRoot,
+		archiveParams{
+			deleteLocal:    archFileFlags.deleteLocal,
+			cleanupDelay:   valet.DefaultCleanupDelay,
+			selection:      selection,
+			report:         report,
+			verifyComp:     archFileFlags.verifyComp,
+			provenance:     true,
+			remoteChecksum: remoteChecksum,
+		})
+	if err != nil {
+		exitOnError(log, err, "archiving the file failed")
+	}
+}
+
+// ArchiveFile does the work of the archiving work plan of CreateArchive on the
+// single file at localPath, which is archived beneath archiveRoot at its path
+// relative to root. The outcome of each step is written to w. If a step fails,
+// its error is returned as a processing error.
+func ArchiveFile(w io.Writer, localPath string, root string, archiveRoot string,
+	params archiveParams) error {
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	setupSignalHandler(cancel)
+
+	path, err := valet.NewFilePath(localPath)
+	if err != nil {
+		return usageError(err)
+	}
+	if !path.Info.Mode().IsRegular() {
+		return usageError(errors.Errorf("'%s' is not a regular file",
+			path.Location))
+	}
+
+	clientPool := ex.NewClientPool(ex.DefaultClientPoolParams, "--silent")
+	defer clientPool.Close()
+
+	if err = checkArchive(clientPool); err != nil {
+		return err
+	}
+
+	workPlan, err := valet.ArchiveFilesWorkPlan(cancelCtx,
+		valet.ArchiveParams{
+			LocalBase:         root,
+			RemoteBase:        archiveRoot,
+			ClientPool:        clientPool,
+			DeleteLocal:       params.deleteLocal,
+			CleanupDelay:      params.cleanupDelay,
+			Selection:         params.selection,
+			Report:            params.report,
+			RemoteChecksum:    params.remoteChecksum,
+			NoProvenance:      !params.provenance,
+			VerifyCompression: params.verifyComp,
+		})
+	if err != nil {
+		return err
+	}
+
+	results, err := valet.ProcessFile(path, workPlan)
+	PrintStepResults(w, results)
+	if err != nil {
+		return processingError(err)
+	}
+
+	return nil
+}
+
+// PrintStepResults writes results to w, one line per step of the work plan.
+func PrintStepResults(w io.Writer, results []valet.StepResult) {
+	var last string
+	for _, r := range results {
+		if r.Path != last {
+			_, _ = fmt.Fprintf(w, "%s\n", r.Path)
+			last = r.Path
+		}
+		_, _ = fmt.Fprintf(w, "  %-6d %-8s %s\n", r.Rank(), r.Outcome, r.Match)
+		if r.Err != nil {
+			_, _ = fmt.Fprintf(w, "  %-6s %-8s %v\n", "", "", r.Err)
+		}
+	}
+}
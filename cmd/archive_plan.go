@@ -0,0 +1,255 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file archive_plan.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	ex "github.com/wtsi-npg/extendo/v2"
+	logs "github.com/wtsi-npg/logshim"
+
+	"github.com/wtsi-npg/valet/valet"
+)
+
+var archPlanFlags = &dataDirCliFlags{}
+
+var archivePlanCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Summarise the archiving work to be done under a root directory",
+	Long: `
+valet archive plan will make a single sweep of a directory hierarchy and
+evaluate the tests of each step of the archiving work plan against the files
+within it, without doing any of the work. It then prints the number of files
+that would be selected by each step e.g. how many require compression, how many
+require checksum files, how many are already archived and how many would be
+deleted.
+
+The steps that delete local files are always included, so that the effect of
+--delete-on-archive on valet archive create may be previewed.
+
+The counts are for a single pass; files that become eligible for a step only
+after an earlier step has been done (e.g. a file to be archived once it has
+been compressed) are not counted. Files for which a test failed are counted
+separately as errors.
+`,
+	Example: `
+valet archive plan --root /data --exclude /data/custom \
+    --archive-root /seq/ont/gridion/gxb02004`,
+	Run: runArchivePlanCmd,
+}
+
+func init() {
+	archivePlanCmd.Flags().StringVarP(&archPlanFlags.localRoot,
+		"root", "r", "",
+		"the root directory to summarise")
+
+	err := archivePlanCmd.MarkFlagRequired("root")
+	if err != nil {
+		logs.GetLogger().Error().
+			Err(err).Msg("failed to mark --root required")
+		os.Exit(1)
+	}
+
+	archivePlanCmd.Flags().StringVarP(&archPlanFlags.archiveRoot,
+		"archive-root", "a", "",
+		"the archive root collection")
+
+	err = archivePlanCmd.MarkFlagRequired("archive-root")
+	if err != nil {
+		logs.GetLogger().Error().
+			Err(err).Msg("failed to mark --archive-root required")
+		os.Exit(1)
+	}
+
+	archivePlanCmd.Flags().StringArrayVar(&archPlanFlags.excludeDirs,
+		"exclude", []string{},
+		"glob patterns matching directories to prune "+
+			"(** matches any number of directories)")
+
+	addPredicateExprFlags(archivePlanCmd, archPlanFlags)
+
+	archivePlanCmd.Flags().DurationVar(&archPlanFlags.excludeOlder,
+		"exclude-older-than", 0,
+		"prune directories marked as archived that have not been "+
+			"modified for this long (disabled by default)")
+
+	archivePlanCmd.Flags().StringArrayVar(&archPlanFlags.onlyRuns,
+		"only-run", []string{},
+		"a MinKNOW run ID to restrict processing to; files in other runs "+
+			"are ignored (may be repeated)")
+
+	archivePlanCmd.Flags().StringVar(&archPlanFlags.onlyRunsFile,
+		"only-runs-file", "",
+		"a file of MinKNOW run IDs, one per line, to restrict processing to")
+
+	archivePlanCmd.Flags().DurationVar(&archPlanFlags.cleanupDelay,
+		"cleanup", valet.DefaultCleanupDelay,
+		fmt.Sprintf("run directory cleanup delay, minimum %s",
+			valet.MinCleanupDelay))
+
+	archivePlanCmd.Flags().StringArrayVar(&archPlanFlags.bundleDirs,
+		"bundle-dirs", []string{},
+		"glob patterns matching directories to archive as single tar "+
+			"objects (** matches any number of directories)")
+
+	archivePlanCmd.Flags().IntVar(&archPlanFlags.bundleMinFiles,
+		"bundle-min-files", valet.DefaultBundleMinFiles,
+		"the minimum number of files in a directory to bundle it")
+
+	archivePlanCmd.Flags().Int64Var(&archPlanFlags.bundleMaxSize,
+		"bundle-max-size", valet.DefaultBundleMaxSize,
+		"the maximum total size in bytes of files in a directory to bundle it")
+
+	archivePlanCmd.Flags().DurationVar(&archPlanFlags.bundleSettle,
+		"bundle-settle", valet.DefaultBundleSettleDelay,
+		"the time a directory must be unmodified before bundling it")
+
+	archivePlanCmd.Flags().StringVar(&archPlanFlags.remoteChecksum,
+		"remote-checksum", string(valet.MD5Checksum),
+		"the checksum algorithm used by the archive (md5 or sha256)")
+
+	archiveCmd.AddCommand(archivePlanCmd)
+}
+
+func runArchivePlanCmd(cmd *cobra.Command, args []string) {
+	log := setupLogger(baseFlags)
+
+	if archPlanFlags.cleanupDelay < valet.MinCleanupDelay {
+		log.Error().Msgf("invalid cleanup delay %s (must be > %s)",
+			archPlanFlags.cleanupDelay, valet.MinCleanupDelay)
+		os.Exit(ExitUsage)
+	}
+
+	remoteChecksum, err := valet.ParseChecksumAlgorithm(
+		archPlanFlags.remoteChecksum)
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid --remote-checksum")
+	}
+
+	onlyRuns, err := readRunIDs(archPlanFlags)
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid --only-run")
+	}
+
+	selection, err := makeSelection()
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid file selection options")
+	}
+
+	report, err := makeReportConfig(0, 0)
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid report options")
+	}
+
+	matchExpr, pruneExpr, err := parsePredicateExprs(archPlanFlags, selection)
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid predicate expression")
+	}
+
+	summary, err := PlanArchive(
+		archPlanFlags.localRoot,
+		archPlanFlags.archiveRoot,
+		archiveParams{
+			maxProc:        baseFlags.maxProc,
+			exclude:        archiveExcludeDirs(archPlanFlags.localRoot, archPlanFlags),
+			selection:      selection,
+			report:         report,
+			matchExpr:      matchExpr,
+			pruneExpr:      pruneExpr,
+			deleteLocal:    true,
+			cleanupDelay:   archPlanFlags.cleanupDelay,
+			remoteChecksum: remoteChecksum,
+			excludeOlder:   archPlanFlags.excludeOlder,
+			onlyRuns:       onlyRuns,
+			bundle: valet.BundleParams{
+				Patterns:    archPlanFlags.bundleDirs,
+				MinFiles:    archPlanFlags.bundleMinFiles,
+				MaxSize:     archPlanFlags.bundleMaxSize,
+				SettleDelay: archPlanFlags.bundleSettle,
+			},
+		})
+	if err != nil {
+		exitOnError(log, err, "archive planning failed")
+	}
+
+	PrintPlanSummary(os.Stdout, summary)
+}
+
+// PlanArchive makes a single sweep of the files under root that would be
+// selected by CreateArchive and summarises the work that CreateArchive would
+// do on them, without doing any work.
+func PlanArchive(root string, archiveRoot string,
+	params archiveParams) (valet.PlanSummary, error) {
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	setupSignalHandler(cancel)
+
+	matchFn, pruneFn := archiveFilters(root, params)
+
+	clientPool := ex.NewClientPool(ex.DefaultClientPoolParams, "--silent")
+	defer clientPool.Close()
+
+	if err := checkArchive(clientPool); err != nil {
+		return valet.PlanSummary{}, err
+	}
+
+	workPlan, err := valet.ArchiveFilesWorkPlan(cancelCtx,
+		valet.ArchiveParams{
+			LocalBase:      root,
+			RemoteBase:     archiveRoot,
+			ClientPool:     clientPool,
+			DeleteLocal:    params.deleteLocal,
+			CleanupDelay:   params.cleanupDelay,
+			Bundle:         params.bundle,
+			Selection:      params.selection,
+			Report:         params.report,
+			RemoteChecksum: params.remoteChecksum,
+		})
+	if err != nil {
+		return valet.PlanSummary{}, err
+	}
+
+	paths, errs := valet.FindFiles(cancelCtx, root, matchFn, pruneFn)
+
+	log := logs.GetLogger()
+	go func() {
+		for err := range errs {
+			log.Warn().Err(err).Msg("while finding files")
+		}
+	}()
+
+	return valet.SummarisePlan(paths, workPlan, params.maxProc), nil
+}
+
+// PrintPlanSummary writes summary to w, one line per step of the work plan.
+func PrintPlanSummary(w io.Writer, summary valet.PlanSummary) {
+	_, _ = fmt.Fprintf(w, "%-6s %10s %10s  %s\n", "rank", "files", "errors",
+		"step")
+	for _, step := range summary.Steps {
+		_, _ = fmt.Fprintf(w, "%-6d %10d %10d  %s\n", step.Rank(),
+			step.Matched, step.Errors, step.Match)
+	}
+	_, _ = fmt.Fprintf(w, "%d files examined\n", summary.NumPaths)
+}
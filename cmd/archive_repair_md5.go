@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file archive_repair_md5.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	ex "github.com/wtsi-npg/extendo/v2"
+	logs "github.com/wtsi-npg/logshim"
+
+	"github.com/wtsi-npg/valet/valet"
+)
+
+var archRepairFlags = &dataDirCliFlags{}
+
+var archiveRepairMD5Cmd = &cobra.Command{
+	Use:   "repair-md5",
+	Short: "Repair incorrect checksum metadata in the archive",
+	Long: `
+valet archive repair-md5 will list every data object in an archive collection
+and compare its checksum metadata (under the "md5" key) with its MD5 checksum in
+the iRODS catalogue. Where they disagree, the checksum metadata are replaced
+with the checksum and the repair is logged.
+
+Before each repair, the checksum of the data object is recalculated by the
+server and the repair is refused if it does not match the catalogue. Data
+objects with no checksum metadata are left for valet archive create to archive
+again. Data objects without an MD5 checksum, such as those in an archive using
+SHA-256, cannot be compared and are counted as such.
+
+Only the metadata of the data objects are changed. With --dry-run, the repairs
+that would be made are logged, but no changes are made. A summary is printed
+and valet will exit with a non-zero status if any data object could not be
+examined or repaired.
+`,
+	Example: `
+valet archive repair-md5 --archive-root /seq/ont/gridion/gxb02004 --dry-run`,
+	Run: runArchiveRepairMD5Cmd,
+}
+
+func init() {
+	archiveRepairMD5Cmd.Flags().StringVarP(&archRepairFlags.archiveRoot,
+		"archive-root", "a", "",
+		"the archive root collection to repair")
+
+	err := archiveRepairMD5Cmd.MarkFlagRequired("archive-root")
+	if err != nil {
+		logs.GetLogger().Error().
+			Err(err).Msg("failed to mark --archive-root required")
+		os.Exit(1)
+	}
+
+	archiveRepairMD5Cmd.Flags().BoolVar(&baseFlags.dryRun,
+		"dry-run", false,
+		"dry-run (log the repairs, but make no changes)")
+
+	archiveCmd.AddCommand(archiveRepairMD5Cmd)
+}
+
+func runArchiveRepairMD5Cmd(cmd *cobra.Command, args []string) {
+	log := setupLogger(baseFlags)
+
+	summary, err := RepairChecksumMetadata(
+		archRepairFlags.archiveRoot,
+		baseFlags.maxProc,
+		baseFlags.dryRun)
+	if err != nil {
+		exitOnError(log, err, "checksum metadata repair failed")
+	}
+
+	PrintRepairSummary(os.Stdout, summary, baseFlags.dryRun)
+
+	if summary.NumErrors > 0 {
+		exitOnError(log, processingError(errors.Errorf("%d of %d data "+
+			"objects could not be examined or repaired", summary.NumErrors,
+			summary.NumObjects)), "checksum metadata repair failed")
+	}
+}
+
+// RepairChecksumMetadata repairs the checksum metadata of the data objects in
+// the archive under archiveRoot, using up to maxProc clients. If dryRun is
+// true, no changes are made.
+func RepairChecksumMetadata(archiveRoot string, maxProc int,
+	dryRun bool) (valet.RepairSummary, error) {
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	setupSignalHandler(cancel)
+
+	clientPool := ex.NewClientPool(ex.DefaultClientPoolParams, "--silent")
+	defer clientPool.Close()
+
+	if err := checkArchive(clientPool); err != nil {
+		return valet.RepairSummary{}, err
+	}
+
+	summary, err := valet.RepairChecksumMetadata(cancelCtx, archiveRoot,
+		clientPool, maxProc, dryRun)
+	if err != nil {
+		return summary, processingError(err)
+	}
+
+	return summary, nil
+}
+
+// PrintRepairSummary writes the totals of summary to w.
+func PrintRepairSummary(w io.Writer, summary valet.RepairSummary,
+	dryRun bool) {
+	repaired := "repaired"
+	if dryRun {
+		repaired = "would be repaired"
+	}
+
+	_, _ = fmt.Fprintf(w, "%d data objects examined, %d %s, %d without an "+
+		"MD5 checksum, %d errors\n", summary.NumObjects, summary.NumRepaired,
+		repaired, summary.NumUncompared, summary.NumErrors)
+}
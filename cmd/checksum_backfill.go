@@ -0,0 +1,183 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file checksum_backfill.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/spf13/cobra"
+	ex "github.com/wtsi-npg/extendo/v2"
+	logs "github.com/wtsi-npg/logshim"
+
+	"github.com/wtsi-npg/valet/valet"
+)
+
+var backfillFlags = &dataDirCliFlags{}
+
+var checksumBackfillCmd = &cobra.Command{
+	Use:   "backfill",
+	Short: "Create missing checksum files for files already archived",
+	Long: `
+valet checksum backfill will make a single sweep of a directory hierarchy and
+locate data files within it that have no accompanying checksum file, or have a
+checksum file that is stale. For each of these that has been archived, valet
+will confirm that the local content matches the checksum and checksum metadata
+of the archived copy and then create the checksum file.
+
+This reconciles the local checksum files with the archive without copying the
+data again e.g. after data have been restored from a backup without their
+checksum files. Files that have not been archived are skipped. A file whose
+content does not match its archived copy is logged as an error and valet will
+exit with a non-zero status.
+`,
+	Example: `
+valet checksum backfill --root /data --exclude /data/intermediate \
+    --archive-root /seq/ont/gridion/gxb02004`,
+	Run: runChecksumBackfillCmd,
+}
+
+func init() {
+	checksumBackfillCmd.Flags().StringVarP(&backfillFlags.localRoot,
+		"root", "r", "",
+		"the root directory to backfill")
+
+	err := checksumBackfillCmd.MarkFlagRequired("root")
+	if err != nil {
+		logs.GetLogger().Error().
+			Err(err).Msg("failed to mark --root required")
+		os.Exit(1)
+	}
+
+	checksumBackfillCmd.Flags().StringVarP(&backfillFlags.archiveRoot,
+		"archive-root", "a", "",
+		"the archive root collection")
+
+	err = checksumBackfillCmd.MarkFlagRequired("archive-root")
+	if err != nil {
+		logs.GetLogger().Error().
+			Err(err).Msg("failed to mark --archive-root required")
+		os.Exit(1)
+	}
+
+	checksumBackfillCmd.Flags().StringArrayVar(&backfillFlags.excludeDirs,
+		"exclude", []string{},
+		"glob patterns matching directories to prune "+
+			"(** matches any number of directories)")
+
+	checksumBackfillCmd.Flags().StringVar(&backfillFlags.remoteChecksum,
+		"remote-checksum", string(valet.MD5Checksum),
+		"the checksum algorithm used by the archive (md5 or sha256)")
+
+	checksumBackfillCmd.Flags().BoolVar(&baseFlags.dryRun,
+		"dry-run", false,
+		"dry-run (make no changes)")
+
+	checksumBackfillCmd.Flags().BoolVar(&baseFlags.printPlan,
+		"print-plan", false,
+		"print the work plan as JSON and exit, without doing any work")
+
+	checksumCmd.AddCommand(checksumBackfillCmd)
+}
+
+func runChecksumBackfillCmd(cmd *cobra.Command, args []string) {
+	log := setupLogger(baseFlags)
+
+	alg, err := valet.ParseChecksumAlgorithm(backfillFlags.remoteChecksum)
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid --remote-checksum")
+	}
+
+	sel, err := makeSelection()
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid file selection options")
+	}
+
+	err = BackfillChecksums(
+		backfillFlags.localRoot,
+		backfillFlags.archiveRoot,
+		backfillFlags.excludeDirs,
+		alg,
+		sel,
+		baseFlags.maxProc,
+		baseFlags.dryRun,
+		baseFlags.printPlan)
+	if err != nil {
+		exitOnError(log, err, "checksum backfill failed")
+	}
+}
+
+// BackfillChecksums makes a single sweep of the files under root (subject to
+// any exclusion patterns in exclude) and creates checksum files for any that
+// do not have one and whose content matches their archived copy under
+// archiveRoot. The archive is expected to use checksum algorithm alg. The
+// files are those selected by sel. If printPlan is true, the work plan is
+// printed as JSON and no work is done.
+func BackfillChecksums(root string, archiveRoot string, exclude []string,
+	alg valet.ChecksumAlgorithm, sel valet.Selection, maxProc int, dryRun bool,
+	printPlan bool) error {
+	log := logs.GetLogger()
+
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	setupSignalHandler(cancel)
+
+	pruneFn, err := valet.MakeGlobPruneFunc(exclude)
+	if err != nil {
+		return usageError(err)
+	}
+
+	clientPool := ex.NewClientPool(ex.DefaultClientPoolParams, "--silent")
+	defer clientPool.Close()
+
+	var workPlan valet.WorkPlan
+	if dryRun {
+		workPlan = valet.DryRunWorkPlan()
+	} else {
+		workPlan = valet.BackfillChecksumWorkPlan(root, archiveRoot,
+			clientPool, alg, sel)
+	}
+
+	if printPlan {
+		return printWorkPlan(os.Stdout, workPlan)
+	}
+
+	if err = checkArchive(clientPool); err != nil {
+		return err
+	}
+
+	matchFn := valet.And(valet.Not(valet.IsSpecial),
+		sel.OrBuiltIn().RequiresChecksum)
+	paths, errs := valet.FindFiles(cancelCtx, root, matchFn, pruneFn)
+
+	go func() {
+		for err := range errs {
+			log.Warn().Err(err).Msg("while finding files")
+		}
+	}()
+
+	if err = valet.DoProcessFiles(cancelCtx, paths,
+		valet.ProcessParams{Plan: workPlan, MaxProc: maxProc}); err != nil {
+		return processingError(err)
+	}
+
+	return nil
+}
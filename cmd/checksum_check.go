@@ -0,0 +1,262 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file checksum_check.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	ex "github.com/wtsi-npg/extendo/v2"
+	logs "github.com/wtsi-npg/logshim"
+
+	"github.com/wtsi-npg/valet/utilities"
+	"github.com/wtsi-npg/valet/valet"
+)
+
+var checksumCheckFlags = &dataFileCliFlags{}
+
+var checksumCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Re-checksum and verify a single file",
+	Long: `
+valet checksum check will recalculate the checksum of a single file and compare
+it with the checksum in its accompanying checksum file. If an archive path is
+given, it will also compare it with the checksum and checksum metadata of the
+corresponding data object in the remote data store.
+
+For a gzip-compressed file whose data object has checksum metadata for its
+uncompressed content (ont:md5_uncompressed), the file is also decompressed as
+it is read and the checksum of its uncompressed content is compared with those
+metadata. As the compressed content is confirmed to match the data object, this
+verifies the uncompressed content of the data object end-to-end.
+A file whose gzip stream ends prematurely, e.g. because its compression was
+interrupted, is reported as truncated, distinctly from a checksum mismatch.
+
+The result of each comparison is printed. valet will exit with a non-zero
+status if any comparison fails.
+`,
+	Example: `
+valet checksum check \
+  --path /data/66/DN585561I_A1/20190904_1514_GA20000_FAL01979_43578c8f/fast5_pass/reads1.fast5 \
+  --archive-path /archive/66/DN585561I_A1/20190904_1514_GA20000_FAL01979_43578c8f/fast5_pass/reads1.fast5
+`,
+	Run: runChecksumCheckCmd,
+}
+
+func init() {
+	checksumCheckCmd.Flags().StringVarP(&checksumCheckFlags.localPath,
+		"path", "p", "",
+		"the local path of the file to check")
+
+	err := checksumCheckCmd.MarkFlagRequired("path")
+	if err != nil {
+		logs.GetLogger().Error().
+			Err(err).Msg("failed to mark --path required")
+		os.Exit(1)
+	}
+
+	checksumCheckCmd.Flags().StringVarP(&checksumCheckFlags.archivePath,
+		"archive-path", "a", "",
+		"the archive path of the file to check (optional)")
+
+	checksumCheckCmd.Flags().StringVar(&checksumCheckFlags.remoteChecksum,
+		"remote-checksum", string(valet.MD5Checksum),
+		"the checksum algorithm used by the archive (md5 or sha256)")
+
+	checksumCmd.AddCommand(checksumCheckCmd)
+}
+
+func runChecksumCheckCmd(cmd *cobra.Command, args []string) {
+	log := setupLogger(baseFlags)
+
+	alg, err := valet.ParseChecksumAlgorithm(checksumCheckFlags.remoteChecksum)
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid --remote-checksum")
+	}
+
+	cf, err := makeChecksumFiles()
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid checksum file options")
+	}
+
+	ok, err := CheckChecksum(os.Stdout, checksumCheckFlags.localPath,
+		checksumCheckFlags.archivePath, alg, cf)
+	if err != nil {
+		exitOnError(log, err, "checksum check failed")
+	}
+	if !ok {
+		log.Error().Str("path", checksumCheckFlags.localPath).
+			Msg("checksum verification failed")
+		os.Exit(ExitMismatch)
+	}
+}
+
+// CheckChecksum recalculates the checksum of the file at localPath and
+// compares it with that in the file's checksum file. If archivePath is not
+// empty, the checksum is also compared with that of the data object at
+// archivePath, which is expected to have been made with algorithm alg. The
+// checksum file is named as described by cf. The result of each comparison is
+// written to w. Returns true if all the comparisons succeed.
+func CheckChecksum(w io.Writer, localPath string, archivePath string,
+	alg valet.ChecksumAlgorithm, cf valet.ChecksumFiles) (ok bool,
+	err error) { // NRV
+	var fp valet.FilePath
+	if fp, err = valet.NewFilePath(localPath); err != nil {
+		return
+	}
+
+	var md5sum []byte
+	if md5sum, err = valet.CalculateFileMD5(fp); err != nil {
+		return
+	}
+	checksum := fmt.Sprintf("%x", md5sum)
+
+	report := func(desc string, value string, match bool) {
+		result := "ok"
+		if !match {
+			result = "MISMATCH"
+		}
+		_, _ = fmt.Fprintf(w, "%-20s %-34s %s\n", desc, value, result)
+	}
+
+	_, _ = fmt.Fprintf(w, "%-20s %s\n", "path", fp.Location)
+	_, _ = fmt.Fprintf(w, "%-20s %s\n", "calculated", checksum)
+
+	ok = true
+
+	var hasFile bool
+	if hasFile, err = cf.HasChecksumFile(fp); err != nil {
+		return false, err
+	}
+	if hasFile {
+		var chkFile valet.FilePath
+		chkFile, err = valet.NewFilePathNoStat(cf.ChecksumFilename(fp))
+		if err != nil {
+			return false, err
+		}
+
+		var recorded []byte
+		if recorded, err = valet.ReadMD5ChecksumFile(chkFile); err != nil {
+			return false, err
+		}
+
+		match := string(recorded) == checksum
+		report("checksum file", string(recorded), match)
+		ok = ok && match
+
+		var stale bool
+		if stale, err = cf.HasStaleChecksumFile(fp); err != nil {
+			return false, err
+		}
+		if stale {
+			_, _ = fmt.Fprintf(w, "%-20s %s\n", "checksum file", "STALE")
+		}
+	} else {
+		_, _ = fmt.Fprintf(w, "%-20s %s\n", "checksum file", "MISSING")
+		ok = false
+	}
+
+	if archivePath == "" {
+		return
+	}
+
+	cPool := ex.NewClientPool(ex.DefaultClientPoolParams, "--silent")
+
+	var client *ex.Client
+	if client, err = valet.GetClient(cPool); err != nil {
+		return false, unreachableError(err)
+	}
+	defer func() {
+		err = utilities.CombineErrors(err, cPool.Return(client))
+	}()
+
+	obj := ex.NewDataObject(client, archivePath)
+
+	var exists bool
+	if exists, err = obj.Exists(); err != nil {
+		return false, err
+	}
+	if !exists {
+		_, _ = fmt.Fprintf(w, "%-20s %s\n", "archive", "MISSING")
+		return false, err
+	}
+
+	var expected string
+	if expected, err = alg.RemoteChecksum(fp.Location, checksum); err != nil {
+		return false, err
+	}
+
+	var match bool
+	if match, err = obj.HasValidChecksum(expected); err != nil {
+		return false, err
+	}
+	report("archive checksum", obj.Checksum(), match)
+	ok = ok && match
+
+	if match, err = obj.HasValidChecksumMetadata(checksum); err != nil {
+		return false, err
+	}
+	report("archive metadata", checksum, match)
+	ok = ok && match
+
+	if hasFile {
+		var state valet.RemoteState
+		if state, err = valet.ObjChecksumState(fp, obj, alg, cf); err != nil {
+			return false, err
+		}
+		match = state == valet.RemoteComplete
+		report("archive state", state.String(), match)
+		ok = ok && match
+	}
+
+	// Where the compressed file matches the data object, as checked above, if
+	// the uncompressed content of the file matches the data object's
+	// uncompressed checksum metadata, then so does that of the data object
+	var compressed bool
+	if compressed, err = valet.IsCompressed(fp); err != nil || !compressed {
+		return ok, err
+	}
+
+	var avus []ex.AVU
+	if avus, err = obj.FetchMetadata(); err != nil {
+		return false, err
+	}
+	if rawChecksum, found := valet.UncompressedChecksumMetadata(avus); found {
+		var rawsum []byte
+		rawsum, err = valet.CalculateUncompressedMD5(fp)
+		if errors.Is(err, valet.ErrTruncatedGzip) {
+			_, _ = fmt.Fprintf(w, "%-20s %s\n", "uncompressed", "TRUNCATED")
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		match = fmt.Sprintf("%x", rawsum) == rawChecksum
+		report("archive raw metadata", rawChecksum, match)
+		ok = ok && match
+	}
+
+	return
+}
@@ -22,10 +22,12 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"time"
 
 	"github.com/spf13/cobra"
+	ex "github.com/wtsi-npg/extendo/v2"
 	logs "github.com/wtsi-npg/logshim"
 
 	"github.com/wtsi-npg/valet/valet"
@@ -52,7 +54,11 @@ checksum file.
 
   - Checksum file patterns supported
 
-    - (data file name).md5
+    - (data file name).md5 (see --checksum-suffix and --checksum-hidden)
+    - (data file name).raw.md5 for the uncompressed content of compressed
+      files (see --of-uncompressed)
+    - (data file name).sha256 holding the checksum as the archive reports
+      it, if the archive uses SHA-256 (see --algo-from-archive)
 `,
 	Example: `
 valet checksum create --root /data --exclude /data/intermediate \
@@ -77,14 +83,71 @@ func init() {
 		"sweepInterval", "i", valet.DefaultSweepInterval,
 		"directory sweep interval, minimum 30s")
 
+	checksumCreateCmd.Flags().Float64Var(&checksumFlags.sweepJitter,
+		"jitter", 0,
+		fmt.Sprintf("vary each sweep interval randomly by up to this "+
+			"fraction of it e.g. 0.1 for ±10%%, maximum %g", valet.MaxSweepJitter))
+
+	checksumCreateCmd.Flags().DurationVar(&checksumFlags.fullSweep,
+		"full-sweep-interval", 0,
+		"make sweeps incremental, searching only directories changed since "+
+			"the previous sweep, with a full sweep at this interval "+
+			"(disabled by default)")
+
 	checksumCreateCmd.Flags().BoolVar(&baseFlags.dryRun,
 		"dry-run", false,
 		"dry-run (make no changes)")
 
+	checksumCreateCmd.Flags().BoolVar(&baseFlags.printPlan,
+		"print-plan", false,
+		"print the work plan as JSON and exit, without doing any work")
+
+	checksumCreateCmd.Flags().BoolVar(&checksumFlags.ofUncompressed,
+		"of-uncompressed", false,
+		"also create checksum files for the uncompressed content of "+
+			"compressed files")
+
+	checksumCreateCmd.Flags().BoolVar(&checksumFlags.algFromArchive,
+		"algo-from-archive", false,
+		"discover the checksum algorithm used by the archive from a data "+
+			"object under --archive-root and, if it is not MD5, also create "+
+			"checksum files using that algorithm")
+
+	checksumCreateCmd.Flags().StringVarP(&checksumFlags.archiveRoot,
+		"archive-root", "a", "",
+		"the archive root collection, used with --algo-from-archive")
+
+	checksumCreateCmd.Flags().DurationVar(&checksumFlags.cleanupTemp,
+		"cleanup-temp-older-than", 0,
+		"on startup, remove valet temporary files that have not been "+
+			"modified for this long from the temp directory "+
+			"(disabled by default)")
+
 	checksumCreateCmd.Flags().StringArrayVar(&checksumFlags.excludeDirs,
 		"exclude", []string{},
-		"patterns matching directories to prune "+
-			"from both monitoring and interval sweeps")
+		"glob patterns matching directories to prune "+
+			"from both monitoring and interval sweeps "+
+			"(** matches any number of directories)")
+
+	checksumCreateCmd.Flags().IntVar(&checksumFlags.quarantineAfter,
+		"quarantine-after", 0,
+		"quarantine a file, so that it is no longer worked on, after this "+
+			"many consecutive failures (disabled by default)")
+
+	checksumCreateCmd.Flags().StringVar(&checksumFlags.quarantineFile,
+		"quarantine-file", "",
+		"a file in which to keep the quarantined files, so that they remain "+
+			"quarantined after a restart")
+
+	checksumCreateCmd.Flags().BoolVar(&checksumFlags.startPaused,
+		"start-paused", false,
+		"start with processing paused; files are detected, but not worked "+
+			"on until resumed with SIGUSR2 (SIGUSR1 pauses again)")
+
+	checksumCreateCmd.Flags().StringVar(&checksumFlags.healthAddr,
+		"health-addr", "",
+		"the address on which to serve /healthz and /readyz "+
+			"e.g. :8080 (disabled by default)")
 
 	checksumCmd.AddCommand(checksumCreateCmd)
 }
@@ -95,52 +158,173 @@ func runChecksumCreateCmd(cmd *cobra.Command, args []string) {
 	if checksumFlags.sweepInterval < valet.MinSweepInterval {
 		log.Error().Msgf("Invalid sweep interval %s (must be > %s)",
 			checksumFlags.sweepInterval, valet.MinSweepInterval)
-		os.Exit(1)
+		os.Exit(ExitUsage)
+	}
+
+	if checksumFlags.sweepJitter < 0 ||
+		checksumFlags.sweepJitter > valet.MaxSweepJitter {
+		log.Error().Msgf("invalid sweep jitter %g (must be 0 to %g)",
+			checksumFlags.sweepJitter, valet.MaxSweepJitter)
+		os.Exit(ExitUsage)
+	}
+
+	if checksumFlags.algFromArchive != (checksumFlags.archiveRoot != "") {
+		log.Error().Msg("--algo-from-archive and --archive-root must be " +
+			"used together")
+		os.Exit(ExitUsage)
+	}
+
+	alg := valet.MD5Checksum
+	if checksumFlags.algFromArchive {
+		var err error
+		if alg, err = discoverChecksumAlgorithm(
+			checksumFlags.archiveRoot); err != nil {
+			exitOnError(log, err, "failed to discover the archive's "+
+				"checksum algorithm")
+		}
+	}
+
+	sel, err := makeSelection()
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid file selection options")
+	}
+
+	if !baseFlags.printPlan {
+		sweepTempFiles(checksumFlags.cleanupTemp, baseFlags.dryRun)
 	}
 
-	err := CreateChecksumFiles(
+	stopTracing := startTracing(baseFlags)
+	defer stopTracing()
+
+	err = CreateChecksumFiles(
 		checksumFlags.localRoot,
 		checksumFlags.excludeDirs,
 		checksumFlags.sweepInterval,
+		checksumFlags.sweepJitter,
+		checksumFlags.fullSweep,
+		checksumFlags.ofUncompressed,
+		alg,
+		sel,
 		baseFlags.maxProc,
-		baseFlags.dryRun)
+		baseFlags.chkWorkers,
+		baseFlags.maxProcPerRun,
+		baseFlags.maxBytes,
+		baseFlags.fileTimeout,
+		newQuarantine(checksumFlags),
+		checksumFlags.startPaused,
+		checksumFlags.healthAddr,
+		baseFlags.dryRun,
+		baseFlags.printPlan)
 
 	if err != nil {
-		log.Error().Err(err).Msg("checksum creation failed")
-		os.Exit(1)
+		exitOnError(log, err, "checksum creation failed")
 	}
 }
 
 // CreateChecksumFiles searches for files recursively under root (subject
 // to any exclusions patterns in exclude) and creates checksum files for any
-// that do not have one.
+// that do not have one. Sweeps are made every interval, varied randomly by the
+// fraction jitter. If fullSweep is greater than 0, sweeps are incremental
+// with a full sweep every fullSweep. If ofUncompressed is true, checksum files
+// are also created for the uncompressed content of compressed files. If alg,
+// the checksum algorithm of the archive, is not MD5, checksum files are also
+// created using alg, so that they may be compared with the archive. If
+// quarantine is not nil, files that fail repeatedly are quarantined. If
+// startPaused is true, processing is paused until resumed by SIGUSR2. If
+// chkWorkers is greater than 0, it limits the number of checksums calculated
+// at once, in place of maxProc. If maxProcPerRun is greater than 0, it limits
+// the number of files of any one run directory worked on at once. If
+// printPlan is true, the work plan is printed as JSON and no work is done. The
+// files to be checksummed are those selected by sel.
 func CreateChecksumFiles(root string, exclude []string, interval time.Duration,
-	maxProc int, dryRun bool) error {
+	jitter float64, fullSweep time.Duration, ofUncompressed bool,
+	alg valet.ChecksumAlgorithm, sel valet.Selection, maxProc int,
+	chkWorkers int, maxProcPerRun int, maxBytes int64,
+	fileTimeout time.Duration, quarantine *valet.Quarantine, startPaused bool,
+	healthAddr string, dryRun bool, printPlan bool) error {
 	log := logs.GetLogger()
 
 	cancelCtx, cancel := context.WithCancel(context.Background())
 	setupSignalHandler(cancel)
 
+	pause := valet.NewPause(startPaused)
+	setupPauseHandler(pause)
+
 	// pruneFn, err := valet.MakeRegexPruneFn(exclude)
 	pruneFn, err := valet.MakeGlobPruneFunc(exclude)
 	if err != nil {
-		log.Error().Err(err).Msg("error in exclusion patterns")
-		os.Exit(1)
+		exitOnError(log, usageError(err), "error in exclusion patterns")
 	}
 
+	sel = sel.OrBuiltIn()
+	matchFn := sel.RequiresChecksum
 	var workPlan valet.WorkPlan
 	if dryRun {
 		workPlan = valet.DryRunWorkPlan()
 	} else {
-		workPlan = valet.CreateChecksumWorkPlan()
+		workPlan = valet.CreateChecksumWorkPlan(sel)
+	}
+
+	if ofUncompressed {
+		matchFn = valet.Or(matchFn, sel.RequiresRawChecksum)
+		if !dryRun {
+			workPlan = append(workPlan,
+				valet.CreateRawChecksumWorkPlan(sel)...)
+		}
+	}
+
+	if !alg.IsMD5() {
+		matchFn = valet.Or(matchFn, sel.MakeRequiresRemoteChecksum(alg))
+		if !dryRun {
+			workPlan = append(workPlan,
+				valet.CreateRemoteChecksumWorkPlan(alg, sel)...)
+		}
+	}
+
+	if printPlan {
+		return printWorkPlan(os.Stdout, workPlan)
+	}
+
+	health := startHealthServer(cancelCtx, healthAddr, nil)
+
+	if err = valet.ProcessFiles(cancelCtx, valet.ProcessParams{
+		Root:             root,
+		MatchFunc:        matchFn,
+		PruneFunc:        pruneFn,
+		Plan:             workPlan,
+		SweepInterval:    interval,
+		SweepJitter:      jitter,
+		FullSweep:        fullSweep,
+		MaxProc:          maxProc,
+		ChecksumWorkers:  chkWorkers,
+		MaxProcPerRun:    maxProcPerRun,
+		MaxBytesInFlight: maxBytes,
+		FileTimeout:      fileTimeout,
+		Quarantine:       quarantine,
+		Pause:            pause,
+		Health:           health,
+	}); err != nil {
+		return processingError(err)
+	}
+
+	return nil
+}
+
+// discoverChecksumAlgorithm returns the checksum algorithm used by the archive
+// under archiveRoot, discovered from one of its data objects.
+func discoverChecksumAlgorithm(archiveRoot string) (valet.ChecksumAlgorithm,
+	error) {
+	clientPool := ex.NewClientPool(ex.DefaultClientPoolParams, "--silent")
+	defer clientPool.Close()
+
+	if err := checkArchive(clientPool); err != nil {
+		return "", err
+	}
+
+	alg, err := valet.DiscoverChecksumAlgorithm(clientPool, archiveRoot)
+	if err != nil {
+		return "", processingError(err)
 	}
 
-	return valet.ProcessFiles(cancelCtx, valet.ProcessParams{
-		Root:          root,
-		MatchFunc:     valet.RequiresChecksum,
-		PruneFunc:     pruneFn,
-		Plan:          workPlan,
-		SweepInterval: interval,
-		MaxProc:       maxProc,
-	})
+	return alg, nil
 }
@@ -60,8 +60,9 @@ func init() {
 
 	checksumStatusCmd.Flags().StringArrayVar(&checksumFlags.excludeDirs,
 		"exclude", []string{},
-		"patterns matching directories to prune "+
-			"from the completeness check")
+		"glob patterns matching directories to prune "+
+			"from the completeness check "+
+			"(** matches any number of directories)")
 
 	checksumCmd.AddCommand(checksumStatusCmd)
 }
@@ -69,11 +70,16 @@ func init() {
 func runChecksumStatusCmd(cmd *cobra.Command, args []string) {
 	log := setupLogger(baseFlags)
 
+	sel, err := makeSelection()
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid file selection options")
+	}
+
 	numWithoutChecksum, err :=
-	 	CountFilesWithoutChecksum(checksumFlags.localRoot,
-			checksumFlags.excludeDirs)
+		CountFilesWithoutChecksum(checksumFlags.localRoot,
+			checksumFlags.excludeDirs, sel)
 	if err != nil {
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 
 	if numWithoutChecksum == 0 {
@@ -83,14 +89,15 @@ func runChecksumStatusCmd(cmd *cobra.Command, args []string) {
 		log.Error().Str("root", checksumFlags.localRoot).
 			Uint64("count", numWithoutChecksum).
 			Msg("checksum files missing")
-		os.Exit(1)
+		os.Exit(ExitMismatch)
 	}
 }
 
 // CountFilesWithoutChecksum searches for files recursively under root (subject
-// to any exclusions patterns in exclude) and counts those that do not have an
-// up-to-date checksum file.
-func CountFilesWithoutChecksum(root string, exclude []string) (uint64, error) {
+// to any exclusions patterns in exclude) and counts those selected by sel that
+// do not have an up-to-date checksum file.
+func CountFilesWithoutChecksum(root string, exclude []string,
+	sel valet.Selection) (uint64, error) {
 	cancelCtx, cancel := context.WithCancel(context.Background())
 	setupSignalHandler(cancel)
 	log := logs.GetLogger()
@@ -99,7 +106,7 @@ func CountFilesWithoutChecksum(root string, exclude []string) (uint64, error) {
 	var numWithoutChecksum uint64
 	var err error
 
-	pred := valet.RequiresChecksum
+	pred := sel.OrBuiltIn().RequiresChecksum
 	pruneFn, perr := valet.MakeGlobPruneFunc(exclude)
 	if perr != nil {
 		log.Error().Err(perr).Msg("error in exclusion patterns")
@@ -123,11 +130,14 @@ func CountFilesWithoutChecksum(root string, exclude []string) (uint64, error) {
 	go func() {
 		defer func() { done <- true }()
 
-		err := valet.DoProcessFiles(paths,
-			valet.ChecksumStateWorkPlan(countFunc), maxProcs)
+		err := valet.DoProcessFiles(cancelCtx, paths,
+			valet.ProcessParams{
+				Plan:    valet.ChecksumStateWorkPlan(countFunc, sel),
+				MaxProc: maxProcs,
+			})
 		if err != nil {
 			log.Error().Err(err).Msg("failed processing")
-			os.Exit(1)
+			os.Exit(ExitProcessing)
 		}
 	}()
 
@@ -135,7 +145,7 @@ func CountFilesWithoutChecksum(root string, exclude []string) (uint64, error) {
 
 	if err := <-errs; err != nil {
 		log.Error().Err(err).Msg("failed to complete processing")
-		os.Exit(1)
+		os.Exit(ExitProcessing)
 	}
 
 	return numWithoutChecksum, err
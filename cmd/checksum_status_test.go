@@ -0,0 +1,59 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file checksum_status_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	logs "github.com/wtsi-npg/logshim"
+	"github.com/wtsi-npg/logshim-zerolog/zlog"
+
+	"github.com/wtsi-npg/valet/valet"
+)
+
+func TestMain(m *testing.M) {
+	logs.InstallLogger(zlog.New(os.Stderr, logs.ErrorLevel))
+
+	os.Exit(m.Run())
+}
+
+func TestCountFilesWithoutChecksumEmptySelection(t *testing.T) {
+	sel, err := valet.MakeSelection(valet.SelectParams{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	expected, err := CountFilesWithoutChecksum("../valet/testdata/valet",
+		[]string{}, sel)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The zero value is the built-in Selection
+	n, err := CountFilesWithoutChecksum("../valet/testdata/valet",
+		[]string{}, valet.Selection{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, expected, n)
+		assert.NotZero(t, n)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file cleanup_temp.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	logs "github.com/wtsi-npg/logshim"
+
+	"github.com/wtsi-npg/valet/valet"
+)
+
+type cleanupTempCliFlags struct {
+	tempDir   string        // The temp directory to clean up
+	olderThan time.Duration // The age after which temp files are stale
+}
+
+var cleanupTempFlags = &cleanupTempCliFlags{}
+
+var cleanupTempCmd = &cobra.Command{
+	Use:   "cleanup-temp",
+	Short: "Remove stale temporary files left by interrupted processes",
+	Long: `
+valet cleanup-temp will remove temporary files created by valet that have been
+left in the temp directory by an interrupted process e.g. one that crashed
+while compressing a file. Only files named by valet (valet- followed by a
+random number) which have not been modified for longer than --older-than are
+removed. The paths of the files are printed; with --dry-run they are listed,
+but not removed.
+`,
+	Example: `
+valet cleanup-temp --older-than 48h --dry-run`,
+	Run: runCleanupTempCmd,
+}
+
+func init() {
+	cleanupTempCmd.Flags().StringVar(&cleanupTempFlags.tempDir,
+		"temp-dir", os.TempDir(),
+		"the temp directory to clean up")
+
+	cleanupTempCmd.Flags().DurationVar(&cleanupTempFlags.olderThan,
+		"older-than", valet.DefaultTempFileAge,
+		"remove temporary files that have not been modified for this long")
+
+	cleanupTempCmd.Flags().BoolVar(&baseFlags.dryRun,
+		"dry-run", false,
+		"dry-run (list the files, but make no changes)")
+
+	valetCmd.AddCommand(cleanupTempCmd)
+}
+
+func runCleanupTempCmd(cmd *cobra.Command, args []string) {
+	log := setupLogger(baseFlags)
+
+	err := CleanupTemp(os.Stdout, cleanupTempFlags.tempDir,
+		cleanupTempFlags.olderThan, baseFlags.dryRun)
+	if err != nil {
+		exitOnError(log, err, "temp file cleanup failed")
+	}
+}
+
+// CleanupTemp removes stale valet temporary files from dir that have not been
+// modified for longer than age and writes their paths to w. If dryRun is true,
+// the files are not removed.
+func CleanupTemp(w io.Writer, dir string, age time.Duration,
+	dryRun bool) error {
+	var paths []string
+	var err error
+	if dryRun {
+		paths, err = valet.FindStaleTempFiles(dir, age)
+	} else {
+		paths, err = valet.RemoveStaleTempFiles(dir, age)
+	}
+
+	for _, path := range paths {
+		_, _ = fmt.Fprintln(w, path)
+	}
+
+	return err
+}
+
+// sweepTempFiles removes stale valet temporary files from the temp directory
+// on startup, if age is greater than zero. Any error is logged, but does not
+// prevent startup.
+func sweepTempFiles(age time.Duration, dryRun bool) {
+	if age <= 0 {
+		return
+	}
+
+	err := CleanupTemp(io.Discard, os.TempDir(), age, dryRun)
+	if err != nil {
+		logs.GetLogger().Warn().Err(err).Str("temp_dir", os.TempDir()).
+			Msg("failed to remove stale temporary files")
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file config.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/wtsi-npg/valet/valet"
+)
+
+// effectiveConfig describes the configuration resolved for a command from its
+// flags, their defaults and the environment.
+type effectiveConfig struct {
+	Command     string            `json:"command"`
+	Version     string            `json:"version"`
+	Flags       map[string]any    `json:"flags"`       // All flags, by name
+	Explicit    []string          `json:"explicit"`    // The flags given explicitly
+	Environment map[string]string `json:"environment"` // Relevant environment variables
+}
+
+// The environment variables that affect valet's behaviour.
+var configEnvVars = []string{IRODSEnvFileVar, TraceEnvVar, "TMPDIR"}
+
+// printConfig writes the effective configuration of cmd to w as JSON.
+func printConfig(w io.Writer, cmd *cobra.Command) error {
+	config := effectiveConfig{
+		Command:     cmd.CommandPath(),
+		Version:     valet.Version,
+		Flags:       make(map[string]any),
+		Explicit:    []string{},
+		Environment: make(map[string]string),
+	}
+
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Name == "help" || f.Name == "print-config" {
+			return
+		}
+
+		config.Flags[f.Name] = flagValue(f)
+		if f.Changed {
+			config.Explicit = append(config.Explicit, f.Name)
+		}
+	})
+
+	for _, name := range configEnvVars {
+		if value, ok := os.LookupEnv(name); ok {
+			config.Environment[name] = value
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(config)
+}
+
+// flagValue returns the value of flag f as a JSON-friendly type, where the
+// type of the flag is known, or otherwise as a string.
+func flagValue(f *pflag.Flag) any {
+	if slice, ok := f.Value.(pflag.SliceValue); ok {
+		return slice.GetSlice()
+	}
+
+	s := f.Value.String()
+	switch f.Value.Type() {
+	case "bool":
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	case "int", "int32", "int64":
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+	case "float32", "float64":
+		if x, err := strconv.ParseFloat(s, 64); err == nil {
+			return x
+		}
+	}
+
+	return s
+}
+
+// printWorkPlan writes workPlan to w as JSON, one element per WorkMatch in the
+// order of the plan.
+func printWorkPlan(w io.Writer, workPlan valet.WorkPlan) error {
+	if workPlan == nil {
+		workPlan = valet.WorkPlan{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false) // As for WorkMatch.MarshalJSON
+
+	return enc.Encode(workPlan)
+}
@@ -0,0 +1,272 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file doctor.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	ex "github.com/wtsi-npg/extendo/v2"
+
+	"github.com/wtsi-npg/valet/utilities"
+	"github.com/wtsi-npg/valet/valet"
+)
+
+// The default minimum free space on the filesystem of the root directory
+const defaultMinFreeSpace = 10 * 1024 * 1024 * 1024
+
+type doctorCliFlags struct {
+	localRoot    string   // The root directory to check
+	archiveRoot  string   // The root collection of the archive to check
+	excludeDirs  []string // Exclusion patterns to check
+	minFreeSpace uint64   // The minimum free space on the root filesystem
+}
+
+// doctorCheck is a single check of the environment, which passes if its
+// function returns nil.
+type doctorCheck struct {
+	desc  string
+	check func() error
+}
+
+var doctorFlags = &doctorCliFlags{}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that the environment is configured correctly for valet",
+	Long: `
+valet doctor will check the environment in which valet is to run and print a
+checklist of the results. It checks that:
+
+- the root directory exists and is readable
+
+- TMPDIR is writable and on the same filesystem as the root directory
+
+- the --exclude patterns are valid
+
+- the filesystem of the root directory has at least --min-free-space bytes free
+
+and, if --archive-root is given, that:
+
+- an iRODS client can be obtained
+
+- the parent collection of the archive root exists
+
+valet doctor exits with a non-zero status if any check fails.
+`,
+	Example: `
+valet doctor --root /data --exclude /data/custom \
+    --archive-root /seq/ont/gridion/gxb02004`,
+	Run: runDoctorCmd,
+}
+
+func init() {
+	doctorCmd.Flags().StringVarP(&doctorFlags.localRoot,
+		"root", "r", "",
+		"the root directory to check")
+
+	err := doctorCmd.MarkFlagRequired("root")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to mark --root required: %s\n", err)
+		os.Exit(1)
+	}
+
+	doctorCmd.Flags().StringVarP(&doctorFlags.archiveRoot,
+		"archive-root", "a", "",
+		"the archive root collection to check (optional)")
+
+	doctorCmd.Flags().StringArrayVar(&doctorFlags.excludeDirs,
+		"exclude", []string{},
+		"glob patterns matching directories to prune "+
+			"(** matches any number of directories)")
+
+	doctorCmd.Flags().Uint64Var(&doctorFlags.minFreeSpace,
+		"min-free-space", defaultMinFreeSpace,
+		"the minimum free space in bytes on the filesystem of the root "+
+			"directory")
+
+	valetCmd.AddCommand(doctorCmd)
+}
+
+func runDoctorCmd(cmd *cobra.Command, args []string) {
+	setupLogger(baseFlags)
+
+	checks := doctorChecks(doctorFlags, os.TempDir())
+	if doctorFlags.archiveRoot != "" {
+		cPool := ex.NewClientPool(ex.DefaultClientPoolParams, "--silent")
+		defer cPool.Close()
+
+		checks = append(checks,
+			archiveChecks(cPool, doctorFlags.archiveRoot)...)
+	}
+
+	if !RunDoctorChecks(os.Stdout, checks) {
+		os.Exit(ExitFailure)
+	}
+}
+
+// RunDoctorChecks runs each of checks in turn, writing a checklist of the
+// results to w. Returns true if all the checks pass.
+func RunDoctorChecks(w io.Writer, checks []doctorCheck) bool {
+	ok := true
+	for _, c := range checks {
+		if err := c.check(); err != nil {
+			_, _ = fmt.Fprintf(w, "[FAIL] %s: %s\n", c.desc, err)
+			ok = false
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "[PASS] %s\n", c.desc)
+	}
+
+	return ok
+}
+
+// doctorChecks returns the checks of the local environment.
+func doctorChecks(flags *doctorCliFlags, tempDir string) []doctorCheck {
+	root := flags.localRoot
+
+	return []doctorCheck{
+		{
+			desc: fmt.Sprintf("root directory '%s' is readable", root),
+			check: func() error {
+				return checkReadableDir(root)
+			},
+		},
+		{
+			desc: fmt.Sprintf("temp directory '%s' is writable", tempDir),
+			check: func() error {
+				return checkWritableDir(tempDir)
+			},
+		},
+		{
+			desc: fmt.Sprintf("temp directory '%s' is on the same "+
+				"filesystem as the root directory", tempDir),
+			check: func() error {
+				same, err := utilities.IsSameFilesystem(root, tempDir)
+				if err == nil && !same {
+					err = errors.New("files cannot be renamed from the " +
+						"temp directory into the root directory; set TMPDIR")
+				}
+				return err
+			},
+		},
+		{
+			desc: "exclusion patterns are valid",
+			check: func() error {
+				_, err := valet.MakeGlobPruneFunc(flags.excludeDirs)
+				if err != nil {
+					return err
+				}
+				_, err = valet.MakeDefaultPruneFunc(root)
+				return err
+			},
+		},
+		{
+			desc: fmt.Sprintf("root filesystem has at least %d bytes free",
+				flags.minFreeSpace),
+			check: func() error {
+				free, err := utilities.FreeSpace(root)
+				if err == nil && free < flags.minFreeSpace {
+					err = errors.Errorf("only %d bytes free", free)
+				}
+				return err
+			},
+		},
+	}
+}
+
+// archiveChecks returns the checks of the archive, whose root collection is
+// archiveRoot.
+func archiveChecks(cPool *ex.ClientPool, archiveRoot string) []doctorCheck {
+	parent := path.Dir(archiveRoot)
+
+	return []doctorCheck{
+		{
+			desc: "an iRODS client can be obtained",
+			check: func() error {
+				return checkArchive(cPool)
+			},
+		},
+		{
+			desc: fmt.Sprintf("archive root parent collection '%s' exists",
+				parent),
+			check: func() (err error) { // NRV
+				var client *ex.Client
+				if client, err = valet.GetClient(cPool); err != nil {
+					return err
+				}
+				defer func() {
+					err = utilities.CombineErrors(err, cPool.Return(client))
+				}()
+
+				coll := ex.NewCollection(client, parent)
+
+				var exists bool
+				if exists, err = coll.Exists(); err != nil {
+					return err
+				}
+				if !exists {
+					return errors.New("collection does not exist")
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// checkReadableDir returns an error if dir is not a directory whose entries
+// may be read.
+func checkReadableDir(dir string) (err error) { // NRV
+	var f *os.File
+	if f, err = os.Open(dir); err != nil {
+		return err
+	}
+	defer func() {
+		err = utilities.CombineErrors(err, f.Close())
+	}()
+
+	var info os.FileInfo
+	if info, err = f.Stat(); err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New("not a directory")
+	}
+
+	if _, err = f.Readdirnames(1); err == io.EOF {
+		err = nil
+	}
+	return err
+}
+
+// checkWritableDir returns an error if a file cannot be created in dir.
+func checkWritableDir(dir string) error {
+	f, err := os.CreateTemp(dir, "valet-doctor-")
+	if err != nil {
+		return err
+	}
+
+	return utilities.CombineErrors(f.Close(), os.Remove(f.Name()))
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file exitcode.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	logs "github.com/wtsi-npg/logshim"
+
+	"github.com/wtsi-npg/valet/valet"
+)
+
+// The exit codes of valet, by category of failure. Supervisors may use them
+// to decide whether to retry e.g. a retry may succeed after ExitUnreachable,
+// but not after ExitUsage.
+const (
+	ExitFailure     = 1 // An unclassified failure
+	ExitUsage       = 2 // Invalid arguments or configuration
+	ExitUnreachable = 3 // The archive could not be reached
+	ExitProcessing  = 4 // An error occurred while processing files
+	ExitMismatch    = 5 // Checksum verification failed
+)
+
+// exitError is an error that determines the exit code of valet.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// usageError returns err categorised as an ExitUsage error.
+func usageError(err error) error {
+	return &exitError{ExitUsage, err}
+}
+
+// unreachableError returns err categorised as an ExitUnreachable error.
+func unreachableError(err error) error {
+	return &exitError{ExitUnreachable, err}
+}
+
+// processingError returns err categorised as an ExitProcessing error.
+func processingError(err error) error {
+	return &exitError{ExitProcessing, err}
+}
+
+// archivingError returns err, from processing files, categorised as an
+// ExitUnreachable error if it occurred because the archive could not be
+// reached, or otherwise as an ExitProcessing error.
+func archivingError(err error) error {
+	if valet.IsUnreachable(err) {
+		return unreachableError(err)
+	}
+	return processingError(err)
+}
+
+// mismatchError returns err categorised as an ExitMismatch error.
+func mismatchError(err error) error {
+	return &exitError{ExitMismatch, err}
+}
+
+// exitCode returns the exit code for err. An error which has not been
+// categorised has the code ExitFailure.
+func exitCode(err error) int {
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return ExitFailure
+}
+
+// exitOnError logs err with msg and exits with the exit code for err.
+func exitOnError(log logs.Logger, err error, msg string) {
+	log.Error().Err(err).Msg(msg)
+	os.Exit(exitCode(err))
+}
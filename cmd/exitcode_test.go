@@ -0,0 +1,49 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file exitcode_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	ex "github.com/wtsi-npg/extendo/v2"
+
+	"github.com/wtsi-npg/valet/valet"
+)
+
+func TestArchivingError(t *testing.T) {
+	cPool := ex.NewClientPool(ex.DefaultClientPoolParams)
+	cPool.Close()
+
+	// No client can be obtained from a closed pool
+	hasCollection := valet.MakeHasCollection("/data", "/zone/archive", cPool)
+	path, _ := valet.NewFilePathNoStat("/data/run")
+	_, unreachable := hasCollection(path)
+	if assert.Error(t, unreachable) {
+		assert.Equal(t, ExitUnreachable,
+			exitCode(archivingError(unreachable)))
+	}
+
+	failed := errors.New("encountered 1 errors processing 1 files")
+	assert.Equal(t, ExitProcessing, exitCode(archivingError(failed)))
+	assert.Equal(t, ExitFailure, exitCode(failed))
+}
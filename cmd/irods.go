@@ -0,0 +1,54 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file irods.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// IRODSEnvFileVar is the environment variable naming the iRODS environment
+// file, which is read by the iRODS clients started by extendo.
+const IRODSEnvFileVar = "IRODS_ENVIRONMENT_FILE"
+
+// setIRODSEnvironment points the iRODS clients started by extendo at the
+// environment file path, rather than at the default $HOME/.irods/
+// irods_environment.json. The clients inherit valet's environment, so this
+// applies to every client pool created afterwards.
+func setIRODSEnvironment(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(abs)
+	if err != nil {
+		return errors.Wrap(err, "invalid iRODS environment file")
+	}
+	if !info.Mode().IsRegular() {
+		return errors.Errorf("iRODS environment file %s is not a "+
+			"regular file", abs)
+	}
+
+	return os.Setenv(IRODSEnvFileVar, abs)
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file quarantine.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	logs "github.com/wtsi-npg/logshim"
+
+	"github.com/wtsi-npg/valet/valet"
+)
+
+type quarantineCliFlags struct {
+	quarantineFile string // The quarantine file
+}
+
+var quarantineFlags = &quarantineCliFlags{}
+
+var quarantineCmd = &cobra.Command{
+	Use:   "quarantine",
+	Short: "Manage files quarantined after repeated failures",
+	Long: `
+valet quarantine provides commands to list the files quarantined by valet
+because work on them failed repeatedly (see --quarantine-after), and to clear
+them from the quarantine so that they will be worked on again.
+
+The quarantine file is read when valet starts, so a running valet must be
+restarted for files cleared from the quarantine to be worked on.
+`,
+	Run: runQuarantineCmd,
+}
+
+var quarantineListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List quarantined files",
+	Example: `
+valet quarantine list --quarantine-file /var/lib/valet/quarantine.json`,
+	Run: runQuarantineListCmd,
+}
+
+var quarantineClearCmd = &cobra.Command{
+	Use:   "clear [path ...]",
+	Short: "Clear files from the quarantine",
+	Long: `
+valet quarantine clear will remove the given paths from the quarantine, or all
+paths if none are given, and print the paths removed.
+`,
+	Example: `
+valet quarantine clear --quarantine-file /var/lib/valet/quarantine.json \
+    /data/run1/reads1.fast5`,
+	Run: runQuarantineClearCmd,
+}
+
+func init() {
+	subCmds := []*cobra.Command{quarantineListCmd, quarantineClearCmd}
+	for _, cmd := range subCmds {
+		cmd.Flags().StringVar(&quarantineFlags.quarantineFile,
+			"quarantine-file", "",
+			"the quarantine file")
+
+		if err := cmd.MarkFlagRequired("quarantine-file"); err != nil {
+			logs.GetLogger().Error().
+				Err(err).Msg("failed to mark --quarantine-file required")
+			os.Exit(1)
+		}
+
+		quarantineCmd.AddCommand(cmd)
+	}
+
+	valetCmd.AddCommand(quarantineCmd)
+}
+
+func runQuarantineCmd(cmd *cobra.Command, args []string) {
+	if err := cmd.Help(); err != nil {
+		logs.GetLogger().Error().Err(err).Msg("help command failed")
+		os.Exit(1)
+	}
+}
+
+func runQuarantineListCmd(cmd *cobra.Command, args []string) {
+	log := setupLogger(baseFlags)
+
+	entries, err := valet.ReadQuarantineFile(quarantineFlags.quarantineFile)
+	if err != nil {
+		exitOnError(log, err, "failed to read the quarantine file")
+	}
+
+	printQuarantineEntries(os.Stdout, entries)
+}
+
+func runQuarantineClearCmd(cmd *cobra.Command, args []string) {
+	log := setupLogger(baseFlags)
+
+	var paths []string
+	for _, arg := range args {
+		path, err := filepath.Abs(arg)
+		if err != nil {
+			exitOnError(log, usageError(err), "invalid path")
+		}
+		paths = append(paths, path)
+	}
+
+	cleared, err := valet.ClearQuarantineFile(quarantineFlags.quarantineFile,
+		paths)
+	if err != nil {
+		exitOnError(log, err, "failed to clear the quarantine")
+	}
+
+	for _, e := range cleared {
+		_, _ = fmt.Fprintln(os.Stdout, e.Path)
+	}
+}
+
+// printQuarantineEntries writes a line for each of entries to w.
+func printQuarantineEntries(w io.Writer, entries []valet.QuarantineEntry) {
+	for _, e := range entries {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", e.Path, e.Failures,
+			e.QuarantinedAt.Format(time.RFC3339), e.LastError)
+	}
+}
+
+// newQuarantine returns the quarantine configured by flags, or nil if
+// quarantining is disabled. It exits if the quarantine file cannot be read.
+func newQuarantine(flags *dataDirCliFlags) *valet.Quarantine {
+	if flags.quarantineAfter <= 0 {
+		return nil
+	}
+
+	q, err := valet.NewQuarantine(flags.quarantineFile, flags.quarantineAfter)
+	if err != nil {
+		exitOnError(logs.GetLogger(), usageError(err),
+			"failed to read the quarantine file")
+	}
+
+	return q
+}
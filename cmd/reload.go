@@ -0,0 +1,114 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file reload.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	logs "github.com/wtsi-npg/logshim"
+
+	"github.com/wtsi-npg/valet/valet"
+)
+
+// reloadSettings are the settings that may be changed by reloading the file
+// given by --reload-file on SIGHUP. Settings absent from the file are left
+// unchanged.
+type reloadSettings struct {
+	SweepInterval *string `json:"sweep_interval"` // e.g. "10m"
+	CleanupDelay  *string `json:"cleanup_delay"`  // e.g. "336h"
+}
+
+// readReloadFile reads the settings in the JSON file at path and returns the
+// new sweep interval and cleanup delay, or 0 for any that are absent. It
+// returns an error if any setting is invalid, so that none is applied.
+func readReloadFile(path string) (interval time.Duration,
+	cleanup time.Duration, err error) {
+	var data []byte
+	if data, err = os.ReadFile(path); err != nil {
+		return 0, 0, err
+	}
+
+	var settings reloadSettings
+	if err = json.Unmarshal(data, &settings); err != nil {
+		return 0, 0, errors.Wrapf(err, "invalid reload file '%s'", path)
+	}
+
+	if settings.SweepInterval != nil {
+		if interval, err = time.ParseDuration(*settings.SweepInterval); err != nil {
+			return 0, 0, errors.Wrap(err, "invalid sweep_interval")
+		}
+		if interval < valet.MinSweepInterval {
+			return 0, 0, errors.Errorf("invalid sweep_interval %s "+
+				"(must be >= %s)", interval, valet.MinSweepInterval)
+		}
+	}
+
+	if settings.CleanupDelay != nil {
+		if cleanup, err = time.ParseDuration(*settings.CleanupDelay); err != nil {
+			return 0, 0, errors.Wrap(err, "invalid cleanup_delay")
+		}
+		if cleanup < valet.MinCleanupDelay {
+			return 0, 0, errors.Errorf("invalid cleanup_delay %s "+
+				"(must be >= %s)", cleanup, valet.MinCleanupDelay)
+		}
+	}
+
+	return interval, cleanup, nil
+}
+
+// setupReloadHandler reloads the settings in the file at path on SIGHUP,
+// sending any new sweep interval to intervals and setting any new cleanup
+// delay in cleanup. A file that cannot be read, or has an invalid setting, is
+// logged as an error and ignored, leaving the current settings unchanged.
+func setupReloadHandler(path string, intervals chan<- time.Duration,
+	cleanup *valet.DurationSetting) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		log := logs.GetLogger()
+
+		for range signals {
+			log.Info().Str("path", path).Msg("got SIGHUP, reloading settings")
+
+			interval, delay, err := readReloadFile(path)
+			if err != nil {
+				log.Error().Err(err).Str("path", path).
+					Msg("failed to reload settings, leaving them unchanged")
+				continue
+			}
+
+			if delay > 0 {
+				cleanup.Set(delay)
+				log.Info().Dur("cleanup_delay", delay).
+					Msg("changed cleanup delay")
+			}
+			if interval > 0 {
+				// Applied by the sweeps once any sweep in progress finishes
+				intervals <- interval
+			}
+		}
+	}()
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (C) 2019, 2020. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file report_validate.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	logs "github.com/wtsi-npg/logshim"
+
+	"github.com/wtsi-npg/valet/valet"
+)
+
+var reportValidateFlags = &dataDirCliFlags{}
+
+var reportValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the MinKNOW reports under a root directory",
+	Long: `
+valet report validate will find the MinKNOW reports under a root directory and
+check that each can be parsed and that its metadata can be made, including the
+mapping of its device ID to an instrument slot (see --slot-mapping). These are
+the reports used to annotate the archive, so validating them before a bulk
+annotation catches the errors that would otherwise stop annotation part way.
+
+Nothing is changed and the archive is not consulted. Each report that fails is
+printed with the reason, followed by a summary, and valet will exit with a
+non-zero status if any failed.
+`,
+	Example: `
+valet report validate --root /data --slot-mapping slots.json`,
+	Run: runReportValidateCmd,
+}
+
+func init() {
+	reportValidateCmd.Flags().StringVarP(&reportValidateFlags.localRoot,
+		"root", "r", "",
+		"the root directory under which to validate reports")
+
+	err := reportValidateCmd.MarkFlagRequired("root")
+	if err != nil {
+		logs.GetLogger().Error().
+			Err(err).Msg("failed to mark --root required")
+		os.Exit(1)
+	}
+
+	reportValidateCmd.Flags().StringArrayVar(&reportValidateFlags.excludeDirs,
+		"exclude", []string{},
+		"glob patterns matching directories to prune "+
+			"(** matches any number of directories)")
+
+	reportCmd.AddCommand(reportValidateCmd)
+}
+
+func runReportValidateCmd(cmd *cobra.Command, args []string) {
+	log := setupLogger(baseFlags)
+
+	report, err := makeReportConfig(0, 0)
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid report options")
+	}
+
+	validation, err := ValidateReports(reportValidateFlags.localRoot,
+		reportValidateFlags.excludeDirs, report)
+	if err != nil {
+		exitOnError(log, err, "report validation failed")
+	}
+
+	PrintReportValidation(os.Stdout, validation)
+
+	if len(validation.Failed) > 0 {
+		exitOnError(log, processingError(errors.Errorf("%d of %d reports "+
+			"failed validation", len(validation.Failed),
+			validation.NumReports)), "report validation failed")
+	}
+}
+
+// ValidateReports validates the MinKNOW reports under root (subject to any
+// exclusion patterns in exclude), as configured by rc.
+func ValidateReports(root string, exclude []string,
+	rc valet.ReportConfig) (valet.ReportValidation, error) {
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	setupSignalHandler(cancel)
+
+	pruneFn, err := valet.MakeGlobPruneFunc(exclude)
+	if err != nil {
+		return valet.ReportValidation{}, usageError(err)
+	}
+
+	paths, errs := valet.FindFiles(cancelCtx, root,
+		valet.And(valet.Not(valet.IsSpecial), valet.IsMinKNOWReport), pruneFn)
+
+	log := logs.GetLogger()
+	go func() {
+		for err := range errs {
+			log.Warn().Err(err).Msg("while finding reports")
+		}
+	}()
+
+	return valet.ValidateReports(paths, rc), nil
+}
+
+// PrintReportValidation writes validation to w, one line per report that
+// failed, followed by the totals.
+func PrintReportValidation(w io.Writer, validation valet.ReportValidation) {
+	for _, failure := range validation.Failed {
+		_, _ = fmt.Fprintln(w, failure)
+	}
+	_, _ = fmt.Fprintf(w, "%d reports validated, %d failed\n",
+		validation.NumReports, len(validation.Failed))
+}
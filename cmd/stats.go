@@ -0,0 +1,172 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file stats.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	logs "github.com/wtsi-npg/logshim"
+
+	"github.com/wtsi-npg/valet/valet"
+)
+
+type statsCliFlags struct {
+	localRoot   string   // The root directory to summarise
+	excludeDirs []string // Directories to exclude from the summary
+	json        bool     // Print the summary as JSON
+}
+
+var statsFlags = &statsCliFlags{}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Summarise the files under a root directory",
+	Long: `
+valet stats will make a single sweep of a directory hierarchy and print a
+summary of the files within it, for capacity planning. It reports:
+
+- the number and total size of the files of each type, by suffix; compressed
+  files are of the type of their content, where valet compresses that type
+
+- the number of files to be archived that have, or lack, an up-to-date
+  checksum file
+
+- the number of MinKNOW run directories and the least and most recently
+  modified of them
+
+Nothing is changed and the archive is not consulted. The summary is printed as
+a table or, with --json, as JSON.
+`,
+	Example: `
+valet stats --root /data --exclude /data/custom --json`,
+	Run: runStatsCmd,
+}
+
+func init() {
+	statsCmd.Flags().StringVarP(&statsFlags.localRoot,
+		"root", "r", "",
+		"the root directory to summarise")
+
+	err := statsCmd.MarkFlagRequired("root")
+	if err != nil {
+		logs.GetLogger().Error().
+			Err(err).Msg("failed to mark --root required")
+		os.Exit(1)
+	}
+
+	statsCmd.Flags().StringArrayVar(&statsFlags.excludeDirs,
+		"exclude", []string{},
+		"glob patterns matching directories to prune "+
+			"(** matches any number of directories)")
+
+	statsCmd.Flags().BoolVar(&statsFlags.json,
+		"json", false,
+		"print the summary as JSON")
+
+	valetCmd.AddCommand(statsCmd)
+}
+
+func runStatsCmd(cmd *cobra.Command, args []string) {
+	log := setupLogger(baseFlags)
+
+	sel, err := makeSelection()
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid file selection options")
+	}
+
+	stats, err := SummariseTree(statsFlags.localRoot, statsFlags.excludeDirs,
+		sel)
+	if err != nil {
+		exitOnError(log, err, "summary failed")
+	}
+
+	if statsFlags.json {
+		err = PrintTreeStatsJSON(os.Stdout, stats)
+	} else {
+		PrintTreeStats(os.Stdout, stats)
+	}
+	if err != nil {
+		exitOnError(log, err, "failed to print summary")
+	}
+}
+
+// SummariseTree makes a single sweep of the files under root (subject to any
+// exclusion patterns in exclude) and summarises them, counting the files
+// selected by sel as those to be archived.
+func SummariseTree(root string, exclude []string,
+	sel valet.Selection) (valet.TreeStats, error) {
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	setupSignalHandler(cancel)
+
+	pruneFn, err := valet.MakeGlobPruneFunc(exclude)
+	if err != nil {
+		return valet.TreeStats{}, usageError(err)
+	}
+
+	paths, errs := valet.FindFiles(cancelCtx, root, valet.Not(valet.IsSpecial),
+		pruneFn)
+
+	log := logs.GetLogger()
+	go func() {
+		for err := range errs {
+			log.Warn().Err(err).Msg("while finding files")
+		}
+	}()
+
+	return valet.SummariseTree(paths, sel), nil
+}
+
+// PrintTreeStats writes stats to w as a table, one line per file type,
+// followed by the totals.
+func PrintTreeStats(w io.Writer, stats valet.TreeStats) {
+	_, _ = fmt.Fprintf(w, "%-10s %10s %16s\n", "type", "files", "bytes")
+	for _, ts := range stats.Types {
+		_, _ = fmt.Fprintf(w, "%-10s %10d %16d\n", ts.Type, ts.NumFiles,
+			ts.NumBytes)
+	}
+	_, _ = fmt.Fprintf(w, "%-10s %10d %16d\n", "total", stats.NumFiles,
+		stats.NumBytes)
+
+	_, _ = fmt.Fprintf(w, "%d files to archive with a checksum file, "+
+		"%d without\n", stats.NumWithChecksum, stats.NumWithoutChecksum)
+	_, _ = fmt.Fprintf(w, "%d run directories\n", stats.NumRunDirs)
+	if stats.OldestRun != nil {
+		_, _ = fmt.Fprintf(w, "oldest run: %s (%s)\n", stats.OldestRun.Path,
+			stats.OldestRun.ModTime.Format(time.RFC3339))
+		_, _ = fmt.Fprintf(w, "newest run: %s (%s)\n", stats.NewestRun.Path,
+			stats.NewestRun.ModTime.Format(time.RFC3339))
+	}
+}
+
+// PrintTreeStatsJSON writes stats to w as JSON.
+func PrintTreeStatsJSON(w io.Writer, stats valet.TreeStats) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(stats)
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file tracing.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"time"
+
+	logs "github.com/wtsi-npg/logshim"
+)
+
+// TraceEnvVar is the environment variable which, if set to a non-empty value,
+// enables tracing by default.
+const TraceEnvVar = "VALET_TRACE"
+
+// traceShutdownTimeout is the time allowed to export any remaining spans on
+// exit.
+const traceShutdownTimeout = 5 * time.Second
+
+// startTracing enables tracing if flags request it and returns a function to
+// be called on exit to flush any remaining spans. If tracing cannot be
+// enabled, it exits.
+func startTracing(flags *baseCliFlags) func() {
+	if !flags.trace {
+		return func() {}
+	}
+
+	log := logs.GetLogger()
+
+	shutdown, err := setupTracing(context.Background())
+	if err != nil {
+		exitOnError(log, usageError(err), "failed to enable tracing")
+	}
+	log.Info().Msg("tracing enabled")
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(),
+			traceShutdownTimeout)
+		defer cancel()
+
+		if err := shutdown(ctx); err != nil {
+			log.Warn().Err(err).Msg("failed to flush traces")
+		}
+	}
+}
+
+// traceDefault returns the default for the --trace flag.
+func traceDefault() bool {
+	return os.Getenv(TraceEnvVar) != ""
+}
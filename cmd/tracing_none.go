@@ -0,0 +1,36 @@
+//go:build !otlp
+
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file tracing_none.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// setupTracing returns an error because this build of valet does not include
+// a trace exporter. Build with the otlp tag to include one.
+func setupTracing(_ context.Context) (func(context.Context) error, error) {
+	return nil, errors.New("tracing is not supported by this build of " +
+		"valet (build with -tags otlp)")
+}
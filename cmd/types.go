@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file types.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/wtsi-npg/valet/valet"
+)
+
+type typesCliFlags struct {
+	json bool // Print the file types as JSON
+}
+
+var typesFlags = &typesCliFlags{}
+
+var typesCmd = &cobra.Command{
+	Use:   "types",
+	Short: "List the supported file types and their handling",
+	Long: `
+valet types will print each type of data file that valet recognises, named by
+its suffix, and whether files of that type are compressed, given a checksum
+file and copied to the archive. Compressed files are of the type of their
+content and a type that is compressed is archived as its compressed version.
+
+The handling is found from the same rules that select files for archiving, so
+it reflects the current settings, such as --min-compress-size. Files with any
+suffix given by --include-suffix are also copied and given a checksum file.
+The types are printed as a table or, with --json, as JSON.
+`,
+	Example: `
+valet types --json`,
+	Run: runTypesCmd,
+}
+
+func init() {
+	typesCmd.Flags().BoolVar(&typesFlags.json,
+		"json", false,
+		"print the file types as JSON")
+
+	valetCmd.AddCommand(typesCmd)
+}
+
+func runTypesCmd(cmd *cobra.Command, args []string) {
+	log := setupLogger(baseFlags)
+
+	sel, err := makeSelection()
+	if err != nil {
+		exitOnError(log, usageError(err), "invalid file selection options")
+	}
+
+	handling, err := valet.DescribeFileTypes(sel)
+	if err != nil {
+		exitOnError(log, err, "failed to describe the file types")
+	}
+
+	if typesFlags.json {
+		err = PrintFileTypesJSON(os.Stdout, handling)
+	} else {
+		PrintFileTypes(os.Stdout, handling)
+	}
+	if err != nil {
+		exitOnError(log, err, "failed to print the file types")
+	}
+}
+
+// PrintFileTypes writes handling to w as a table, one line per file type.
+func PrintFileTypes(w io.Writer, handling []valet.FileTypeHandling) {
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+
+	_, _ = fmt.Fprintf(w, "%-10s %-10s %-11s %s\n", "type", "compressed",
+		"checksummed", "copied")
+	for _, h := range handling {
+		_, _ = fmt.Fprintf(w, "%-10s %-10s %-11s %s\n", h.Type,
+			yesNo(h.Compressed), yesNo(h.Checksummed), yesNo(h.Copied))
+	}
+}
+
+// PrintFileTypesJSON writes handling to w as JSON.
+func PrintFileTypesJSON(w io.Writer, handling []valet.FileTypeHandling) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(handling)
+}
@@ -33,8 +33,10 @@ import (
 
 	"golang.org/x/crypto/ssh/terminal"
 
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
+	ex "github.com/wtsi-npg/extendo/v2"
 
 	"github.com/wtsi-npg/valet/utilities"
 	"github.com/wtsi-npg/valet/valet"
@@ -44,24 +46,108 @@ import (
 )
 
 type baseCliFlags struct {
-	debug   bool // Enable debug logging
-	verbose bool // Enable verbose logging
-	dryRun  bool // Enable dry-run mode
-	maxProc int  // The maximum number of threads to use
+	debug          bool          // Enable debug logging
+	verbose        bool          // Enable verbose logging
+	dryRun         bool          // Enable dry-run mode
+	dryRunVerify   bool          // Enable dry-run mode, consulting the archive
+	maxProc        int           // The maximum number of threads to use
+	chkWorkers     int           // The maximum number of checksum threads to use
+	maxProcPerRun  int           // The maximum number of files of one run in flight
+	maxBytes       int64         // The maximum total size of files in flight
+	fileTimeout    time.Duration // The maximum time to work on one file
+	checksumSuffix string        // The suffix of checksum files
+	checksumHidden bool          // Checksum files are hidden (dot-prefixed)
+	trace          bool          // Enable tracing
+	printConfig    bool          // Print the effective configuration and exit
+	printPlan      bool          // Print the work plan and exit
+
+	reportNamespace string // The namespace of metadata from MinKNOW reports
+	slotMapping     string // A file mapping device IDs to instrument slots
+	irodsEnv        string // The iRODS environment file
+
+	includeSuffixes  []string // Additional suffixes of files to archive
+	minCompressSize  int64    // The size below which files are not compressed
+	minCompressRatio float64  // The compression ratio below which files are archived uncompressed
+
+	logFile    string        // The file to log to, instead of the terminal
+	logMaxSize int           // The size in megabytes at which to rotate the log file
+	logMaxAge  time.Duration // The age after which rotated log files are removed
 }
 
 type dataDirCliFlags struct {
 	archiveRoot   string        // The root collection of the archive
+	archiveRoots  []string      // Root collections to archive to, with fan-out
+	archiveEnvs   []string      // The iRODS environment file of each archive root
 	deleteLocal   bool          // Delete local files on successful archiving
+	reportDels    bool          // Only report the files that would be deleted
+	annotateOnly  bool          // Only annotate files already archived
+	extChecksum   bool          // Checksum files are created by a separate process
+	forceArchive  bool          // Archive every file again, overwriting archived copies
+	forceID       string        // Identifies the recovery made by archiving by force
+	chkMetaOnly   bool          // Checksum files are removed once confirmed as metadata
+	verifyComp    bool          // Compressed files are verified before use
+	provenance    bool          // Add provenance metadata to archived data objects
 	excludeDirs   []string      // Directories to exclude from monitoring
+	matchExpr     string        // A predicate expression restricting the files matched
+	pruneExpr     string        // A predicate expression matching directories to prune
 	localRoot     string        // The root directory to monitor
+	localPath     string        // A single file to process, instead of a root
 	sweepInterval time.Duration // The interval at which to perform sweeps
+	fullSweep     time.Duration // The interval at which to perform full sweeps
+	sweepJitter   float64       // The fraction by which to vary the sweep interval
+	watchGrace    time.Duration // The time a watched file must be unchanged
+	waitForRoot   time.Duration // The time to wait for the root directory to be created
+	stableSweep   bool          // Sweeps find only files unchanged since the last sweep
 	cleanupDelay  time.Duration // The delay after which empty run directories are removed
+	reloadFile    string        // A file of settings to reload on SIGHUP
+	healthAddr    string        // The address on which to serve health checks
+	startPaused   bool          // Start with processing paused
+	archWindow    string        // The daily window for compressing and archiving
+	archWindowTZ  string        // The time zone of the archive window
+	excludeOlder  time.Duration // The age after which archived directories are pruned
+	sizeLimit     int64         // The size at which files are skipped
+	excludeActive bool          // Exclude the run MinKNOW appears to be writing
+	onlyOwnFiles  bool          // Match only files owned by the current user
+	activeWindow  time.Duration // The period within which an active run is modified
+	minRunAge     time.Duration // The age below which run directories are pruned
+	mirrorEmpty   bool          // Create collections for empty directories
+	skipHardLinks bool          // Skip further hard links to files already seen
+	cleanupTemp   time.Duration // The age after which temp files are removed on startup
+	onlyRuns      []string      // The run IDs to restrict processing to
+	onlyRunsFile  string        // A file of run IDs to restrict processing to
+	meta          []string      // Metadata to add to archived data objects
+	metaFile      string        // A file of metadata to add to archived data objects
+	grants        []string      // ACLs to add to archived data objects
+	requireRepl   []string      // Resources on which archived data objects must be replicated
+	inheritNew    bool          // Enable inheritance on collections valet creates
+	preserveTimes bool          // Give data objects the modification times of their files
+	reportTries   int           // The number of attempts to parse an incomplete report
+	reportDelay   time.Duration // The delay between attempts to parse a report
+
+	mqURL   string // The URL of a Kafka REST proxy to publish archive events to
+	mqTopic string // The topic to publish archive events to
+
+	quarantineAfter int    // The number of consecutive failures to quarantine after
+	quarantineFile  string // The file in which to persist quarantined files
+	maxErrors       uint64 // The number of errors after which to abort
+
+	quotaHold    time.Duration // The initial hold on archiving when out of quota
+	quotaHoldMax time.Duration // The maximum hold on archiving when out of quota
+
+	remoteChecksum string // The checksum algorithm used by the archive
+	ofUncompressed bool   // Also checksum the uncompressed content of compressed files
+	algFromArchive bool   // Also checksum with the algorithm the archive uses
+
+	bundleDirs     []string      // Directories to archive as single tar objects
+	bundleMinFiles int           // The minimum number of files in a bundle
+	bundleMaxSize  int64         // The maximum total size of a bundle
+	bundleSettle   time.Duration // The delay before a directory is bundled
 }
 
 type dataFileCliFlags struct {
-	archivePath string // The path of the file in the archive
-	localPath   string // The path of the file on the local filesystem
+	archivePath    string // The path of the file in the archive
+	localPath      string // The path of the file on the local filesystem
+	remoteChecksum string // The checksum algorithm used by the archive
 }
 
 var baseFlags = &baseCliFlags{}
@@ -73,14 +159,15 @@ valet is a utility for performing data management tasks automatically. Once
 started, valet will continue working until interrupted by SIGINT or SIGTERM,
 when it will stop gracefully.
 `,
-	Run:     runValetCmd,
-	Version: valet.Version,
+	PersistentPreRun: configureValet,
+	Run:              runValetCmd,
+	Version:          valet.Version,
 }
 
 func Execute() {
 	if err := valetCmd.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(ExitUsage)
 	}
 }
 
@@ -90,6 +177,9 @@ func init() {
 		defaultMaxProc = 12
 	}
 
+	// The default size in megabytes at which the log file is rotated
+	const defaultLogMaxSize = 100
+
 	valetCmd.PersistentFlags().BoolVar(&baseFlags.debug,
 		"debug", false,
 		"enable debug output")
@@ -99,6 +189,74 @@ func init() {
 	valetCmd.PersistentFlags().IntVarP(&baseFlags.maxProc,
 		"max-proc", "m", defaultMaxProc,
 		"set the maximum number of processes to use")
+	valetCmd.PersistentFlags().IntVar(&baseFlags.chkWorkers,
+		"checksum-workers", 0,
+		"set the maximum number of processes to use for compression "+
+			"and checksumming, separately from --max-proc "+
+			"(0 to share --max-proc)")
+	valetCmd.PersistentFlags().IntVar(&baseFlags.maxProcPerRun,
+		"max-proc-per-run", 0,
+		"set the maximum number of files of any one run directory to "+
+			"process at once, so that other runs are not starved "+
+			"(0 for no limit)")
+	valetCmd.PersistentFlags().Int64Var(&baseFlags.maxBytes,
+		"max-bytes-in-flight", 0,
+		"set the maximum total size in bytes of files being processed "+
+			"at once (0 for no limit)")
+	valetCmd.PersistentFlags().DurationVar(&baseFlags.fileTimeout,
+		"file-timeout", 0,
+		"set the maximum time to work on any one file, after which the "+
+			"work is abandoned (0 for no limit)")
+	valetCmd.PersistentFlags().StringVar(&baseFlags.checksumSuffix,
+		"checksum-suffix", valet.MD5Suffix,
+		"the suffix of checksum files")
+	valetCmd.PersistentFlags().BoolVar(&baseFlags.checksumHidden,
+		"checksum-hidden", false,
+		"checksum files are hidden i.e. named .(data file name).(suffix)")
+	valetCmd.PersistentFlags().StringVar(&baseFlags.reportNamespace,
+		"report-namespace", valet.OxfordNanoporeNamespace,
+		"the namespace of metadata from MinKNOW reports")
+	valetCmd.PersistentFlags().StringVar(&baseFlags.irodsEnv,
+		"irods-env", "",
+		"the iRODS environment file to use, instead of the default "+
+			"discovered by the iRODS clients (sets "+IRODSEnvFileVar+")")
+	valetCmd.PersistentFlags().StringVar(&baseFlags.slotMapping,
+		"slot-mapping", "",
+		"a JSON file mapping device IDs to instrument slots, replacing the "+
+			"built-in mapping")
+	valetCmd.PersistentFlags().StringArrayVar(&baseFlags.includeSuffixes,
+		"include-suffix", []string{},
+		"an additional file suffix to treat as requiring copying and "+
+			"checksumming (repeatable; adds to, never removes, the "+
+			"built-in types)")
+	valetCmd.PersistentFlags().Int64Var(&baseFlags.minCompressSize,
+		"min-compress-size", 0,
+		"the size in bytes below which files are archived uncompressed, "+
+			"rather than compressed first (0 to compress files of any size)")
+	valetCmd.PersistentFlags().Float64Var(&baseFlags.minCompressRatio,
+		"min-compress-ratio", 0,
+		"the ratio of uncompressed to compressed size e.g. 1.1 below which "+
+			"a compressed file is discarded and the original archived "+
+			"uncompressed, which is recorded in a .incompressible file "+
+			"beside it (0 to keep every compressed file)")
+	valetCmd.PersistentFlags().BoolVar(&baseFlags.trace,
+		"trace", traceDefault(),
+		"export OpenTelemetry traces of the work on each file (also "+
+			"enabled by setting "+TraceEnvVar+")")
+	valetCmd.PersistentFlags().BoolVar(&baseFlags.printConfig,
+		"print-config", false,
+		"print the effective configuration of the command as JSON and exit, "+
+			"without doing any work")
+	valetCmd.PersistentFlags().StringVar(&baseFlags.logFile,
+		"log-file", "",
+		"log to this file, rotating it, instead of the terminal")
+	valetCmd.PersistentFlags().IntVar(&baseFlags.logMaxSize,
+		"log-max-size", defaultLogMaxSize,
+		"the size in megabytes at which to rotate the log file "+
+			"(0 for no rotation)")
+	valetCmd.PersistentFlags().DurationVar(&baseFlags.logMaxAge,
+		"log-max-age", 0,
+		"the age after which rotated log files are removed (0 to keep them)")
 
 	valetCmd.SetVersionTemplate(`{{printf "%s\n" .Version}}`)
 }
@@ -110,6 +268,91 @@ func runValetCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+// configureValet applies any package-wide valet configuration given on the
+// command line. It is run before any command.
+func configureValet(cmd *cobra.Command, args []string) {
+	// Each command installs its own logger when it runs and only the first
+	// logger installed takes effect, so configuration errors are logged to
+	// stderr by a logger that is not installed
+	log := zlog.New(zerolog.SyncWriter(os.Stderr), logs.ErrorLevel)
+
+	_, err := makeChecksumFiles()
+	if err != nil {
+		exitOnError(log, usageError(err),
+			"invalid checksum file options")
+	}
+
+	if baseFlags.irodsEnv != "" {
+		if err = setIRODSEnvironment(baseFlags.irodsEnv); err != nil {
+			exitOnError(log, usageError(err),
+				"invalid --irods-env")
+		}
+	}
+
+	if _, err = makeReportConfig(0, 0); err != nil {
+		exitOnError(log, usageError(err),
+			"invalid --report-namespace or --slot-mapping")
+	}
+
+	if _, err = makeSelection(); err != nil {
+		exitOnError(log, usageError(err),
+			"invalid file selection options")
+	}
+
+	if baseFlags.printConfig {
+		if err = printConfig(os.Stdout, cmd); err != nil {
+			exitOnError(log, err, "failed to print configuration")
+		}
+		os.Exit(0)
+	}
+}
+
+// makeSelection returns the Selection of files to work on, the built-in types
+// as extended by the command line options e.g. --include-suffix.
+func makeSelection() (valet.Selection, error) {
+	cf, err := makeChecksumFiles()
+	if err != nil {
+		return valet.Selection{}, err
+	}
+
+	return valet.MakeSelection(valet.SelectParams{
+		IncludedSuffixes: baseFlags.includeSuffixes,
+		MinCompressSize:  baseFlags.minCompressSize,
+		MinCompressRatio: baseFlags.minCompressRatio,
+		ChecksumFiles:    cf,
+	})
+}
+
+// makeChecksumFiles returns the naming of checksum files given by the command
+// line options --checksum-suffix and --checksum-hidden.
+func makeChecksumFiles() (valet.ChecksumFiles, error) {
+	return valet.MakeChecksumFiles(baseFlags.checksumSuffix,
+		baseFlags.checksumHidden)
+}
+
+// makeReportConfig returns the configuration with which MinKNOW reports are
+// parsed and annotated, from the command line options e.g. --report-namespace,
+// making up to attempts to parse an incomplete report, delay apart (0 for the
+// defaults).
+func makeReportConfig(attempts int,
+	delay time.Duration) (valet.ReportConfig, error) {
+	params := valet.ReportParams{
+		Namespace:     baseFlags.reportNamespace,
+		ParseAttempts: attempts,
+		ParseDelay:    delay,
+	}
+
+	if baseFlags.slotMapping != "" {
+		mapping, err := valet.LoadSlotMapping(baseFlags.slotMapping)
+		if err != nil {
+			return valet.ReportConfig{}, err
+		}
+		params.SlotMapping = mapping
+	}
+
+	return valet.MakeReportConfig(params)
+}
+
 func setupLogger(flags *baseCliFlags) logs.Logger {
 	var level logs.Level
 	if flags.debug {
@@ -122,7 +365,16 @@ func setupLogger(flags *baseCliFlags) logs.Logger {
 
 	// Choose a Zerolog logging backend
 	var writer io.Writer
-	if terminal.IsTerminal(int(os.Stdout.Fd())) {
+	if flags.logFile != "" {
+		rf, err := utilities.NewRotatingFile(flags.logFile,
+			int64(flags.logMaxSize)*1024*1024, flags.logMaxAge)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open log file %s: %s\n",
+				flags.logFile, err)
+			os.Exit(ExitUsage)
+		}
+		writer = rf
+	} else if terminal.IsTerminal(int(os.Stdout.Fd())) {
 		writer = zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}
 	} else {
 		writer = os.Stderr
@@ -155,3 +407,90 @@ func setupSignalHandler(cancel context.CancelFunc) {
 		}
 	}()
 }
+
+// setupPauseHandler pauses processing on SIGUSR1 and resumes it on SIGUSR2.
+func setupPauseHandler(pause *valet.Pause) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		log := logs.GetLogger()
+
+		for s := range signals {
+			switch s {
+			case syscall.SIGUSR1:
+				log.Info().Msg("got SIGUSR1, pausing processing")
+				pause.Pause()
+			case syscall.SIGUSR2:
+				log.Info().Msg("got SIGUSR2, resuming processing")
+				pause.Resume()
+			}
+		}
+	}()
+}
+
+// startHealthServer serves health check endpoints on addr until the cancel
+// function of cancelCtx is called. If cPool is not nil, readiness includes
+// obtaining a client from it. Returns the Health to be updated by processing,
+// or nil if addr is empty.
+func startHealthServer(cancelCtx context.Context, addr string,
+	cPool *ex.ClientPool) *valet.Health {
+	if addr == "" {
+		return nil
+	}
+
+	health := valet.NewHealth(cPool)
+	if err := valet.ServeHealth(cancelCtx, addr, health); err != nil {
+		logs.GetLogger().Error().Err(err).Str("addr", addr).
+			Msg("failed to start health check server")
+		os.Exit(ExitUsage)
+	}
+
+	return health
+}
+
+// checkArchive returns an error categorised as ExitUnreachable if a client
+// connected to the archive cannot be obtained from cPool.
+func checkArchive(cPool *ex.ClientPool) error {
+	client, err := valet.GetClient(cPool)
+	if err != nil {
+		return unreachableError(errors.Wrap(err, "failed to connect to "+
+			"the archive"))
+	}
+
+	return cPool.Return(client)
+}
+
+// The initial and maximum delays between checks of the archive while waiting
+// for it to be reachable (see waitForArchive).
+const (
+	archiveWaitMinDelay = 250 * time.Millisecond
+	archiveWaitMaxDelay = 30 * time.Second
+)
+
+// waitForArchive checks the archive as checkArchive does, retrying at
+// intervals that double from archiveWaitMinDelay to archiveWaitMaxDelay until
+// it can be reached, so that an archive that is briefly unreachable when valet
+// starts does not stop it. It returns nil once the archive has been reached,
+// or an error if cancelCtx is cancelled first.
+func waitForArchive(cancelCtx context.Context, cPool *ex.ClientPool) error {
+	log := logs.GetLogger()
+	delay := archiveWaitMinDelay
+	for {
+		err := checkArchive(cPool)
+		if err == nil {
+			return nil
+		}
+
+		log.Warn().Err(err).Dur("retry_in", delay).
+			Msg("waiting for the archive to be reachable")
+
+		select {
+		case <-cancelCtx.Done():
+			return unreachableError(errors.Wrap(cancelCtx.Err(),
+				"cancelled while waiting for the archive"))
+		case <-time.After(delay):
+		}
+
+		delay = min(delay*2, archiveWaitMaxDelay)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file filesystem.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package utilities
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// IsSameFilesystem returns true if paths a and b are on the same filesystem
+// i.e. a file may be renamed from one to the other. Both paths must exist.
+func IsSameFilesystem(a string, b string) (bool, error) {
+	devA, err := deviceID(a)
+	if err != nil {
+		return false, err
+	}
+	devB, err := deviceID(b)
+	if err != nil {
+		return false, err
+	}
+
+	return devA == devB, nil
+}
+
+// FreeSpace returns the number of bytes available to an unprivileged user on
+// the filesystem containing path.
+func FreeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, errors.Wrapf(err, "failed to stat filesystem of '%s'", path)
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
+
+func deviceID(path string) (uint64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, errors.Errorf("failed to find the device of '%s'", path)
+	}
+
+	return uint64(stat.Dev), nil
+}
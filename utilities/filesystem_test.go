@@ -0,0 +1,55 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file filesystem_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package utilities
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSameFilesystem(t *testing.T) {
+	tmpDir := t.TempDir()
+	subDir := filepath.Join(tmpDir, "sub")
+	if !assert.NoError(t, os.Mkdir(subDir, 0755)) {
+		return
+	}
+
+	same, err := IsSameFilesystem(tmpDir, subDir)
+	if assert.NoError(t, err) {
+		assert.True(t, same)
+	}
+
+	_, err = IsSameFilesystem(tmpDir, filepath.Join(tmpDir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestFreeSpace(t *testing.T) {
+	free, err := FreeSpace(t.TempDir())
+	if assert.NoError(t, err) {
+		assert.Greater(t, free, uint64(0))
+	}
+
+	_, err = FreeSpace(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
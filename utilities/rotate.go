@@ -0,0 +1,200 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file rotate.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package utilities
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the timestamp format used to name rotated files.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotatingFile is an io.WriteCloser that writes to a file which it rotates
+// once it reaches a maximum size. A rotated file is renamed with a timestamp
+// inserted before its extension e.g. valet.log becomes
+// valet-2026-10-16T12-00-00.000.log. Rotated files older than a maximum age
+// are removed.
+type RotatingFile struct {
+	filename string        // The path of the current file
+	maxSize  int64         // The size in bytes at which to rotate; 0 disables
+	maxAge   time.Duration // The age after which rotated files are removed; 0 disables
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewRotatingFile returns a new RotatingFile writing to filename, which is
+// created if necessary and otherwise appended to. The file is rotated when a
+// write would take it over maxSize bytes, unless maxSize is 0. Rotated files
+// older than maxAge are removed, unless maxAge is 0.
+func NewRotatingFile(filename string, maxSize int64,
+	maxAge time.Duration) (*RotatingFile, error) {
+	rf := &RotatingFile{filename: filename, maxSize: maxSize, maxAge: maxAge}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	return rf, rf.removeExpired()
+}
+
+// Write writes p to the current file, rotating it first if the write would
+// take it over the maximum size. A single write larger than the maximum size
+// is written to a new file.
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+
+	return n, err
+}
+
+// Close closes the current file.
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	return rf.file.Close()
+}
+
+func (rf *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(rf.filename), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(rf.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND,
+		0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return CombineErrors(err, f.Close())
+	}
+
+	rf.file, rf.size = f, info.Size()
+
+	return nil
+}
+
+// rotate renames the current file and opens a new one in its place. The
+// current file is renamed while still open, so that writing may continue to it
+// if the rename fails.
+func (rf *RotatingFile) rotate() error {
+	backup, err := rf.unusedBackupName(time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err = os.Rename(rf.filename, backup); err != nil {
+		return err
+	}
+
+	rotated := rf.file
+	if err = rf.open(); err != nil {
+		return err
+	}
+
+	if err = rotated.Close(); err != nil {
+		return err
+	}
+
+	return rf.removeExpired()
+}
+
+// unusedBackupName returns the name of a file rotated at time t, or, if that
+// is taken, the name for the first later millisecond that is not. Rotations
+// within the same millisecond are thus given distinct names, rather than
+// overwriting one another.
+func (rf *RotatingFile) unusedBackupName(t time.Time) (string, error) {
+	for {
+		backup := rf.backupName(t)
+
+		_, err := os.Lstat(backup)
+		if os.IsNotExist(err) {
+			return backup, nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// backupName returns the name of a file rotated at time t.
+func (rf *RotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(rf.filename)
+	prefix := strings.TrimSuffix(rf.filename, ext)
+
+	return prefix + "-" + t.Format(backupTimeFormat) + ext
+}
+
+// removeExpired removes rotated files older than the maximum age.
+func (rf *RotatingFile) removeExpired() error {
+	if rf.maxAge <= 0 {
+		return nil
+	}
+
+	ext := filepath.Ext(rf.filename)
+	prefix := strings.TrimSuffix(filepath.Base(rf.filename), ext) + "-"
+	dir := filepath.Dir(rf.filename)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-rf.maxAge)
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || !strings.HasPrefix(name, prefix) ||
+			!strings.HasSuffix(name, ext) {
+			continue
+		}
+
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		t, perr := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if perr != nil || !t.Before(cutoff) {
+			continue
+		}
+
+		if rerr := os.Remove(filepath.Join(dir, name)); rerr != nil &&
+			!os.IsNotExist(rerr) {
+			err = CombineErrors(err, rerr)
+		}
+	}
+
+	return err
+}
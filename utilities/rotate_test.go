@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file rotate_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package utilities
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "valet.log")
+
+	// An expired backup, which should be removed on opening
+	expired := filepath.Join(dir, "valet-"+
+		time.Now().Add(-48*time.Hour).Format(backupTimeFormat)+".log")
+	if !assert.NoError(t, os.WriteFile(expired, []byte("old\n"), 0600)) {
+		return
+	}
+
+	rf, err := NewRotatingFile(filename, 10, 24*time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = os.Stat(expired)
+	assert.True(t, os.IsNotExist(err), "expected expired backup to be removed")
+
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n"} {
+		_, err = rf.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, rf.Close())
+
+	content, err := os.ReadFile(filename)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "line 3\n", string(content))
+	}
+
+	backups, err := filepath.Glob(filepath.Join(dir, "valet-*.log"))
+	if assert.NoError(t, err) {
+		assert.Len(t, backups, 2)
+	}
+}
+
+func TestRotatingFileFailedRotation(t *testing.T) {
+	// A name that leaves no room for the timestamp of a rotated file
+	filename := filepath.Join(t.TempDir(), strings.Repeat("v", 240)+".log")
+
+	rf, err := NewRotatingFile(filename, 10, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = rf.Write([]byte("line 1\n"))
+	assert.NoError(t, err)
+	_, err = rf.Write([]byte("line 2\n"))
+	assert.Error(t, err, "expected rotation to fail")
+
+	// The current file remains open after the failure
+	_, err = rf.file.Write([]byte("line 3\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, rf.Close())
+
+	content, err := os.ReadFile(filename)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "line 1\nline 3\n", string(content))
+	}
+}
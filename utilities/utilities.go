@@ -101,6 +101,12 @@ func (err *combinedError) Errors() []error {
 	return make([]error, len(err.errors))
 }
 
+// Unwrap returns the combined errors, so that errors.Is and errors.As match
+// any of them.
+func (err *combinedError) Unwrap() []error {
+	return err.errors
+}
+
 // IsDescendantPath returns true if path is a descendant of root i.e. is
 // somehow contained within root, directly or indirectly. This is achieved by
 // lexical comparison; the neither root nor path are required to exist.
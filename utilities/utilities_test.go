@@ -60,6 +60,9 @@ func TestCombineErrors(t *testing.T) {
 		assert.Equal(t, &combinedError{[]error{err1, err2, err3}}, cerr4,
 			"multiple errors with nils were not combined correctly")
 	}
+
+	assert.True(t, errors.Is(cerr4, err2),
+		"combined errors did not match one of their errors")
 }
 
 func TestIsDescendantPath(t *testing.T) {
@@ -0,0 +1,142 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file acl.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	ex "github.com/wtsi-npg/extendo/v2"
+	logs "github.com/wtsi-npg/logshim"
+)
+
+// The iRODS access levels that may be granted.
+var aclLevels = map[string]bool{
+	"read":  true,
+	"write": true,
+	"own":   true,
+}
+
+// ParseACL parses an ACL of the form owner:level, where owner is an iRODS
+// group (or user), optionally qualified by its zone as owner#zone, and level is
+// one of the iRODS access levels read, write or own.
+func ParseACL(s string) (ex.ACL, error) {
+	owner, level, found := strings.Cut(s, ":")
+	if !found || owner == "" || level == "" {
+		return ex.ACL{}, errors.Errorf("invalid ACL '%s': expected "+
+			"owner:level", s)
+	}
+
+	if !aclLevels[level] {
+		return ex.ACL{}, errors.Errorf("invalid ACL '%s': unknown access "+
+			"level '%s'", s, level)
+	}
+
+	owner, zone, qualified := strings.Cut(owner, "#")
+	if owner == "" || (qualified && zone == "") ||
+		strings.Contains(zone, "#") {
+		return ex.ACL{}, errors.Errorf("invalid ACL '%s': expected "+
+			"owner or owner#zone", s)
+	}
+
+	return ex.ACL{Owner: owner, Level: level, Zone: zone}, nil
+}
+
+// ParseACLs parses each of the ACLs in acls (see ParseACL).
+func ParseACLs(acls []string) ([]ex.ACL, error) {
+	var parsed []ex.ACL
+	for _, s := range acls {
+		acl, err := ParseACL(s)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, acl)
+	}
+
+	return parsed, nil
+}
+
+// aclGranter adds ACLs to archived data objects and collections, and to their
+// parent collections, up to, but not including, the remote root collection.
+// Each parent collection is granted the ACLs once only, however many data
+// objects it contains.
+//
+// The methods of a nil *aclGranter do nothing, so that granting may be
+// disabled by using nil.
+type aclGranter struct {
+	remoteBase string
+	acls       []ex.ACL
+	granted    sync.Map // Collections already granted the ACLs
+}
+
+// newACLGranter returns an aclGranter for the data objects and collections
+// archived under remoteBase, or nil if acls is empty.
+func newACLGranter(remoteBase string, acls []ex.ACL) *aclGranter {
+	if len(acls) == 0 {
+		return nil
+	}
+
+	return &aclGranter{remoteBase: filepath.Clean(remoteBase), acls: acls}
+}
+
+// grantObject adds the ACLs to the data object dst and its parent
+// collections.
+func (g *aclGranter) grantObject(client *ex.Client, dst string) error {
+	if g == nil {
+		return nil
+	}
+
+	obj := ex.NewDataObject(client, dst)
+	if err := obj.AddACLs(g.acls); err != nil {
+		return errors.Wrapf(err, "failed to add ACLs to '%s'", dst)
+	}
+
+	return g.grantCollection(client, filepath.Dir(dst))
+}
+
+// grantCollection adds the ACLs to the collection coll and its parent
+// collections.
+func (g *aclGranter) grantCollection(client *ex.Client, coll string) error {
+	if g == nil {
+		return nil
+	}
+
+	log := logs.GetLogger()
+	base := g.remoteBase + "/"
+
+	for ; strings.HasPrefix(coll, base); coll = filepath.Dir(coll) {
+		if _, ok := g.granted.Load(coll); ok {
+			continue
+		}
+
+		c := ex.NewCollection(client, coll)
+		if err := c.AddACLs(g.acls); err != nil {
+			return errors.Wrapf(err, "failed to add ACLs to '%s'", coll)
+		}
+		g.granted.Store(coll, true)
+
+		log.Debug().Str("path", coll).Msg("added ACLs to collection")
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file acl_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ex "github.com/wtsi-npg/extendo/v2"
+)
+
+func TestParseACLs(t *testing.T) {
+	acls, err := ParseACLs([]string{"public:read", "ont#seq:own",
+		"ont_admin:write"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []ex.ACL{
+			{Owner: "public", Level: "read"},
+			{Owner: "ont", Level: "own", Zone: "seq"},
+			{Owner: "ont_admin", Level: "write"},
+		}, acls)
+	}
+
+	acls, err = ParseACLs(nil)
+	if assert.NoError(t, err) {
+		assert.Empty(t, acls)
+	}
+
+	for _, spec := range []string{"public", "public:", ":read",
+		"public:admin", "public#:read", "#seq:read", "ont#seq#x:read"} {
+		_, err = ParseACL(spec)
+		assert.Error(t, err, "expected an error for '%s'", spec)
+	}
+}
+
+func TestNewACLGranterNoACLs(t *testing.T) {
+	// No iRODS access is attempted when there are no ACLs to add
+	granter := newACLGranter("/zone1/x/y", nil)
+	assert.Nil(t, granter)
+	assert.NoError(t, granter.grantObject(nil, "/zone1/x/y/d/e/f.fast5"))
+	assert.NoError(t, granter.grantCollection(nil, "/zone1/x/y/d/e"))
+}
@@ -0,0 +1,330 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file audit.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	ex "github.com/wtsi-npg/extendo/v2"
+	logs "github.com/wtsi-npg/logshim"
+
+	"github.com/wtsi-npg/valet/utilities"
+)
+
+// AuditProblem describes a problem with the integrity of an archived data
+// object, found by AuditArchive.
+type AuditProblem string
+
+const (
+	// The data object has no checksum in the iRODS catalogue.
+	NoRemoteChecksum AuditProblem = "no-remote-checksum"
+	// The checksum is not of the format of the archive's checksum algorithm.
+	UnexpectedChecksumFormat AuditProblem = "unexpected-checksum-format"
+	// The data object has no checksum metadata (under the "md5" key).
+	MissingChecksumMetadata AuditProblem = "missing-checksum-metadata"
+	// The checksum metadata do not match the checksum, or are not MD5.
+	ChecksumMetadataMismatch AuditProblem = "checksum-metadata-mismatch"
+)
+
+// AuditResult is the result of auditing one archived data object.
+type AuditResult struct {
+	RemotePath   string         // The path of the data object
+	LocalPath    string         // The local path from which it was archived
+	LocalPresent bool           // True if the local path exists
+	Problems     []AuditProblem // Any problems found
+}
+
+// IsSuspect returns true if the archived data object has problems.
+func (r AuditResult) IsSuspect() bool {
+	return len(r.Problems) > 0
+}
+
+// IsUnsafeDeletion returns true if the local path is absent, although the
+// archived data object has problems i.e. the local file may have been deleted
+// without a sound archived copy.
+func (r AuditResult) IsUnsafeDeletion() bool {
+	return !r.LocalPresent && r.IsSuspect()
+}
+
+// String returns a description of the result suitable for a report.
+func (r AuditResult) String() string {
+	problems := make([]string, len(r.Problems))
+	for i, p := range r.Problems {
+		problems[i] = string(p)
+	}
+
+	local := "present"
+	if !r.LocalPresent {
+		local = "absent"
+	}
+
+	return fmt.Sprintf("%s local=%s problems=%s", r.RemotePath, local,
+		strings.Join(problems, ","))
+}
+
+// AuditSummary summarises an audit of an archive.
+type AuditSummary struct {
+	NumObjects uint64        // The number of data objects audited
+	NumErrors  uint64        // The number that could not be audited
+	Suspect    []AuditResult // The results for data objects with problems
+}
+
+// NumUnsafeDeletions returns the number of suspect data objects whose local
+// path is absent.
+func (s AuditSummary) NumUnsafeDeletions() uint64 {
+	var n uint64
+	for _, r := range s.Suspect {
+		if r.IsUnsafeDeletion() {
+			n++
+		}
+	}
+	return n
+}
+
+// AuditDataObject returns any problems with the integrity of a data object,
+// given its item listed with its checksum and AVUs. The checksum is expected
+// to be of the format of alg and to have checksum metadata, as data objects
+// archived by valet do. The checksum metadata are always MD5, so in an MD5
+// archive they are expected to match the checksum, while otherwise they are
+// only expected to be of the MD5 format.
+func AuditDataObject(item ex.RodsItem, alg ChecksumAlgorithm) []AuditProblem {
+	var problems []AuditProblem
+
+	if item.IChecksum == "" {
+		problems = append(problems, NoRemoteChecksum)
+	} else if !alg.HasRemoteFormat(item.IChecksum) {
+		problems = append(problems, UnexpectedChecksumFormat)
+	}
+
+	var hasMetadata, matches bool
+	for _, avu := range item.IAVUs {
+		if avu.Attr != ex.ChecksumAttr {
+			continue
+		}
+		hasMetadata = true
+
+		if alg.IsMD5() {
+			matches = matches || avu.Value == item.IChecksum
+		} else {
+			matches = matches || MD5Checksum.HasRemoteFormat(avu.Value)
+		}
+	}
+
+	switch {
+	case !hasMetadata:
+		problems = append(problems, MissingChecksumMetadata)
+	case !matches && item.IChecksum != "":
+		problems = append(problems, ChecksumMetadataMismatch)
+	}
+
+	return problems
+}
+
+// untranslatePath returns the local path under lBase from which the data
+// object at remotePath under rBase was archived. It is the inverse of
+// translatePath.
+func untranslatePath(lBase string, rBase string,
+	remotePath string) (string, error) {
+	ok, err := utilities.IsDescendantPath(rBase, remotePath)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", errors.Errorf("refusing to translate '%s', which is "+
+			"outside the archive root '%s'", remotePath, rBase)
+	}
+
+	rel, err := filepath.Rel(rBase, remotePath)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(lBase, rel), nil
+}
+
+// isLocallyPresent returns true if localPath exists. A bundle, whose local
+// path is its directory without the tar suffix, is also present if that
+// directory exists.
+func isLocallyPresent(localPath string) (bool, error) {
+	paths := []string{localPath}
+	if dir, ok := strings.CutSuffix(localPath, "."+TarSuffix); ok {
+		paths = append(paths, dir)
+	}
+
+	for _, p := range paths {
+		_, err := os.Lstat(p)
+		if err == nil {
+			return true, nil
+		}
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// AuditArchive lists every data object in the archive under remoteBase and
+// checks the integrity of its checksum and checksum metadata (see
+// AuditDataObject), independently of whether the local file from which it was
+// archived, under localBase, is still present. Whether it is present is
+// recorded, so that data objects with problems whose local files have been
+// deleted may be identified. Up to maxProc data objects are audited
+// concurrently and the suspect results are sorted by remote path.
+//
+// The audit is read-only. A data object that cannot be audited is logged and
+// counted as an error, rather than stopping the audit.
+func AuditArchive(ctx context.Context, localBase string, remoteBase string,
+	cPool *ex.ClientPool, alg ChecksumAlgorithm,
+	maxProc int) (summary AuditSummary, err error) { // NRV
+	log := logs.GetLogger()
+
+	var items []ex.RodsItem
+	items, err = listDataObjects(cPool, remoteBase)
+	if err != nil {
+		return summary, err
+	}
+
+	var mu sync.Mutex
+	forEachDataObject(ctx, items, maxProc, func(item ex.RodsItem) {
+		result, aerr := auditItem(cPool, localBase, remoteBase, item, alg)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		summary.NumObjects++
+		if aerr != nil {
+			summary.NumErrors++
+			log.Error().Err(aerr).Str("path", item.RodsPath()).
+				Msg("failed to audit")
+		} else if result.IsSuspect() {
+			summary.Suspect = append(summary.Suspect, result)
+		}
+	})
+
+	sort.Slice(summary.Suspect, func(i, j int) bool {
+		return summary.Suspect[i].RemotePath < summary.Suspect[j].RemotePath
+	})
+
+	return summary, ctx.Err()
+}
+
+// forEachDataObject calls fn on each of items, using up to maxProc goroutines,
+// and returns when fn has returned for each of them. If ctx is cancelled, no
+// further items are passed to fn.
+func forEachDataObject(ctx context.Context, items []ex.RodsItem, maxProc int,
+	fn func(item ex.RodsItem)) {
+	if maxProc < 1 {
+		maxProc = 1
+	}
+
+	var wg sync.WaitGroup
+
+	work := make(chan ex.RodsItem)
+	for i := 0; i < maxProc; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for item := range work {
+				fn(item)
+			}
+		}()
+	}
+
+send:
+	for _, item := range items {
+		select {
+		case work <- item:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(work)
+	wg.Wait()
+}
+
+// listDataObjects returns all the data objects in the collection remoteBase
+// and its descendants.
+func listDataObjects(cPool *ex.ClientPool,
+	remoteBase string) (objs []ex.RodsItem, err error) { // NRV
+	var client *ex.Client
+	if client, err = getClient(cPool); err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = returnClient(cPool, client, err)
+	}()
+
+	coll := ex.NewCollection(client, filepath.Clean(remoteBase))
+
+	var items []ex.RodsItem
+	if items, err = coll.FetchContentsRecurse(); err != nil {
+		return nil, errors.Wrapf(err, "failed to list '%s'", remoteBase)
+	}
+
+	for _, item := range items {
+		if item.IsDataObject() {
+			objs = append(objs, item)
+		}
+	}
+
+	return objs, nil
+}
+
+// auditItem audits the data object item.
+func auditItem(cPool *ex.ClientPool, localBase string, remoteBase string,
+	item ex.RodsItem, alg ChecksumAlgorithm) (result AuditResult, err error) { // NRV
+	result.RemotePath = item.RodsPath()
+
+	if result.LocalPath, err = untranslatePath(localBase, remoteBase,
+		result.RemotePath); err != nil {
+		return result, err
+	}
+	if result.LocalPresent, err = isLocallyPresent(result.LocalPath); err != nil {
+		return result, err
+	}
+
+	var client *ex.Client
+	if client, err = getClient(cPool); err != nil {
+		return result, err
+	}
+	defer func() {
+		err = returnClient(cPool, client, err)
+	}()
+
+	var listed ex.RodsItem
+	if listed, err = client.ListItem(ex.Args{AVU: true, Checksum: true},
+		item); err != nil {
+		return result, err
+	}
+
+	result.Problems = AuditDataObject(listed, alg)
+
+	return result, nil
+}
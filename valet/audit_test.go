@@ -0,0 +1,145 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file audit_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ex "github.com/wtsi-npg/extendo/v2"
+)
+
+func TestAuditDataObject(t *testing.T) {
+	md5 := "1181c1834012245d785120e3505ed169"
+	other := "348bd3ce10ec00ecc29d31ec97cd5839"
+	sha256 := "sha2:Tv1hPRcdvmRZZC/lEQMmFLkLUnQDmlBOvyL/6DHzrm4="
+
+	for name, tc := range map[string]struct {
+		item     ex.RodsItem
+		alg      ChecksumAlgorithm
+		expected []AuditProblem
+	}{
+		"sound": {
+			item: ex.RodsItem{IChecksum: md5,
+				IAVUs: []ex.AVU{{Attr: ex.ChecksumAttr, Value: md5}}},
+			alg: MD5Checksum,
+		},
+		"sound sha256": {
+			item: ex.RodsItem{IChecksum: sha256,
+				IAVUs: []ex.AVU{{Attr: ex.ChecksumAttr, Value: md5}}},
+			alg: SHA256Checksum,
+		},
+		"mismatched metadata sha256": {
+			item: ex.RodsItem{IChecksum: sha256,
+				IAVUs: []ex.AVU{{Attr: ex.ChecksumAttr, Value: sha256}}},
+			alg:      SHA256Checksum,
+			expected: []AuditProblem{ChecksumMetadataMismatch},
+		},
+		"no checksum": {
+			item: ex.RodsItem{
+				IAVUs: []ex.AVU{{Attr: ex.ChecksumAttr, Value: md5}}},
+			alg:      MD5Checksum,
+			expected: []AuditProblem{NoRemoteChecksum},
+		},
+		"unexpected format": {
+			item: ex.RodsItem{IChecksum: md5,
+				IAVUs: []ex.AVU{{Attr: ex.ChecksumAttr, Value: md5}}},
+			alg:      SHA256Checksum,
+			expected: []AuditProblem{UnexpectedChecksumFormat},
+		},
+		"no metadata": {
+			item: ex.RodsItem{IChecksum: md5,
+				IAVUs: []ex.AVU{{Attr: "experiment_name", Value: "66"}}},
+			alg:      MD5Checksum,
+			expected: []AuditProblem{MissingChecksumMetadata},
+		},
+		"mismatched metadata": {
+			item: ex.RodsItem{IChecksum: md5,
+				IAVUs: []ex.AVU{{Attr: ex.ChecksumAttr, Value: other}}},
+			alg:      MD5Checksum,
+			expected: []AuditProblem{ChecksumMetadataMismatch},
+		},
+		"no checksum or metadata": {
+			item: ex.RodsItem{},
+			alg:  MD5Checksum,
+			expected: []AuditProblem{NoRemoteChecksum,
+				MissingChecksumMetadata},
+		},
+	} {
+		assert.Equal(t, tc.expected, AuditDataObject(tc.item, tc.alg),
+			"for %s", name)
+	}
+}
+
+func TestUntranslatePath(t *testing.T) {
+	local, err := untranslatePath("/data", "/archive/gxb02004",
+		"/archive/gxb02004/66/DN585561I_A1/reads.fastq.gz")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/data/66/DN585561I_A1/reads.fastq.gz", local)
+	}
+
+	_, err = untranslatePath("/data", "/archive/gxb02004",
+		"/archive/other/reads.fastq.gz")
+	assert.Error(t, err, "expected an error for a path outside the root")
+}
+
+func TestIsLocallyPresent(t *testing.T) {
+	root := t.TempDir()
+
+	file := filepath.Join(root, "reads.fastq.gz")
+	if !assert.NoError(t, os.WriteFile(file, []byte("reads"), 0644)) {
+		return
+	}
+	dir := filepath.Join(root, "fast5_skip")
+	if !assert.NoError(t, os.Mkdir(dir, 0755)) {
+		return
+	}
+
+	for path, expected := range map[string]bool{
+		file:                                true,
+		filepath.Join(root, "absent.fastq"): false,
+		dir + "." + TarSuffix:               true,
+		filepath.Join(root, "absent.tar"):   false,
+	} {
+		ok, err := isLocallyPresent(path)
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, ok, "for %s", path)
+		}
+	}
+}
+
+func TestAuditSummaryNumUnsafeDeletions(t *testing.T) {
+	summary := AuditSummary{
+		NumObjects: 3,
+		Suspect: []AuditResult{
+			{RemotePath: "/archive/a", LocalPresent: true,
+				Problems: []AuditProblem{MissingChecksumMetadata}},
+			{RemotePath: "/archive/b", LocalPresent: false,
+				Problems: []AuditProblem{ChecksumMetadataMismatch}},
+		},
+	}
+
+	assert.Equal(t, uint64(1), summary.NumUnsafeDeletions())
+	assert.Equal(t, "/archive/b local=absent "+
+		"problems=checksum-metadata-mismatch", summary.Suspect[1].String())
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file buffer.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"io"
+	"sync"
+)
+
+// copyBufferSize is the size of the buffers in copyBuffers.
+const copyBufferSize = 64 * 1024
+
+// copyBuffers holds the buffers used to copy file content e.g. to calculate
+// checksums or to compress, shared by all workers so that a buffer is not
+// allocated for each file.
+var copyBuffers = sync.Pool{
+	New: func() any {
+		buf := make([]byte, copyBufferSize)
+		return &buf
+	},
+}
+
+// copyBuffered copies from src to dst as io.Copy does, using a buffer from
+// copyBuffers. Any io.WriterTo implemented by src is not used, because that of
+// *os.File allocates a buffer for each copy to a destination that is not a
+// file or socket e.g. a hash.
+func copyBuffered(dst io.Writer, src io.Reader) (int64, error) {
+	buf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buf)
+
+	return io.CopyBuffer(dst, struct{ io.Reader }{src}, *buf)
+}
@@ -0,0 +1,724 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file bundle.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	ex "github.com/wtsi-npg/extendo/v2"
+	logs "github.com/wtsi-npg/logshim"
+
+	"github.com/wtsi-npg/valet/utilities"
+)
+
+// TarSuffix is the suffix of bundle data objects.
+const TarSuffix string = "tar"
+
+// BundleManifestName is the name of the manifest within a bundle. The manifest
+// lists the MD5 checksum of each bundled file, in the format used by md5sum.
+const BundleManifestName = "manifest.md5"
+
+const DefaultBundleMinFiles = 1000
+const DefaultBundleMaxSize int64 = 10 * 1024 * 1024 * 1024
+const DefaultBundleSettleDelay = time.Hour
+
+const bundleManifestAttr = "manifest_md5"
+const bundleNumFilesAttr = "num_files"
+
+// BundleParams describe which directories are archived as a single tar
+// object (a bundle), rather than as one data object per file. A directory is
+// bundled if:
+//
+// 1. It matches one of Patterns (see MakeGlobPruneFunc for the syntax).
+//
+// 2. It contains no directories.
+//
+// 3. It has not been modified for at least SettleDelay.
+//
+// 4. It contains at least MinFiles files to be archived, whose total size
+// is no more than MaxSize.
+//
+// If a directory matches one of Patterns, its files are not archived
+// individually until it has settled. If it then does not meet the other
+// criteria, its files are archived individually, as normal.
+type BundleParams struct {
+	Patterns    []string      // Glob patterns of directories to bundle
+	MinFiles    int           // The minimum number of files in a bundle
+	MaxSize     int64         // The maximum total size of files in a bundle
+	SettleDelay time.Duration // The time without modification before bundling
+}
+
+// IsEnabled returns true if the parameters describe any directories to bundle.
+func (params BundleParams) IsEnabled() bool {
+	return len(params.Patterns) > 0
+}
+
+// bundleDirSummary describes the files to be archived in a directory.
+type bundleDirSummary struct {
+	modTime         time.Time  // The modification time of the directory
+	hasDirs         bool       // True if the directory contains directories
+	hasUncompressed bool       // True if any file requires compression
+	files           []FilePath // The files to be archived
+	numBytes        int64      // The total size of the files
+}
+
+// bundleDirCache caches directory summaries, keyed by directory path, so that
+// a directory need not be re-read for every file within it. A summary is
+// valid while the directory modification time is unchanged.
+type bundleDirCache struct {
+	sync.Mutex
+	sel       Selection // Selects the files to be archived
+	summaries map[string]bundleDirSummary
+}
+
+func (cache *bundleDirCache) summarise(dir FilePath) (bundleDirSummary, error) {
+	cache.Lock()
+	summary, ok := cache.summaries[dir.Location]
+	cache.Unlock()
+
+	if ok && summary.modTime.Equal(dir.Info.ModTime()) {
+		return summary, nil
+	}
+
+	summary, err := summariseBundleDir(dir, cache.sel)
+	if err != nil {
+		return summary, err
+	}
+
+	cache.Lock()
+	cache.summaries[dir.Location] = summary
+	cache.Unlock()
+
+	return summary, nil
+}
+
+// MakeIsBundleDir returns a predicate that returns true if its argument is a
+// directory matching one of the bundling patterns in params.
+func MakeIsBundleDir(params BundleParams) (FilePredicate, error) {
+	match, err := MakeGlobPruneFunc(params.Patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	return And(IsDir, func(path FilePath) (bool, error) {
+		ok, _ := match(path) // Ignore the SkipDir error used for pruning
+		return ok, nil
+	}), nil
+}
+
+// MakeRequiresBundling returns a predicate that returns true if its argument is
+// a directory to be bundled, according to params, where the files to be
+// archived are selected by sel. In addition to the criteria described by
+// BundleParams, every file to be bundled must have a valid checksum file and
+// no file in the directory may require compression.
+func MakeRequiresBundling(params BundleParams,
+	sel Selection) (FilePredicate, error) {
+	isBundleDir, err := MakeIsBundleDir(params)
+	if err != nil {
+		return nil, err
+	}
+	sel = sel.OrBuiltIn()
+
+	return And(isBundleDir, MakeIsOlderThan(params.SettleDelay),
+		func(dir FilePath) (bool, error) {
+			summary, serr := summariseBundleDir(dir, sel)
+			if serr != nil {
+				return false, serr
+			}
+			if !summary.meets(params) || summary.hasUncompressed {
+				return false, nil
+			}
+
+			cf := sel.checksums
+			for _, fp := range summary.files {
+				ok, perr := And(cf.HasChecksumFile,
+					Not(cf.HasStaleChecksumFile))(fp)
+				if perr != nil || !ok {
+					return false, perr
+				}
+			}
+
+			return true, nil
+		}), nil
+}
+
+// MakeIsInBundleDir returns a predicate that returns true if its argument is
+// a file whose directory is, or may become, a bundle according to params,
+// where the files to be archived are selected by sel. Such files are not
+// archived individually.
+func MakeIsInBundleDir(params BundleParams,
+	sel Selection) (FilePredicate, error) {
+	isBundleDir, err := MakeIsBundleDir(params)
+	if err != nil {
+		return nil, err
+	}
+
+	isSettled := MakeIsOlderThan(params.SettleDelay)
+	cache := &bundleDirCache{sel: sel.OrBuiltIn(),
+		summaries: make(map[string]bundleDirSummary)}
+
+	return func(path FilePath) (bool, error) {
+		if path.Info.IsDir() {
+			return false, nil
+		}
+
+		dir, derr := NewFilePath(filepath.Dir(path.Location))
+		if derr != nil {
+			return false, derr
+		}
+
+		ok, perr := isBundleDir(dir)
+		if perr != nil || !ok {
+			return false, perr
+		}
+
+		// Until the directory settles, we can't tell whether it will be
+		// bundled
+		ok, perr = isSettled(dir)
+		if perr != nil || !ok {
+			return true, perr
+		}
+
+		summary, serr := cache.summarise(dir)
+		if serr != nil {
+			return false, serr
+		}
+
+		return summary.meets(params), nil
+	}, nil
+}
+
+// MakeIsBundleArchived returns a predicate that returns true if its argument
+// is a directory whose bundle is present in the archive, with a valid checksum
+// and a manifest matching the current contents of the directory, of the files
+// selected by sel. The archive is expected to use checksum algorithm alg.
+func MakeIsBundleArchived(localBase string, remoteBase string,
+	cPool *ex.ClientPool, alg ChecksumAlgorithm, sel Selection) FilePredicate {
+	sel = sel.OrBuiltIn()
+
+	return func(dir FilePath) (ok bool, err error) { // NRV
+		defer func() {
+			if err != nil {
+				err = errors.Wrap(err, "IsBundleArchived")
+			}
+		}()
+
+		var dest string
+		if dest, err = bundlePath(localBase, remoteBase, dir); err != nil {
+			return
+		}
+
+		var summary bundleDirSummary
+		if summary, err = summariseBundleDir(dir, sel); err != nil {
+			return
+		}
+
+		var manifest []byte
+		if manifest, err = MakeBundleManifest(dir, summary.files,
+			sel.checksums); err != nil {
+			return false, nil // Checksum files are not ready yet
+		}
+
+		return isArchivedBundle(cPool, dest, manifest, alg)
+	}
+}
+
+// isArchivedBundle returns true if the bundle at dest is present in the
+// archive, with a valid checksum and manifest.
+func isArchivedBundle(cPool *ex.ClientPool, dest string, manifest []byte,
+	alg ChecksumAlgorithm) (ok bool, err error) { // NRV
+	var client *ex.Client
+	if client, err = getClient(cPool); err != nil {
+		return
+	}
+	defer func() {
+		err = returnClient(cPool, client, err)
+	}()
+
+	obj := ex.NewDataObject(client, dest)
+	if ok, err = obj.Exists(); err != nil || !ok {
+		return
+	}
+
+	return hasValidBundleMetadata(obj, manifest, alg)
+}
+
+// MakeTarArchiver returns a WorkFunc that archives a directory as a single tar
+// data object (a bundle). The data object path is determined as described for
+// MakeCopier, with the suffix ".tar" added. The bundle contains the files to be
+// archived within the directory, as selected by sel, and a manifest of their
+// checksums, named BundleManifestName.
+//
+// The bundle is written to TMPDIR before being copied to iRODS. An existing
+// bundle is never replaced by one with a different manifest because its files
+// may already have been removed locally; this is reported as an error.
+//
+// The checksum calculated by iRODS is verified against that of the bundle,
+// calculated using the archive's checksum algorithm alg. Any additional
+// metadata meta and ACLs acls are added to the bundle, as described for
+// MakeCopier. Each bundle archived successfully is counted in stats, if not
+// nil. If opts.InheritNewCollections is true, the collections created have
+// inheritance enabled.
+//
+// WorkFunc prerequisites: CreateOrUpdateMD5ChecksumFile for each bundled file.
+func MakeTarArchiver(localBase string, remoteBase string,
+	cPool *ex.ClientPool, alg ChecksumAlgorithm, meta []ex.AVU,
+	acls []ex.ACL, stats *ArchiveStats, opts CopyOptions,
+	sel Selection) WorkFunc {
+	granter := newACLGranter(remoteBase, acls)
+	sel = sel.OrBuiltIn()
+
+	return func(dir FilePath) (err error) { // NRV
+		defer func() {
+			if err != nil {
+				err = errors.Wrap(err, "TarArchiver")
+			}
+		}()
+
+		var dst string
+		if dst, err = bundlePath(localBase, remoteBase, dir); err != nil {
+			return
+		}
+
+		var summary bundleDirSummary
+		if summary, err = summariseBundleDir(dir, sel); err != nil {
+			return
+		}
+
+		var tmp *os.File
+		if tmp, err = createTempFile(); err != nil {
+			return
+		}
+		defer func() {
+			if rerr := os.Remove(tmp.Name()); !os.IsNotExist(rerr) {
+				err = utilities.CombineErrors(err, rerr)
+			}
+		}()
+
+		h := md5.New()
+		writers := []io.Writer{h, tmp}
+
+		rh, remoteSum, herr := alg.NewRemoteHash()
+		if herr != nil {
+			return herr
+		}
+		if rh != nil {
+			writers = append(writers, rh)
+		}
+
+		var manifest []byte
+		manifest, err = WriteBundle(io.MultiWriter(writers...), dir,
+			summary.files, sel.checksums)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return
+		}
+		chk := fmt.Sprintf("%x", h.Sum(nil))
+		expected := chk
+		if remoteSum != nil {
+			expected = remoteSum()
+		}
+
+		log := logs.GetLogger()
+		log.Debug().Str("path", dir.Location).Str("to", dst).
+			Int("num_files", len(summary.files)).
+			Str("checksum", chk).Msg("archiving bundle")
+
+		var client *ex.Client
+		if client, err = getClient(cPool); err != nil {
+			return
+		}
+		defer func() {
+			err = returnClient(cPool, client, err)
+		}()
+
+		obj := ex.NewDataObject(client, dst)
+		var exists bool
+		if exists, err = obj.Exists(); err != nil {
+			return
+		}
+		if exists {
+			var valid bool
+			if valid, err = hasValidBundleMetadata(obj, manifest,
+				alg); err != nil {
+				return
+			}
+			if !valid {
+				return errors.Errorf("refusing to replace bundle '%s' with "+
+					"different contents from '%s'", dst, dir.Location)
+			}
+		}
+
+		if err = ensureCollection(client, filepath.Dir(dst),
+			opts.InheritNewCollections); err != nil {
+			return
+		}
+
+		avus := append(ex.MakeCreationMetadata(chk),
+			ex.AVU{Attr: bundleManifestAttr,
+				Value: fmt.Sprintf("%x", md5.Sum(manifest))}.
+				WithNamespace(ValetNamespace),
+			ex.AVU{Attr: bundleNumFilesAttr,
+				Value: strconv.Itoa(len(summary.files))}.
+				WithNamespace(ValetNamespace))
+
+		if _, err = ex.ArchiveDataObject(client, tmp.Name(), dst, expected,
+			avus, meta); err != nil {
+			return
+		}
+
+		if err = granter.grantObject(client, dst); err != nil {
+			return
+		}
+
+		var size int64
+		if info, serr := os.Stat(tmp.Name()); serr == nil {
+			size = info.Size()
+		}
+		stats.Add(size)
+
+		log.Info().Str("path", dir.Location).Str("to", dst).
+			Int("num_files", len(summary.files)).
+			Int64("size", size).
+			Str("checksum", chk).Msg("archived bundle")
+		return
+	}
+}
+
+// MakeBundledFileRemover returns a WorkFunc that removes the files in a
+// directory that are archived in its bundle, together with their checksum
+// files. The manifest of the directory's current contents must be that of the
+// archived bundle, which is verified as for MakeIsBundleArchived, otherwise
+// nothing is removed and an error is returned. Only the files listed in the
+// manifest are removed, each only once its MD5 checksum has been calculated
+// again and found to match the manifest. The files of the manifest are those
+// selected by sel.
+func MakeBundledFileRemover(localBase string, remoteBase string,
+	cPool *ex.ClientPool, alg ChecksumAlgorithm, sel Selection) WorkFunc {
+	sel = sel.OrBuiltIn()
+
+	return func(dir FilePath) (err error) { // NRV
+		defer func() {
+			if err != nil {
+				err = errors.Wrap(err, "BundledFileRemover")
+			}
+		}()
+
+		var dest string
+		if dest, err = bundlePath(localBase, remoteBase, dir); err != nil {
+			return
+		}
+
+		var summary bundleDirSummary
+		if summary, err = summariseBundleDir(dir, sel); err != nil {
+			return
+		}
+
+		var manifest []byte
+		if manifest, err = MakeBundleManifest(dir, summary.files,
+			sel.checksums); err != nil {
+			return
+		}
+
+		var valid bool
+		if valid, err = isArchivedBundle(cPool, dest, manifest,
+			alg); err != nil {
+			return
+		}
+		if !valid {
+			return errors.Errorf("refusing to remove the files of '%s' "+
+				"because they differ from those archived in '%s'",
+				dir.Location, dest)
+		}
+
+		var entries []bundleManifestEntry
+		if entries, err = parseBundleManifest(dir, manifest); err != nil {
+			return
+		}
+
+		log := logs.GetLogger()
+		for _, entry := range entries {
+			var fp FilePath
+			if fp, err = NewFilePath(entry.path); err != nil {
+				if os.IsNotExist(err) {
+					log.Warn().Str("path", entry.path).
+						Msg("had gone before deletion")
+					err = nil
+					continue
+				}
+				return
+			}
+
+			var md5sum []byte
+			if md5sum, err = CalculateFileMD5(fp); err != nil {
+				return
+			}
+			if checksum := fmt.Sprintf("%x", md5sum); checksum != entry.checksum {
+				return errors.Errorf("refusing to remove '%s' because its "+
+					"checksum '%s' differs from '%s' in the manifest of '%s'",
+					fp.Location, checksum, entry.checksum, dest)
+			}
+
+			if err = RemoveFile(fp); err != nil {
+				return
+			}
+			if err = sel.checksums.RemoveMD5ChecksumFile(fp); err != nil {
+				return
+			}
+		}
+
+		return
+	}
+}
+
+// bundleManifestEntry is a file listed in a bundle manifest.
+type bundleManifestEntry struct {
+	path     string // The local path of the file
+	checksum string // The MD5 checksum of the file
+}
+
+// parseBundleManifest returns the entries of a manifest made for directory dir
+// (see MakeBundleManifest).
+func parseBundleManifest(dir FilePath,
+	manifest []byte) ([]bundleManifestEntry, error) {
+	base := filepath.Dir(dir.Location)
+
+	var entries []bundleManifestEntry
+	for _, line := range strings.Split(string(manifest), "\n") {
+		if line == "" {
+			continue
+		}
+
+		checksum, name, ok := strings.Cut(line, "  ")
+		if !ok || checksum == "" || name == "" {
+			return nil, errors.Errorf("invalid line in the manifest of "+
+				"'%s': '%s'", dir.Location, line)
+		}
+
+		path := filepath.Join(base, name)
+		if filepath.Dir(path) != dir.Location {
+			return nil, errors.Errorf("manifest of '%s' lists '%s', which "+
+				"is not in the directory", dir.Location, name)
+		}
+
+		entries = append(entries, bundleManifestEntry{
+			path:     path,
+			checksum: checksum,
+		})
+	}
+
+	return entries, nil
+}
+
+// MakeBundleManifest returns a manifest of the MD5 checksums of files, in the
+// format used by md5sum, with file names relative to the parent of dir. The
+// checksums are read from the files' checksum files, named as described by cf,
+// which must be present.
+func MakeBundleManifest(dir FilePath, files []FilePath,
+	cf ChecksumFiles) ([]byte, error) {
+	base := filepath.Dir(dir.Location)
+
+	var buf bytes.Buffer
+	for _, fp := range files {
+		chkFile, err := NewFilePathNoStat(cf.ChecksumFilename(fp))
+		if err != nil {
+			return nil, err
+		}
+		checksum, err := ReadMD5ChecksumFile(chkFile)
+		if err != nil {
+			return nil, err
+		}
+
+		name, err := fp.RelativeTo(base)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(fmt.Sprintf("%s  %s\n", checksum, name))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// WriteBundle writes a tar archive of files in directory dir to w. The files'
+// names in the archive are relative to the parent of dir. The first entry in
+// the archive is a manifest (see MakeBundleManifest), made from the checksum
+// files named as described by cf, which is returned.
+func WriteBundle(w io.Writer, dir FilePath, files []FilePath,
+	cf ChecksumFiles) (manifest []byte, err error) { // NRV
+	if manifest, err = MakeBundleManifest(dir, files, cf); err != nil {
+		return
+	}
+
+	tw := tar.NewWriter(w)
+	defer func() {
+		err = utilities.CombineErrors(err, tw.Close())
+	}()
+
+	name := filepath.Join(filepath.Base(dir.Location), BundleManifestName)
+	if err = tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(manifest)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return
+	}
+	if _, err = tw.Write(manifest); err != nil {
+		return
+	}
+
+	base := filepath.Dir(dir.Location)
+	for _, fp := range files {
+		if err = writeTarEntry(tw, base, fp); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func writeTarEntry(tw *tar.Writer, base string, fp FilePath) (err error) { // NRV
+	var hdr *tar.Header
+	if hdr, err = tar.FileInfoHeader(fp.Info, ""); err != nil {
+		return
+	}
+	if hdr.Name, err = fp.RelativeTo(base); err != nil {
+		return
+	}
+
+	var f *os.File
+	if f, err = os.Open(fp.Location); err != nil {
+		return
+	}
+	defer func() {
+		err = utilities.CombineErrors(err, f.Close())
+	}()
+
+	if err = tw.WriteHeader(hdr); err != nil {
+		return
+	}
+	_, err = io.Copy(tw, f)
+
+	return
+}
+
+func (summary bundleDirSummary) meets(params BundleParams) bool {
+	return !summary.hasDirs &&
+		len(summary.files) >= params.MinFiles &&
+		summary.numBytes <= params.MaxSize
+}
+
+// summariseBundleDir returns a summary of the files to be archived in dir, as
+// selected by sel, sorted by path.
+func summariseBundleDir(dir FilePath, sel Selection) (bundleDirSummary, error) {
+	summary := bundleDirSummary{modTime: dir.Info.ModTime()}
+
+	entries, err := os.ReadDir(dir.Location)
+	if err != nil {
+		return summary, err
+	}
+
+	requiresCopying := And(IsRegular, sel.RequiresCopying)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			summary.hasDirs = true
+			continue
+		}
+
+		fp, ferr := NewFilePath(filepath.Join(dir.Location, entry.Name()))
+		if ferr != nil {
+			if os.IsNotExist(ferr) {
+				continue
+			}
+			return summary, ferr
+		}
+
+		ok, perr := requiresCopying(fp)
+		if perr != nil {
+			return summary, perr
+		}
+		if ok {
+			summary.files = append(summary.files, fp)
+			summary.numBytes += fp.Info.Size()
+			continue
+		}
+
+		ok, perr = sel.RequiresCompression(fp)
+		if perr != nil {
+			return summary, perr
+		}
+		if ok {
+			summary.hasUncompressed = true
+		}
+	}
+
+	SortFilePaths(summary.files)
+
+	return summary, nil
+}
+
+func hasValidBundleMetadata(obj *ex.DataObject, manifest []byte,
+	alg ChecksumAlgorithm) (bool, error) {
+	checksum, err := obj.FetchChecksum()
+	if err != nil || checksum == "" {
+		return false, err
+	}
+
+	// The bundle is not kept locally, so a remote checksum made with an
+	// algorithm other than MD5 cannot be compared with the MD5 checksum
+	// metadata. It was verified on upload, so check only its form.
+	if alg.IsMD5() {
+		ok, err := obj.HasValidChecksumMetadata(checksum)
+		if err != nil || !ok {
+			return false, err
+		}
+	} else if !alg.HasRemoteFormat(checksum) {
+		return false, nil
+	}
+
+	avu := ex.AVU{Attr: bundleManifestAttr,
+		Value: fmt.Sprintf("%x", md5.Sum(manifest))}.
+		WithNamespace(ValetNamespace)
+
+	return obj.HasMetadatum(avu), nil
+}
+
+func bundlePath(localBase string, remoteBase string,
+	dir FilePath) (string, error) {
+	dest, err := translatePath(localBase, remoteBase, dir)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s.%s", dest, TarSuffix), nil
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file bundle_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wtsi-npg/valet/utilities"
+)
+
+// makeBundleDir creates a directory fast5_pass under a new temporary directory,
+// containing copies of the test fast5 files and their checksum files.
+func makeBundleDir(t *testing.T) (string, FilePath) {
+	tmpDir, err := os.MkdirTemp("", "TestBundle")
+	assert.NoError(t, err)
+
+	dir := filepath.Join(tmpDir, "fast5_pass")
+	assert.NoError(t, os.Mkdir(dir, 0700))
+
+	for _, name := range []string{"reads1.fast5", "reads2.fast5", "reads3.fast5"} {
+		dst := filepath.Join(dir, name)
+		err = utilities.CopyFile(
+			filepath.Join("./testdata/valet/1/reads/fast5", name), dst, 0600)
+		assert.NoError(t, err)
+
+		fp, _ := NewFilePath(dst)
+		assert.NoError(t, defaultChecksums.CreateMD5ChecksumFile(fp))
+	}
+
+	fp, err := NewFilePath(dir)
+	assert.NoError(t, err)
+
+	return tmpDir, fp
+}
+
+func TestWriteBundle(t *testing.T) {
+	tmpDir, dir := makeBundleDir(t)
+	defer os.RemoveAll(tmpDir)
+
+	summary, err := summariseBundleDir(dir, builtIn)
+	if assert.NoError(t, err) {
+		assert.Len(t, summary.files, 3)
+		assert.False(t, summary.hasDirs)
+	}
+
+	var buf bytes.Buffer
+	manifest, err := WriteBundle(&buf, dir, summary.files, defaultChecksums)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var names []string
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, terr := tr.Next()
+		if terr == io.EOF {
+			break
+		}
+		if !assert.NoError(t, terr) {
+			return
+		}
+		names = append(names, hdr.Name)
+
+		if hdr.Name == "fast5_pass/"+BundleManifestName {
+			content, rerr := io.ReadAll(tr)
+			if assert.NoError(t, rerr) {
+				assert.Equal(t, manifest, content)
+			}
+		}
+	}
+
+	assert.Equal(t, []string{
+		"fast5_pass/" + BundleManifestName,
+		"fast5_pass/reads1.fast5",
+		"fast5_pass/reads2.fast5",
+		"fast5_pass/reads3.fast5"}, names)
+
+	expected := fmt.Sprintf("%s  %s\n",
+		"1181c1834012245d785120e3505ed169", "fast5_pass/reads1.fast5")
+	assert.Contains(t, string(manifest), expected)
+}
+
+func TestRequiresBundling(t *testing.T) {
+	tmpDir, dir := makeBundleDir(t)
+	defer os.RemoveAll(tmpDir)
+
+	params := BundleParams{
+		Patterns:    []string{"**/fast5_pass"},
+		MinFiles:    3,
+		MaxSize:     DefaultBundleMaxSize,
+		SettleDelay: 0,
+	}
+
+	requiresBundling, err := MakeRequiresBundling(params, Selection{})
+	if assert.NoError(t, err) {
+		ok, perr := requiresBundling(dir)
+		if assert.NoError(t, perr) {
+			assert.True(t, ok, "expected directory to require bundling")
+		}
+	}
+
+	file, _ := NewFilePath(filepath.Join(dir.Location, "reads1.fast5"))
+	isInBundleDir, err := MakeIsInBundleDir(params, Selection{})
+	if assert.NoError(t, err) {
+		ok, perr := isInBundleDir(file)
+		if assert.NoError(t, perr) {
+			assert.True(t, ok, "expected file to be in a bundle directory")
+		}
+	}
+
+	params.MinFiles = 4
+	requiresBundling, err = MakeRequiresBundling(params, Selection{})
+	if assert.NoError(t, err) {
+		ok, perr := requiresBundling(dir)
+		if assert.NoError(t, perr) {
+			assert.False(t, ok, "expected too few files to bundle")
+		}
+	}
+
+	isInBundleDir, err = MakeIsInBundleDir(params, Selection{})
+	if assert.NoError(t, err) {
+		ok, perr := isInBundleDir(file)
+		if assert.NoError(t, perr) {
+			assert.False(t, ok, "expected file to be archived individually")
+		}
+	}
+
+	params.MinFiles = 3
+	params.Patterns = []string{"**/fast5_fail"}
+	requiresBundling, err = MakeRequiresBundling(params, Selection{})
+	if assert.NoError(t, err) {
+		ok, perr := requiresBundling(dir)
+		if assert.NoError(t, perr) {
+			assert.False(t, ok, "expected non-matching directory not to bundle")
+		}
+	}
+}
+
+func TestParseBundleManifest(t *testing.T) {
+	tmpDir, dir := makeBundleDir(t)
+	defer os.RemoveAll(tmpDir)
+
+	summary, err := summariseBundleDir(dir, builtIn)
+	if !assert.NoError(t, err) {
+		return
+	}
+	manifest, err := MakeBundleManifest(dir, summary.files, defaultChecksums)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	entries, err := parseBundleManifest(dir, manifest)
+	if assert.NoError(t, err) && assert.Len(t, entries, 3) {
+		assert.Equal(t, filepath.Join(dir.Location, "reads1.fast5"),
+			entries[0].path)
+		assert.Equal(t, "1181c1834012245d785120e3505ed169",
+			entries[0].checksum)
+	}
+
+	_, err = parseBundleManifest(dir, []byte("no checksum\n"))
+	assert.Error(t, err, "expected an invalid line to be rejected")
+
+	_, err = parseBundleManifest(dir,
+		[]byte("1181c1834012245d785120e3505ed169  other/reads1.fast5\n"))
+	assert.Error(t, err, "expected a file elsewhere to be rejected")
+}
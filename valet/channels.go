@@ -26,6 +26,10 @@ import "github.com/wtsi-npg/logshim"
 // long as at least one of them is open. One both x and y have been closed, the
 // channel returned will be closed by this function. The caller should not
 // close the returned channel themselves.
+//
+// An input channel must be closed only once nothing more will be sent on it,
+// as is the case for the channels of FindFilesInterval, which stops and drains
+// its sweeps before closing them.
 func MergeFileChannels(
 	x <-chan FilePath,
 	y <-chan FilePath) chan FilePath {
@@ -0,0 +1,209 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file checksum.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"hash"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	ex "github.com/wtsi-npg/extendo/v2"
+	logs "github.com/wtsi-npg/logshim"
+
+	"github.com/wtsi-npg/valet/utilities"
+)
+
+// ChecksumAlgorithm is the algorithm used by the remote data store to
+// calculate the checksums of data objects. Local checksum files and checksum
+// metadata are always MD5, regardless of the remote algorithm.
+type ChecksumAlgorithm string
+
+const (
+	MD5Checksum    ChecksumAlgorithm = "md5"    // iRODS default
+	SHA256Checksum ChecksumAlgorithm = "sha256" // iRODS SHA-256 (sha2)
+
+	// The prefix iRODS adds to SHA-256 checksums, which are base64 encoded
+	sha256RemotePrefix = "sha2:"
+)
+
+// ParseChecksumAlgorithm returns the ChecksumAlgorithm named by name, which
+// may be "md5", or "sha256" (also "sha2" or "sha-256").
+func ParseChecksumAlgorithm(name string) (ChecksumAlgorithm, error) {
+	switch strings.ToLower(name) {
+	case "md5":
+		return MD5Checksum, nil
+	case "sha256", "sha2", "sha-256":
+		return SHA256Checksum, nil
+	default:
+		return "", errors.Errorf("unsupported checksum algorithm '%s'", name)
+	}
+}
+
+// IsMD5 returns true if the algorithm is MD5, the same algorithm as used for
+// local checksum files. The empty ChecksumAlgorithm is treated as MD5.
+func (alg ChecksumAlgorithm) IsMD5() bool {
+	return alg == "" || alg == MD5Checksum
+}
+
+// newHash returns a new hash for the algorithm.
+func (alg ChecksumAlgorithm) newHash() (hash.Hash, error) {
+	switch alg {
+	case SHA256Checksum:
+		return sha256.New(), nil
+	default:
+		return nil, errors.Errorf("unsupported checksum algorithm '%s'", alg)
+	}
+}
+
+// formatRemote returns sum formatted as the remote data store reports it.
+func (alg ChecksumAlgorithm) formatRemote(sum []byte) string {
+	return sha256RemotePrefix + base64.StdEncoding.EncodeToString(sum)
+}
+
+// RemoteChecksum returns the checksum of the file at path as the remote data
+// store would report it using the algorithm. For MD5 this is md5sum, the
+// MD5 checksum of the file, which is already known. For other algorithms
+// the file is read to calculate its checksum.
+func (alg ChecksumAlgorithm) RemoteChecksum(path string,
+	md5sum string) (checksum string, err error) { // NRV
+	if alg.IsMD5() {
+		return md5sum, nil
+	}
+
+	var h hash.Hash
+	if h, err = alg.newHash(); err != nil {
+		return
+	}
+
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		return
+	}
+
+	defer func() {
+		err = utilities.CombineErrors(err, f.Close())
+	}()
+
+	if _, err = copyBuffered(h, f); err != nil {
+		return
+	}
+
+	return alg.formatRemote(h.Sum(nil)), nil
+}
+
+// NewRemoteHash returns a hash calculating checksums with the algorithm and a
+// function returning its current sum, formatted as the remote data store
+// reports it. For MD5 the returned hash is nil because the remote checksum
+// is the local MD5 checksum.
+func (alg ChecksumAlgorithm) NewRemoteHash() (hash.Hash, func() string, error) {
+	if alg.IsMD5() {
+		return nil, nil, nil
+	}
+
+	h, err := alg.newHash()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return h, func() string { return alg.formatRemote(h.Sum(nil)) }, nil
+}
+
+// HasRemoteFormat returns true if checksum has the form of a remote checksum
+// made with the algorithm.
+func (alg ChecksumAlgorithm) HasRemoteFormat(checksum string) bool {
+	if alg.IsMD5() {
+		return len(checksum) == 32 && !strings.Contains(checksum, ":")
+	}
+	return strings.HasPrefix(checksum, sha256RemotePrefix)
+}
+
+// DetectChecksumAlgorithm returns the ChecksumAlgorithm that made checksum,
+// a checksum as reported by the remote data store, by its form.
+func DetectChecksumAlgorithm(checksum string) (ChecksumAlgorithm, error) {
+	for _, alg := range []ChecksumAlgorithm{MD5Checksum, SHA256Checksum} {
+		if alg.HasRemoteFormat(checksum) {
+			return alg, nil
+		}
+	}
+
+	return "", errors.Errorf("unrecognised checksum '%s'", checksum)
+}
+
+// DiscoverChecksumAlgorithm returns the ChecksumAlgorithm used by the remote
+// data store under remoteBase, detected from the checksum of the first data
+// object found there that has one. Collections are searched breadth-first and
+// the search stops at that data object, so that the whole of remoteBase is not
+// listed. It returns an error if no data object with a checksum is found.
+func DiscoverChecksumAlgorithm(cPool *ex.ClientPool,
+	remoteBase string) (alg ChecksumAlgorithm, err error) { // NRV
+	var client *ex.Client
+	if client, err = getClient(cPool); err != nil {
+		return "", err
+	}
+	defer func() {
+		err = returnClient(cPool, client, err)
+	}()
+
+	queue := []string{filepath.Clean(remoteBase)}
+	for len(queue) > 0 {
+		coll := ex.NewCollection(client, queue[0])
+		queue = queue[1:]
+
+		var items []ex.RodsItem
+		if items, err = coll.FetchContents(); err != nil {
+			return "", errors.Wrapf(err, "failed to list '%s'", coll.RodsPath())
+		}
+
+		for _, item := range items {
+			if item.IsCollection() {
+				queue = append(queue, item.RodsPath())
+				continue
+			}
+
+			var listed ex.RodsItem
+			if listed, err = client.ListItem(ex.Args{Checksum: true},
+				item); err != nil {
+				return "", err
+			}
+			if listed.IChecksum == "" {
+				continue
+			}
+
+			if alg, err = DetectChecksumAlgorithm(listed.IChecksum); err != nil {
+				return "", errors.WithMessagef(err, "data object '%s'",
+					listed.RodsPath())
+			}
+
+			logs.GetLogger().Info().Str("path", listed.RodsPath()).
+				Str("checksum", listed.IChecksum).Str("algorithm", string(alg)).
+				Msg("discovered the archive's checksum algorithm")
+
+			return alg, nil
+		}
+	}
+
+	return "", errors.Errorf("no data object with a checksum was found "+
+		"under '%s'", remoteBase)
+}
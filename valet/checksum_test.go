@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file checksum_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseChecksumAlgorithm(t *testing.T) {
+	for name, expected := range map[string]ChecksumAlgorithm{
+		"md5":     MD5Checksum,
+		"MD5":     MD5Checksum,
+		"sha256":  SHA256Checksum,
+		"sha2":    SHA256Checksum,
+		"SHA-256": SHA256Checksum,
+	} {
+		alg, err := ParseChecksumAlgorithm(name)
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, alg, "for %s", name)
+		}
+	}
+
+	_, err := ParseChecksumAlgorithm("crc32")
+	assert.Error(t, err)
+}
+
+func TestRemoteChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hello.txt")
+	if !assert.NoError(t, os.WriteFile(path, []byte("hello\n"), 0600)) {
+		return
+	}
+	md5sum := "b1946ac92492d2347c6235b4d2611184"
+
+	chk, err := MD5Checksum.RemoteChecksum(path, md5sum)
+	if assert.NoError(t, err) {
+		assert.Equal(t, md5sum, chk)
+		assert.True(t, MD5Checksum.HasRemoteFormat(chk))
+	}
+
+	// As reported by iRODS for a zone configured for SHA-256
+	chk, err = SHA256Checksum.RemoteChecksum(path, md5sum)
+	if assert.NoError(t, err) {
+		assert.Equal(t,
+			"sha2:WJG1tSLV3whtD/CxEPvZ0hu0/HFjrzTQgoai6Eb2vgM=", chk)
+		assert.True(t, SHA256Checksum.HasRemoteFormat(chk))
+		assert.False(t, MD5Checksum.HasRemoteFormat(chk))
+	}
+
+	h, sum, err := SHA256Checksum.NewRemoteHash()
+	if assert.NoError(t, err) {
+		_, _ = h.Write([]byte("hello\n"))
+		assert.Equal(t, chk, sum())
+	}
+
+	h, sum, err = MD5Checksum.NewRemoteHash()
+	if assert.NoError(t, err) {
+		assert.Nil(t, h)
+		assert.Nil(t, sum)
+	}
+}
+
+func TestDetectChecksumAlgorithm(t *testing.T) {
+	for checksum, expected := range map[string]ChecksumAlgorithm{
+		"b1946ac92492d2347c6235b4d2611184":                  MD5Checksum,
+		"sha2:WJG1tSLV3whtD/CxEPvZ0hu0/HFjrzTQgoai6Eb2vgM=": SHA256Checksum,
+	} {
+		alg, err := DetectChecksumAlgorithm(checksum)
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, alg, "for %s", checksum)
+		}
+	}
+
+	_, err := DetectChecksumAlgorithm("crc32:12345")
+	assert.Error(t, err)
+}
+
+func TestRemoteChecksumFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "reads1.fast5")
+	if !assert.NoError(t, os.WriteFile(file, []byte("hello\n"), 0600)) {
+		return
+	}
+
+	path, err := NewFilePath(file)
+	if !assert.NoError(t, err) {
+		return
+	}
+	remoteFile := defaultChecksums.RemoteChecksumFilename(path,
+		SHA256Checksum)
+	assert.Equal(t, file+".sha256", remoteFile)
+
+	requires := builtIn.MakeRequiresRemoteChecksum(SHA256Checksum)
+	ok, err := requires(path)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	assert.Empty(t, CreateRemoteChecksumWorkPlan(MD5Checksum, Selection{}))
+	assert.Len(t, CreateRemoteChecksumWorkPlan(SHA256Checksum, Selection{}), 1)
+
+	create := MakeRemoteChecksumFileCreator(SHA256Checksum, defaultChecksums)
+	if !assert.NoError(t, create(path)) {
+		return
+	}
+
+	content, err := os.ReadFile(remoteFile)
+	if assert.NoError(t, err) {
+		assert.Equal(t,
+			"sha2:WJG1tSLV3whtD/CxEPvZ0hu0/HFjrzTQgoai6Eb2vgM=\n",
+			string(content))
+	}
+
+	ok, err = requires(path)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, defaultChecksums.RemoveMD5ChecksumFile(path))
+	assert.NoFileExists(t, remoteFile)
+}
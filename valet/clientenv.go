@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file clientenv.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"os"
+	"sync"
+
+	ex "github.com/wtsi-npg/extendo/v2"
+)
+
+// IRODSEnvironmentVar is the environment variable naming the iRODS
+// environment file from which an iRODS client takes the zone to connect to
+// and the account with which to connect.
+const IRODSEnvironmentVar = "IRODS_ENVIRONMENT_FILE"
+
+// clientEnvs records the iRODS environment file of each client pool made by
+// NewClientPool with one. A client pool starts its clients, which inherit the
+// environment of valet, while getting one. Each pool's clients are given their
+// own iRODS environment by setting IRODSEnvironmentVar while getting a client
+// from it (see GetClient), so while any pool has its own environment, clients
+// are got from one pool at a time.
+var clientEnvs = struct {
+	sync.Mutex
+	files map[*ex.ClientPool]string // The environment file of each pool
+}{files: make(map[*ex.ClientPool]string)}
+
+// NewClientPool returns a new ex.ClientPool, as ex.NewClientPool does, whose
+// clients connect using the iRODS environment file envFile. If envFile is
+// empty, its clients use the iRODS environment of valet.
+func NewClientPool(params ex.ClientPoolParams, envFile string,
+	clientArgs ...string) *ex.ClientPool {
+	cPool := ex.NewClientPool(params, clientArgs...)
+
+	if envFile != "" {
+		clientEnvs.Lock()
+		clientEnvs.files[cPool] = envFile
+		clientEnvs.Unlock()
+	}
+
+	return cPool
+}
+
+// GetClient returns a client from cPool, which must be got this way, rather
+// than by its Get method, so that any client it starts has the iRODS
+// environment of the pool (see NewClientPool). While no pool has its own
+// environment, clients are got from pools concurrently.
+func GetClient(cPool *ex.ClientPool) (*ex.Client, error) {
+	clientEnvs.Lock()
+	if len(clientEnvs.files) == 0 {
+		clientEnvs.Unlock()
+		return cPool.Get()
+	}
+	defer clientEnvs.Unlock()
+
+	envFile, ok := clientEnvs.files[cPool]
+	if !ok {
+		return cPool.Get()
+	}
+
+	initial, isSet := os.LookupEnv(IRODSEnvironmentVar)
+	if err := os.Setenv(IRODSEnvironmentVar, envFile); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if isSet {
+			_ = os.Setenv(IRODSEnvironmentVar, initial)
+		} else {
+			_ = os.Unsetenv(IRODSEnvironmentVar)
+		}
+	}()
+
+	return cPool.Get()
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file clientenv_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ex "github.com/wtsi-npg/extendo/v2"
+)
+
+func TestNewClientPoolEnvironment(t *testing.T) {
+	t.Setenv(IRODSEnvironmentVar, "/home/valet/.irods/irods_environment.json")
+
+	shared := NewClientPool(ex.DefaultClientPoolParams, "")
+	own := NewClientPool(ex.DefaultClientPoolParams,
+		"/home/valet/.irods/otherZone.json")
+	defer func() {
+		clientEnvs.Lock()
+		delete(clientEnvs.files, own)
+		clientEnvs.Unlock()
+	}()
+
+	clientEnvs.Lock()
+	_, ok := clientEnvs.files[shared]
+	assert.False(t, ok, "expected no environment for a shared pool")
+	assert.Equal(t, "/home/valet/.irods/otherZone.json", clientEnvs.files[own])
+	clientEnvs.Unlock()
+
+	// Closed pools start no clients, but the environment of valet is the same
+	// after getting from them
+	shared.Close()
+	own.Close()
+
+	_, err := GetClient(own)
+	assert.Error(t, err)
+	_, err = GetClient(shared)
+	assert.Error(t, err)
+	assert.Equal(t, "/home/valet/.irods/irods_environment.json",
+		os.Getenv(IRODSEnvironmentVar))
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file dryrun.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+
+	logs "github.com/wtsi-npg/logshim"
+)
+
+// Decision describes what archiving would do to a file, as reported by a
+// verifying dry-run (see VerifyArchiveWorkPlan).
+type Decision string
+
+const (
+	WouldCompress       Decision = "would-compress"
+	WouldChecksum       Decision = "would-checksum"
+	WouldArchive        Decision = "would-archive"
+	WouldReportMismatch Decision = "would-report-mismatch"
+	WouldAnnotate       Decision = "would-annotate"
+	WouldMark           Decision = "would-mark"
+	WouldDelete         Decision = "would-delete"
+	WouldDeleteChecksum Decision = "would-delete-checksum"
+	AlreadyArchived     Decision = "already-archived"
+	NoAction            Decision = "no-action"
+)
+
+// DecisionFunc receives the Decisions made for a file by a verifying dry-run,
+// in the order that the work would be done.
+type DecisionFunc func(path FilePath, decisions []Decision)
+
+// LogDecisions is a DecisionFunc that logs the Decisions for each file at info
+// level.
+func LogDecisions(path FilePath, decisions []Decision) {
+	s := make([]string, len(decisions))
+	for i, d := range decisions {
+		s[i] = string(d)
+	}
+
+	logs.GetLogger().Info().Str("path", path.Location).
+		Str("decision", strings.Join(s, ",")).Msg("dry-run")
+}
+
+// MakeDeletionReporter returns a DecisionFunc that writes to w the path of each
+// file or directory that would be deleted, one per line, ignoring all other
+// Decisions. This gives a focused report of deletions e.g. before enabling
+// deletion on archiving.
+func MakeDeletionReporter(w io.Writer) DecisionFunc {
+	var mu sync.Mutex
+
+	return func(path FilePath, decisions []Decision) {
+		for _, d := range decisions {
+			if d == WouldDelete {
+				mu.Lock()
+				_, _ = fmt.Fprintln(w, path.Location)
+				mu.Unlock()
+				return
+			}
+		}
+	}
+}
+
+// VerifyArchiveWorkPlan returns a WorkPlan with the predicates of the
+// ArchiveFilesWorkPlan for params, but whose work only records what would
+// have been done. This gives a truthful preview of archiving because the
+// predicates consult the archive, although they make no changes to it, or to
+// the local files.
+//
+// Once all the predicates have been evaluated for a file, its Decisions are
+// passed to report. A file for which there is no work is reported as
+// AlreadyArchived, if it has been archived, or otherwise as NoAction.
+//
+// As no work is done, predicates that would only be true after earlier work
+// are evaluated against the file as it is. For example, a file that would be
+// compressed is not reported as would-archive because its compressed version
+// does not yet exist.
+func VerifyArchiveWorkPlan(ctx context.Context, params ArchiveParams,
+	report DecisionFunc) (WorkPlan, error) {
+	plan, isArchived, err := archiveFilesWorkPlan(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// The Decisions for each file being worked on. DoProcessFiles never works
+	// on the same file concurrently.
+	var decided sync.Map
+
+	record := func(decision Decision) WorkFunc {
+		return func(path FilePath) error {
+			var decisions []Decision
+			if v, ok := decided.Load(path.Location); ok {
+				decisions = v.([]Decision)
+			}
+
+			n := len(decisions)
+			if n == 0 || decisions[n-1] != decision {
+				decided.Store(path.Location, append(decisions, decision))
+			}
+			return nil
+		}
+	}
+
+	reportDecisions := func(path FilePath) error {
+		var decisions []Decision
+		if v, ok := decided.LoadAndDelete(path.Location); ok {
+			decisions = v.([]Decision)
+		}
+
+		if len(decisions) == 0 {
+			ok, err := isArchived(path)
+			if err != nil {
+				return err
+			}
+
+			decision := NoAction
+			if ok {
+				decision = AlreadyArchived
+			}
+			decisions = []Decision{decision}
+		}
+
+		report(path, decisions)
+		return nil
+	}
+
+	verify := make(WorkPlan, 0, len(plan)+1)
+	for _, wm := range plan {
+		wm.work = Work{WorkFunc: record(wm.decision), Rank: wm.work.Rank}
+		wm.workDoc = string(wm.decision)
+		verify = append(verify, wm)
+	}
+
+	return append(verify, WorkMatch{
+		pred:    IsTrue,
+		predDoc: "Is True",
+		work:    Work{WorkFunc: reportDecisions, Rank: math.MaxUint16},
+		workDoc: "Report Decisions",
+	}), nil
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file dryrun_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyArchiveWorkPlan(t *testing.T) {
+	reported := make(map[string][]Decision)
+	report := func(path FilePath, decisions []Decision) {
+		reported[path.Location] = decisions
+	}
+
+	params := ArchiveParams{LocalBase: "./testdata/valet",
+		RemoteBase: "/testZone/home/irods"}
+	plan, err := VerifyArchiveWorkPlan(context.Background(), params, report)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Neither of these requires the archive to be consulted
+	fastq := "./testdata/valet/1/reads/fastq/reads3.fastq"
+	dir := "./testdata/valet/testdir"
+
+	locations := make(map[string]string)
+	for _, p := range []string{fastq, dir} {
+		path, err := NewFilePath(p)
+		if !assert.NoError(t, err) {
+			return
+		}
+		locations[p] = path.Location
+
+		work, err := makeWork(context.Background(), path, plan, nil, nil)
+		if assert.NoError(t, err) {
+			assert.NoError(t, work.WorkFunc(path))
+		}
+	}
+
+	assert.Equal(t, []Decision{WouldCompress}, reported[locations[fastq]])
+	assert.Equal(t, []Decision{NoAction}, reported[locations[dir]])
+
+	// No work was done
+	_, err = os.Stat(fastq + ".gz")
+	assert.True(t, os.IsNotExist(err), "expected no compressed file")
+}
+
+func TestMakeDeletionReporter(t *testing.T) {
+	var buf bytes.Buffer
+	report := MakeDeletionReporter(&buf)
+
+	file := FilePath{FileResource: FileResource{"/data/run/reads1.fast5"}}
+	dir := FilePath{FileResource: FileResource{"/data/run"}}
+	kept := FilePath{FileResource: FileResource{"/data/run/reads2.fast5"}}
+
+	report(file, []Decision{WouldArchive, WouldDelete})
+	report(kept, []Decision{WouldArchive})
+	report(dir, []Decision{WouldDelete})
+
+	assert.Equal(t, "/data/run/reads1.fast5\n/data/run\n", buf.String())
+}
+
+func TestArchiveFilesWorkPlanDecisions(t *testing.T) {
+	params := ArchiveParams{LocalBase: "./testdata/valet",
+		RemoteBase: "/testZone/home/irods", DeleteLocal: true,
+		MirrorEmpty: true, Bundle: BundleParams{Patterns: []string{"**/fast5"}}}
+	plan, _, err := archiveFilesWorkPlan(context.Background(), params)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	expected := map[string]Decision{
+		"Compress Local File":                      WouldCompress,
+		"Create Or Update Local MD5 Checksum File": WouldChecksum,
+		"Re-annotate Archived Run":                 WouldAnnotate,
+		"Report Mismatched Archived Copy":          WouldReportMismatch,
+		"Archive Empty Directory":                  WouldArchive,
+		"Archive Bundle":                           WouldArchive,
+		"Annotate Run From Directory":              WouldAnnotate,
+		"Mark Run Directory Archived":              WouldMark,
+		"Remove Local Uncompressed Version":        WouldDelete,
+		"Verify And Remove Local File":             WouldDelete,
+		"Remove Local MD5 Checksum File":           WouldDeleteChecksum,
+		"Remove Old Run Directory":                 WouldDelete,
+		"Remove Local Bundled Files":               WouldDelete,
+	}
+	for _, m := range plan {
+		if m.workDoc == "Archive" {
+			// Both copying and annotation are described as archiving
+			if m.work.Rank == 4 {
+				assert.Equal(t, WouldAnnotate, m.decision, m.String())
+			} else {
+				assert.Equal(t, WouldArchive, m.decision, m.String())
+			}
+			continue
+		}
+		if assert.Contains(t, expected, m.workDoc) {
+			assert.Equal(t, expected[m.workDoc], m.decision, m.workDoc)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file errlimit.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"sync/atomic"
+
+	logs "github.com/wtsi-npg/logshim"
+)
+
+// ErrorLimit cancels processing once more than a maximum number of work errors
+// have been counted, so that a persistent failure, such as a misconfigured
+// archive, stops valet promptly, rather than every file failing in turn. Errors
+// are counted from the start of processing.
+//
+// The methods of a nil *ErrorLimit do nothing, so that the limit may be
+// disabled by using nil.
+type ErrorLimit struct {
+	max      uint64
+	count    atomic.Uint64
+	exceeded atomic.Bool
+	cancel   context.CancelFunc
+}
+
+// NewErrorLimit returns a new ErrorLimit which calls cancel once more than max
+// errors have been recorded.
+func NewErrorLimit(max uint64, cancel context.CancelFunc) *ErrorLimit {
+	return &ErrorLimit{max: max, cancel: cancel}
+}
+
+// Record counts an error, calling the cancel function of the limit if this is
+// the first error to exceed the maximum.
+func (l *ErrorLimit) Record() {
+	if l == nil {
+		return
+	}
+
+	if n := l.count.Add(1); n > l.max && l.exceeded.CompareAndSwap(false, true) {
+		logs.GetLogger().Error().Uint64("errors", n).Uint64("max_errors", l.max).
+			Msg("exceeded the maximum number of errors, aborting")
+		l.cancel()
+	}
+}
+
+// Exceeded returns true if more than the maximum number of errors have been
+// recorded.
+func (l *ErrorLimit) Exceeded() bool {
+	if l == nil {
+		return false
+	}
+
+	return l.exceeded.Load()
+}
+
+// Count returns the number of errors recorded.
+func (l *ErrorLimit) Count() uint64 {
+	if l == nil {
+		return 0
+	}
+
+	return l.count.Load()
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file errlimit_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorLimit(t *testing.T) {
+	var cancelled atomic.Int32
+	limit := NewErrorLimit(2, func() { cancelled.Add(1) })
+
+	var worked atomic.Int32
+	plan := WorkPlan{
+		WorkMatch{
+			pred: IsTrue,
+			work: Work{WorkFunc: func(path FilePath) error {
+				worked.Add(1)
+				return errors.New("archive misconfigured")
+			}},
+		},
+	}
+
+	ch := make(chan FilePath, 10)
+	for i := 0; i < 10; i++ {
+		fp, err := NewFilePathNoStat(fmt.Sprintf("/data/file%d", i))
+		if !assert.NoError(t, err) {
+			return
+		}
+		ch <- fp
+	}
+	close(ch)
+
+	err := DoProcessFiles(context.Background(), ch,
+		ProcessParams{Plan: plan, MaxProc: 1, errLimit: limit})
+	assert.Error(t, err)
+	assert.True(t, limit.Exceeded())
+	assert.Equal(t, uint64(3), limit.Count())
+	assert.Equal(t, int32(3), worked.Load(), "expected the rest skipped")
+	assert.Equal(t, int32(1), cancelled.Load())
+
+	var none *ErrorLimit
+	none.Record()
+	assert.False(t, none.Exceeded())
+}
+
+func TestProcessFilesMaxErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir,
+			fmt.Sprintf("file%d", i)), []byte("content"), 0644))
+	}
+
+	plan := WorkPlan{
+		WorkMatch{
+			pred: IsTrue,
+			work: Work{WorkFunc: func(path FilePath) error {
+				return errors.New("archive misconfigured")
+			}},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	err := ProcessFiles(ctx, ProcessParams{
+		Root:          tmpDir,
+		MatchFunc:     IsRegular,
+		PruneFunc:     IsFalse,
+		Plan:          plan,
+		SweepInterval: MinSweepInterval,
+		MaxProc:       1,
+		MaxErrors:     1,
+	})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "exceeding the maximum of 1")
+	}
+	assert.NoError(t, ctx.Err(), "expected to abort before the timeout")
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file fanout.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"github.com/pkg/errors"
+	ex "github.com/wtsi-npg/extendo/v2"
+	logs "github.com/wtsi-npg/logshim"
+)
+
+// The functions here apply the archiving of a file to each of several remote
+// roots (fan-out), so that a file is archived redundantly e.g. to two zones.
+// With a single remote root, they return the predicate or WorkFunc made for
+// it, unchanged.
+//
+// Each remote root is reached through its own client pool, which may connect
+// to its zone with its own iRODS environment (see NewClientPool), so that an
+// outage of one zone does not hold up the connections to another.
+
+// RemoteRoot is a remote root collection and the client pool through which it
+// is reached.
+type RemoteRoot struct {
+	Base       string         // The remote root collection
+	ClientPool *ex.ClientPool // The pool of clients connecting to its zone
+}
+
+// forAllBases returns a predicate that will return true if the predicates made
+// by makePred for every one of remoteRoots return true.
+func forAllBases(remoteRoots []RemoteRoot,
+	makePred func(root RemoteRoot) FilePredicate) FilePredicate {
+	if len(remoteRoots) == 1 {
+		return makePred(remoteRoots[0])
+	}
+
+	var preds []FilePredicate
+	for _, root := range remoteRoots {
+		preds = append(preds, makePred(root))
+	}
+
+	return And(preds...)
+}
+
+// forAnyBase returns a predicate that will return true if the predicate made
+// by makePred for any one of remoteRoots returns true.
+func forAnyBase(remoteRoots []RemoteRoot,
+	makePred func(root RemoteRoot) FilePredicate) FilePredicate {
+	if len(remoteRoots) == 1 {
+		return makePred(remoteRoots[0])
+	}
+
+	var preds []FilePredicate
+	for _, root := range remoteRoots {
+		preds = append(preds, makePred(root))
+	}
+
+	return Or(preds...)
+}
+
+// forEachBase returns a WorkFunc that does the work made by makeWork for each
+// of remoteRoots in turn, except for those where the predicate made by
+// makeDone returns true because the work is already done there. It stops at the
+// first error, so that the work succeeds only once done for every remote root.
+// The work already done is not repeated when it is tried again.
+func forEachBase(remoteRoots []RemoteRoot,
+	makeWork func(root RemoteRoot) WorkFunc,
+	makeDone func(root RemoteRoot) FilePredicate) WorkFunc {
+	if len(remoteRoots) == 1 {
+		return makeWork(remoteRoots[0])
+	}
+
+	works := make([]WorkFunc, len(remoteRoots))
+	dones := make([]FilePredicate, len(remoteRoots))
+	for i, root := range remoteRoots {
+		works[i], dones[i] = makeWork(root), makeDone(root)
+	}
+
+	return func(path FilePath) error {
+		log := logs.GetLogger()
+
+		for i, root := range remoteRoots {
+			done, err := dones[i](path)
+			if err != nil {
+				return errors.WithMessagef(err, "remote base %s", root.Base)
+			}
+			if done {
+				log.Debug().Str("path", path.Location).
+					Str("remote_base", root.Base).
+					Msg("already done, skipping")
+				continue
+			}
+
+			if err = works[i](path); err != nil {
+				return errors.WithMessagef(err, "remote base %s", root.Base)
+			}
+		}
+
+		return nil
+	}
+}
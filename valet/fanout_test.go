@@ -0,0 +1,130 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file fanout_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForEachBase(t *testing.T) {
+	bases := []RemoteRoot{{Base: "/zoneA/archive"}, {Base: "/zoneB/archive"},
+		{Base: "/zoneC/archive"}}
+
+	var worked []string
+	done := map[string]bool{"/zoneA/archive": true}
+	failing := make(map[string]bool)
+
+	makeWork := func(root RemoteRoot) WorkFunc {
+		return func(path FilePath) error {
+			if failing[root.Base] {
+				return errors.New("failed to archive")
+			}
+			worked = append(worked, root.Base)
+			done[root.Base] = true
+			return nil
+		}
+	}
+	makeDone := func(root RemoteRoot) FilePredicate {
+		return func(path FilePath) (bool, error) {
+			return done[root.Base], nil
+		}
+	}
+
+	path, err := NewFilePathNoStat("/data/reads1.fast5")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The work stops at the first failing base
+	failing["/zoneB/archive"] = true
+	work := forEachBase(bases, makeWork, makeDone)
+	err = work(path)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "/zoneB/archive")
+	}
+	assert.Empty(t, worked)
+
+	// and is not repeated for the bases already done
+	delete(failing, "/zoneB/archive")
+	assert.NoError(t, work(path))
+	assert.Equal(t, []string{"/zoneB/archive", "/zoneC/archive"}, worked)
+
+	worked = nil
+	assert.NoError(t, work(path))
+	assert.Empty(t, worked)
+
+	// A single base has its work done unconditionally
+	assert.NoError(t, forEachBase(bases[:1], makeWork, makeDone)(path))
+	assert.Equal(t, []string{"/zoneA/archive"}, worked)
+}
+
+func TestForAllAndAnyBase(t *testing.T) {
+	bases := []RemoteRoot{{Base: "/zoneA/archive"}, {Base: "/zoneB/archive"}}
+	copied := map[string]bool{"/zoneA/archive": true}
+
+	makePred := func(root RemoteRoot) FilePredicate {
+		return func(path FilePath) (bool, error) {
+			return copied[root.Base], nil
+		}
+	}
+
+	path, err := NewFilePathNoStat("/data/reads1.fast5")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ok, err := forAllBases(bases, makePred)(path)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = forAnyBase(bases, makePred)(path)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	copied["/zoneB/archive"] = true
+	ok, err = forAllBases(bases, makePred)(path)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestArchiveFilesWorkPlanMirrors(t *testing.T) {
+	params := ArchiveParams{LocalBase: "./testdata/valet",
+		RemoteBase: "/testZone/home/irods",
+		Mirrors:    []RemoteRoot{{Base: "/otherZone/home/irods"}}}
+
+	plan, err := ArchiveFilesWorkPlan(context.Background(), params)
+	if assert.NoError(t, err) {
+		assert.NotEmpty(t, plan)
+	}
+
+	params.Mirrors = []RemoteRoot{{Base: "/testZone/home/irods/"}}
+	_, err = ArchiveFilesWorkPlan(context.Background(), params)
+	assert.Error(t, err)
+
+	params.Mirrors = []RemoteRoot{{Base: "/otherZone/home/irods"}}
+	params.RequireReplica = []string{"archiveResc"}
+	_, err = ArchiveFilesWorkPlan(context.Background(), params)
+	assert.Error(t, err)
+}
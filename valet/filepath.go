@@ -26,6 +26,8 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/pkg/errors"
 )
 
 // FileResource is a locatable file.
@@ -38,6 +40,8 @@ type FileResource struct {
 type FilePath struct {
 	FileResource
 	Info os.FileInfo
+
+	stats *statCache // Sidecar file stats, during evaluation (see WithStatCache)
 }
 
 // NewFilePath returns a new instance where the path has been cleaned and made
@@ -45,19 +49,53 @@ type FilePath struct {
 // created using this constructor to ensure that always have a clean, absolute
 // path and populated FileInfo.
 func NewFilePath(path string) (FilePath, error) {
-	var fp FilePath
-	absPath, err := filepath.Abs(filepath.Clean(path))
+	fp, err := NewFilePathNoStat(path)
 	if err != nil {
 		return fp, err
 	}
 
-	info, err := os.Stat(absPath)
-	fp.Info = info
-	fp.FileResource = FileResource{absPath}
+	fp.Info, err = os.Stat(fp.Location)
 
 	return fp, err
 }
 
+// NewFilePathNoStat returns a new instance where the path has been cleaned and
+// made absolute, without calling os.Stat. The FileInfo is nil, so the file need
+// not exist. It is for callers that only need a path e.g. to derive or open a
+// sidecar file, saving a system call for each. Predicates and other functions
+// that use the FileInfo must not be given such an instance.
+func NewFilePathNoStat(path string) (FilePath, error) {
+	absPath, err := filepath.Abs(filepath.Clean(path))
+	if err != nil {
+		return FilePath{}, err
+	}
+
+	return FilePath{FileResource: FileResource{absPath}}, nil
+}
+
+// RelativeTo returns the path of the file relative to root, which may itself be
+// relative to the working directory. It returns an error if the file is not
+// root or within root.
+func (path *FilePath) RelativeTo(root string) (string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(absRoot, path.Location)
+	if err != nil {
+		return "", err
+	}
+
+	parent := ".." + string(filepath.Separator)
+	if rel == ".." || strings.HasPrefix(rel, parent) {
+		return "", errors.Errorf("'%s' is not within '%s'",
+			path.Location, absRoot)
+	}
+
+	return rel, nil
+}
+
 // SortFilePaths sorts paths by Location.
 func SortFilePaths(paths []FilePath) {
 	sort.SliceStable(paths, func(i, j int) bool {
@@ -65,10 +103,90 @@ func SortFilePaths(paths []FilePath) {
 	})
 }
 
+// ChecksumFiles describes how the names of checksum files, and of the other
+// sidecar files valet writes, are derived from the names of the data files
+// they accompany. The zero value uses MD5Suffix and does not hide the files.
+type ChecksumFiles struct {
+	suffix string // The suffix appended to the data file name
+	hidden bool   // True if the checksum file name is prefixed with a dot
+}
+
+// MakeChecksumFiles returns a ChecksumFiles using suffix for checksum files,
+// which are hidden (i.e. named .<data file name>.<suffix>) if hidden is true.
+// Any leading dot on suffix is ignored.
+func MakeChecksumFiles(suffix string, hidden bool) (ChecksumFiles, error) {
+	suffix = strings.TrimPrefix(suffix, ".")
+	if suffix == "" {
+		return ChecksumFiles{}, errors.New("the checksum file suffix may " +
+			"not be empty")
+	}
+	if strings.ContainsRune(suffix, filepath.Separator) {
+		return ChecksumFiles{}, errors.Errorf("the checksum file suffix "+
+			"'%s' may not contain a path separator", suffix)
+	}
+
+	return ChecksumFiles{suffix: suffix, hidden: hidden}, nil
+}
+
+// Suffix returns the checksum file suffix.
+func (cf ChecksumFiles) Suffix() string {
+	if cf.suffix == "" {
+		return MD5Suffix
+	}
+	return cf.suffix
+}
+
+// Hidden returns true if checksum files are hidden.
+func (cf ChecksumFiles) Hidden() bool {
+	return cf.hidden
+}
+
 // ChecksumFilename returns the expected path of the checksum file belonging
-// to the path.
-func (path *FilePath) ChecksumFilename() string {
-	return fmt.Sprintf("%s.%s", path.Location, MD5Suffix)
+// to path.
+func (cf ChecksumFiles) ChecksumFilename(path FilePath) string {
+	return cf.sidecarFilename(path, cf.Suffix())
+}
+
+// RawChecksumFilename returns the expected path of the checksum file for the
+// uncompressed content of path. Its name has RawChecksumInfix inserted before
+// the checksum file suffix e.g. reads.fastq.gz.raw.md5.
+func (cf ChecksumFiles) RawChecksumFilename(path FilePath) string {
+	return cf.sidecarFilename(path, RawChecksumInfix+"."+cf.Suffix())
+}
+
+// RemoteChecksumFilename returns the expected path of the file holding the
+// checksum of path made by the remote algorithm alg. Its suffix is the name
+// of the algorithm e.g. reads.fast5.sha256.
+func (cf ChecksumFiles) RemoteChecksumFilename(path FilePath,
+	alg ChecksumAlgorithm) string {
+	return cf.sidecarFilename(path, string(alg))
+}
+
+// IncompressibleFilename returns the expected path of the marker file
+// recording that compression of path achieved too little to be worthwhile
+// (see SelectParams). Its suffix is IncompressibleSuffix e.g.
+// reads.txt.incompressible.
+func (cf ChecksumFiles) IncompressibleFilename(path FilePath) string {
+	return cf.sidecarFilename(path, IncompressibleSuffix)
+}
+
+// IsChecksumFilename returns true if name is the name of a checksum file.
+func (cf ChecksumFiles) IsChecksumFilename(name string) bool {
+	base := filepath.Base(name)
+	if cf.hidden && !strings.HasPrefix(base, ".") {
+		return false
+	}
+
+	return strings.HasSuffix(base, "."+cf.Suffix())
+}
+
+func (cf ChecksumFiles) sidecarFilename(path FilePath, suffix string) string {
+	name := fmt.Sprintf("%s.%s", filepath.Base(path.Location), suffix)
+	if cf.hidden {
+		name = "." + name
+	}
+
+	return filepath.Join(filepath.Dir(path.Location), name)
 }
 
 // CompressedFilename returns the expected path of the compressed  version of
@@ -51,16 +51,121 @@ func TestNewFilePath(t *testing.T) {
 	assert.Error(t, nerr, "expected an error for non-existent path")
 }
 
-func TestFilePath_ChecksumFilename(t *testing.T) {
+func TestNewFilePathNoStat(t *testing.T) {
+	fqPath := "testdata/valet/1/reads/fastq/../fastq/reads1.fastq"
+	file, err := NewFilePathNoStat(fqPath)
+	if assert.NoError(t, err) {
+		absFile, _ := filepath.Abs("testdata/valet/1/reads/fastq/reads1.fastq")
+		assert.Equal(t, absFile, file.Location)
+		assert.Nil(t, file.Info, "expected Info not to be populated")
+	}
+
+	absent, err := NewFilePathNoStat("no_such_path")
+	if assert.NoError(t, err, "expected no error for non-existent path") {
+		absPath, _ := filepath.Abs("no_such_path")
+		assert.Equal(t, absPath, absent.Location)
+	}
+}
+
+func TestFilePath_RelativeTo(t *testing.T) {
+	file, _ := NewFilePath("testdata/valet/1/reads/fastq/reads1.fastq")
+
+	rel, err := file.RelativeTo("testdata/valet")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1/reads/fastq/reads1.fastq", rel)
+	}
+
+	absRoot, _ := filepath.Abs("testdata/valet/1")
+	rel, err = file.RelativeTo(absRoot + "/")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "reads/fastq/reads1.fastq", rel)
+	}
+
+	rel, err = file.RelativeTo(file.Location)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ".", rel)
+	}
+
+	_, err = file.RelativeTo("testdata/valet/1/reads/fast5")
+	assert.Error(t, err, "expected an error for a path outside root")
+
+	_, err = file.RelativeTo("testdata/valet/1/reads/fastq/reads1")
+	assert.Error(t, err, "expected an error for a path outside root")
+}
+
+// defaultChecksums is the default naming of checksum files.
+var defaultChecksums ChecksumFiles
+
+func TestChecksumFiles_ChecksumFilename(t *testing.T) {
 	file, _ := NewFilePath("testdata/valet/1/reads/fastq/reads1.fastq")
 
 	absDir, _ := filepath.Abs(".")
-	path, err := filepath.Rel(absDir, file.ChecksumFilename())
+	path, err := filepath.Rel(absDir, defaultChecksums.ChecksumFilename(file))
 	if assert.NoError(t, err) {
 		assert.Equal(t, "testdata/valet/1/reads/fastq/reads1.fastq.md5", path)
 	}
 }
 
+func TestMakeChecksumFiles(t *testing.T) {
+	file, _ := NewFilePath("testdata/valet/1/reads/fastq/reads1.fastq")
+	absDir, _ := filepath.Abs(".")
+
+	cf, err := MakeChecksumFiles(".md5sum", false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "md5sum", cf.Suffix())
+		assert.False(t, cf.Hidden())
+
+		path, err := filepath.Rel(absDir, cf.ChecksumFilename(file))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "testdata/valet/1/reads/fastq/reads1.fastq.md5sum",
+				path)
+		}
+		assert.True(t, cf.IsChecksumFilename(cf.ChecksumFilename(file)))
+		assert.False(t, cf.IsChecksumFilename(file.Location))
+		assert.False(t, defaultChecksums.IsChecksumFilename(
+			cf.ChecksumFilename(file)))
+	}
+
+	cf, err = MakeChecksumFiles("md5", true)
+	if assert.NoError(t, err) {
+		path, err := filepath.Rel(absDir, cf.ChecksumFilename(file))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "testdata/valet/1/reads/fastq/.reads1.fastq.md5",
+				path)
+		}
+		assert.True(t, cf.IsChecksumFilename(cf.ChecksumFilename(file)))
+		assert.False(t, cf.IsChecksumFilename(file.Location+".md5"))
+	}
+
+	_, err = MakeChecksumFiles("", false)
+	assert.Error(t, err)
+	_, err = MakeChecksumFiles("a/md5", false)
+	assert.Error(t, err)
+}
+
+func TestChecksumFiles_RawChecksumFilename(t *testing.T) {
+	file, _ := NewFilePath("testdata/valet/1/reads/fastq/reads2.fastq.gz")
+	absDir, _ := filepath.Abs(".")
+
+	path, err := filepath.Rel(absDir, defaultChecksums.RawChecksumFilename(file))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "testdata/valet/1/reads/fastq/reads2.fastq.gz.raw.md5",
+			path)
+	}
+	assert.True(t, defaultChecksums.IsChecksumFilename(
+		defaultChecksums.RawChecksumFilename(file)))
+
+	cf, err := MakeChecksumFiles("md5", true)
+	if assert.NoError(t, err) {
+		path, err := filepath.Rel(absDir, cf.RawChecksumFilename(file))
+		if assert.NoError(t, err) {
+			assert.Equal(t,
+				"testdata/valet/1/reads/fastq/.reads2.fastq.gz.raw.md5", path)
+		}
+		assert.True(t, cf.IsChecksumFilename(cf.RawChecksumFilename(file)))
+	}
+}
+
 func TestFilePath_CompressedFilename(t *testing.T) {
 	file, _ := NewFilePath("testdata/valet/1/reads/fastq/reads1.fastq")
 
@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file filetypes.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// FileTypeHandling describes how valet archives the files of one recognised
+// type.
+type FileTypeHandling struct {
+	Type        string `json:"type"`        // The type of the files
+	Compressed  bool   `json:"compressed"`  // Compressed before archiving
+	Checksummed bool   `json:"checksummed"` // Given a checksum file
+	Copied      bool   `json:"copied"`      // Copied to the archive
+}
+
+// DescribeFileTypes returns the handling of each recognised type of data file
+// (checksum files are not data), in the order in which the types are tested
+// (see FileType). The handling is not tabulated, but found by evaluating the
+// predicates of sel that select files for work (RequiresCompression,
+// RequiresChecksum and RequiresCopying) on a sample file of each type, made in
+// a temporary directory, so that it follows the predicates and the current
+// settings, such as the minimum compression size. A type that is compressed is
+// described by the handling of its compressed version, which is what is
+// archived.
+func DescribeFileTypes(sel Selection) ([]FileTypeHandling, error) {
+	sel = sel.OrBuiltIn()
+
+	tmpDir, err := os.MkdirTemp("", "valet-types")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	sampleSize := sel.minCompressSize
+	if sampleSize < 1 {
+		sampleSize = 1
+	}
+
+	var handling []FileTypeHandling
+	for _, t := range fileTypes {
+		h := FileTypeHandling{Type: t.name}
+
+		sample, err := makeSampleFile(tmpDir, "sample."+t.name, sampleSize)
+		if err != nil {
+			return nil, err
+		}
+		if h.Compressed, err = sel.RequiresCompression(sample); err != nil {
+			return nil, err
+		}
+		if h.Compressed {
+			// Made apart, as it would otherwise prevent compression above
+			sample, err = makeSampleFile(tmpDir, filepath.Base(
+				sample.CompressedFilename()), sampleSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if h.Checksummed, err = sel.RequiresChecksum(sample); err != nil {
+			return nil, err
+		}
+		if h.Copied, err = sel.RequiresCopying(sample); err != nil {
+			return nil, err
+		}
+
+		handling = append(handling, h)
+	}
+
+	return handling, nil
+}
+
+// makeSampleFile creates a file named name of size bytes in a new directory
+// under dir and returns its FilePath.
+func makeSampleFile(dir string, name string, size int64) (FilePath, error) {
+	sampleDir, err := os.MkdirTemp(dir, "")
+	if err != nil {
+		return FilePath{}, err
+	}
+
+	path := filepath.Join(sampleDir, name)
+	if err = os.WriteFile(path, make([]byte, size), 0600); err != nil {
+		return FilePath{}, errors.Wrapf(err, "failed to make sample file '%s'",
+			path)
+	}
+
+	return NewFilePath(path)
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file filetypes_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribeFileTypes(t *testing.T) {
+	handling, err := DescribeFileTypes(Selection{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	byType := make(map[string]FileTypeHandling)
+	for _, h := range handling {
+		byType[h.Type] = h
+	}
+
+	assert.Len(t, handling, len(fileTypes))
+	assert.NotContains(t, byType, ChecksumFileType)
+
+	assert.Equal(t, FileTypeHandling{Type: Fast5Suffix, Checksummed: true,
+		Copied: true}, byType[Fast5Suffix])
+	assert.Equal(t, FileTypeHandling{Type: BAMSuffix, Checksummed: true,
+		Copied: true}, byType[BAMSuffix])
+	assert.Equal(t, FileTypeHandling{Type: FastqSuffix, Compressed: true,
+		Checksummed: true, Copied: true}, byType[FastqSuffix])
+	assert.Equal(t, FileTypeHandling{Type: JSONSuffix, Compressed: true,
+		Checksummed: true, Copied: true}, byType[JSONSuffix])
+}
+
+func TestDescribeFileTypesMinCompressSize(t *testing.T) {
+	sel, err := MakeSelection(SelectParams{MinCompressSize: 1024})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	handling, err := DescribeFileTypes(sel)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Samples are no smaller than the minimum, so compression is reported
+	for _, h := range handling {
+		if h.Type == FastqSuffix {
+			assert.True(t, h.Compressed)
+			assert.True(t, h.Copied)
+		}
+	}
+}
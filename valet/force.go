@@ -0,0 +1,212 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file force.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	ex "github.com/wtsi-npg/extendo/v2"
+	logs "github.com/wtsi-npg/logshim"
+)
+
+// ForceArchivedAttr is the attribute, in the ValetNamespace, of the metadata
+// recording that a data object was archived by force (see
+// ArchiveParams.ForceArchive). Its value identifies the recovery for which it
+// was archived (see ArchiveParams.ForceArchiveID).
+const ForceArchivedAttr string = "force_archived"
+
+// ForceArchivedMetadata returns an AVU recording that a data object was
+// archived by force for the recovery identified by id.
+func ForceArchivedMetadata(id string) ex.AVU {
+	return ex.AVU{Attr: ForceArchivedAttr, Value: id}.
+		WithNamespace(ValetNamespace)
+}
+
+// forcedCopies records the files that have been archived again by force (see
+// ArchiveParams.ForceArchive), by path, with their size and modification time
+// when archived. A file not recorded while valet is running is looked up in
+// the archive, where its data objects are annotated when it is archived by
+// force (see ForceArchivedMetadata), so that after a restart, it is not
+// archived by force again.
+type forcedCopies struct {
+	sync.Mutex
+	files      map[string]fileSignature
+	isRecorded FilePredicate // Archived by force, as recorded in the archive
+}
+
+// newForcedCopies returns a new forcedCopies which consults isRecorded for
+// files archived by force before it was made, if isRecorded is not nil.
+func newForcedCopies(isRecorded FilePredicate) *forcedCopies {
+	return &forcedCopies{files: make(map[string]fileSignature),
+		isRecorded: isRecorded}
+}
+
+// isForceCopied returns true if path has been archived by force and has not
+// changed since.
+func (f *forcedCopies) isForceCopied(path FilePath) (bool, error) {
+	if path.Info == nil {
+		return false, nil
+	}
+
+	f.Lock()
+	sig, ok := f.files[path.Location]
+	f.Unlock()
+
+	if ok && sig.matches(path.Info) {
+		return true, nil
+	}
+	if f.isRecorded == nil {
+		return false, nil
+	}
+
+	recorded, err := f.isRecorded(path)
+	if err != nil || !recorded {
+		return false, err
+	}
+	f.record(path)
+
+	return true, nil
+}
+
+// record records path as archived by force.
+func (f *forcedCopies) record(path FilePath) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.files[path.Location] = fileSignature{size: path.Info.Size(),
+		modTime: path.Info.ModTime()}
+}
+
+// makeForceCopier returns a WorkFunc that recalculates the checksum file of
+// its file, named as described by cf, rather than trusting the one present,
+// and then archives the file using copyFile, overwriting any archived copy.
+// Each file archived is recorded (see isForceCopied), so that it is archived
+// by force only once. copyFile is expected to annotate the data objects it
+// makes with ForceArchivedMetadata, so that this is also recorded in the
+// archive.
+func (f *forcedCopies) makeForceCopier(copyFile WorkFunc,
+	cf ChecksumFiles) WorkFunc {
+	return func(path FilePath) error {
+		if err := cf.CreateMD5ChecksumFile(path); err != nil {
+			return errors.Wrap(err, "failed to recalculate the checksum "+
+				"before archiving by force")
+		}
+
+		logs.GetLogger().Notice().Str("path", path.Location).
+			Msg("archiving by force, overwriting any archived copy")
+
+		if err := copyFile(path); err != nil {
+			return err
+		}
+		f.record(path)
+
+		return nil
+	}
+}
+
+// makeIsForceArchived returns a predicate that will return true if its
+// argument has been archived by force from localBase to remoteBase for the
+// recovery identified by id, and has not changed since, and no errors occur
+// while confirming this.
+//
+// The criteria are:
+//
+// 1. The data object exists in the archive.
+//
+// 2. The data object has ForceArchivedMetadata for id.
+//
+// 3. The size of the data object matches the size of the file.
+//
+// 4. The file has not been modified since it was archived.
+func makeIsForceArchived(localBase string, remoteBase string,
+	cPool *ex.ClientPool, id string) FilePredicate {
+	forced := ForceArchivedMetadata(id)
+
+	return func(path FilePath) (ok bool, err error) { // NRV
+		defer func() {
+			if err != nil {
+				err = errors.Wrap(err, "IsForceArchived")
+			}
+		}()
+
+		var dest string
+		if dest, err = translatePath(localBase, remoteBase, path); err != nil {
+			return false, err
+		}
+
+		client, err := getClient(cPool)
+		if err != nil {
+			return false, err
+		}
+
+		defer func() {
+			err = returnClient(cPool, client, err)
+		}()
+
+		obj := ex.NewDataObject(client, dest)
+
+		var exists bool
+		if exists, err = obj.Exists(); err != nil || !exists {
+			return false, err
+		}
+
+		item, err := client.ListItem(ex.Args{AVU: true, Size: true,
+			Timestamp: true}, *obj.RodsItem)
+		if err != nil {
+			return false, err
+		}
+
+		return isForceArchive(path.Info.Size(), path.Info.ModTime(),
+			item.ISize, item.ITimestamps, item.IAVUs, forced), nil
+	}
+}
+
+// isForceArchive returns true if a data object of size remoteSize, with
+// timestamps and metadata avus, is an archive by force, recorded by the AVU
+// forced, of a local file of size localSize, last modified at localModTime.
+func isForceArchive(localSize int64, localModTime time.Time,
+	remoteSize uint64, timestamps []ex.Timestamp, avus []ex.AVU,
+	forced ex.AVU) bool {
+	if localSize < 0 || remoteSize != uint64(localSize) {
+		return false
+	}
+
+	var hasForced bool
+	for _, avu := range avus {
+		if avu.Attr == forced.Attr && avu.Value == forced.Value {
+			hasForced = true
+			break
+		}
+	}
+	if !hasForced {
+		return false
+	}
+
+	archived, ok := archivedModTime(timestamps, avus)
+	if !ok {
+		return false
+	}
+
+	// Recorded times have a resolution of one second
+	return !localModTime.Truncate(time.Second).After(archived)
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file force_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	ex "github.com/wtsi-npg/extendo/v2"
+)
+
+func TestForcedCopies(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "reads1.fast5")
+	if !assert.NoError(t, os.WriteFile(file, []byte("12345"), 0600)) {
+		return
+	}
+	// A checksum file that is not stale, but wrong
+	if !assert.NoError(t, os.WriteFile(file+".md5",
+		[]byte("00000000000000000000000000000000\n"), 0600)) {
+		return
+	}
+
+	path, err := NewFilePath(file)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	forced := newForcedCopies(nil)
+	var fail bool
+	var copied int
+	copier := forced.makeForceCopier(func(path FilePath) error {
+		if fail {
+			return errors.New("failed to archive")
+		}
+		copied++
+		return nil
+	}, defaultChecksums)
+
+	fail = true
+	assert.Error(t, copier(path))
+	ok, err := forced.isForceCopied(path)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected a failed copy not to be recorded")
+	}
+
+	fail = false
+	assert.NoError(t, copier(path))
+	assert.Equal(t, 1, copied)
+	ok, err = forced.isForceCopied(path)
+	if assert.NoError(t, err) {
+		assert.True(t, ok)
+	}
+
+	checksum, err := os.ReadFile(file + ".md5")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "827ccb0eea8a706c4c34a16891f84e7b\n", string(checksum),
+			"expected the checksum file to be recalculated")
+	}
+
+	// Changed since, so to be archived by force again
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(file, later, later))
+	path, _ = NewFilePath(file)
+	ok, err = forced.isForceCopied(path)
+	if assert.NoError(t, err) {
+		assert.False(t, ok)
+	}
+
+	// After a restart, a copy recorded in the archive is found there
+	var consulted int
+	restarted := newForcedCopies(func(path FilePath) (bool, error) {
+		consulted++
+		return true, nil
+	})
+	for i := 0; i < 2; i++ {
+		ok, err = restarted.isForceCopied(path)
+		if assert.NoError(t, err) {
+			assert.True(t, ok)
+		}
+	}
+	assert.Equal(t, 1, consulted, "expected the archive to be consulted once")
+}
+
+func TestIsForceArchive(t *testing.T) {
+	forced := ForceArchivedMetadata("recovery-1")
+	assert.Equal(t, "valet:force_archived", forced.Attr)
+
+	archived := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	timestamps := []ex.Timestamp{{Modified: archived}}
+	avus := []ex.AVU{forced}
+	before := archived.Add(-time.Minute)
+
+	assert.True(t, isForceArchive(100, before, 100, timestamps, avus, forced))
+	assert.False(t, isForceArchive(100, before, 100, timestamps, avus,
+		ForceArchivedMetadata("recovery-2")),
+		"expected an archive by force for another recovery to be rejected")
+	assert.False(t, isForceArchive(100, before, 100, timestamps, nil, forced),
+		"expected an object not archived by force to be rejected")
+	assert.False(t, isForceArchive(100, before, 50, timestamps, avus, forced),
+		"expected a size mismatch to be rejected")
+	assert.False(t, isForceArchive(100, archived.Add(time.Minute), 100,
+		timestamps, avus, forced),
+		"expected a file modified since archiving to be rejected")
+}
+
+func TestArchiveFilesWorkPlanForceArchive(t *testing.T) {
+	params := ArchiveParams{LocalBase: "./testdata/valet",
+		RemoteBase: "/testZone/home/irods", ForceArchive: true,
+		ForceArchiveID: "recovery-1"}
+
+	plan, err := ArchiveFilesWorkPlan(context.Background(), params)
+	if assert.NoError(t, err) {
+		var found bool
+		for _, m := range plan {
+			if m.workDoc != "Archive" || m.work.Rank != 3 {
+				continue
+			}
+			found = true
+			assert.Equal(t, "Requires Copying && Is Not In Bundle && "+
+				"Is Not Archived By Force", m.predDoc)
+		}
+		assert.True(t, found)
+	}
+
+	unidentified := params
+	unidentified.ForceArchiveID = " "
+	_, err = ArchiveFilesWorkPlan(context.Background(), unidentified)
+	assert.Error(t, err)
+
+	external := params
+	external.ExternalChecksum = true
+	_, err = ArchiveFilesWorkPlan(context.Background(), external)
+	assert.Error(t, err)
+
+	bundled := params
+	bundled.Bundle = BundleParams{Patterns: []string{"**/fast5"}}
+	_, err = ArchiveFilesWorkPlan(context.Background(), bundled)
+	assert.Error(t, err)
+}
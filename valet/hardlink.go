@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file hardlink.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"os"
+	"sync"
+	"syscall"
+)
+
+// fileID identifies a file by its device and inode, which are shared by all the
+// hard links to it.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// minPruneSize is the number of files recorded by a HardLinks below which it
+// is not pruned.
+const minPruneSize = 1024
+
+// HardLinks records the first path seen for each file having more than one hard
+// link, so that the same content is worked on once, rather than once for each
+// of its paths. Files with a single link are not recorded.
+//
+// A record is dropped once its first path is gone, is no longer a link to the
+// same file, or its file has fewer than two links. This is checked whenever
+// another path of the file is seen, so that a remaining path is then worked on
+// as usual and a reused inode is not mistaken for a duplicate. All the records
+// are also checked each time their number doubles, so that those of files
+// never seen again do not accumulate.
+//
+// The methods of a nil *HardLinks do nothing, so that the detection of hard
+// links may be disabled by using nil.
+type HardLinks struct {
+	mu      sync.Mutex
+	first   map[fileID]string // The first path seen for each file
+	pruneAt int               // The number of records at which to prune next
+}
+
+// NewHardLinks returns a new, empty HardLinks.
+func NewHardLinks() *HardLinks {
+	return &HardLinks{first: make(map[fileID]string), pruneAt: minPruneSize}
+}
+
+// IsDuplicate returns true if path is a hard link to a file first seen at a
+// different path, which it also returns. Otherwise, it records path as the
+// first path of its file, if the file has more than one link.
+func (h *HardLinks) IsDuplicate(path FilePath) (bool, string) {
+	if h == nil || path.Info == nil || !path.Info.Mode().IsRegular() {
+		return false, ""
+	}
+
+	stat, ok := path.Info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false, ""
+	}
+
+	id := fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if stat.Nlink < 2 {
+		delete(h.first, id)
+		return false, ""
+	}
+
+	first, seen := h.first[id]
+	if seen && first != path.Location && isLinkTo(first, id) {
+		return true, first
+	}
+
+	h.first[id] = path.Location
+	if len(h.first) >= h.pruneAt {
+		h.prune()
+	}
+
+	return false, ""
+}
+
+// prune drops the records whose first path is no longer a link to their file.
+// The caller must hold the lock.
+func (h *HardLinks) prune() {
+	for id, first := range h.first {
+		if !isLinkTo(first, id) {
+			delete(h.first, id)
+		}
+	}
+
+	h.pruneAt = max(minPruneSize, 2*len(h.first))
+}
+
+// isLinkTo returns true if path is one of at least two hard links to the file
+// id.
+func isLinkTo(path string, id fileID) bool {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+
+	return ok && stat.Nlink >= 2 &&
+		uint64(stat.Dev) == id.dev && uint64(stat.Ino) == id.ino
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file hardlink_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHardLinks_IsDuplicate(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	first := filepath.Join(tmpDir, "first.fastq")
+	second := filepath.Join(tmpDir, "second.fastq")
+	single := filepath.Join(tmpDir, "single.fastq")
+
+	if !assert.NoError(t, os.WriteFile(first, []byte("reads"), 0644)) ||
+		!assert.NoError(t, os.Link(first, second)) ||
+		!assert.NoError(t, os.WriteFile(single, []byte("reads"), 0644)) {
+		return
+	}
+
+	fp1, _ := NewFilePath(first)
+	fp2, _ := NewFilePath(second)
+	fps, _ := NewFilePath(single)
+
+	links := NewHardLinks()
+
+	dup, _ := links.IsDuplicate(fp1)
+	assert.False(t, dup, "expected the first path not to be a duplicate")
+	dup, _ = links.IsDuplicate(fp1)
+	assert.False(t, dup, "expected the first path seen again not to be a duplicate")
+
+	dup, firstPath := links.IsDuplicate(fp2)
+	assert.True(t, dup, "expected the second path to be a duplicate")
+	assert.Equal(t, fp1.Location, firstPath)
+
+	dup, _ = links.IsDuplicate(fps)
+	assert.False(t, dup, "expected a file with one link not to be a duplicate")
+
+	var disabled *HardLinks
+	dup, _ = disabled.IsDuplicate(fp2)
+	assert.False(t, dup, "expected nil HardLinks to find no duplicates")
+
+	// Once the first path is gone, the remaining path is the first
+	third := filepath.Join(tmpDir, "third.fastq")
+	if !assert.NoError(t, os.Link(second, third)) ||
+		!assert.NoError(t, os.Remove(first)) {
+		return
+	}
+	fp2, _ = NewFilePath(second)
+	fp3, _ := NewFilePath(third)
+
+	dup, _ = links.IsDuplicate(fp2)
+	assert.False(t, dup, "expected a path whose first path is gone not to be a duplicate")
+	dup, firstPath = links.IsDuplicate(fp3)
+	assert.True(t, dup, "expected another path to be a duplicate of the new first path")
+	assert.Equal(t, fp2.Location, firstPath)
+}
+
+func TestHardLinks_Prune(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	links := NewHardLinks()
+
+	// A file whose links have all gone is dropped when pruned
+	gone := filepath.Join(tmpDir, "gone.fastq")
+	goneLink := filepath.Join(tmpDir, "gone_link.fastq")
+	if !assert.NoError(t, os.WriteFile(gone, []byte("reads"), 0644)) ||
+		!assert.NoError(t, os.Link(gone, goneLink)) {
+		return
+	}
+	fpg, _ := NewFilePath(gone)
+	links.IsDuplicate(fpg)
+
+	// A file whose links remain is kept
+	kept := filepath.Join(tmpDir, "kept.fastq")
+	keptLink := filepath.Join(tmpDir, "kept_link.fastq")
+	if !assert.NoError(t, os.WriteFile(kept, []byte("reads"), 0644)) ||
+		!assert.NoError(t, os.Link(kept, keptLink)) {
+		return
+	}
+	fpk, _ := NewFilePath(kept)
+	links.IsDuplicate(fpk)
+	assert.Len(t, links.first, 2)
+
+	if !assert.NoError(t, os.Remove(gone)) ||
+		!assert.NoError(t, os.Remove(goneLink)) {
+		return
+	}
+
+	links.prune()
+	assert.Len(t, links.first, 1)
+	assert.Contains(t, links.first, fileID{
+		dev: uint64(fpk.Info.Sys().(*syscall.Stat_t).Dev),
+		ino: uint64(fpk.Info.Sys().(*syscall.Stat_t).Ino)})
+	assert.Equal(t, minPruneSize, links.pruneAt)
+}
+
+func TestDoProcessFilesHardLinks(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	first := filepath.Join(tmpDir, "first.fastq")
+	second := filepath.Join(tmpDir, "second.fastq")
+	if !assert.NoError(t, os.WriteFile(first, []byte("reads"), 0644)) ||
+		!assert.NoError(t, os.Link(first, second)) {
+		return
+	}
+
+	fp1, _ := NewFilePath(first)
+	fp2, _ := NewFilePath(second)
+
+	var mu sync.Mutex
+	var worked []string
+
+	plan := WorkPlan{
+		WorkMatch{
+			pred: IsTrue,
+			work: Work{WorkFunc: func(path FilePath) error {
+				mu.Lock()
+				worked = append(worked, path.Location)
+				mu.Unlock()
+				return nil
+			}},
+		},
+	}
+
+	ch := make(chan FilePath, 2)
+	ch <- fp1
+	ch <- fp2
+	close(ch)
+
+	err := DoProcessFiles(context.Background(), ch,
+		ProcessParams{Plan: plan, MaxProc: 1, HardLinks: NewHardLinks()})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{fp1.Location}, worked)
+	}
+}
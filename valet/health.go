@@ -0,0 +1,140 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file health.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	ex "github.com/wtsi-npg/extendo/v2"
+	logs "github.com/wtsi-npg/logshim"
+)
+
+const (
+	HealthPath = "/healthz" // The liveness endpoint
+	ReadyPath  = "/readyz"  // The readiness endpoint
+
+	healthShutdownTimeout = 5 * time.Second
+)
+
+// Health records the state of the components valet depends on, for reporting
+// by the health check endpoints.
+type Health struct {
+	watching atomic.Bool    // True when the initial watches have been set up
+	cPool    *ex.ClientPool // The pool to test for iRODS connectivity, or nil
+}
+
+// NewHealth returns a new Health. If cPool is not nil, readiness requires
+// that a client can be obtained from it.
+func NewHealth(cPool *ex.ClientPool) *Health {
+	return &Health{cPool: cPool}
+}
+
+// SetWatching records whether the filesystem watcher has set up its initial
+// watches.
+func (h *Health) SetWatching(watching bool) {
+	h.watching.Store(watching)
+}
+
+// IsWatching returns true if the filesystem watcher has set up its initial
+// watches.
+func (h *Health) IsWatching() bool {
+	return h.watching.Load()
+}
+
+// CheckReady returns nil if valet is ready to do work, or an error
+// describing why it is not.
+func (h *Health) CheckReady() (err error) { // NRV
+	if !h.IsWatching() {
+		return errors.New("filesystem watches not established")
+	}
+	if h.cPool == nil {
+		return
+	}
+
+	var client *ex.Client
+	if client, err = getClient(h.cPool); err != nil {
+		return errors.Wrap(err, "iRODS client unavailable")
+	}
+
+	return h.cPool.Return(client)
+}
+
+// ServeHTTP responds to requests on HealthPath with 200 while the process is
+// alive and to requests on ReadyPath with 200 when ready, or 503 otherwise.
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case HealthPath:
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintln(w, "ok")
+	case ReadyPath:
+		if err := h.CheckReady(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = fmt.Fprintln(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintln(w, "ok")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// ServeHealth serves the health check endpoints of h on addr until the cancel
+// function of cancelCtx is called. It returns an error if it fails to listen
+// on addr. Errors while serving are logged.
+func ServeHealth(cancelCtx context.Context, addr string, h *Health) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, "ServeHealth")
+	}
+
+	log := logs.GetLogger()
+	server := &http.Server{Handler: h, ReadHeaderTimeout: time.Minute}
+
+	go func() {
+		log.Info().Str("addr", listener.Addr().String()).
+			Msg("serving health checks")
+		if err := server.Serve(listener); err != nil &&
+			err != http.ErrServerClosed {
+			log.Error().Err(err).Msg("health check server failed")
+		}
+	}()
+
+	go func() {
+		<-cancelCtx.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(),
+			healthShutdownTimeout)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("health check server shutdown failed")
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file health_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthServeHTTP(t *testing.T) {
+	health := NewHealth(nil)
+
+	status := func(path string) int {
+		rec := httptest.NewRecorder()
+		health.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, status(HealthPath))
+	assert.Equal(t, http.StatusServiceUnavailable, status(ReadyPath))
+	assert.Equal(t, http.StatusNotFound, status("/other"))
+
+	health.SetWatching(true)
+	assert.Equal(t, http.StatusOK, status(ReadyPath))
+
+	health.SetWatching(false)
+	assert.Equal(t, http.StatusServiceUnavailable, status(ReadyPath))
+}
+
+func TestWatchFilesHealth(t *testing.T) {
+	tmpDir := t.TempDir()
+	health := NewHealth(nil)
+
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	paths, errs := watchFiles(cancelCtx, tmpDir, IsRegular, IsFalse, 0, health)
+
+	assert.Eventually(t, health.IsWatching, 5*time.Second,
+		10*time.Millisecond, "initial watches were not recorded")
+
+	cancel()
+	for range paths {
+	}
+	for range errs {
+	}
+
+	assert.False(t, health.IsWatching(),
+		"end of watching was not recorded")
+}
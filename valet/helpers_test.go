@@ -52,7 +52,7 @@ func makeLocalPathTransform(root string) func(i []valet.FilePath) []string {
 	return func(items []valet.FilePath) []string {
 		var paths []string
 		for _, p := range items {
-			r, err := filepath.Rel(root, p.Location)
+			r, err := p.RelativeTo(root)
 			if err != nil {
 				panic(err)
 			}
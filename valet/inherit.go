@@ -0,0 +1,95 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file inherit.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	ex "github.com/wtsi-npg/extendo/v2"
+	logs "github.com/wtsi-npg/logshim"
+)
+
+// setInheritance enables inheritance on the collection coll. Neither extendo,
+// nor the baton clients it uses, has an operation to do this, so the iRODS
+// icommand ichmod is used, which must be on the PATH.
+func setInheritance(coll string) error {
+	out, err := exec.Command("ichmod", "inherit", coll).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "failed to enable inheritance on '%s': %s",
+			coll, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// ensureCollection ensures that the collection coll and its parents exist, as
+// Collection.Ensure does. If inherit is true, the missing collections are
+// instead created one at a time, from the top down, and inheritance is enabled
+// on each before its child is created. Collections that already exist are
+// never changed.
+func ensureCollection(client *ex.Client, coll string, inherit bool) error {
+	if !inherit {
+		return ex.NewCollection(client, coll).Ensure()
+	}
+
+	missing, err := missingCollections(coll, func(c string) (bool, error) {
+		return ex.NewCollection(client, c).Exists()
+	})
+	if err != nil {
+		return err
+	}
+
+	log := logs.GetLogger()
+	for _, c := range missing {
+		if _, err = ex.MakeCollection(client, c); err != nil {
+			return err
+		}
+		if err = setInheritance(c); err != nil {
+			return err
+		}
+
+		log.Debug().Str("path", c).Msg("created collection with inheritance")
+	}
+
+	return nil
+}
+
+// missingCollections returns the collections, of coll and its parents, that
+// do not exist according to exists, from the top down.
+func missingCollections(coll string,
+	exists func(coll string) (bool, error)) ([]string, error) {
+	var missing []string
+	for c := filepath.Clean(coll); c != filepath.Dir(c); c = filepath.Dir(c) {
+		ok, err := exists(c)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		missing = append([]string{c}, missing...)
+	}
+
+	return missing, nil
+}
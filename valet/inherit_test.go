@@ -0,0 +1,52 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file inherit_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMissingCollections(t *testing.T) {
+	existing := map[string]bool{"/testZone": true, "/testZone/archive": true}
+	exists := func(coll string) (bool, error) {
+		return existing[coll], nil
+	}
+
+	missing, err := missingCollections("/testZone/archive/expt/sample/", exists)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"/testZone/archive/expt",
+			"/testZone/archive/expt/sample"}, missing)
+	}
+
+	missing, err = missingCollections("/testZone/archive", exists)
+	if assert.NoError(t, err) {
+		assert.Empty(t, missing)
+	}
+
+	_, err = missingCollections("/testZone/archive/expt",
+		func(coll string) (bool, error) {
+			return false, errors.New("failed to connect")
+		})
+	assert.Error(t, err)
+}
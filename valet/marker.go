@@ -0,0 +1,240 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file marker.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	logs "github.com/wtsi-npg/logshim"
+)
+
+// ArchivedMarkerName is the name of the marker file placed in a run directory
+// to indicate that all its files have been archived.
+const ArchivedMarkerName = ".valet-archived"
+
+// ArchivedMarker is the content of an ArchivedMarkerName marker file.
+type ArchivedMarker struct {
+	ArchivedAt time.Time `json:"archived_at"` // When the marker was written
+	NumFiles   int       `json:"num_files"`   // The number of archived files present
+	NumBytes   int64     `json:"num_bytes"`   // The total size of those files
+}
+
+// IsRunArchivedMarked returns true if path is a MinKNOW run directory
+// containing an ArchivedMarkerName marker file.
+func IsRunArchivedMarked(path FilePath) (bool, error) {
+	ok, err := IsMinKNOWRunDir(path)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	info, err := os.Stat(filepath.Join(path.Location, ArchivedMarkerName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return info.Mode().IsRegular(), nil
+}
+
+// MakeIsRunArchived returns a predicate that will return true if its argument
+// is a MinKNOW run directory that has no remaining un-archived files. Every
+// file beneath the directory that requires compression or copying, according
+// to sel, is tested:
+//
+//  1. No file may require compression.
+//
+//  2. A file requiring copying must pass isArchived or, if it passes
+//     isInBundleDir, its directory must pass isBundleArchived.
+//
+// Files which are not to be archived, such as checksum files, are ignored. As
+// MinKNOW writes its run report once a run has finished, the directory must
+// also contain a report; this prevents a new run being considered archived
+// before it has written any data.
+func MakeIsRunArchived(isArchived FilePredicate, isInBundleDir FilePredicate,
+	isBundleArchived FilePredicate, sel Selection) FilePredicate {
+	sel = sel.OrBuiltIn()
+
+	return func(dir FilePath) (bool, error) {
+		ok, err := IsMinKNOWRunDir(dir)
+		if err != nil || !ok {
+			return false, err
+		}
+
+		log := logs.GetLogger()
+		hasReport := false
+		bundles := make(map[string]bool)
+
+		err = filepath.WalkDir(dir.Location,
+			func(p string, d fs.DirEntry, werr error) error {
+				if werr != nil {
+					return werr
+				}
+				if !d.Type().IsRegular() {
+					return nil
+				}
+
+				fp, ferr := NewFilePath(p)
+				if ferr != nil {
+					return ferr
+				}
+
+				done, perr := isFileArchived(fp, sel, isArchived,
+					isInBundleDir, isBundleArchived, bundles)
+				if perr != nil {
+					return perr
+				}
+				if !done {
+					log.Debug().Str("path", dir.Location).
+						Str("file", p).Msg("run has un-archived file")
+					return errRunNotArchived
+				}
+
+				if isReport, _ := IsMinKNOWReport(fp); isReport {
+					hasReport = true
+				}
+
+				return nil
+			})
+		if errors.Is(err, errRunNotArchived) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		return hasReport, nil
+	}
+}
+
+// errRunNotArchived is used to stop walking a run directory at the first
+// un-archived file.
+var errRunNotArchived = errors.New("run not archived")
+
+// isFileArchived returns true if fp does not require archiving, according to
+// sel, or has been archived individually or as part of a bundle. The bundles
+// map caches the archived state of bundle directories.
+func isFileArchived(fp FilePath, sel Selection, isArchived FilePredicate,
+	isInBundleDir FilePredicate, isBundleArchived FilePredicate,
+	bundles map[string]bool) (bool, error) {
+	ok, err := sel.RequiresCompression(fp)
+	if err != nil || ok {
+		return false, err
+	}
+
+	ok, err = sel.RequiresCopying(fp)
+	if err != nil || !ok {
+		return true, err
+	}
+
+	ok, err = isInBundleDir(fp)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return isArchived(fp)
+	}
+
+	dirPath := filepath.Dir(fp.Location)
+	if archived, seen := bundles[dirPath]; seen {
+		return archived, nil
+	}
+
+	bundleDir, err := NewFilePath(dirPath)
+	if err != nil {
+		return false, err
+	}
+
+	ok, err = isBundleArchived(bundleDir)
+	if err != nil {
+		return false, err
+	}
+	bundles[dirPath] = ok
+
+	return ok, nil
+}
+
+// WriteArchivedMarker writes an ArchivedMarkerName marker file into the run
+// directory path, recording the time and a summary of the archived files of
+// the built-in types present (see MakeArchivedMarkerWriter).
+func WriteArchivedMarker(path FilePath) error {
+	return MakeArchivedMarkerWriter(builtIn)(path)
+}
+
+// MakeArchivedMarkerWriter returns a WorkFunc that writes an ArchivedMarkerName
+// marker file into the run directory path, recording the time and a summary of
+// the archived files present, as selected by sel.
+func MakeArchivedMarkerWriter(sel Selection) WorkFunc {
+	sel = sel.OrBuiltIn()
+
+	return func(path FilePath) error {
+		if !path.Info.IsDir() {
+			return errors.Errorf("failed to mark %s archived as it is not "+
+				"a directory", path.Location)
+		}
+
+		marker := ArchivedMarker{ArchivedAt: time.Now().UTC()}
+
+		err := filepath.WalkDir(path.Location,
+			func(p string, d fs.DirEntry, werr error) error {
+				if werr != nil {
+					return werr
+				}
+				if !d.Type().IsRegular() {
+					return nil
+				}
+
+				fp, ferr := NewFilePath(p)
+				if ferr != nil {
+					return ferr
+				}
+
+				ok, perr := sel.RequiresCopying(fp)
+				if perr != nil || !ok {
+					return perr
+				}
+
+				marker.NumFiles++
+				marker.NumBytes += fp.Info.Size()
+				return nil
+			})
+		if err != nil {
+			return err
+		}
+
+		content, err := json.Marshal(marker)
+		if err != nil {
+			return err
+		}
+
+		logs.GetLogger().Info().Str("path", path.Location).
+			Int("num_files", marker.NumFiles).Msg("marking run archived")
+
+		return os.WriteFile(filepath.Join(path.Location, ArchivedMarkerName),
+			append(content, '\n'), 0644)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file marker_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// makeRunDir creates a MinKNOW run directory containing the named files
+// in a temporary directory.
+func makeRunDir(t *testing.T, names ...string) FilePath {
+	dir := filepath.Join(t.TempDir(), "20200212_1021_X1_PAE51234_4b8e0f6a")
+	if !assert.NoError(t, os.Mkdir(dir, 0700)) {
+		t.FailNow()
+	}
+
+	for _, name := range names {
+		p := filepath.Join(dir, name)
+		if !assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0700)) ||
+			!assert.NoError(t, os.WriteFile(p, []byte(name), 0600)) {
+			t.FailNow()
+		}
+	}
+
+	fp, err := NewFilePath(dir)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	return fp
+}
+
+func TestMakeIsRunArchived(t *testing.T) {
+	isRunArchived := MakeIsRunArchived(IsTrue, IsFalse, IsFalse, Selection{})
+	isNotArchived := MakeIsRunArchived(IsFalse, IsFalse, IsFalse, Selection{})
+
+	run := makeRunDir(t, "report_PAE51234_20200212_1021_4b8e0f6a.md",
+		"fast5_pass/reads.fast5", "reads.fast5.md5")
+
+	ok, err := isRunArchived(run)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected run to be archived")
+	}
+
+	ok, err = isNotArchived(run)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected run not to be archived")
+	}
+
+	// Nothing has been archived until MinKNOW has written its report
+	noReport := makeRunDir(t, "fast5_pass/reads.fast5")
+	ok, err = isRunArchived(noReport)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected run without report not to be archived")
+	}
+
+	uncompressed := makeRunDir(t, "report_PAE51234_20200212_1021_4b8e0f6a.md",
+		"fastq_pass/reads.fastq")
+	ok, err = isRunArchived(uncompressed)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected run requiring compression not to be "+
+			"archived")
+	}
+
+	// Bundled files are archived when their bundle is
+	isBundled := MakeIsRunArchived(IsFalse, IsTrue, IsTrue, Selection{})
+	ok, err = isBundled(run)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected bundled run to be archived")
+	}
+}
+
+func TestWriteArchivedMarker(t *testing.T) {
+	run := makeRunDir(t, "report_PAE51234_20200212_1021_4b8e0f6a.md",
+		"fast5_pass/reads.fast5", "reads.fast5.md5")
+
+	ok, err := IsRunArchivedMarked(run)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected run not to be marked")
+	}
+
+	if !assert.NoError(t, WriteArchivedMarker(run)) {
+		return
+	}
+
+	ok, err = IsRunArchivedMarked(run)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected run to be marked")
+	}
+
+	content, err := os.ReadFile(filepath.Join(run.Location, ArchivedMarkerName))
+	if assert.NoError(t, err) {
+		var marker ArchivedMarker
+		if assert.NoError(t, json.Unmarshal(content, &marker)) {
+			assert.Equal(t, 2, marker.NumFiles)
+			assert.False(t, marker.ArchivedAt.IsZero())
+		}
+	}
+}
+
+func TestRemoveDirectoryMarked(t *testing.T) {
+	run := makeRunDir(t)
+	if !assert.NoError(t, WriteArchivedMarker(run)) {
+		return
+	}
+
+	if assert.NoError(t, RemoveDirectory(run)) {
+		_, err := os.Stat(run.Location)
+		assert.True(t, os.IsNotExist(err), "expected marked run to be removed")
+	}
+
+	remaining := makeRunDir(t, "reads.fast5")
+	if !assert.NoError(t, WriteArchivedMarker(remaining)) {
+		return
+	}
+
+	if assert.NoError(t, RemoveDirectory(remaining)) {
+		_, err := os.Stat(filepath.Join(remaining.Location, ArchivedMarkerName))
+		assert.NoError(t, err, "expected marker to remain with files")
+	}
+}
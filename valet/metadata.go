@@ -0,0 +1,135 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file metadata.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	ex "github.com/wtsi-npg/extendo/v2"
+)
+
+// UserNamespace is the namespace of iRODS metadata supplied by the user to be
+// added to every archived data object e.g. study_id=1234 is added as
+// user:study_id=1234. Namespacing prevents user metadata from replacing the
+// metadata added by valet itself.
+const UserNamespace string = "user"
+
+// UnknownVersion is recorded as the valet version in provenance metadata when
+// Version is not set e.g. in a development build.
+const UnknownVersion string = "unknown"
+
+// UncompressedChecksumAttr is the attribute, in the OxfordNanoporeNamespace, of
+// the MD5 checksum metadata of the uncompressed content of a compressed data
+// object.
+const UncompressedChecksumAttr string = "md5_uncompressed"
+
+// metadataKeyRegex matches a valid user metadata key.
+var metadataKeyRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*$`)
+
+// ParseMetadata returns an AVU in the UserNamespace for each of specs, which
+// must be of the form key=value. A key must start with a letter and contain
+// only letters, digits, '_', '.' or '-'. The value must not be empty.
+func ParseMetadata(specs []string) ([]ex.AVU, error) {
+	var avus []ex.AVU
+	for _, spec := range specs {
+		key, value, ok := strings.Cut(spec, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		if !ok || !metadataKeyRegex.MatchString(key) || value == "" {
+			return nil, errors.Errorf("invalid metadata '%s': expected "+
+				"key=value where key contains only letters, digits, "+
+				"'_', '.' or '-'", spec)
+		}
+
+		avus = append(avus,
+			ex.AVU{Attr: key, Value: value}.WithNamespace(UserNamespace))
+	}
+
+	return avus, nil
+}
+
+// ReadMetadataFile returns the AVUs parsed from the file at path, which
+// contains one key=value pair per line, as described for ParseMetadata. Blank
+// lines and lines starting with '#' are ignored.
+func ReadMetadataFile(path string) ([]ex.AVU, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var specs []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		specs = append(specs, line)
+	}
+
+	avus, err := ParseMetadata(specs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "in metadata file '%s'", path)
+	}
+
+	return avus, nil
+}
+
+// ProvenanceMetadata returns AVUs recording which valet archived a data
+// object: the name of the host running valet (archived_by_host) and the
+// valet Version (archived_by_valet_version), both in the
+// OxfordNanoporeNamespace.
+func ProvenanceMetadata() ([]ex.AVU, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find the host name")
+	}
+
+	version := Version
+	if version == "" {
+		version = UnknownVersion
+	}
+
+	return []ex.AVU{
+		ex.AVU{Attr: "archived_by_host", Value: host}.
+			WithNamespace(OxfordNanoporeNamespace),
+		ex.AVU{Attr: "archived_by_valet_version", Value: version}.
+			WithNamespace(OxfordNanoporeNamespace),
+	}, nil
+}
+
+// UncompressedChecksumMetadata returns the value of the uncompressed checksum
+// metadata (see UncompressedChecksumAttr) in avus and true, or false if there
+// is none.
+func UncompressedChecksumMetadata(avus []ex.AVU) (string, bool) {
+	attr := ex.AVU{Attr: UncompressedChecksumAttr}.
+		WithNamespace(OxfordNanoporeNamespace).Attr
+
+	for _, avu := range avus {
+		if avu.Attr == attr {
+			return avu.Value, true
+		}
+	}
+
+	return "", false
+}
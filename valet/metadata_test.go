@@ -0,0 +1,117 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file metadata_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ex "github.com/wtsi-npg/extendo/v2"
+)
+
+func TestParseMetadata(t *testing.T) {
+	avus, err := ParseMetadata([]string{"study_id=1234",
+		" cost_code = S0001 ", "note=a=b"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []ex.AVU{
+			{Attr: "user:study_id", Value: "1234"},
+			{Attr: "user:cost_code", Value: "S0001"},
+			{Attr: "user:note", Value: "a=b"},
+		}, avus)
+	}
+
+	avus, err = ParseMetadata(nil)
+	if assert.NoError(t, err) {
+		assert.Empty(t, avus)
+	}
+
+	for _, spec := range []string{"study_id", "=1234", "study_id=",
+		"1study=1234", "md5:x=1234", "study id=1234"} {
+		_, err = ParseMetadata([]string{spec})
+		assert.Error(t, err, "expected an error for '%s'", spec)
+	}
+}
+
+func TestReadMetadataFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "meta.txt")
+	content := "# Campaign metadata\nstudy_id=1234\n\ncost_code=S0001\n"
+	if !assert.NoError(t, os.WriteFile(path, []byte(content), 0644)) {
+		return
+	}
+
+	avus, err := ReadMetadataFile(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []ex.AVU{
+			{Attr: "user:study_id", Value: "1234"},
+			{Attr: "user:cost_code", Value: "S0001"},
+		}, avus)
+	}
+
+	if !assert.NoError(t, os.WriteFile(path, []byte("invalid\n"), 0644)) {
+		return
+	}
+	_, err = ReadMetadataFile(path)
+	assert.Error(t, err)
+}
+
+func TestProvenanceMetadata(t *testing.T) {
+	defer func(v string) { Version = v }(Version)
+
+	host, err := os.Hostname()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	Version = "1.2.3"
+	avus, err := ProvenanceMetadata()
+	if assert.NoError(t, err) {
+		assert.ElementsMatch(t, []ex.AVU{
+			{Attr: "ont:archived_by_host", Value: host},
+			{Attr: "ont:archived_by_valet_version", Value: "1.2.3"},
+		}, avus)
+	}
+
+	Version = ""
+	avus, err = ProvenanceMetadata()
+	if assert.NoError(t, err) {
+		assert.Contains(t, avus, ex.AVU{Attr: "ont:archived_by_valet_version",
+			Value: UnknownVersion})
+	}
+}
+
+func TestUncompressedChecksumMetadata(t *testing.T) {
+	rawChecksum, found := UncompressedChecksumMetadata([]ex.AVU{
+		{Attr: ex.ChecksumAttr, Value: "348bd3ce10ec00ecc29d31ec97cd5839"},
+		{Attr: "ont:md5_uncompressed",
+			Value: "1181c1834012245d785120e3505ed169"},
+	})
+	if assert.True(t, found) {
+		assert.Equal(t, "1181c1834012245d785120e3505ed169", rawChecksum)
+	}
+
+	_, found = UncompressedChecksumMetadata([]ex.AVU{
+		{Attr: ex.ChecksumAttr, Value: "348bd3ce10ec00ecc29d31ec97cd5839"},
+		{Attr: "md5_uncompressed", Value: "1181c1834012245d785120e3505ed169"},
+	})
+	assert.False(t, found, "expected the attribute to require a namespace")
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file mtime.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"time"
+
+	ex "github.com/wtsi-npg/extendo/v2"
+)
+
+// SourceModifiedTimeAttr is the attribute, in the ValetNamespace, of the
+// metadata recording the modification time of the file from which a data
+// object was archived.
+const SourceModifiedTimeAttr string = "source_mtime"
+
+// SourceModifiedTimeMetadata returns an AVU recording the modification time of
+// path, in UTC and RFC 3339 format.
+func SourceModifiedTimeMetadata(path FilePath) ex.AVU {
+	return ex.AVU{Attr: SourceModifiedTimeAttr,
+		Value: path.Info.ModTime().UTC().Format(time.RFC3339)}.
+		WithNamespace(ValetNamespace)
+}
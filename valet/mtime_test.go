@@ -0,0 +1,50 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file mtime_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	ex "github.com/wtsi-npg/extendo/v2"
+)
+
+func TestSourceModifiedTimeMetadata(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "reads1.fast5")
+	if !assert.NoError(t, os.WriteFile(file, []byte("12345"), 0644)) {
+		return
+	}
+
+	mtime := time.Date(2019, 9, 4, 16, 14, 0, 0,
+		time.FixedZone("BST", 60*60))
+	if !assert.NoError(t, os.Chtimes(file, mtime, mtime)) {
+		return
+	}
+
+	fp, err := NewFilePath(file)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ex.AVU{Attr: "valet:source_mtime",
+			Value: "2019-09-04T15:14:00Z"}, SourceModifiedTimeMetadata(fp))
+	}
+}
@@ -22,6 +22,7 @@ package valet
 
 import (
 	"context"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
 	"time"
@@ -32,6 +33,10 @@ import (
 const DefaultSweepInterval = 5 * time.Minute
 const MinSweepInterval = 30 * time.Second
 
+// MaxSweepJitter is the maximum fraction of the sweep interval by which each
+// interval may be varied randomly.
+const MaxSweepJitter = 0.5
+
 const DefaultCleanupDelay = 14 * 24 * time.Hour
 const MinCleanupDelay = 60 * time.Second
 
@@ -42,11 +47,14 @@ const MinCleanupDelay = 60 * time.Second
 // Files encountered are reported to the caller on the first returned (output)
 // channel and any errors on the second (error) channel. Files are filtered by
 // testing with the predicate pred; only where the predicate returns true are
-// the files sent to the channel.
+// the files sent to the channel. Each file's sidecar files are stat-ed at most
+// once while pred is tested (see WithStatCache).
 //
 // The walking goroutine will continue to run until the directory tree is
 // fully traversed, or the cancel function of cancelCtx is called. Either will
-// close the output and error channels and exit the goroutine cleanly.
+// close the output and error channels and exit the goroutine cleanly. Once
+// cancelled, the goroutine never blocks sending to either channel, so the
+// caller need not drain them.
 func FindFiles(
 	ctx context.Context,
 	root string,
@@ -54,6 +62,7 @@ func FindFiles(
 	pruneFn FilePredicate) (<-chan FilePath, <-chan error) {
 
 	paths, errs := make(chan FilePath), make(chan error)
+	pred = WithStatCache(pred)
 
 	log := logs.GetLogger()
 	log.Debug().Str("root", root).Msg("started find")
@@ -64,7 +73,7 @@ func FindFiles(
 			log.Debug().
 				Str("root", root).
 				Str("path", path).Msg("cancelled find")
-			return filepath.SkipDir
+			return filepath.SkipAll
 		default:
 			if err != nil {
 				if os.IsNotExist(err) {
@@ -78,7 +87,7 @@ func FindFiles(
 				return nil
 			}
 
-			p := FilePath{FileResource{path}, info}
+			p := FilePath{FileResource: FileResource{path}, Info: info}
 
 			if _, perr := pruneFn(p); perr != nil {
 				if perr == filepath.SkipDir {
@@ -95,7 +104,9 @@ func FindFiles(
 				return perr
 			} else if ok {
 				log.Debug().Str("path", path).Msg("accepted by FindFiles")
-				paths <- p
+				if !sendPath(ctx, paths, p) {
+					return filepath.SkipAll
+				}
 			} else {
 				log.Debug().Str("path", path).Msg("rejected by FindFiles")
 			}
@@ -111,11 +122,11 @@ func FindFiles(
 
 		root, rerr := filepath.Abs(root)
 		if rerr != nil {
-			errs <- rerr
+			sendError(ctx, errs, rerr)
 		} else {
 			werr := filepath.Walk(root, walkFn) // Directory walk
 			if werr != nil {
-				errs <- werr
+				sendError(ctx, errs, werr)
 			}
 		}
 	}()
@@ -126,16 +137,74 @@ func FindFiles(
 // FindFilesInterval executes FindFiles every interval seconds. Aside from
 // having the additional intervals parameter, it behaves in the same way as
 // FindFiles.
+//
+// If jitter is greater than 0, each interval is varied randomly by up to that
+// fraction of interval (at most MaxSweepJitter) e.g. 0.1 for ±10%, so that
+// the sweeps of many instances started together do not remain synchronised.
+//
+// Only one sweep runs at a time. When ctx is cancelled, any sweep in progress
+// is stopped and drained before the output and error channels are closed, so
+// that no sweep goroutine remains and the caller need not drain them.
 func FindFilesInterval(
 	ctx context.Context,
 	root string, pred FilePredicate,
 	pruneFn FilePredicate,
-	interval time.Duration) (<-chan FilePath, <-chan error) {
+	interval time.Duration,
+	jitter float64) (<-chan FilePath, <-chan error) {
+
+	return findFilesInterval(ctx, root, pred, pruneFn, interval, jitter, 0,
+		nil, false)
+}
+
+// FindFilesIncremental behaves in the same way as FindFilesInterval, except
+// that sweeps after the first are incremental. An incremental sweep tests only
+// the files in directories that are new, or whose modification time has
+// changed, since the previous sweep. Directories are traversed as usual
+// because a change within a directory does not change the modification times
+// of its ancestors. A full sweep is made instead once fullInterval has
+// elapsed since the previous full sweep.
+//
+// A directory's modification time changes only when entries are added to,
+// removed from or renamed within it. Files whose state changes in other ways
+// (e.g. they become due for removal, or work on them failed and should be
+// retried) are found again by the next full sweep.
+func FindFilesIncremental(
+	ctx context.Context,
+	root string, pred FilePredicate,
+	pruneFn FilePredicate,
+	interval time.Duration,
+	jitter float64,
+	fullInterval time.Duration) (<-chan FilePath, <-chan error) {
+
+	return findFilesInterval(ctx, root, pred, pruneFn, interval, jitter,
+		fullInterval, nil, false)
+}
+
+// findFilesInterval sweeps root every interval, varied by jitter. If
+// fullInterval is greater than 0, sweeps are incremental, except once every
+// fullInterval. Otherwise, every sweep is a full sweep by FindFiles.
+//
+// Each interval received from intervals, if not nil, replaces interval from
+// then on. The next sweep is due one new interval after it is received, or
+// after the sweep in progress, if any, finishes.
+//
+// If stable is true, a file is only sent once it has the same size and
+// modification time as in the previous sweep that saw it, so that it has
+// been unchanged for at least one interval (see stableFiles).
+func findFilesInterval(
+	ctx context.Context,
+	root string, pred FilePredicate,
+	pruneFn FilePredicate,
+	interval time.Duration,
+	jitter float64,
+	fullInterval time.Duration,
+	intervals <-chan time.Duration,
+	stable bool) (<-chan FilePath, <-chan error) {
 
 	paths, errs := make(chan FilePath), make(chan error)
 
 	log := logs.GetLogger()
-	findTick := time.NewTicker(interval)
+	findTick := time.NewTicker(jitterInterval(interval, jitter))
 
 	go func() {
 		defer func() {
@@ -143,19 +212,43 @@ func FindFilesInterval(
 			close(errs)
 		}()
 
-		finder := func(now time.Time) {
-			log.Debug().Str("root", root).
-				Time("at", now).Msg("starting interval sweep")
+		state := &sweepState{}
+		var lastFull time.Time
 
-			ipaths, ierrs := FindFiles(ctx, root, pred, pruneFn)
+		var stability *stableFiles
+		if stable {
+			stability = newStableFiles(pred)
+		}
 
-			for path := range ipaths {
-				log.Debug().Msg("interval sweep sending path")
-				paths <- path
+		finder := func(now time.Time) {
+			var ipaths <-chan FilePath
+			var ierrs <-chan error
+			full := true
+
+			switch {
+			case fullInterval <= 0:
+				log.Debug().Str("root", root).
+					Time("at", now).Msg("starting interval sweep")
+				ipaths, ierrs = FindFiles(ctx, root, pred, pruneFn)
+			case lastFull.IsZero() || now.Sub(lastFull) >= fullInterval:
+				log.Debug().Str("root", root).
+					Time("at", now).Msg("starting full interval sweep")
+				state, lastFull = &sweepState{}, now
+				ipaths, ierrs = findChangedFiles(ctx, root, pred, pruneFn,
+					state)
+			default:
+				log.Debug().Str("root", root).
+					Time("at", now).Msg("starting incremental interval sweep")
+				ipaths, ierrs = findChangedFiles(ctx, root, pred, pruneFn,
+					state)
+				full = false
 			}
-			for err := range ierrs {
-				errs <- err
+
+			if stability != nil {
+				ipaths = stability.filter(ipaths, full)
 			}
+
+			relaySweep(ctx, ipaths, ierrs, paths, errs)
 		}
 
 		// find files immediately
@@ -165,7 +258,14 @@ func FindFilesInterval(
 		for {
 			select {
 			case now := <-findTick.C:
+				if jitter > 0 {
+					findTick.Reset(jitterInterval(interval, jitter))
+				}
 				finder(now)
+			case interval = <-intervals:
+				log.Info().Str("root", root).Dur("interval", interval).
+					Msg("changed sweep interval")
+				findTick.Reset(jitterInterval(interval, jitter))
 			case <-ctx.Done():
 				log.Debug().Str("root", root).
 					Msg("cancelled interval sweep")
@@ -177,3 +277,321 @@ func FindFilesInterval(
 
 	return paths, errs
 }
+
+// fileSignature is the size and modification time of a file seen by a sweep.
+type fileSignature struct {
+	size    int64
+	modTime time.Time
+	pending bool // The file has not yet been sent, awaiting another sweep
+}
+
+func (sig fileSignature) matches(info os.FileInfo) bool {
+	return sig.size == info.Size() && sig.modTime.Equal(info.ModTime())
+}
+
+// stableFiles records the signature of each regular file seen by a sweep, so
+// that a later sweep may send only the files that are unchanged since. A file
+// is therefore first sent by the sweep after the one that first saw it, having
+// been unchanged for at least one interval. Files that are not regular, such
+// as run directories, are sent as usual.
+//
+// An incremental sweep does not see the files in directories that have not
+// changed (see findChangedFiles), so at the end of such a sweep, each file
+// awaiting another sweep that it did not see is stat-ed directly and, if
+// unchanged and still matching pred, sent then.
+type stableFiles struct {
+	pred FilePredicate
+	seen map[string]fileSignature
+}
+
+func newStableFiles(pred FilePredicate) *stableFiles {
+	return &stableFiles{pred: pred, seen: make(map[string]fileSignature)}
+}
+
+// filter returns a channel of the stable paths of in, which is read until
+// closed. If full is true, the sweep saw every file, so that the signatures of
+// files it did not see are forgotten. The stableFiles must not be used again
+// until the returned channel is closed.
+func (s *stableFiles) filter(in <-chan FilePath, full bool) <-chan FilePath {
+	out := make(chan FilePath)
+
+	go func() {
+		defer close(out)
+
+		log := logs.GetLogger()
+		next := make(map[string]fileSignature)
+
+		for path := range in {
+			if path.Info == nil || !path.Info.Mode().IsRegular() {
+				out <- path
+				continue
+			}
+
+			prev, ok := s.seen[path.Location]
+			if ok && prev.matches(path.Info) {
+				next[path.Location] = fileSignature{size: prev.size,
+					modTime: prev.modTime}
+				out <- path
+				continue
+			}
+
+			log.Debug().Str("path", path.Location).
+				Msg("deferring until unchanged for a sweep")
+			next[path.Location] = fileSignature{size: path.Info.Size(),
+				modTime: path.Info.ModTime(), pending: true}
+		}
+
+		if !full {
+			for loc, sig := range s.seen {
+				if _, ok := next[loc]; ok {
+					continue
+				}
+				if sig.pending {
+					var path FilePath
+					var ok bool
+					if path, sig, ok = s.recheck(loc, sig); !ok {
+						continue
+					}
+					if !sig.pending {
+						out <- path
+					}
+				}
+				next[loc] = sig
+			}
+		}
+
+		s.seen = next
+	}()
+
+	return out
+}
+
+// recheck stats the file at loc, which awaits another sweep, having been seen
+// with signature sig. It returns the file, its new signature and true, or
+// false if the file no longer exists. The file remains pending if it has
+// changed, or does not match pred.
+func (s *stableFiles) recheck(loc string,
+	sig fileSignature) (FilePath, fileSignature, bool) {
+	path, err := NewFilePath(loc)
+	if err != nil {
+		return FilePath{}, sig, false
+	}
+
+	if !sig.matches(path.Info) {
+		return path, fileSignature{size: path.Info.Size(),
+			modTime: path.Info.ModTime(), pending: true}, true
+	}
+
+	ok, err := s.pred(path)
+	if err != nil {
+		logs.GetLogger().Debug().Err(err).Str("path", loc).
+			Msg("failed to test a stable file")
+	}
+	sig.pending = !ok
+
+	return path, sig, true
+}
+
+// relaySweep relays the paths and errors of a single sweep to paths and errs,
+// until both of the sweep's channels are closed. Once ctx is cancelled, the
+// remainder are discarded, so that the sweep's goroutine has stopped by the
+// time relaySweep returns.
+func relaySweep(ctx context.Context,
+	ipaths <-chan FilePath, ierrs <-chan error,
+	paths chan<- FilePath, errs chan<- error) {
+	for ipaths != nil || ierrs != nil {
+		select {
+		case path, ok := <-ipaths:
+			if !ok {
+				ipaths = nil
+				continue
+			}
+			sendPath(ctx, paths, path)
+		case err, ok := <-ierrs:
+			if !ok {
+				ierrs = nil
+				continue
+			}
+			sendError(ctx, errs, err)
+		}
+	}
+}
+
+// sendPath sends path on paths and returns true, unless ctx is cancelled
+// first, when it returns false. Finders use this so that they never block
+// once their consumer has stopped receiving after cancellation.
+func sendPath(ctx context.Context, paths chan<- FilePath, path FilePath) bool {
+	select {
+	case paths <- path:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// sendError sends err on errs and returns true, unless ctx is cancelled
+// first, when it returns false (see sendPath).
+func sendError(ctx context.Context, errs chan<- error, err error) bool {
+	select {
+	case errs <- err:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// jitterInterval returns interval varied randomly by up to the fraction
+// jitter of interval, in either direction. The fraction is limited to
+// MaxSweepJitter. If jitter is not greater than 0, interval is returned
+// unchanged.
+func jitterInterval(interval time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	if jitter > MaxSweepJitter {
+		jitter = MaxSweepJitter
+	}
+
+	offset := (rand.Float64()*2 - 1) * jitter * float64(interval)
+
+	return interval + time.Duration(offset)
+}
+
+// sweepState records the modification times of the directories seen by a
+// sweep, so that a later sweep may skip the files in directories that have not
+// changed since. An empty sweepState causes every file to be tested.
+type sweepState struct {
+	started time.Time            // When the sweep started
+	dirs    map[string]time.Time // Directory modification times
+}
+
+// isChanged returns true if the directory dir, having modification time mtime,
+// is new or may have changed since the sweep recorded in the state. A
+// directory modified after that sweep started is considered changed, even if
+// its modification time is the same as that recorded, because the resolution
+// of modification times may be too coarse to show a change made during the
+// sweep.
+func (s *sweepState) isChanged(dir string, mtime time.Time) bool {
+	prev, ok := s.dirs[dir]
+
+	return !ok || !prev.Equal(mtime) || !mtime.Before(s.started)
+}
+
+// findChangedFiles walks the directory tree under root in the same way as
+// FindFiles, except that files in directories which have not changed since the
+// sweep recorded in state are skipped without being tested. Directories are
+// tested only if they have changed. When the walk is complete, state is
+// replaced by a record of this sweep; it must not be used by the caller until
+// the returned channels are closed. If the walk is incomplete, state is
+// emptied so that the next sweep tests every file.
+func findChangedFiles(
+	ctx context.Context,
+	root string,
+	pred FilePredicate,
+	pruneFn FilePredicate,
+	state *sweepState) (<-chan FilePath, <-chan error) {
+
+	paths, errs := make(chan FilePath), make(chan error)
+	pred = WithStatCache(pred)
+
+	log := logs.GetLogger()
+	log.Debug().Str("root", root).Msg("started find")
+
+	next := &sweepState{started: time.Now(), dirs: make(map[string]time.Time)}
+	changed := make(map[string]bool) // The changed state of each directory
+	cancelled := false
+
+	walkFn := func(path string, d os.DirEntry, err error) error {
+		select {
+		case <-ctx.Done():
+			log.Debug().
+				Str("root", root).
+				Str("path", path).Msg("cancelled find")
+			cancelled = true
+			return filepath.SkipAll
+		default:
+		}
+
+		// Files in unchanged directories are skipped without a stat
+		if err == nil && !d.IsDir() && !changed[filepath.Dir(path)] {
+			return nil
+		}
+
+		var info os.FileInfo
+		if err == nil {
+			info, err = d.Info()
+		}
+		if err != nil {
+			if os.IsNotExist(err) {
+				log.Warn().Err(err).Str("path", path).
+					Msg("file was deleted")
+				return nil
+			}
+
+			log.Error().Err(err).Str("path", path).
+				Msg("while walking")
+			return nil
+		}
+
+		p := FilePath{FileResource: FileResource{path}, Info: info}
+
+		if _, perr := pruneFn(p); perr != nil {
+			if perr == filepath.SkipDir {
+				log.Info().
+					Str("path", path).
+					Str("reason", perr.Error()).Msg("pruned path")
+				return perr
+			}
+		}
+
+		if info.IsDir() {
+			next.dirs[path] = info.ModTime()
+			changed[path] = state.isChanged(path, info.ModTime())
+			if !changed[path] {
+				return nil
+			}
+		}
+
+		ok, perr := pred(p) // Predicate test
+
+		if perr != nil {
+			return perr
+		} else if ok {
+			log.Debug().Str("path", path).Msg("accepted by FindFiles")
+			if !sendPath(ctx, paths, p) {
+				cancelled = true
+				return filepath.SkipAll
+			}
+		} else {
+			log.Debug().Str("path", path).Msg("rejected by FindFiles")
+		}
+		return nil
+	}
+
+	go func() {
+		defer func() {
+			close(paths)
+			close(errs)
+		}()
+
+		root, rerr := filepath.Abs(root)
+		if rerr != nil {
+			*state = sweepState{}
+			sendError(ctx, errs, rerr)
+			return
+		}
+
+		werr := filepath.WalkDir(root, walkFn) // Directory walk
+		if werr != nil || cancelled {
+			*state = sweepState{}
+		} else {
+			*state = *next
+		}
+
+		if werr != nil {
+			sendError(ctx, errs, werr)
+		}
+	}()
+
+	return paths, errs
+}
@@ -0,0 +1,247 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file pathfind_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJitterInterval(t *testing.T) {
+	interval := time.Minute
+
+	assert.Equal(t, interval, jitterInterval(interval, 0))
+	assert.Equal(t, interval, jitterInterval(interval, -0.1))
+
+	varied := false
+	for i := 0; i < 1000; i++ {
+		d := jitterInterval(interval, 0.1)
+		assert.GreaterOrEqual(t, d, 54*time.Second)
+		assert.LessOrEqual(t, d, 66*time.Second)
+		varied = varied || d != interval
+	}
+	assert.True(t, varied, "expected the interval to vary")
+
+	// The jitter is limited to MaxSweepJitter
+	for i := 0; i < 1000; i++ {
+		d := jitterInterval(interval, 10)
+		assert.GreaterOrEqual(t, d, 30*time.Second)
+		assert.LessOrEqual(t, d, 90*time.Second)
+	}
+}
+
+func TestFindChangedFiles(t *testing.T) {
+	root := t.TempDir()
+
+	for _, name := range []string{"a/f1", "b/f2", "d/e/f3"} {
+		p := filepath.Join(root, name)
+		if !assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0755)) ||
+			!assert.NoError(t, os.WriteFile(p, []byte(name), 0644)) {
+			return
+		}
+	}
+
+	// Ensure that the directories predate the sweeps
+	past := time.Now().Add(-time.Hour)
+	for _, dir := range []string{"", "a", "b", "d", "d/e"} {
+		if !assert.NoError(t, os.Chtimes(filepath.Join(root, dir),
+			past, past)) {
+			return
+		}
+	}
+
+	sweep := func(state *sweepState) []string {
+		var found []string
+		paths, errs := findChangedFiles(context.Background(), root,
+			IsRegular, IsFalse, state)
+		for p := range paths {
+			rel, err := p.RelativeTo(root)
+			assert.NoError(t, err)
+			found = append(found, rel)
+		}
+		for err := range errs {
+			assert.NoError(t, err)
+		}
+		return found
+	}
+
+	state := &sweepState{}
+	assert.ElementsMatch(t, []string{"a/f1", "b/f2", "d/e/f3"}, sweep(state),
+		"expected a full sweep to find all files")
+
+	assert.Empty(t, sweep(state),
+		"expected no files to be found in unchanged directories")
+
+	// Adding a file changes only its own directory
+	f4 := filepath.Join(root, "d/e/f4")
+	if !assert.NoError(t, os.WriteFile(f4, []byte("f4"), 0644)) {
+		return
+	}
+	assert.ElementsMatch(t, []string{"d/e/f3", "d/e/f4"}, sweep(state))
+
+	// A new directory is always searched
+	f5 := filepath.Join(root, "b/g/f5")
+	if !assert.NoError(t, os.MkdirAll(filepath.Dir(f5), 0755)) ||
+		!assert.NoError(t, os.WriteFile(f5, []byte("f5"), 0644)) {
+		return
+	}
+	assert.ElementsMatch(t, []string{"b/f2", "b/g/f5"}, sweep(state))
+
+	assert.ElementsMatch(t, []string{"a/f1", "b/f2", "b/g/f5", "d/e/f3",
+		"d/e/f4"}, sweep(&sweepState{}),
+		"expected a sweep with an empty state to find all files")
+}
+
+func TestFindFilesIntervalCancelled(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 10; i++ {
+		p := filepath.Join(root, fmt.Sprintf("f%d", i))
+		if !assert.NoError(t, os.WriteFile(p, []byte("f"), 0644)) {
+			return
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	paths, errs := FindFilesInterval(ctx, root, IsRegular, IsFalse,
+		100*time.Millisecond, 0)
+
+	// Stop receiving part way through the first sweep
+	<-paths
+	cancel()
+
+	closed := make(chan struct{})
+	go func() {
+		for range errs {
+		}
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		_, ok := <-paths
+		assert.False(t, ok, "expected the paths channel to be closed")
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "expected the channels to close without draining "+
+			"the remaining paths")
+	}
+}
+
+func TestFindFilesIntervalChanged(t *testing.T) {
+	root := t.TempDir()
+	if !assert.NoError(t, os.WriteFile(filepath.Join(root, "f1"),
+		[]byte("f1"), 0644)) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	intervals := make(chan time.Duration, 1)
+	paths, _ := findFilesInterval(ctx, root, IsRegular, IsFalse, time.Hour,
+		0, 0, intervals, false)
+
+	// The first sweep is immediate, the second is due after the new interval
+	<-paths
+	intervals <- 100 * time.Millisecond
+
+	select {
+	case p := <-paths:
+		assert.Equal(t, filepath.Join(root, "f1"), p.Location)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "expected a sweep after the interval was changed")
+	}
+}
+
+func TestFindFilesIntervalError(t *testing.T) {
+	root := t.TempDir()
+	if !assert.NoError(t, os.WriteFile(filepath.Join(root, "f1"),
+		[]byte("f1"), 0644)) {
+		return
+	}
+
+	failing := func(path FilePath) (bool, error) {
+		return false, errors.New("predicate failed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, errs := FindFilesInterval(ctx, root, failing, IsFalse, time.Hour, 0)
+
+	select {
+	case err := <-errs:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "expected the sweep error to be relayed")
+	}
+}
+
+func TestStableFiles(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"f1", "f2", "f3"} {
+		p := filepath.Join(root, name)
+		if !assert.NoError(t, os.WriteFile(p, []byte(name), 0644)) {
+			return
+		}
+	}
+
+	stability := newStableFiles(IsRegular)
+	sweep := func(full bool, names ...string) []string {
+		in := make(chan FilePath, len(names))
+		for _, name := range names {
+			p, err := NewFilePath(filepath.Join(root, name))
+			if assert.NoError(t, err) {
+				in <- p
+			}
+		}
+		close(in)
+
+		var found []string
+		for p := range stability.filter(in, full) {
+			rel, _ := filepath.Rel(root, p.Location)
+			found = append(found, rel)
+		}
+		return found
+	}
+
+	assert.Empty(t, sweep(true, "f1", "f2"),
+		"expected no files from the first sweep to see them")
+
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "f2"),
+		[]byte("f2 appended"), 0644))
+	assert.ElementsMatch(t, []string{"f1"}, sweep(true, "f1", "f2"),
+		"expected a changed file to be deferred")
+	assert.ElementsMatch(t, []string{"f1", "f2"}, sweep(true, "f1", "f2"))
+
+	assert.ElementsMatch(t, []string{"."}, sweep(false, ".", "f3"),
+		"expected a directory to be sent at once")
+	assert.ElementsMatch(t, []string{"f3"}, sweep(false),
+		"expected a pending file unseen by an incremental sweep to be "+
+			"sent once unchanged")
+	assert.Empty(t, sweep(false),
+		"expected a file to be sent only once by incremental sweeps")
+}
@@ -22,6 +22,8 @@ package valet
 
 import (
 	"context"
+	"os"
+	"sort"
 	"sync"
 	"time"
 
@@ -33,12 +35,218 @@ type token struct{}
 type semaphore chan token
 
 type ProcessParams struct {
-	Root          string        // The local root directory to work on.
-	MatchFunc     FilePredicate // The file selecting predicate.
-	PruneFunc     FilePredicate // The local directory tree pruning predicate.
-	Plan          WorkPlan      // The plan for selected files.
-	SweepInterval time.Duration // The interval between sweeps of the local directory tree.
-	MaxProc       int           // The maximum number of threads to run.
+	Root             string        // The local root directory to work on.
+	MatchFunc        FilePredicate // The file selecting predicate.
+	PruneFunc        FilePredicate // The local directory tree pruning predicate.
+	Plan             WorkPlan      // The plan for selected files.
+	SweepInterval    time.Duration // The interval between sweeps of the local directory tree.
+	SweepJitter      float64       // The fraction of SweepInterval by which to vary it randomly (0 for none).
+	WatchGrace       time.Duration // The time a watched file must be unchanged before it is worked on (0 for none).
+	FullSweep        time.Duration // The interval between full sweeps, if sweeps are incremental (0 for all full).
+	MaxProc          int           // The maximum number of threads to run.
+	ChecksumWorkers  int           // The maximum number of CPU-bound WorkFuncs to run (0 to share MaxProc).
+	MaxBytesInFlight int64         // The maximum total size of files worked on at once (0 for no limit).
+	FileTimeout      time.Duration // The maximum time to work on one file (0 for no limit).
+	Quarantine       *Quarantine   // Quarantine for repeatedly failing files (optional).
+	Pause            *Pause        // Pause control for the dispatch of work (optional).
+	Health           *Health       // Health state to update (optional).
+
+	// New values of SweepInterval, applied while running (optional).
+	SweepIntervals <-chan time.Duration
+
+	// The daily window outside which Windowed Work is skipped (optional).
+	Window *WorkWindow
+
+	// Hard links to files already seen, which are skipped (optional).
+	HardLinks *HardLinks
+
+	// Sweeps send only files unchanged since the previous sweep, so that
+	// files still being written are not worked on (see findFilesInterval).
+	StableSweep bool
+
+	// The number of work errors after which processing is cancelled and an
+	// error returned (0 for no limit, see ErrorLimit).
+	MaxErrors uint64
+
+	// The maximum number of files of any one run to work on at once (0 for no
+	// limit, see RunLimit).
+	MaxProcPerRun int
+
+	// The time to wait for Root to be created, if it does not exist, before
+	// returning an error (0 not to wait, see waitForDir).
+	WaitForRoot time.Duration
+
+	errLimit *ErrorLimit // The limit shared by ProcessFiles with DoProcessFiles
+}
+
+// workLimits limits the number of WorkFuncs running concurrently, with
+// separate limits for CPU-bound work (e.g. compression and checksumming) and
+// other work (e.g. archiving). A file waits for a slot before each of its
+// WorkFuncs, rather than once for all of them (see fileSlots).
+type workLimits struct {
+	cpu semaphore // Slots for CPU-bound work
+	io  semaphore // Slots for other work
+}
+
+// newWorkLimits returns limits of maxThreads WorkFuncs and cpuThreads
+// CPU-bound WorkFuncs. If cpuThreads is 0, both kinds of work share the
+// maxThreads slots.
+func newWorkLimits(maxThreads int, cpuThreads int) *workLimits {
+	l := &workLimits{io: make(semaphore, maxThreads)}
+	l.cpu = l.io
+	if cpuThreads > 0 {
+		l.cpu = make(semaphore, cpuThreads)
+	}
+
+	return l
+}
+
+// forFile returns fileSlots for the work on one file.
+func (l *workLimits) forFile() *fileSlots {
+	return &fileSlots{limits: l}
+}
+
+// fileSlots tracks the slot held by the work on one file, so that the slot may
+// be released if the work is abandoned.
+//
+// The methods of a nil *fileSlots do nothing, so that limits may be disabled
+// by using nil.
+type fileSlots struct {
+	limits    *workLimits
+	mu        sync.Mutex
+	held      semaphore // The semaphore of the slot held, if any
+	abandoned bool      // The work has been abandoned and holds no slots
+}
+
+// acquire blocks until there is a slot for work and takes it. It returns a
+// function that releases the slot. Once abandoned, no slots are taken.
+func (s *fileSlots) acquire(work Work) func() {
+	if s == nil {
+		return func() {}
+	}
+
+	sem := s.limits.io
+	if work.CPUBound {
+		sem = s.limits.cpu
+	}
+
+	s.mu.Lock()
+	abandoned := s.abandoned
+	s.mu.Unlock()
+	if abandoned {
+		return func() {}
+	}
+
+	sem <- token{}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.abandoned {
+		<-sem
+		return func() {}
+	}
+	s.held = sem
+
+	return s.release
+}
+
+// release releases any slot held.
+func (s *fileSlots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.held != nil {
+		<-s.held
+		s.held = nil
+	}
+}
+
+// abandon releases any slot held and prevents any more being taken, so that
+// abandoned work continuing in the background does not occupy a slot.
+func (s *fileSlots) abandon() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.abandoned = true
+	s.mu.Unlock()
+
+	s.release()
+}
+
+// byteBudget limits the total size of the files being worked on concurrently.
+// A file larger than the whole budget is admitted only when no other files
+// are being worked on, so that it cannot block forever.
+type byteBudget struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int64 // The budget, or 0 for no limit
+	used  int64 // The total size of the files being worked on
+}
+
+func newByteBudget(limit int64) *byteBudget {
+	b := &byteBudget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire blocks until n bytes of budget are available and then takes them.
+func (b *byteBudget) acquire(n int64) {
+	if b.limit <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	for b.used > 0 && b.used+n > b.limit {
+		b.cond.Wait()
+	}
+	b.used += n
+	b.mu.Unlock()
+}
+
+// release returns n bytes of budget.
+func (b *byteBudget) release(n int64) {
+	if b.limit <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// runWork runs work on path. If ctx has a deadline and the work does not
+// finish by then, runWork returns a channel on which the result of the
+// abandoned work will be sent when it finishes. Otherwise, it returns a nil
+// channel and the result of the work.
+func runWork(ctx context.Context, work Work,
+	path FilePath) (<-chan error, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		return nil, work.do(ctx, path)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- work.do(ctx, path)
+	}()
+
+	select {
+	case err := <-done:
+		return nil, err
+	case <-ctx.Done():
+		return done, nil
+	}
+}
+
+// fileSize returns the size of path for the purposes of the byte budget.
+func fileSize(path FilePath) int64 {
+	if path.Info == nil || !path.Info.Mode().IsRegular() {
+		return 0
+	}
+	return path.Info.Size()
 }
 
 // ProcessFiles detects files to work on, dispatches any files found to
@@ -50,17 +258,54 @@ type ProcessParams struct {
 // function to return an error itself. Error that occur during processing are
 // counted. If when cancelled, this function has counted any processing errors,
 // it will return an error itself.
+//
+// Named pipes, sockets and device files are never worked on, whatever the
+// match function (see IsSpecial).
+//
+// If a Pause is supplied, files detected while paused are held in a buffer of
+// up to PauseBufferSize files until processing is resumed. If cancelled while
+// paused, the held files are not worked on.
+//
+// If WaitForRoot is greater than 0 and the root directory does not exist, the
+// detection of files starts once it has been created. An error is returned if
+// it is not created within WaitForRoot.
 func ProcessFiles(cancelCtx context.Context, params ProcessParams) error {
+	if params.WaitForRoot > 0 {
+		if err := waitForDir(cancelCtx, params.Root,
+			params.WaitForRoot); err != nil {
+			return err
+		}
+	}
+
+	// Special files are excluded whatever the match function, because a
+	// worker opening one could block indefinitely
+	matchFn := And(Not(IsSpecial), params.MatchFunc)
+
+	// Exceeding the error limit cancels the detection of files, as would the
+	// caller
+	if params.MaxErrors > 0 {
+		var cancel context.CancelFunc
+		cancelCtx, cancel = context.WithCancel(cancelCtx)
+		defer cancel()
+		params.errLimit = NewErrorLimit(params.MaxErrors, cancel)
+	}
 
-	wpaths, werrs := WatchFiles(cancelCtx, params.Root, params.MatchFunc,
-		params.PruneFunc)
-	fpaths, ferrs := FindFilesInterval(cancelCtx, params.Root, params.MatchFunc,
-		params.PruneFunc, params.SweepInterval)
+	wpaths, werrs := watchFiles(cancelCtx, params.Root, matchFn,
+		params.PruneFunc, params.WatchGrace, params.Health)
+	fpaths, ferrs := findFilesInterval(cancelCtx, params.Root,
+		matchFn, params.PruneFunc, params.SweepInterval, params.SweepJitter,
+		params.FullSweep, params.SweepIntervals, params.StableSweep)
 
-	paths := MergeFileChannels(wpaths, fpaths)
+	var paths <-chan FilePath = MergeFileChannels(wpaths, fpaths)
 	errs := MergeErrorChannels(werrs, ferrs)
 	log := logs.GetLogger()
 
+	if params.Pause != nil {
+		paths = bufferFilePaths(paths, PauseBufferSize)
+		stop := context.AfterFunc(cancelCtx, params.Pause.cancel)
+		defer stop()
+	}
+
 	// Inform the user that cancellation has started because it can take a
 	// while for jobs to complete. This blocks until then, or until the data-
 	// and error-processing goroutines return, when a send on the noCancelMsg
@@ -83,7 +328,7 @@ func ProcessFiles(cancelCtx context.Context, params ProcessParams) error {
 	go func() {
 		defer wg.Done()
 
-		perr = DoProcessFiles(paths, params.Plan, params.MaxProc)
+		perr = DoProcessFiles(cancelCtx, paths, params)
 	}()
 
 	// Log as warnings any errors encountered
@@ -101,68 +346,225 @@ func ProcessFiles(cancelCtx context.Context, params ProcessParams) error {
 	noCancelMsg <- token{}
 	log.Info().Msg("processing done")
 
+	if params.errLimit.Exceeded() {
+		return withUnreachable(errors.Errorf("aborted after %d errors, "+
+			"exceeding the maximum of %d", params.errLimit.Count(),
+			params.MaxErrors), IsUnreachable(perr))
+	}
+
 	return perr
 }
 
-// DoProcessFiles operates by applying workPlan to each FilePath in the paths
-// channel. Each WorkPlan is executed in its own goroutine, with no more than
-// maxThreads goroutines running in parallel.
+// DoProcessFiles operates by applying params.Plan to each FilePath in the
+// paths channel. Each WorkPlan is executed in its own goroutine, with no more
+// than params.MaxProc goroutines running in parallel. The detection fields of
+// params (Root, MatchFunc, PruneFunc and those of sweeps and watches) are not
+// used.
+//
+// If params.ChecksumWorkers is greater than 0, CPU-bound work (see Work) is
+// limited to that many WorkFuncs in parallel and other work to MaxProc, each
+// step of a WorkPlan waiting for a slot of its kind. Up to
+// MaxProc + ChecksumWorkers goroutines then run in parallel, so that both
+// kinds of work may be fully occupied at once.
+//
+// If params.MaxBytesInFlight is greater than 0, the total size of the files
+// being worked on in parallel is limited to it. Dispatch of a file is blocked
+// until enough running work has finished to bring the total within the limit.
+// A single file larger than the limit is worked on alone.
+//
+// If params.FileTimeout is greater than 0, work on any one file that takes
+// longer is abandoned; the timeout is logged and counted as an error and the
+// file's goroutine slot is freed for other work. The context of the abandoned
+// work is cancelled, which interrupts any ContextWorkFunc in progress, such as
+// compression, and prevents the remaining steps of its WorkPlan. Other
+// WorkFuncs cannot be interrupted, so abandoned work may continue in the
+// background; the FilePath is not worked on again until it finishes and
+// DoProcessFiles does not return until then.
 //
 // This function keeps track of the FilePaths being worked on. If a FilePath is
 // passed in subsequently, but before existing work has finished, it is skipped.
 //
+// If params.Quarantine is not nil, the success or failure of the work on each
+// FilePath is recorded in it and quarantined FilePaths are skipped.
+//
+// If params.Pause is not nil, dispatch of each FilePath waits while it is
+// paused. If it is cancelled while paused, the remaining FilePaths are skipped.
+//
+// If params.Window is not nil, Windowed Work is skipped while it is closed
+// (see WorkWindow).
+//
+// If params.HardLinks is not nil, a FilePath that is a hard link to a file
+// already passed in at another path is skipped, so that its content is worked
+// on once (see HardLinks).
+//
+// If params.MaxErrors is greater than 0, the remaining FilePaths are skipped
+// once more errors than that have been counted (see ErrorLimit).
+//
+// If params.MaxProcPerRun is greater than 0, the number of FilePaths of any
+// one run worked on at once is limited (see RunLimit). A FilePath whose run is
+// at its limit is queued, without holding up the dispatch of the FilePaths of
+// other runs, until a file of its run finishes. Queued FilePaths are skipped
+// once ctx is cancelled.
+//
 // If any WorkPlan encounters an error, the error is logged and counted. When
 // DoProcessFiles exits, it will return an error if the error count across all
 // the WorkPlans was greater than 0.
-func DoProcessFiles(paths <-chan FilePath, workPlan WorkPlan, maxThreads int) error {
+func DoProcessFiles(ctx context.Context, paths <-chan FilePath,
+	params ProcessParams) error {
+	workPlan, maxThreads := params.Plan, params.MaxProc
+	checksumWorkers, fileTimeout := params.ChecksumWorkers, params.FileTimeout
+	quarantine, pause := params.Quarantine, params.Pause
+	window, hardLinks := params.Window, params.HardLinks
+
+	errLimit := params.errLimit
+	if errLimit == nil && params.MaxErrors > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		errLimit = NewErrorLimit(params.MaxErrors, cancel)
+	}
+
+	var runLimit *RunLimit
+	if params.MaxProcPerRun > 0 {
+		runLimit = NewRunLimit(params.MaxProcPerRun)
+	}
+
 	var wg sync.WaitGroup // The group of all work goroutines
 
-	var mu = sync.Mutex{} // Protects running, jobCount, errCount
+	var mu = sync.Mutex{} // Protects running, jobCount, errCount, unreachable
 	var running = make(map[string]token)
 	var jobCount uint64
 	var errCount uint64
+	var unreachable bool // Any error was because the archive was unreachable
+
+	maxFiles := maxThreads
+	if checksumWorkers > 0 {
+		maxFiles += checksumWorkers
+	}
 
-	sem := make(semaphore, maxThreads) // Ensure upper limit on thread count
+	sem := make(semaphore, maxFiles) // Ensure upper limit on thread count
+	limits := newWorkLimits(maxThreads, checksumWorkers)
+	budget := newByteBudget(params.MaxBytesInFlight) // Ensure upper limit on bytes in flight
 
 	log := logs.GetLogger()
 
-	for path := range paths {
-		mu.Lock()
-		if _, ok := running[path.Location]; ok {
+	// finishRun passes the place of a file of run to the next file queued for
+	// it, if any. Once cancelled, the queued files are skipped instead.
+	var dispatch func(path FilePath, run string)
+	finishRun := func(run string) {
+		for {
+			next, ok := runLimit.release(run)
+			if !ok {
+				return
+			}
+			if ctx.Err() == nil {
+				dispatch(next, run)
+				return
+			}
+
+			log.Debug().Str("path", next.Location).
+				Msg("skipping (cancelled while queued)")
+			mu.Lock()
+			delete(running, next.Location)
 			mu.Unlock()
-			log.Info().Str("path", path.Location).
-				Msg("skipping (already working on)")
-			continue
 		}
-		mu.Unlock()
+	}
 
+	// dispatch starts the work on path, once there is capacity for it. The
+	// caller has already marked path as running and taken a place for it in
+	// its run.
+	dispatch = func(path FilePath, run string) {
+		size := fileSize(path)
+		budget.acquire(size)
 		sem <- token{}
+
+		// Checked once work is possible, as the work waited for may fail
+		if errLimit.Exceeded() {
+			<-sem
+			budget.release(size)
+			mu.Lock()
+			delete(running, path.Location)
+			mu.Unlock()
+			log.Debug().Str("path", path.Location).
+				Msg("skipping (error limit exceeded)")
+			finishRun(run)
+			return
+		}
 		wg.Add(1)
 
 		go func(p FilePath) {
-			defer func() {
+			defer wg.Done()
+
+			var once sync.Once
+			release := func() {
 				<-sem
-				wg.Done()
-			}()
+				budget.release(size)
+				finishRun(run)
+			}
+			defer once.Do(release)
+
+			ctx, span := startFileSpan(ctx, p)
+			var serr error // The error recorded in the span
+			defer func() { endSpan(span, serr) }()
+
+			// The work is cancelled if it times out, but not if processing
+			// is cancelled, so that work in progress is finished
+			ctx = context.WithoutCancel(ctx)
+			if fileTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, fileTimeout)
+				defer cancel()
+			}
+
+			slots := limits.forFile()
 
 			mu.Lock()
-			running[p.Location] = token{}
 			jobCount++
 
-			work, derr := makeWork(p, workPlan)
+			work, derr := makeWork(ctx, p, workPlan, slots, window)
 			if derr != nil {
+				serr = derr
+				delete(running, p.Location)
+				errCount++
+				unreachable = unreachable || IsUnreachable(derr)
 				mu.Unlock()
 				log.Error().Err(derr).
 					Str("path", p.Location).
 					Msg("work dispatch failed")
-				errCount++
+				errLimit.Record()
+				quarantine.RecordFailure(p, derr)
 				return
 			}
 			mu.Unlock()
 
 			log.Debug().Str("path", p.Location).
 				Str("plan", workPlan.String()).Msg("starting work")
-			werr := work.WorkFunc(p)
+			pending, werr := runWork(ctx, work, p)
+			serr = werr
+			if pending != nil {
+				serr = errors.Errorf("work timed out after %s", fileTimeout)
+				mu.Lock()
+				errCount++
+				errLimit.Record()
+				mu.Unlock()
+				log.Error().Str("path", p.Location).
+					Dur("timeout", fileTimeout).
+					Msg("work timed out, abandoning")
+				quarantine.RecordFailure(p, serr)
+
+				// Free the slots, but keep the path marked as running, and
+				// DoProcessFiles waiting, until the abandoned work finishes
+				slots.abandon()
+				once.Do(release)
+				werr = <-pending
+
+				mu.Lock()
+				delete(running, p.Location)
+				mu.Unlock()
+				log.Warn().Err(werr).Str("path", p.Location).
+					Msg("abandoned work finished")
+				return
+			}
 			log.Debug().Str("path", p.Location).
 				Str("plan", workPlan.String()).Msg("finished work")
 
@@ -170,24 +572,173 @@ func DoProcessFiles(paths <-chan FilePath, workPlan WorkPlan, maxThreads int) er
 			delete(running, p.Location)
 			if werr != nil {
 				errCount++
+				unreachable = unreachable || IsUnreachable(werr)
+				errLimit.Record()
 				mu.Unlock()
 				log.Error().Err(werr).
 					Str("path", p.Location).
 					Msg("worker function failed")
+				quarantine.RecordFailure(p, werr)
 				return
 			}
 			mu.Unlock()
+			quarantine.RecordSuccess(p)
 		}(path)
 	}
 
+	for path := range paths {
+		if !pause.wait() {
+			log.Debug().Str("path", path.Location).
+				Msg("skipping (cancelled while paused)")
+			continue
+		}
+
+		if q, _ := quarantine.IsQuarantined(path); q {
+			log.Debug().Str("path", path.Location).
+				Msg("skipping (quarantined)")
+			continue
+		}
+
+		if dup, first := hardLinks.IsDuplicate(path); dup {
+			log.Info().Str("path", path.Location).Str("first", first).
+				Msg("skipping (hard link to a file already seen)")
+			continue
+		}
+
+		mu.Lock()
+		if _, ok := running[path.Location]; ok {
+			mu.Unlock()
+			log.Info().Str("path", path.Location).
+				Msg("skipping (already working on)")
+			continue
+		}
+		running[path.Location] = token{}
+		mu.Unlock()
+
+		// A file of a run at its limit is queued, so that the files of other
+		// runs are dispatched meanwhile
+		run := runLimit.runOf(path)
+		if !runLimit.acquireOrQueue(run, path) {
+			log.Debug().Str("path", path.Location).Str("run", run).
+				Msg("queueing (run has the most files in flight)")
+			continue
+		}
+
+		dispatch(path, run)
+	}
+
 	wg.Wait()
 
 	if errCount > 0 {
-		return errors.Errorf("encountered %d errors processing %d files",
-			errCount, jobCount)
+		return withUnreachable(errors.Errorf("encountered %d errors "+
+			"processing %d files", errCount, jobCount), unreachable)
 	}
 
 	log.Info().Uint64("num_files", jobCount).Msg("finished processing")
 
 	return nil
 }
+
+// StepOutcome is the outcome of one step of a WorkPlan for a single file.
+type StepOutcome int
+
+const (
+	StepSkipped StepOutcome = iota // The step's predicate did not match
+	StepDone                       // The step's work was done
+	StepFailed                     // The step's predicate or work failed
+)
+
+func (o StepOutcome) String() string {
+	switch o {
+	case StepSkipped:
+		return "skipped"
+	case StepDone:
+		return "done"
+	case StepFailed:
+		return "FAILED"
+	default:
+		return "unknown"
+	}
+}
+
+// StepResult describes the outcome of one step of a WorkPlan for a file.
+type StepResult struct {
+	Path    string      // The path of the file
+	Match   WorkMatch   // The step
+	Outcome StepOutcome // The outcome of the step
+	Err     error       // The error, if the step failed
+}
+
+// Rank returns the rank of the step's Work.
+func (r StepResult) Rank() uint16 {
+	return r.Match.work.Rank
+}
+
+// ProcessFile does the work of workPlan on the single file path,
+// synchronously, evaluating each step in rank order as DoProcessFiles would,
+// and returns the outcome of every step. If the work compresses the file, the
+// work is then done on its compressed version, in the same way, so that a file
+// may be taken through the whole plan in one call. The work window, byte budget
+// and quarantine of DoProcessFiles do not apply.
+//
+// Processing stops at the first step that fails, whose error is returned.
+func ProcessFile(path FilePath, workPlan WorkPlan) ([]StepResult, error) {
+	wp := make(WorkPlan, len(workPlan))
+	copy(wp, workPlan)
+	sort.Stable(wp)
+
+	results, err := processFileSteps(path, wp)
+	if err != nil {
+		return results, err
+	}
+
+	// The compressed version is made by the first pass, so needs another
+	if compressed, cerr := IsCompressed(path); cerr != nil || compressed {
+		return results, cerr
+	}
+
+	gz, err := NewFilePath(path.CompressedFilename())
+	if os.IsNotExist(err) {
+		return results, nil
+	}
+	if err != nil {
+		return results, err
+	}
+
+	more, err := processFileSteps(gz, wp)
+	return append(results, more...), err
+}
+
+func processFileSteps(path FilePath, wp WorkPlan) ([]StepResult, error) {
+	log := logs.GetLogger()
+
+	var results []StepResult
+	for _, wm := range wp {
+		result := StepResult{Path: path.Location, Match: wm}
+
+		// Each predicate is evaluated with its own stat cache because the
+		// preceding work may have changed the sidecar files
+		ok, err := WithStatCache(wm.pred)(path)
+		if err == nil && ok {
+			log.Info().Str("path", path.Location).Str("desc", wm.String()).
+				Uint64("rank", uint64(wm.work.Rank)).Msg("working")
+			err = wm.work.do(context.Background(), path)
+		}
+
+		switch {
+		case err != nil:
+			result.Outcome, result.Err = StepFailed, err
+		case ok:
+			result.Outcome = StepDone
+		default:
+			result.Outcome = StepSkipped
+		}
+
+		results = append(results, result)
+		if err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
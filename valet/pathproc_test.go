@@ -0,0 +1,318 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file pathproc_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoProcessFilesMaxBytes(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var paths []FilePath
+	for i, size := range []int{100, 100, 100, 500} {
+		p := filepath.Join(tmpDir, fmt.Sprintf("file%d", i))
+		if !assert.NoError(t, os.WriteFile(p, make([]byte, size), 0644)) {
+			return
+		}
+		fp, err := NewFilePath(p)
+		if !assert.NoError(t, err) {
+			return
+		}
+		paths = append(paths, fp)
+	}
+
+	var mu sync.Mutex
+	var inFlight, maxInFlight int64 // maxInFlight excludes the large file
+	var maxLargeCompanions int64
+
+	work := func(path FilePath) error {
+		mu.Lock()
+		inFlight += path.Info.Size()
+		if path.Info.Size() < 500 && inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		if path.Info.Size() == 500 && inFlight-500 > maxLargeCompanions {
+			maxLargeCompanions = inFlight - 500
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight -= path.Info.Size()
+		mu.Unlock()
+		return nil
+	}
+
+	plan := WorkPlan{
+		WorkMatch{
+			pred: func(path FilePath) (bool, error) { return true, nil },
+			work: Work{WorkFunc: work},
+		},
+	}
+
+	ch := make(chan FilePath, len(paths))
+	for _, p := range paths {
+		ch <- p
+	}
+	close(ch)
+
+	err := DoProcessFiles(context.Background(), ch, ProcessParams{
+		Plan: plan, MaxProc: len(paths), MaxBytesInFlight: 250})
+	if assert.NoError(t, err) {
+		// Two 100 byte files fit in the budget, but not three. The 500 byte
+		// file exceeds the budget and must run alone.
+		assert.LessOrEqual(t, maxInFlight, int64(250))
+		assert.Equal(t, int64(0), maxLargeCompanions)
+	}
+}
+
+func TestDoProcessFilesTimeout(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var paths []FilePath
+	for _, name := range []string{"hang", "file1", "file2"} {
+		p := filepath.Join(tmpDir, name)
+		if !assert.NoError(t, os.WriteFile(p, []byte(name), 0644)) {
+			return
+		}
+		fp, err := NewFilePath(p)
+		if !assert.NoError(t, err) {
+			return
+		}
+		paths = append(paths, fp)
+	}
+
+	var mu sync.Mutex
+	var numDone int
+	var hangFinished bool
+
+	// The hung work ignores the cancellation of its context for a while, as
+	// would a WorkFunc that cannot be interrupted
+	hangWork := func(ctx context.Context, path FilePath) error {
+		if filepath.Base(path.Location) == "hang" {
+			<-ctx.Done()
+			time.Sleep(200 * time.Millisecond)
+
+			mu.Lock()
+			hangFinished = true
+			mu.Unlock()
+		}
+		return nil
+	}
+
+	work := func(path FilePath) error {
+		mu.Lock()
+		numDone++
+		mu.Unlock()
+		return nil
+	}
+
+	isTrue := func(path FilePath) (bool, error) { return true, nil }
+	plan := WorkPlan{
+		WorkMatch{pred: isTrue, work: Work{ContextFunc: hangWork, Rank: 1}},
+		WorkMatch{pred: isTrue, work: Work{WorkFunc: work, Rank: 2}},
+	}
+
+	ch := make(chan FilePath, len(paths))
+	for _, p := range paths {
+		ch <- p
+	}
+	close(ch)
+
+	// With a single slot, the other files are worked on only if the hung
+	// work is abandoned
+	err := DoProcessFiles(context.Background(), ch, ProcessParams{
+		Plan: plan, MaxProc: 1, FileTimeout: 50 * time.Millisecond})
+	assert.Error(t, err, "expected the timeout to be counted as an error")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.True(t, hangFinished, "expected to wait for the abandoned work")
+	assert.Equal(t, 2, numDone, "expected no further work once abandoned")
+}
+
+func TestDoProcessFilesChecksumWorkers(t *testing.T) {
+	var paths []FilePath
+	for i := 0; i < 6; i++ {
+		fp, err := NewFilePath("./testdata/valet/1/reads/fastq/reads1.fastq")
+		if !assert.NoError(t, err) {
+			return
+		}
+		fp.Location = fmt.Sprintf("%s.%d", fp.Location, i) // Distinct paths
+		paths = append(paths, fp)
+	}
+
+	var mu sync.Mutex
+	var numCPU, maxCPU, numIO, maxIO int
+
+	count := func(n *int, max *int) WorkFunc {
+		return func(path FilePath) error {
+			mu.Lock()
+			*n++
+			if *n > *max {
+				*max = *n
+			}
+			mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mu.Lock()
+			*n--
+			mu.Unlock()
+			return nil
+		}
+	}
+
+	plan := WorkPlan{
+		WorkMatch{
+			pred: IsTrue,
+			work: Work{WorkFunc: count(&numCPU, &maxCPU), Rank: 1,
+				CPUBound: true},
+		},
+		WorkMatch{
+			pred: IsTrue,
+			work: Work{WorkFunc: count(&numIO, &maxIO), Rank: 2},
+		},
+	}
+
+	ch := make(chan FilePath, len(paths))
+	for _, p := range paths {
+		ch <- p
+	}
+	close(ch)
+
+	err := DoProcessFiles(context.Background(), ch,
+		ProcessParams{Plan: plan, MaxProc: 1, ChecksumWorkers: 3})
+	if assert.NoError(t, err) {
+		// Each kind of work is limited separately, so CPU-bound work is not
+		// restricted by the single slot for other work
+		assert.Equal(t, 3, maxCPU)
+		assert.Equal(t, 1, maxIO)
+	}
+}
+
+func TestFileSlotsAbandon(t *testing.T) {
+	limits := newWorkLimits(1, 0)
+	work := Work{WorkFunc: DoNothing}
+
+	slots := limits.forFile()
+	slots.acquire(work)
+	assert.Len(t, limits.io, 1)
+
+	// Abandoning frees the slot and no more are taken
+	slots.abandon()
+	assert.Len(t, limits.io, 0)
+	release := slots.acquire(work)
+	assert.Len(t, limits.io, 0)
+	release()
+
+	var nilSlots *fileSlots
+	nilSlots.acquire(work)()
+	nilSlots.abandon()
+}
+
+func TestProcessFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "reads1.fastq")
+	if !assert.NoError(t, os.WriteFile(file, []byte("@read1\nACGT\n+\n!!!!\n"),
+		0644)) {
+		return
+	}
+
+	var archived []string
+	archive := func(path FilePath) error {
+		archived = append(archived, path.Location)
+		return nil
+	}
+
+	var cf ChecksumFiles
+	plan := WorkPlan{
+		{pred: RequiresCompression, predDoc: "Requires Compression",
+			work: Work{WorkFunc: MakeCompressor(context.Background(), true,
+				Selection{}),
+				Rank: 1}, workDoc: "Compress"},
+		{pred: RequiresChecksum, predDoc: "Requires Checksum",
+			work:    Work{WorkFunc: cf.CreateOrUpdateMD5ChecksumFile, Rank: 2},
+			workDoc: "Checksum"},
+		{pred: And(RequiresCopying, cf.HasChecksumFile), predDoc: "Requires Copying",
+			work: Work{WorkFunc: archive, Rank: 3}, workDoc: "Archive"},
+		{pred: HasCompressedVersion, predDoc: "Has Compressed Version",
+			work: Work{WorkFunc: RemoveFile, Rank: 6}, workDoc: "Remove"},
+	}
+
+	fp, err := NewFilePath(file)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	results, err := ProcessFile(fp, plan)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var outcomes []string
+	for _, r := range results {
+		outcomes = append(outcomes, fmt.Sprintf("%s %s %s",
+			filepath.Base(r.Path), r.Match.workDoc, r.Outcome))
+	}
+	assert.Equal(t, []string{
+		"reads1.fastq Compress done",
+		"reads1.fastq Checksum skipped",
+		"reads1.fastq Archive skipped",
+		"reads1.fastq Remove done",
+		"reads1.fastq.gz Compress skipped",
+		"reads1.fastq.gz Checksum skipped", // Made by compression
+		"reads1.fastq.gz Archive done",
+		"reads1.fastq.gz Remove skipped",
+	}, outcomes)
+	assert.Equal(t, []string{file + ".gz"}, archived)
+	assert.NoFileExists(t, file)
+
+	failing := WorkPlan{
+		{pred: IsTrue, predDoc: "Is True",
+			work: Work{WorkFunc: func(path FilePath) error {
+				return errors.New("failed")
+			}, Rank: 1}, workDoc: "Fail"},
+		{pred: IsTrue, predDoc: "Is True",
+			work: Work{WorkFunc: DoNothing, Rank: 2}, workDoc: "Nothing"},
+	}
+
+	gz, err := NewFilePath(file + ".gz")
+	if !assert.NoError(t, err) {
+		return
+	}
+	results, err = ProcessFile(gz, failing)
+	assert.Error(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, StepFailed, results[0].Outcome)
+	}
+}
@@ -21,11 +21,19 @@
 package valet
 
 import (
+	"io/fs"
+	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	logs "github.com/wtsi-npg/logshim"
 )
 
+// RecursiveWildcard is the glob path element that matches zero or more
+// complete path elements.
+const RecursiveWildcard = "**"
+
 // Directory names within the root MinKNOW data directory (typically /data)
 // that we will ignore by default.
 var MinKNOWIgnore = []string{
@@ -115,18 +123,29 @@ func MakeRegexPruneFunc(patterns []string) (FilePredicate, error) {
 // directory matching at least one of the glob pattern arguments. The returned
 // function is intended for use as a pruning function argument to the
 // valet.WatchFiles and valet.FindFiles functions.
+//
+// The supported pattern syntax is that of filepath.Match, applied to each
+// path element, with the addition that a path element consisting solely of
+// "**" matches zero or more complete path elements. E.g.
+//
+// /data/**/intermediate matches /data/intermediate and /data/a/b/intermediate
+//
+// **/intermediate       matches any directory named intermediate
+//
+// A "**" combined with other characters in a path element e.g. "a**" has the
+// same meaning as "a*".
 func MakeGlobPruneFunc(patterns []string) (FilePredicate, error) {
 	log := logs.GetLogger()
 
 	for _, pattern := range patterns {
-		if _, err := filepath.Match(pattern, "."); err != nil {
+		if err := validateGlob(pattern); err != nil {
 			return nil, err
 		}
 	}
 
 	return func(fp FilePath) (bool, error) {
 		for _, pattern := range patterns {
-			match, err := filepath.Match(pattern, fp.Location)
+			match, err := MatchGlob(pattern, fp.Location)
 			if err != nil {
 				log.Error().Err(err).Msg("invalid match pattern")
 				continue
@@ -142,3 +161,218 @@ func MakeGlobPruneFunc(patterns []string) (FilePredicate, error) {
 		return false, nil
 	}, nil
 }
+
+// MakeArchivedPruneFunc returns a FilePredicate that will return true for any
+// run directory that has not been modified for longer than duration and which
+// has an ArchivedMarkerName marker file (see IsRunArchivedMarked). Directories
+// for which keep returns true are never pruned e.g. directories that are due
+// to be removed. The returned function is intended for use as a pruning function argument to
+// the valet.WatchFiles and valet.FindFiles functions.
+//
+// A directory without a marker is never pruned, however old, because it may
+// still contain files to be archived. If duration is not greater than zero,
+// nothing is pruned.
+func MakeArchivedPruneFunc(duration time.Duration,
+	keep FilePredicate) FilePredicate {
+	if duration <= 0 {
+		return IsFalse
+	}
+
+	log := logs.GetLogger()
+	isOld := MakeIsOlderThan(duration)
+
+	return func(fp FilePath) (bool, error) {
+		if !fp.Info.IsDir() {
+			return false, nil
+		}
+
+		old, err := isOld(fp)
+		if err != nil || !old {
+			return false, err
+		}
+
+		marked, err := IsRunArchivedMarked(fp)
+		if err != nil || !marked {
+			return false, err
+		}
+
+		kept, err := keep(fp)
+		if err != nil || kept {
+			return false, err
+		}
+
+		log.Debug().Str("path", fp.Location).
+			Msg("archived directory matched for pruning")
+		return true, filepath.SkipDir // return SkipDir to prune here
+	}
+}
+
+// MakeRunsPruneFunc returns a FilePredicate that will return true for any
+// MinKNOW run directory whose run ID is not one of runIDs. The returned
+// function is intended for use as a pruning function argument to the
+// valet.WatchFiles and valet.FindFiles functions, to restrict them to the
+// runs in runIDs.
+func MakeRunsPruneFunc(runIDs []string) FilePredicate {
+	isInRuns := MakeIsInRuns(runIDs)
+
+	return func(fp FilePath) (bool, error) {
+		ok, err := IsMinKNOWRunDir(fp)
+		if err != nil || !ok {
+			return false, err
+		}
+
+		if ok, err = isInRuns(fp); err != nil || ok {
+			return false, err
+		}
+
+		return true, filepath.SkipDir // return SkipDir to prune here
+	}
+}
+
+// MakeActiveRunPruneFunc returns a FilePredicate that will return true for
+// any MinKNOW run directory that appears to be the run that MinKNOW is
+// writing, judged using window (see MakeIsInActiveRun). The returned function
+// is intended for use as a pruning function argument to the valet.WatchFiles
+// and valet.FindFiles functions.
+func MakeActiveRunPruneFunc(window time.Duration) FilePredicate {
+	log := logs.GetLogger()
+	isInActiveRun := MakeIsInActiveRun(window)
+
+	return func(fp FilePath) (bool, error) {
+		ok, err := IsMinKNOWRunDir(fp)
+		if err != nil || !ok {
+			return false, err
+		}
+
+		if ok, err = isInActiveRun(fp); err != nil || !ok {
+			return false, err
+		}
+
+		log.Debug().Str("path", fp.Location).
+			Msg("active run directory matched for pruning")
+		return true, filepath.SkipDir // return SkipDir to prune here
+	}
+}
+
+// MakeRunAgePruneFunc returns a FilePredicate that will return true for any
+// MinKNOW run directory that contains a file or directory, or is itself one,
+// modified within minAge. The returned function is intended for use as a
+// pruning function argument to the valet.WatchFiles and valet.FindFiles
+// functions, so that a run that is still being written is not entered at all.
+// A run pruned in this way is found again by a later sweep, once it has aged.
+//
+// Finding the newest modification time requires a walk of the run directory,
+// which stops at the first recently modified entry. If minAge is not greater
+// than zero, nothing is pruned.
+func MakeRunAgePruneFunc(minAge time.Duration) FilePredicate {
+	if minAge <= 0 {
+		return IsFalse
+	}
+
+	log := logs.GetLogger()
+
+	return func(fp FilePath) (bool, error) {
+		ok, err := IsMinKNOWRunDir(fp)
+		if err != nil || !ok {
+			return false, err
+		}
+
+		if ok, err = isModifiedWithin(fp.Location, minAge); err != nil || !ok {
+			return false, err
+		}
+
+		log.Debug().Str("path", fp.Location).Dur("min_age", minAge).
+			Msg("recently modified run directory matched for pruning")
+		return true, filepath.SkipDir // return SkipDir to prune here
+	}
+}
+
+// isModifiedWithin returns true if dir, or anything within it, has been
+// modified within window.
+func isModifiedWithin(dir string, window time.Duration) (bool, error) {
+	var recent bool
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // Removed since being listed
+			}
+			return err
+		}
+
+		info, err := d.Info()
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if time.Since(info.ModTime()) < window {
+			recent = true
+			return fs.SkipAll
+		}
+
+		return nil
+	})
+
+	return recent, err
+}
+
+// MatchGlob returns true if path matches the glob pattern. The syntax is that
+// of filepath.Match with the addition of the RecursiveWildcard path element
+// (see MakeGlobPruneFunc). The only possible returned error is
+// filepath.ErrBadPattern.
+func MatchGlob(pattern string, path string) (bool, error) {
+	if !strings.Contains(pattern, RecursiveWildcard) {
+		return filepath.Match(pattern, path)
+	}
+
+	sep := string(filepath.Separator)
+	return matchGlobElements(strings.Split(pattern, sep),
+		strings.Split(path, sep))
+}
+
+func matchGlobElements(pattern []string, path []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == RecursiveWildcard {
+			// Collapse any consecutive recursive wildcards
+			for len(pattern) > 0 && pattern[0] == RecursiveWildcard {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true, nil
+			}
+
+			// Try to match the remaining pattern against each suffix
+			for i := range path {
+				match, err := matchGlobElements(pattern, path[i:])
+				if err != nil || match {
+					return match, err
+				}
+			}
+			return false, nil
+		}
+
+		if len(path) == 0 {
+			return false, nil
+		}
+
+		match, err := filepath.Match(pattern[0], path[0])
+		if err != nil || !match {
+			return false, err
+		}
+
+		pattern, path = pattern[1:], path[1:]
+	}
+
+	return len(path) == 0, nil
+}
+
+func validateGlob(pattern string) error {
+	for _, elt := range strings.Split(pattern, string(filepath.Separator)) {
+		if _, err := filepath.Match(elt, "."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file pathprune_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchGlob(t *testing.T) {
+	matches := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"/data/intermediate", "/data/intermediate", true},
+		{"/data/*", "/data/intermediate", true},
+		{"/data/*", "/data/a/intermediate", false},
+		{"**/intermediate", "/data/intermediate", true},
+		{"**/intermediate", "/data/a/b/c/intermediate", true},
+		{"**/intermediate", "/data/a/intermediate/b", false},
+		{"/data/**/intermediate", "/data/intermediate", true},
+		{"/data/**/intermediate", "/data/a/intermediate", true},
+		{"/data/**/intermediate", "/data/a/b/intermediate", true},
+		{"/data/**/intermediate", "/other/a/intermediate", false},
+		{"/data/**", "/data/a/b", true},
+		{"/data/**/**/x*", "/data/a/b/xyz", true},
+		{"/data/**/reads/*.tmp", "/data/a/reads/1.tmp", true},
+		{"/data/**/reads/*.tmp", "/data/a/reads/1.fastq", false},
+	}
+
+	for _, m := range matches {
+		match, err := MatchGlob(m.pattern, m.path)
+		if assert.NoError(t, err) {
+			assert.Equal(t, m.match, match, "%s vs %s", m.pattern, m.path)
+		}
+	}
+
+	_, err := MatchGlob("**/[", "/data/x")
+	assert.ErrorIs(t, err, filepath.ErrBadPattern)
+}
+
+func TestMakeGlobPruneFunc(t *testing.T) {
+	_, err := MakeGlobPruneFunc([]string{"**/["})
+	assert.Error(t, err, "expected an error for an invalid pattern")
+
+	prune, err := MakeGlobPruneFunc([]string{"**/fastq"})
+	if assert.NoError(t, err) {
+		fq, _ := NewFilePath("./testdata/valet/1/reads/fastq")
+		ok, perr := prune(fq)
+		assert.True(t, ok, "expected fastq directory to be pruned")
+		assert.Equal(t, filepath.SkipDir, perr)
+
+		f5, _ := NewFilePath("./testdata/valet/1/reads/fast5")
+		ok, perr = prune(f5)
+		assert.False(t, ok, "expected fast5 directory not to be pruned")
+		assert.NoError(t, perr)
+	}
+}
+
+func TestMakeArchivedPruneFunc(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+
+	unmarked := filepath.Join(dir, "20200212_1021_1-A3-D3_PAE51234_4b8e0f6a")
+	marked := filepath.Join(dir, "20200212_1022_1-A3-D3_PAE51235_5c9f1a7b")
+	for _, d := range []string{unmarked, marked} {
+		if !assert.NoError(t, os.Mkdir(d, 0700)) {
+			return
+		}
+	}
+	if !assert.NoError(t, os.WriteFile(filepath.Join(marked,
+		ArchivedMarkerName), []byte{}, 0600)) {
+		return
+	}
+	for _, d := range []string{unmarked, marked} {
+		if !assert.NoError(t, os.Chtimes(d, old, old)) {
+			return
+		}
+	}
+
+	prune := MakeArchivedPruneFunc(24*time.Hour, IsFalse)
+
+	m, _ := NewFilePath(marked)
+	ok, err := prune(m)
+	assert.True(t, ok, "expected old, marked directory to be pruned")
+	assert.Equal(t, filepath.SkipDir, err)
+
+	u, _ := NewFilePath(unmarked)
+	ok, err = prune(u)
+	assert.False(t, ok, "expected unmarked directory not to be pruned")
+	assert.NoError(t, err)
+
+	recent := MakeArchivedPruneFunc(72*time.Hour, IsFalse)
+	ok, err = recent(m)
+	assert.False(t, ok, "expected recent directory not to be pruned")
+	assert.NoError(t, err)
+
+	kept := MakeArchivedPruneFunc(24*time.Hour, IsTrue)
+	ok, err = kept(m)
+	assert.False(t, ok, "expected kept directory not to be pruned")
+	assert.NoError(t, err)
+
+	disabled := MakeArchivedPruneFunc(0, IsFalse)
+	ok, err = disabled(m)
+	assert.False(t, ok, "expected nothing to be pruned when disabled")
+	assert.NoError(t, err)
+}
+
+func TestMakeRunsPruneFunc(t *testing.T) {
+	prune := MakeRunsPruneFunc([]string{"20190904_1514_GA20000_FAL01979_43578c8f"})
+
+	gridion, _ := NewFilePath("testdata/platform/ont/minknow/gridion/66/" +
+		"DN585561I_A1/20190904_1514_GA20000_FAL01979_43578c8f")
+	ok, err := prune(gridion)
+	assert.False(t, ok, "expected listed run directory not to be pruned")
+	assert.NoError(t, err)
+
+	promethion, _ := NewFilePath("testdata/platform/ont/minknow/promethion/" +
+		"DN467851H_Multiplex_Pool_1/DN467851H_B2_C2_E2_F2/" +
+		"20190820_1538_2-E7-H7_PAD71219_a4a384ec")
+	ok, err = prune(promethion)
+	assert.True(t, ok, "expected unlisted run directory to be pruned")
+	assert.Equal(t, filepath.SkipDir, err)
+
+	parent, _ := NewFilePath("testdata/platform/ont/minknow/promethion")
+	ok, err = prune(parent)
+	assert.False(t, ok, "expected non-run directory not to be pruned")
+	assert.NoError(t, err)
+}
+
+func TestMakeActiveRunPruneFunc(t *testing.T) {
+	exptDir := filepath.Join(t.TempDir(), "66")
+	oldRun := filepath.Join(exptDir, "DN585561I_A1",
+		"20190904_1514_GA20000_FAL01979_43578c8f")
+	newRun := filepath.Join(exptDir, "DN585561I_A1",
+		"20190905_1514_GA20000_FAL01980_43578c90")
+	for _, dir := range []string{oldRun, newRun} {
+		if !assert.NoError(t, os.MkdirAll(dir, 0700)) {
+			return
+		}
+	}
+
+	then := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(oldRun, then, then))
+
+	prune := MakeActiveRunPruneFunc(time.Hour)
+
+	active, _ := NewFilePath(newRun)
+	ok, err := prune(active)
+	assert.True(t, ok, "expected the active run directory to be pruned")
+	assert.Equal(t, filepath.SkipDir, err)
+
+	inactive, _ := NewFilePath(oldRun)
+	ok, err = prune(inactive)
+	assert.False(t, ok, "expected an older run directory not to be pruned")
+	assert.NoError(t, err)
+
+	parent, _ := NewFilePath(filepath.Dir(newRun))
+	ok, err = prune(parent)
+	assert.False(t, ok, "expected non-run directory not to be pruned")
+	assert.NoError(t, err)
+}
+
+func TestMakeRunAgePruneFunc(t *testing.T) {
+	runDir := filepath.Join(t.TempDir(), "66", "DN585561I_A1",
+		"20190904_1514_GA20000_FAL01979_43578c8f")
+	passDir := filepath.Join(runDir, "fast5_pass")
+	if !assert.NoError(t, os.MkdirAll(passDir, 0700)) {
+		return
+	}
+	file := filepath.Join(passDir, "reads1.fast5")
+	if !assert.NoError(t, os.WriteFile(file, []byte("12345"), 0600)) {
+		return
+	}
+
+	then := time.Now().Add(-2 * time.Hour)
+	for _, p := range []string{passDir, runDir} {
+		assert.NoError(t, os.Chtimes(p, then, then))
+	}
+
+	prune := MakeRunAgePruneFunc(time.Hour)
+
+	// Only the file within the run directory is recent
+	run, _ := NewFilePath(runDir)
+	ok, err := prune(run)
+	assert.True(t, ok, "expected a recently modified run directory to be pruned")
+	assert.Equal(t, filepath.SkipDir, err)
+
+	assert.NoError(t, os.Chtimes(file, then, then))
+	ok, err = prune(run)
+	assert.False(t, ok, "expected an older run directory not to be pruned")
+	assert.NoError(t, err)
+
+	parent, _ := NewFilePath(filepath.Dir(runDir))
+	ok, err = prune(parent)
+	assert.False(t, ok, "expected non-run directory not to be pruned")
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.Chtimes(file, time.Now(), time.Now()))
+	disabled := MakeRunAgePruneFunc(0)
+	ok, err = disabled(run)
+	assert.False(t, ok, "expected nothing to be pruned when disabled")
+	assert.NoError(t, err)
+}
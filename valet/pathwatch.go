@@ -25,6 +25,8 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/wtsi-npg/fsnotify"
@@ -53,10 +55,30 @@ func WatchFiles(
 	root string,
 	pred FilePredicate,
 	pruneFn FilePredicate) (<-chan FilePath, <-chan error) {
+	return watchFiles(cancelCtx, root, pred, pruneFn, 0, nil)
+}
+
+// watchFiles is WatchFiles, additionally recording in health (if not nil)
+// whether the initial watches have been set up.
+//
+// If grace is greater than 0, a file is not tested with pred when it is closed
+// or moved into place, but once grace has elapsed without any further event on
+// it and with its size and modification time unchanged, so that a file closed
+// and immediately reopened to be appended to is not reported prematurely (see
+// graceFiles).
+func watchFiles(
+	cancelCtx context.Context,
+	root string,
+	pred FilePredicate,
+	pruneFn FilePredicate,
+	grace time.Duration,
+	health *Health) (<-chan FilePath, <-chan error) {
 
 	// Buffer any error that may occur starting the watcher, so that
 	// we can send it to the channel without blocking WatchFiles from returning
 	paths, errs := make(chan FilePath), make(chan error, 1)
+	pred = WithStatCache(pred)
+	pending := newGraceFiles(grace, pred, paths, errs)
 	log := logs.GetLogger()
 
 	// Returns an error on failure to finish cleanly. Errors encountered
@@ -103,6 +125,11 @@ func WatchFiles(
 							"on directory creation: %s", p.Location)
 					}
 				}
+				if pending.isEnabled() &&
+					event.Op&(fsnotify.Close|fsnotify.Movedto) != 0 {
+					pending.add(ctx, p)
+					continue
+				}
 				if event.Op&fsnotify.Close == fsnotify.Close {
 					if ferr = handleCloseFile(p, pred, paths); ferr != nil {
 						errs <- errors.WithMessagef(err,
@@ -134,6 +161,7 @@ func WatchFiles(
 
 	go func() {
 		defer func() {
+			pending.wait()
 			close(paths)
 			close(errs)
 		}()
@@ -145,6 +173,9 @@ func WatchFiles(
 			// via the filesystem sweeps.
 			if err := addWatchDirs(watcher, root, pruneFn); err != nil {
 				errs <- err
+			} else if health != nil {
+				health.SetWatching(true)
+				defer health.SetWatching(false)
 			}
 			if err := watchFn(cancelCtx, watcher); err != nil {
 				errs <- err
@@ -155,6 +186,163 @@ func WatchFiles(
 	return paths, errs
 }
 
+// graceFiles holds the files awaiting the end of a grace period after an event,
+// each in its own goroutine, so that waiting does not block the handling of
+// other events. Another event on a file during its grace period restarts the
+// period. Once the period has elapsed, the file is stat-ed again and, if its
+// size and modification time have not changed since the event, it is tested
+// and sent as it would have been without a grace period. Otherwise, a new
+// grace period starts.
+type graceFiles struct {
+	grace time.Duration
+	pred  FilePredicate
+	paths chan<- FilePath
+	errs  chan<- error
+
+	mu      sync.Mutex
+	pending map[string]graceState // The files in their grace period
+	wg      sync.WaitGroup
+}
+
+// graceState is the state of a file when its grace period last (re)started.
+type graceState struct {
+	info os.FileInfo
+	at   time.Time
+}
+
+func newGraceFiles(grace time.Duration, pred FilePredicate,
+	paths chan<- FilePath, errs chan<- error) *graceFiles {
+	return &graceFiles{
+		grace:   grace,
+		pred:    pred,
+		paths:   paths,
+		errs:    errs,
+		pending: make(map[string]graceState),
+	}
+}
+
+func (g *graceFiles) isEnabled() bool {
+	return g.grace > 0
+}
+
+// add starts the grace period of target, or restarts it if already started.
+// Waiting stops when ctx is cancelled.
+func (g *graceFiles) add(ctx context.Context, target FilePath) {
+	g.mu.Lock()
+	_, started := g.pending[target.Location]
+	g.pending[target.Location] = graceState{target.Info, time.Now()}
+	g.mu.Unlock()
+
+	logs.GetLogger().Debug().Str("path", target.Location).
+		Dur("grace", g.grace).Msg("waiting for grace period")
+	if started {
+		return
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		g.settle(ctx, target.Location)
+	}()
+}
+
+// settle waits until the file at location has been unchanged for the grace
+// period, then tests and sends it.
+func (g *graceFiles) settle(ctx context.Context, location string) {
+	log := logs.GetLogger()
+
+	timer := time.NewTimer(g.grace)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			g.remove(location)
+			return
+		case <-timer.C:
+		}
+
+		current, err := NewFilePath(location)
+
+		g.mu.Lock()
+		state := g.pending[location]
+		if remaining := g.grace - time.Since(state.at); remaining > 0 {
+			// There was another event during the grace period
+			g.mu.Unlock()
+			timer.Reset(remaining)
+			continue
+		}
+		if err == nil && !isUnchanged(state.info, current.Info) {
+			g.pending[location] = graceState{current.Info, time.Now()}
+			g.mu.Unlock()
+			log.Debug().Str("path", location).
+				Msg("changed during grace period")
+			timer.Reset(g.grace)
+			continue
+		}
+		delete(g.pending, location)
+		g.mu.Unlock()
+
+		if err != nil {
+			if os.IsNotExist(err) {
+				log.Warn().Err(err).Str("path", location).
+					Msg("path deleted externally")
+				return
+			}
+			g.sendErr(ctx, errors.WithMessagef(err,
+				"after grace period: %s", location))
+			return
+		}
+
+		ok, err := g.pred(current)
+		if err != nil {
+			g.sendErr(ctx, errors.WithMessagef(err,
+				"after grace period: %s", location))
+			return
+		}
+		if !ok {
+			log.Debug().Str("path", location).Msg("rejected by WatchFiles")
+			return
+		}
+
+		log.Debug().Str("path", location).Msg("accepted by WatchFiles")
+		select {
+		case g.paths <- current:
+		case <-ctx.Done():
+		}
+		return
+	}
+}
+
+func (g *graceFiles) sendErr(ctx context.Context, err error) {
+	select {
+	case g.errs <- err:
+	case <-ctx.Done():
+	}
+}
+
+func (g *graceFiles) remove(location string) {
+	g.mu.Lock()
+	delete(g.pending, location)
+	g.mu.Unlock()
+}
+
+// wait blocks until all the files' goroutines have returned.
+func (g *graceFiles) wait() {
+	g.wg.Wait()
+}
+
+// isUnchanged returns true if the size and modification time recorded in
+// before and after are the same.
+func isUnchanged(before os.FileInfo, after os.FileInfo) bool {
+	if before == nil || after == nil {
+		return before == after
+	}
+
+	return before.Size() == after.Size() &&
+		before.ModTime().Equal(after.ModTime())
+}
+
 func addWatchDirs(watcher *fsnotify.Watcher, root string, prune FilePredicate) error {
 	if err := ensureIsDir(root); err != nil {
 		return err
@@ -181,7 +369,7 @@ func addWatchDirs(watcher *fsnotify.Watcher, root string, prune FilePredicate) e
 			return nil
 		}
 
-		fp := FilePath{FileResource{path}, info}
+		fp := FilePath{FileResource: FileResource{path}, Info: info}
 		ok, err := include(fp)
 		if err != nil {
 			return err
@@ -276,6 +464,54 @@ func handleMovedtoFile(target FilePath, pred FilePredicate,
 	return err
 }
 
+// The initial and maximum delays between checks for a root directory while
+// waiting for it to be created (see waitForDir).
+const (
+	rootWaitMinDelay = 250 * time.Millisecond
+	rootWaitMaxDelay = 30 * time.Second
+)
+
+// waitForDir waits up to timeout for path to be created, checking at intervals
+// that double from rootWaitMinDelay to rootWaitMaxDelay. It returns nil once
+// path is a directory, or an error if the timeout expires or cancelCtx is
+// cancelled first, or if path exists, but is not a directory.
+func waitForDir(cancelCtx context.Context, path string,
+	timeout time.Duration) error {
+	err := ensureIsDir(path)
+	if err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	log := logs.GetLogger()
+	delay := rootWaitMinDelay
+	for {
+		log.Info().Str("root", path).Dur("retry_in", delay).
+			Msg("waiting for the root directory to be created")
+
+		select {
+		case <-cancelCtx.Done():
+			return cancelCtx.Err()
+		case <-timer.C:
+			return errors.Errorf("root directory %s was not created within %s",
+				path, timeout)
+		case <-time.After(delay):
+		}
+
+		if err = ensureIsDir(path); err == nil {
+			log.Info().Str("root", path).Msg("root directory created")
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		delay = min(delay*2, rootWaitMaxDelay)
+	}
+}
+
 func ensureIsDir(path string) error {
 	fInfo, err := os.Stat(path)
 	if err != nil {
@@ -0,0 +1,154 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file pathwatch_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchFilesGrace(t *testing.T) {
+	tmpDir := t.TempDir()
+	health := NewHealth(nil)
+	grace := 300 * time.Millisecond
+
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	paths, errs := watchFiles(cancelCtx, tmpDir, IsRegular, IsFalse, grace,
+		health)
+	if !assert.Eventually(t, health.IsWatching, 5*time.Second,
+		10*time.Millisecond, "initial watches were not recorded") {
+		return
+	}
+
+	file := filepath.Join(tmpDir, "reads1.fastq")
+	if !assert.NoError(t, os.WriteFile(file, []byte("reads"), 0644)) {
+		return
+	}
+
+	// Reopen the file to append within the grace period
+	time.Sleep(grace / 2)
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = f.WriteString("more reads")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	appended := time.Now()
+
+	select {
+	case p := <-paths:
+		assert.Equal(t, file, p.Location)
+		assert.GreaterOrEqual(t, time.Since(appended), grace,
+			"expected the grace period to restart on the second close")
+		assert.Equal(t, int64(15), p.Info.Size())
+	case err = <-errs:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "file was not reported after the grace period")
+	}
+
+	select {
+	case p := <-paths:
+		assert.Fail(t, "file was reported more than once", p.Location)
+	case <-time.After(2 * grace):
+	}
+
+	cancel()
+	for range paths {
+	}
+	for range errs {
+	}
+}
+
+func TestWatchFilesGraceCancel(t *testing.T) {
+	tmpDir := t.TempDir()
+	health := NewHealth(nil)
+
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	paths, errs := watchFiles(cancelCtx, tmpDir, IsRegular, IsFalse, time.Hour,
+		health)
+	if !assert.Eventually(t, health.IsWatching, 5*time.Second,
+		10*time.Millisecond, "initial watches were not recorded") {
+		cancel()
+		return
+	}
+
+	file := filepath.Join(tmpDir, "reads1.fastq")
+	assert.NoError(t, os.WriteFile(file, []byte("reads"), 0644))
+	time.Sleep(100 * time.Millisecond)
+
+	cancel()
+
+	done := make(chan token)
+	go func() {
+		for range paths {
+			assert.Fail(t, "file was reported before its grace period ended")
+		}
+		for range errs {
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "cancellation did not end the grace period")
+	}
+}
+
+func TestWaitForDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "data")
+
+	ctx := context.Background()
+
+	// Times out when the root is not created
+	err := waitForDir(ctx, root, 100*time.Millisecond)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "was not created")
+	}
+
+	// Returns once the root is created
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = os.Mkdir(root, 0755)
+	}()
+	assert.NoError(t, waitForDir(ctx, root, 10*time.Second))
+
+	// Fails at once when the root is not a directory
+	file := filepath.Join(tmpDir, "file")
+	assert.NoError(t, os.WriteFile(file, []byte{}, 0644))
+	assert.Error(t, waitForDir(ctx, file, 10*time.Second))
+
+	// Stops when cancelled
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, waitForDir(cancelCtx, filepath.Join(tmpDir, "none"),
+		10*time.Second), context.Canceled)
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file pause.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"sync"
+
+	logs "github.com/wtsi-npg/logshim"
+)
+
+// PauseBufferSize is the maximum number of detected files held while
+// processing is paused. Once it is full, detection blocks until processing is
+// resumed.
+const PauseBufferSize = 10000
+
+// Pause controls whether work is dispatched by DoProcessFiles. While paused,
+// no new work is started, although work already running is allowed to finish.
+//
+// The methods of a nil *Pause do nothing, so that pausing may be disabled by
+// using nil.
+type Pause struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	paused    bool
+	cancelled bool
+}
+
+// NewPause returns a new Pause, initially paused if paused is true.
+func NewPause(paused bool) *Pause {
+	p := &Pause{paused: paused}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// Pause stops the dispatch of new work until Resume is called.
+func (p *Pause) Pause() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.paused {
+		logs.GetLogger().Info().Msg("processing paused")
+	}
+	p.paused = true
+}
+
+// Resume restarts the dispatch of work.
+func (p *Pause) Resume() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	if p.paused {
+		logs.GetLogger().Info().Msg("processing resumed")
+	}
+	p.paused = false
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+// IsPaused returns true if the dispatch of work is paused.
+func (p *Pause) IsPaused() bool {
+	if p == nil {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.paused
+}
+
+// wait blocks while paused. It returns true if work may be dispatched, or
+// false if the Pause was cancelled while paused.
+func (p *Pause) wait() bool {
+	if p == nil {
+		return true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for p.paused && !p.cancelled {
+		p.cond.Wait()
+	}
+
+	return !p.paused
+}
+
+// cancel releases anything waiting. If paused, no further work is dispatched.
+func (p *Pause) cancel() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.cancelled = true
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+// bufferFilePaths returns a channel relaying the FilePaths from paths through
+// a buffer of capacity size, so that detection may continue while processing
+// is paused.
+func bufferFilePaths(paths <-chan FilePath, size int) <-chan FilePath {
+	buffered := make(chan FilePath, size)
+
+	go func() {
+		defer close(buffered)
+
+		for path := range paths {
+			buffered <- path
+		}
+	}()
+
+	return buffered
+}
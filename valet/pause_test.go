@@ -0,0 +1,130 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file pause_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoProcessFilesPause(t *testing.T) {
+	fp, err := NewFilePath("./testdata/valet/1/reads/fastq/reads1.fastq")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var numRuns atomic.Int32
+	plan := WorkPlan{
+		WorkMatch{
+			pred: IsTrue,
+			work: Work{WorkFunc: func(path FilePath) error {
+				numRuns.Add(1)
+				return nil
+			}},
+		},
+	}
+
+	pause := NewPause(true)
+	assert.True(t, pause.IsPaused())
+
+	ch := make(chan FilePath, 1)
+	ch <- fp
+	close(ch)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- DoProcessFiles(context.Background(), ch,
+			ProcessParams{Plan: plan, MaxProc: 1, Pause: pause})
+	}()
+
+	select {
+	case <-done:
+		assert.Fail(t, "expected processing to wait while paused")
+	case <-time.After(100 * time.Millisecond):
+		assert.Equal(t, int32(0), numRuns.Load())
+	}
+
+	pause.Resume()
+	assert.False(t, pause.IsPaused())
+
+	select {
+	case err = <-done:
+		assert.NoError(t, err)
+		assert.Equal(t, int32(1), numRuns.Load())
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "expected processing to finish when resumed")
+	}
+}
+
+func TestDoProcessFilesPauseCancelled(t *testing.T) {
+	fp, err := NewFilePath("./testdata/valet/1/reads/fastq/reads1.fastq")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var numRuns atomic.Int32
+	plan := WorkPlan{
+		WorkMatch{
+			pred: IsTrue,
+			work: Work{WorkFunc: func(path FilePath) error {
+				numRuns.Add(1)
+				return nil
+			}},
+		},
+	}
+
+	pause := NewPause(true)
+
+	ch := make(chan FilePath, 2)
+	ch <- fp
+	ch <- fp
+	close(ch)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- DoProcessFiles(context.Background(), ch,
+			ProcessParams{Plan: plan, MaxProc: 1, Pause: pause})
+	}()
+
+	pause.cancel()
+
+	select {
+	case err = <-done:
+		assert.NoError(t, err)
+		assert.Equal(t, int32(0), numRuns.Load(),
+			"expected no work after cancellation while paused")
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "expected processing to finish when cancelled")
+	}
+}
+
+func TestPauseNil(t *testing.T) {
+	var pause *Pause
+	pause.Pause()
+	pause.Resume()
+	pause.cancel()
+	assert.False(t, pause.IsPaused())
+	assert.True(t, pause.wait())
+}
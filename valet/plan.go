@@ -0,0 +1,111 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file plan.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	logs "github.com/wtsi-npg/logshim"
+)
+
+// PlanStepCount is the number of FilePaths matched by the predicate of one
+// WorkMatch in a WorkPlan.
+type PlanStepCount struct {
+	Match   WorkMatch // The WorkMatch
+	Matched uint64    // The number of FilePaths matched by its predicate
+	Errors  uint64    // The number of FilePaths for which its predicate failed
+}
+
+// PlanSummary describes the Work a WorkPlan would do on a set of FilePaths.
+type PlanSummary struct {
+	NumPaths uint64          // The number of FilePaths examined
+	Steps    []PlanStepCount // The counts for each WorkMatch, in rank order
+}
+
+// Rank returns the rank of the step's Work.
+func (c PlanStepCount) Rank() uint16 {
+	return c.Match.work.Rank
+}
+
+// SummarisePlan evaluates the predicate of each WorkMatch in workPlan on every
+// FilePath in the paths channel and counts the matches, without doing any
+// Work. Predicates are evaluated in up to maxThreads goroutines in parallel.
+// Predicate errors are logged at debug level and counted.
+//
+// The counts are of the Work that would be done in a single pass over the
+// paths. Work that becomes possible only after earlier Work is done (e.g.
+// archiving a file once it has been compressed) is not counted.
+func SummarisePlan(paths <-chan FilePath, workPlan WorkPlan,
+	maxThreads int) PlanSummary {
+	if maxThreads < 1 {
+		maxThreads = 1
+	}
+
+	plan := make(WorkPlan, len(workPlan))
+	copy(plan, workPlan)
+	sort.Stable(plan)
+
+	var numPaths uint64
+	matched := make([]uint64, len(plan))
+	errCount := make([]uint64, len(plan))
+
+	log := logs.GetLogger()
+
+	var wg sync.WaitGroup
+	for i := 0; i < maxThreads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for path := range paths {
+				atomic.AddUint64(&numPaths, 1)
+
+				for j, m := range plan {
+					ok, err := m.pred(path)
+					if err != nil {
+						log.Debug().Err(err).Str("path", path.Location).
+							Str("step", m.String()).
+							Msg("failed to evaluate predicate")
+						atomic.AddUint64(&errCount[j], 1)
+						continue
+					}
+					if ok {
+						atomic.AddUint64(&matched[j], 1)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	summary := PlanSummary{NumPaths: numPaths}
+	for j, m := range plan {
+		summary.Steps = append(summary.Steps, PlanStepCount{
+			Match:   m,
+			Matched: matched[j],
+			Errors:  errCount[j],
+		})
+	}
+
+	return summary
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file plan_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarisePlan(t *testing.T) {
+	called := false
+	work := func(path FilePath) error {
+		called = true
+		return nil
+	}
+	failing := func(path FilePath) (bool, error) {
+		return false, errors.New("predicate failed")
+	}
+
+	plan := WorkPlan{
+		{pred: IsFastq, predDoc: "Is Fastq",
+			work: Work{WorkFunc: work, Rank: 2}, workDoc: "Work"},
+		{pred: IsRegular, predDoc: "Is Regular",
+			work: Work{WorkFunc: work, Rank: 1}, workDoc: "Work"},
+		{pred: failing, predDoc: "Fails",
+			work: Work{WorkFunc: work, Rank: 3}, workDoc: "Work"},
+	}
+
+	paths, errs := FindFiles(context.Background(), "./testdata/valet/1/reads",
+		Or(IsFastq, IsFast5), IsFalse)
+	go func() {
+		for err := range errs {
+			t.Log(err)
+		}
+	}()
+
+	summary := SummarisePlan(paths, plan, 2)
+	assert.False(t, called, "work was done")
+
+	if assert.Len(t, summary.Steps, 3) {
+		n := summary.NumPaths
+		assert.Greater(t, n, uint64(0))
+
+		// In rank order
+		assert.Equal(t, "Is Regular => Work", summary.Steps[0].Match.String())
+		assert.Equal(t, uint16(1), summary.Steps[0].Rank())
+		assert.Equal(t, n, summary.Steps[0].Matched)
+
+		assert.Equal(t, "Is Fastq => Work", summary.Steps[1].Match.String())
+		assert.Greater(t, summary.Steps[1].Matched, uint64(0))
+		assert.Less(t, summary.Steps[1].Matched, n)
+
+		assert.Equal(t, uint64(0), summary.Steps[2].Matched)
+		assert.Equal(t, n, summary.Steps[2].Errors)
+	}
+}
@@ -0,0 +1,284 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file predexpr.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	logs "github.com/wtsi-npg/logshim"
+)
+
+// namedPredicates are the predicates that may be named in a predicate
+// expression (see ParsePredicateExpr), by the names of their variables or
+// functions. Those depending on a Selection are named in selectionPredicates.
+var namedPredicates = map[string]FilePredicate{
+	"IsTrue":               IsTrue,
+	"IsFalse":              IsFalse,
+	"IsDir":                IsDir,
+	"IsEmptyDir":           IsEmptyDir,
+	"IsRegular":            IsRegular,
+	"IsFast5":              IsFast5,
+	"IsPOD5":               IsPOD5,
+	"IsBLOW5":              IsBLOW5,
+	"IsSLOW5":              IsSLOW5,
+	"IsFastq":              IsFastq,
+	"IsBED":                IsBED,
+	"IsBAI":                IsBAI,
+	"IsBAM":                IsBAM,
+	"IsTxt":                IsTxt,
+	"IsMarkdown":           IsMarkdown,
+	"IsPDF":                IsPDF,
+	"IsHTML":               IsHTML,
+	"IsCSV":                IsCSV,
+	"IsTSV":                IsTSV,
+	"IsJSON":               IsJSON,
+	"IsCompressed":         IsCompressed,
+	"HasCompressedVersion": HasCompressedVersion,
+	"IsMinKNOWRunDir":      IsMinKNOWRunDir,
+	"IsUnderMinKNOWRunDir": IsUnderMinKNOWRunDir,
+	"IsMinKNOWReport":      IsMinKNOWReport,
+	"IsRunArchivedMarked":  IsRunArchivedMarked,
+	"IsOwnedByCurrentUser": IsOwnedByCurrentUser,
+}
+
+// selectionPredicates returns the predicates selecting files for work, and
+// those depending on the naming of checksum files, that may be named in a
+// predicate expression, taken from sel.
+func selectionPredicates(sel Selection) map[string]FilePredicate {
+	return map[string]FilePredicate{
+		"IsIncludedSuffix":     sel.IsIncludedSuffix,
+		"RequiresCompression":  sel.RequiresCompression,
+		"RequiresCopying":      sel.RequiresCopying,
+		"RequiresChecksum":     sel.RequiresChecksum,
+		"IsChecksumFile":       sel.checksums.IsChecksumFile,
+		"HasChecksumFile":      sel.checksums.HasChecksumFile,
+		"HasStaleChecksumFile": sel.checksums.HasStaleChecksumFile,
+	}
+}
+
+// PredicateNames returns the names of the predicates that may be used in a
+// predicate expression, sorted.
+func PredicateNames() []string {
+	var names []string
+	for name := range namedPredicates {
+		names = append(names, name)
+	}
+	for name := range selectionPredicates(builtIn) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ParsePredicateExpr returns a FilePredicate built from expr, an expression
+// combining the names of predicates (see PredicateNames) with the operators
+// "and", "or" and "not" and with parentheses e.g.
+//
+// IsFast5 or (IsFastq and IsCompressed) and IsUnderMinKNOWRunDir
+//
+// The operators are case-insensitive and, as usual, "not" binds more tightly
+// than "and", which binds more tightly than "or". The predicates are combined
+// with Not, And and Or, so evaluation stops as soon as the result is known.
+// The predicates selecting files for work, such as RequiresCopying, are those
+// of sel. It returns an error if expr names an unknown predicate or is
+// malformed.
+func ParsePredicateExpr(expr string, sel Selection) (FilePredicate, error) {
+	p := &exprParser{tokens: tokeniseExpr(expr),
+		selected: selectionPredicates(sel.OrBuiltIn())}
+	if len(p.tokens) == 0 {
+		return nil, errors.New("empty predicate expression")
+	}
+
+	pred, err := p.parseOr()
+	if err != nil {
+		return nil, errors.WithMessagef(err, "in predicate expression '%s'",
+			expr)
+	}
+	if tok, ok := p.peek(); ok {
+		return nil, errors.Errorf("unexpected '%s' in predicate "+
+			"expression '%s'", tok, expr)
+	}
+
+	return pred, nil
+}
+
+// MakeExprPruneFunc returns a pruning function (see MakeGlobPruneFunc) that
+// prunes any directory for which pred returns true. Files are never pruned.
+func MakeExprPruneFunc(pred FilePredicate) FilePredicate {
+	log := logs.GetLogger()
+
+	return func(fp FilePath) (bool, error) {
+		if fp.Info == nil || !fp.Info.IsDir() {
+			return false, nil
+		}
+
+		match, err := pred(fp)
+		if err != nil || !match {
+			return false, err
+		}
+
+		log.Debug().Str("path", fp.Location).
+			Msg("matched path for pruning")
+		return true, filepath.SkipDir // return SkipDir to prune here
+	}
+}
+
+// tokeniseExpr splits expr into names, operators and parentheses.
+func tokeniseExpr(expr string) []string {
+	var tokens []string
+	var tok strings.Builder
+
+	flush := func() {
+		if tok.Len() > 0 {
+			tokens = append(tokens, tok.String())
+			tok.Reset()
+		}
+	}
+
+	for _, r := range expr {
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		default:
+			tok.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// exprParser is a recursive descent parser of predicate expressions.
+type exprParser struct {
+	tokens   []string
+	pos      int
+	selected map[string]FilePredicate // The predicates selecting files
+}
+
+func (p *exprParser) peek() (string, bool) {
+	if p.pos >= len(p.tokens) {
+		return "", false
+	}
+	return p.tokens[p.pos], true
+}
+
+// accept consumes the next token if it is the operator op.
+func (p *exprParser) accept(op string) bool {
+	if tok, ok := p.peek(); ok && strings.EqualFold(tok, op) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) parseOr() (FilePredicate, error) {
+	pred, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	preds := []FilePredicate{pred}
+	for p.accept("or") {
+		if pred, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		preds = append(preds, pred)
+	}
+
+	if len(preds) == 1 {
+		return preds[0], nil
+	}
+	return Or(preds...), nil
+}
+
+func (p *exprParser) parseAnd() (FilePredicate, error) {
+	pred, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	preds := []FilePredicate{pred}
+	for p.accept("and") {
+		if pred, err = p.parseNot(); err != nil {
+			return nil, err
+		}
+		preds = append(preds, pred)
+	}
+
+	if len(preds) == 1 {
+		return preds[0], nil
+	}
+	return And(preds...), nil
+}
+
+func (p *exprParser) parseNot() (FilePredicate, error) {
+	if p.accept("not") {
+		pred, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return Not(pred), nil
+	}
+
+	return p.parseTerm()
+}
+
+func (p *exprParser) parseTerm() (FilePredicate, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, errors.New("unexpected end")
+	}
+
+	if p.accept("(") {
+		pred, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, errors.New("missing ')'")
+		}
+		return pred, nil
+	}
+
+	switch strings.ToLower(tok) {
+	case ")", "and", "or", "not":
+		return nil, errors.Errorf("unexpected '%s'", tok)
+	}
+
+	pred, ok := namedPredicates[tok]
+	if !ok {
+		pred, ok = p.selected[tok]
+	}
+	if !ok {
+		return nil, errors.Errorf("unknown predicate '%s'", tok)
+	}
+	p.pos++
+
+	return pred, nil
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file predexpr_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePredicateExpr(t *testing.T) {
+	fast5, _ := NewFilePath("./testdata/valet/1/reads/fast5/reads1.fast5")
+	fastq, _ := NewFilePath("./testdata/valet/1/reads/fastq/reads1.fastq")
+	fastqGz, _ := NewFilePath("./testdata/valet/1/reads/fastq/reads2.fastq.gz")
+	bam, _ := NewFilePath("./testdata/valet/1/reads/alignments/alignments1.bam")
+
+	for expr, expected := range map[string][]bool{
+		// fast5, fastq, fastq.gz, bam
+		"IsFast5":                                   {true, false, false, false},
+		"not IsFast5":                               {false, true, true, true},
+		"IsFast5 or IsFastq and IsCompressed":       {true, false, true, false},
+		"(IsFast5 or IsFastq) and IsCompressed":     {false, false, true, false},
+		"IsFast5 OR (IsFastq AND NOT IsCompressed)": {true, true, false, false},
+		"not not IsBAM":                             {false, false, false, true},
+		"IsRegular and not (IsFast5 or IsFastq)":    {false, false, false, true},
+	} {
+		pred, err := ParsePredicateExpr(expr, Selection{})
+		if !assert.NoError(t, err, expr) {
+			continue
+		}
+
+		for i, fp := range []FilePath{fast5, fastq, fastqGz, bam} {
+			ok, err := pred(fp)
+			if assert.NoError(t, err) {
+				assert.Equal(t, expected[i], ok, "%s on %s", expr,
+					filepath.Base(fp.Location))
+			}
+		}
+	}
+}
+
+func TestParsePredicateExprInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"IsFast6",
+		"isfast5",
+		"IsFast5 and",
+		"IsFast5 IsFastq",
+		"(IsFast5 or IsFastq",
+		"IsFast5)",
+		"and IsFast5",
+		"not",
+		"()",
+	} {
+		_, err := ParsePredicateExpr(expr, Selection{})
+		assert.Error(t, err, "expected an error for '%s'", expr)
+	}
+}
+
+func TestPredicateNames(t *testing.T) {
+	names := PredicateNames()
+	assert.Contains(t, names, "IsFast5")
+	assert.Contains(t, names, "IsUnderMinKNOWRunDir")
+	assert.Contains(t, names, "RequiresCopying")
+	assert.IsIncreasing(t, names)
+}
+
+func TestParsePredicateExprSelection(t *testing.T) {
+	vcf := FilePath{FileResource: FileResource{
+		Location: "./testdata/valet/1/calls/calls1.vcf"}}
+
+	sel, err := MakeSelection(SelectParams{IncludedSuffixes: []string{"vcf"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, c := range []struct {
+		sel      Selection
+		expected bool
+	}{{Selection{}, false}, {sel, true}} {
+		pred, err := ParsePredicateExpr("IsIncludedSuffix and RequiresCopying",
+			c.sel)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		ok, err := pred(vcf)
+		if assert.NoError(t, err) {
+			assert.Equal(t, c.expected, ok)
+		}
+	}
+}
+
+func TestMakeExprPruneFunc(t *testing.T) {
+	pred, err := ParsePredicateExpr("IsDir and not IsEmptyDir", Selection{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	pruneFn := MakeExprPruneFunc(pred)
+
+	dir, _ := NewFilePath("./testdata/valet/1/reads")
+	ok, err := pruneFn(dir)
+	assert.True(t, ok)
+	assert.Equal(t, filepath.SkipDir, err)
+
+	file, _ := NewFilePath("./testdata/valet/1/reads/fast5/reads1.fast5")
+	ok, err = pruneFn(file)
+	assert.False(t, ok)
+	assert.NoError(t, err)
+}
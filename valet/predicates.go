@@ -23,16 +23,17 @@ package valet
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
 	ex "github.com/wtsi-npg/extendo/v2"
 	logs "github.com/wtsi-npg/logshim"
-
-	"github.com/wtsi-npg/valet/utilities"
 )
 
 type FilePredicate func(path FilePath) (bool, error)
@@ -55,9 +56,19 @@ const TxtSuffix string = "txt"
 const TSVSuffix string = "tsv"
 const PDFSuffix string = "pdf"
 const POD5Suffix string = "pod5"
-const MD5Suffix string = "md5" // The recognised suffix for MD5 checksum files
+const BLOW5Suffix string = "blow5"
+const SLOW5Suffix string = "slow5"
+const MD5Suffix string = "md5" // The default suffix for MD5 checksum files
 const GzipSuffix string = "gz"
 
+// RawChecksumInfix distinguishes the name of a checksum file for the
+// uncompressed content of a compressed file.
+const RawChecksumInfix string = "raw"
+
+// IncompressibleSuffix is the suffix of the marker file recording that a file
+// is not worth compressing (see IncompressibleFilename).
+const IncompressibleSuffix string = "incompressible"
+
 var fast5Regex = regexp.MustCompile(fmt.Sprintf("(?i).*[.]%s$", Fast5Suffix))
 var fastqRegex = regexp.MustCompile(fmt.Sprintf("(?i).*[.]%s$", FastqSuffix))
 var baiRegex = regexp.MustCompile(fmt.Sprintf("(?i).*[.]%s$", BAISuffix))
@@ -70,6 +81,8 @@ var tsvRegex = regexp.MustCompile(fmt.Sprintf("(?i).*[.]%s$", TSVSuffix))
 var markdownRegex = regexp.MustCompile(fmt.Sprintf("(?i).*[.]%s$", MarkdownSuffix))
 var pdfRegex = regexp.MustCompile(fmt.Sprintf("(?i).*[.]%s$", PDFSuffix))
 var pod5Regex = regexp.MustCompile(fmt.Sprintf("(?i).*[.]%s$", POD5Suffix))
+var blow5Regex = regexp.MustCompile(fmt.Sprintf("(?i).*[.]%s$", BLOW5Suffix))
+var slow5Regex = regexp.MustCompile(fmt.Sprintf("(?i).*[.]%s$", SLOW5Suffix))
 var csvRegex = regexp.MustCompile(fmt.Sprintf("(?i).*[.]%s$", CSVSuffix))
 var gzipRegex = regexp.MustCompile(fmt.Sprintf("(?i).*[.]%s$", GzipSuffix))
 var reportRegex = regexp.MustCompile(fmt.Sprintf("(?i)report.*[.]%s$", MarkdownSuffix))
@@ -80,6 +93,12 @@ var IsFast5 = makeNoCompFilePredicate(fast5Regex)
 // IsPOD5 returns true if path matches the recognised pod5 pattern.
 var IsPOD5 = makeNoCompFilePredicate(pod5Regex)
 
+// IsBLOW5 returns true if path matches the recognised blow5 pattern.
+var IsBLOW5 = makeNoCompFilePredicate(blow5Regex)
+
+// IsSLOW5 returns true if path matches the recognised slow5 pattern.
+var IsSLOW5 = makeNoCompFilePredicate(slow5Regex)
+
 // IsFastq returns true if path matches the recognised fastq pattern. Supports
 // compressed versions.
 var IsFastq = makeCompFilePredicate(fastqRegex)
@@ -121,6 +140,57 @@ var IsTSV = makeCompFilePredicate(tsvRegex)
 // Supports compressed versions.
 var IsJSON = makeCompFilePredicate(jsonRegex)
 
+// MakeSuffixMatchFunc returns a FilePredicate that will return true for any
+// path ending with one of suffixes, preceded by a dot. Any leading dot on a
+// suffix is ignored and matching is case-insensitive, as for the built-in
+// types. Unlike those, no regular expression is compiled, so that it is
+// suitable for sets of suffixes made at runtime. A compressed version of a
+// file does not match, unless its compressed suffix is itself one of suffixes
+// (see MakeCompSuffixMatchFunc).
+func MakeSuffixMatchFunc(suffixes ...string) (FilePredicate, error) {
+	return makeSuffixMatchFunc(suffixes, false)
+}
+
+// MakeCompSuffixMatchFunc returns a FilePredicate that will return true for
+// any path ending with one of suffixes, as MakeSuffixMatchFunc, or for any
+// compressed version of such a path, as for the built-in types that support
+// compressed versions e.g. IsFastq.
+func MakeCompSuffixMatchFunc(suffixes ...string) (FilePredicate, error) {
+	return makeSuffixMatchFunc(suffixes, true)
+}
+
+func makeSuffixMatchFunc(suffixes []string, comp bool) (FilePredicate, error) {
+	dotted := make([]string, 0, len(suffixes))
+	for _, suffix := range suffixes {
+		suffix = strings.TrimPrefix(suffix, ".")
+		if suffix == "" {
+			return nil, errors.New("a suffix may not be empty")
+		}
+		if strings.ContainsRune(suffix, filepath.Separator) {
+			return nil, errors.Errorf("the suffix '%s' may not contain a "+
+				"path separator", suffix)
+		}
+
+		dotted = append(dotted, "."+strings.ToLower(suffix))
+	}
+
+	return func(path FilePath) (bool, error) {
+		name := path.Location
+		if comp {
+			name = path.UncompressedFilename()
+		}
+		name = strings.ToLower(name)
+
+		for _, suffix := range dotted {
+			if strings.HasSuffix(name, suffix) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	}, nil
+}
+
 // MinKNOWRunIDRegex matches the run ID of MinKNOW c. August 2019 for GridION
 // and PromethION i.e. of the form:
 //
@@ -128,42 +198,254 @@ var IsJSON = makeCompFilePredicate(jsonRegex)
 //
 var MinKNOWRunIDRegex = regexp.MustCompile(`^\d+_\d+_\S+_[A-Za-z0-9]+_[A-Za-z0-9]+$`)
 
-var RequiresCopying = Or(
-	And(IsBED, IsCompressed),
-	And(IsCSV, IsCompressed),
-	And(IsFastq, IsCompressed),
-	And(IsJSON, IsCompressed),
-	And(IsTxt, IsCompressed),
-	IsBAI,
-	IsBAM,
-	IsFast5,
-	IsHTML,
-	IsMarkdown,
-	IsPDF,
-	IsPOD5,
-	IsTSV,
-)
+// isCompressible returns true if path is of a type that is compressed before
+// archiving.
+var isCompressible = Or(IsBED, IsCSV, IsFastq, IsJSON, IsTxt)
+
+// SelectParams extend the built-in types of file that are selected for work
+// (see MakeSelection). The zero value selects the built-in types alone.
+type SelectParams struct {
+	// Additional file name suffixes which mark files as requiring copying and
+	// checksumming, matched as by MakeSuffixMatchFunc. These only add to the
+	// built-in types; they never remove any of them.
+	IncludedSuffixes []string
+
+	// The size in bytes below which files of the types that are otherwise
+	// compressed before archiving are archived uncompressed, because
+	// compressing very small files saves little and costs a compression step
+	// each. The default of 0 compresses files of any size.
+	MinCompressSize int64
+
+	// The ratio of uncompressed to compressed size e.g. 1.1, below which
+	// compression is considered not worthwhile. A file whose compressed
+	// version achieves less is archived uncompressed instead, which is
+	// recorded in a marker file beside it (see IncompressibleFilename). The
+	// default of 0 keeps every compressed file.
+	MinCompressRatio float64
+
+	// The naming of checksum files and the other files kept beside the data
+	// files they describe. The zero value is the default naming.
+	ChecksumFiles ChecksumFiles
+}
+
+// Selection holds the predicates that select files for work, according to the
+// SelectParams from which it was made.
+type Selection struct {
+	// RequiresCopying returns true if the argument is of a type that is
+	// copied to the archive.
+	RequiresCopying FilePredicate
+
+	// RequiresChecksum returns true if the argument is a regular file that is
+	// recognised as a checksum target and either has no checksum file, or has
+	// a checksum file that is stale.
+	RequiresChecksum FilePredicate
+
+	// RequiresRawChecksum returns true if the argument is a compressed regular
+	// file that is recognised as a checksum target and either has no checksum
+	// file for its uncompressed content, or has one that is stale.
+	RequiresRawChecksum FilePredicate
+
+	// RequiresCompression returns true if the argument is of a type that is
+	// compressed before archiving and has not been compressed.
+	RequiresCompression FilePredicate
+
+	isIncludedSuffix FilePredicate
+	minCompressSize  int64
+	minCompressRatio float64
+	checksums        ChecksumFiles
+}
+
+// builtIn is the Selection of the built-in types alone.
+var builtIn = mustMakeSelection(SelectParams{})
+
+// MakeSelection returns the Selection of files of the built-in types, together
+// with those described by params.
+func MakeSelection(params SelectParams) (Selection, error) {
+	isIncludedSuffix, err := MakeSuffixMatchFunc(params.IncludedSuffixes...)
+	if err != nil {
+		return Selection{}, errors.Wrap(err, "invalid included suffix")
+	}
+	if params.MinCompressSize < 0 {
+		return Selection{}, errors.Errorf("the minimum compression size %d "+
+			"may not be negative", params.MinCompressSize)
+	}
+	if params.MinCompressRatio != 0 && params.MinCompressRatio < 1 {
+		return Selection{}, errors.Errorf("the minimum compression ratio %g "+
+			"must be 0 or at least 1", params.MinCompressRatio)
+	}
+
+	sel := Selection{
+		isIncludedSuffix: isIncludedSuffix,
+		minCompressSize:  params.MinCompressSize,
+		minCompressRatio: params.MinCompressRatio,
+		checksums:        params.ChecksumFiles,
+	}
+	cf := sel.checksums
+
+	sel.RequiresCopying = And(Not(cf.IsChecksumFile), Or(
+		And(isCompressible, Or(sel.IsBelowMinCompressSize, sel.IsIncompressible),
+			Not(IsCompressed), Not(HasCompressedVersion)),
+		And(IsBED, IsCompressed),
+		And(IsCSV, IsCompressed),
+		And(IsFastq, IsCompressed),
+		And(IsJSON, IsCompressed),
+		And(IsTxt, IsCompressed),
+		IsBAI,
+		IsBAM,
+		IsBLOW5,
+		IsFast5,
+		IsHTML,
+		IsMarkdown,
+		IsPDF,
+		IsPOD5,
+		IsSLOW5,
+		IsTSV,
+		isIncludedSuffix,
+	))
+
+	sel.RequiresChecksum = And(
+		IsRegular,
+		sel.RequiresCopying,
+		Or(Not(cf.HasChecksumFile), cf.HasStaleChecksumFile))
+
+	sel.RequiresRawChecksum = And(
+		IsRegular,
+		sel.RequiresCopying,
+		IsCompressed,
+		Or(Not(cf.HasRawChecksumFile), cf.HasStaleRawChecksumFile))
+
+	sel.RequiresCompression = And(
+		isCompressible,
+		Not(IsCompressed),
+		Not(HasCompressedVersion),
+		Not(sel.IsBelowMinCompressSize),
+		Not(sel.IsIncompressible))
+
+	return sel, nil
+}
+
+func mustMakeSelection(params SelectParams) Selection {
+	sel, err := MakeSelection(params)
+	if err != nil {
+		panic(err)
+	}
+
+	return sel
+}
+
+// OrBuiltIn returns sel, or the Selection of the built-in types if sel is the
+// zero value. Every function given a Selection uses it this way, so that the
+// zero value is safe to use.
+func (sel Selection) OrBuiltIn() Selection {
+	if sel.RequiresCopying == nil {
+		return builtIn
+	}
+
+	return sel
+}
+
+// ChecksumFiles returns the naming of checksum files of the Selection (see
+// SelectParams).
+func (sel Selection) ChecksumFiles() ChecksumFiles {
+	return sel.checksums
+}
+
+// IsIncludedSuffix returns true if path matches any of the additional
+// suffixes of the Selection (see SelectParams).
+func (sel Selection) IsIncludedSuffix(path FilePath) (bool, error) {
+	return sel.OrBuiltIn().isIncludedSuffix(path)
+}
+
+// IsBelowMinCompressSize returns true if path is a regular file smaller than
+// the minimum compression size of the Selection (see SelectParams).
+func (sel Selection) IsBelowMinCompressSize(path FilePath) (bool, error) {
+	if sel.minCompressSize == 0 {
+		return false, nil
+	}
+
+	return path.Info.Mode().IsRegular() &&
+		path.Info.Size() < sel.minCompressSize, nil
+}
 
-// RequiresChecksum returns true if the argument is a regular file that is
-// recognised as a checksum target and either has no checksum file, or has a
-// checksum file that is stale.
-var RequiresChecksum = And(
-	IsRegular,
-	RequiresCopying,
-	Or(Not(HasChecksumFile), HasStaleChecksumFile))
-
-var HasValidChecksumFile = Not(HasStaleChecksumFile)
-
-var RequiresCompression = And(
-	Or(
-		IsBED,
-		IsCSV,
-		IsFastq,
-		IsJSON,
-		IsTxt,
-	),
-	Not(IsCompressed),
-	Not(HasCompressedVersion))
+// IsIncompressible returns true if path has a marker file that is not stale
+// (see IncompressibleFilename), recording that its compression achieved less
+// than the minimum compression ratio of the Selection (see SelectParams). As
+// the marker is kept beside the file, this survives a restart, while a file
+// modified since it was marked is compressed once more.
+func (sel Selection) IsIncompressible(path FilePath) (bool, error) {
+	if sel.minCompressRatio == 0 || path.Info == nil {
+		return false, nil
+	}
+
+	marker := sel.checksums.IncompressibleFilename(path)
+	ok, err := hasSidecarFile(path, marker, "incompressible marker")
+	if err != nil || !ok {
+		return false, err
+	}
+	if ok, err = hasStaleSidecarFile(path, marker,
+		"stale incompressible marker"); err != nil || ok {
+		return false, err
+	}
+
+	ratio, err := readCompressionRatio(marker)
+	if err != nil {
+		return false, err
+	}
+
+	return ratio < sel.minCompressRatio, nil
+}
+
+// IsAwaitingChecksum returns true if the argument requires a checksum file (see
+// RequiresChecksum) and logs that it is waiting for one. It is used where
+// checksum files are created by a separate process.
+func (sel Selection) IsAwaitingChecksum(path FilePath) (bool, error) {
+	ok, err := sel.OrBuiltIn().RequiresChecksum(path)
+	if err == nil && ok {
+		logs.GetLogger().Info().Str("path", path.Location).
+			Msg("waiting for checksum")
+	}
+
+	return ok, err
+}
+
+// MakeRequiresRemoteChecksum returns a predicate that will return true if its
+// argument is a regular file that is recognised as a checksum target and
+// either has no checksum file for the remote algorithm alg (see
+// RemoteChecksumFilename), or has one that is stale.
+func (sel Selection) MakeRequiresRemoteChecksum(alg ChecksumAlgorithm) FilePredicate {
+	sel = sel.OrBuiltIn()
+	hasFile := func(path FilePath) (bool, error) {
+		return hasSidecarFile(path,
+			sel.checksums.RemoteChecksumFilename(path, alg),
+			"remote checksum file")
+	}
+	hasStaleFile := func(path FilePath) (bool, error) {
+		return hasStaleSidecarFile(path,
+			sel.checksums.RemoteChecksumFilename(path, alg),
+			"stale remote checksum")
+	}
+
+	return And(
+		IsRegular,
+		sel.RequiresCopying,
+		Or(Not(hasFile), hasStaleFile))
+}
+
+// RequiresCopying returns true if the argument is of a built-in type that is
+// copied to the archive. A Selection may add further types (see
+// MakeSelection).
+var RequiresCopying = builtIn.RequiresCopying
+
+// RequiresChecksum is the Selection.RequiresChecksum of the built-in types.
+var RequiresChecksum = builtIn.RequiresChecksum
+
+// RequiresRawChecksum is the Selection.RequiresRawChecksum of the built-in
+// types.
+var RequiresRawChecksum = builtIn.RequiresRawChecksum
+
+// RequiresCompression is the Selection.RequiresCompression of the built-in
+// types.
+var RequiresCompression = builtIn.RequiresCompression
 
 var RequiresAnnotation = IsMinKNOWReport
 
@@ -182,11 +464,72 @@ func IsDir(path FilePath) (bool, error) {
 	return path.Info.IsDir(), nil
 }
 
+// IsEmptyDir returns true if the argument is a directory containing no
+// entries.
+func IsEmptyDir(path FilePath) (bool, error) {
+	if !path.Info.IsDir() {
+		return false, nil
+	}
+
+	dir, err := os.Open(path.Location)
+	if err != nil {
+		return false, err
+	}
+	defer dir.Close()
+
+	if _, err = dir.Readdirnames(1); err == io.EOF {
+		return true, nil
+	}
+
+	return false, err
+}
+
 // IsRegular returns true if the argument is a regular file (by os.Stat).
 func IsRegular(path FilePath) (bool, error) {
 	return path.Info.Mode().IsRegular(), nil
 }
 
+// IsFIFO returns true if the argument is a named pipe (by os.Stat).
+func IsFIFO(path FilePath) (bool, error) {
+	return path.Info.Mode()&os.ModeNamedPipe != 0, nil
+}
+
+// IsSocket returns true if the argument is a Unix domain socket (by os.Stat).
+func IsSocket(path FilePath) (bool, error) {
+	return path.Info.Mode()&os.ModeSocket != 0, nil
+}
+
+// IsDevice returns true if the argument is a block or character device file
+// (by os.Stat).
+func IsDevice(path FilePath) (bool, error) {
+	return path.Info.Mode()&os.ModeDevice != 0, nil
+}
+
+// IsSpecial returns true if the argument is a named pipe, socket or device
+// file. Opening one of these may block indefinitely, so they must never be
+// worked on.
+var IsSpecial = Or(IsFIFO, IsSocket, IsDevice)
+
+// IsOwnedByCurrentUser returns true if the argument is owned by the effective
+// user of this process, so that the files of other users, e.g. on a shared
+// instrument, may be left alone. It returns an error if the owner of the
+// argument cannot be determined.
+func IsOwnedByCurrentUser(path FilePath) (bool, error) {
+	stat, ok := path.Info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false, errors.Errorf("failed to determine the owner of '%s'",
+			path.Location)
+	}
+
+	if int(stat.Uid) != os.Geteuid() {
+		logs.GetLogger().Debug().Str("path", path.Location).
+			Int("uid", int(stat.Uid)).Msg("owned by another user")
+		return false, nil
+	}
+
+	return true, nil
+}
+
 // And returns a predicate that returns true if all its arguments return true,
 // or returns false otherwise.
 func And(predicates ...FilePredicate) FilePredicate {
@@ -245,7 +588,7 @@ func HasCompressedVersion(path FilePath) (bool, error) {
 	compressed, err := IsCompressed(path)
 
 	if err == nil && !compressed {
-		_, err := os.Stat(path.CompressedFilename())
+		_, err := path.stats.stat(path.CompressedFilename())
 		if err == nil {
 			logs.GetLogger().Debug().Str("path", path.Location).
 				Msg("compressed version present")
@@ -258,13 +601,51 @@ func HasCompressedVersion(path FilePath) (bool, error) {
 	return false, err
 }
 
+// IsChecksumFile returns true if the argument is a checksum file.
+func (cf ChecksumFiles) IsChecksumFile(path FilePath) (bool, error) {
+	return cf.IsChecksumFilename(path.Location), nil
+}
+
 // HasChecksumFile returns true if the argument has a corresponding checksum
 // file.
-func HasChecksumFile(path FilePath) (bool, error) {
-	_, err := os.Stat(path.ChecksumFilename())
+func (cf ChecksumFiles) HasChecksumFile(path FilePath) (bool, error) {
+	return hasSidecarFile(path, cf.ChecksumFilename(path), "checksum file")
+}
+
+// HasRawChecksumFile returns true if the argument has a corresponding checksum
+// file for its uncompressed content (see RawChecksumFilename).
+func (cf ChecksumFiles) HasRawChecksumFile(path FilePath) (bool, error) {
+	return hasSidecarFile(path, cf.RawChecksumFilename(path),
+		"raw checksum file")
+}
+
+// HasStaleChecksumFile returns true if the argument has a checksum file with a
+// timestamp older than the argument file i.e. the argument file appears to
+// have been modified since the checksum file was last modified.
+//
+// If the argument path does not exist, or has no checksum file, this function
+// returns false.
+func (cf ChecksumFiles) HasStaleChecksumFile(path FilePath) (bool, error) {
+	return hasStaleSidecarFile(path, cf.ChecksumFilename(path),
+		"stale checksum")
+}
+
+// HasStaleRawChecksumFile returns true if the argument has a checksum file for
+// its uncompressed content with a timestamp older than the argument file. If
+// the argument path does not exist, or has no such checksum file, this
+// function returns false.
+func (cf ChecksumFiles) HasStaleRawChecksumFile(path FilePath) (bool, error) {
+	return hasStaleSidecarFile(path, cf.RawChecksumFilename(path),
+		"stale raw checksum")
+}
+
+// hasSidecarFile returns true if the file sidecar, belonging to path, exists.
+// The description desc is used for logging.
+func hasSidecarFile(path FilePath, sidecar string, desc string) (bool, error) {
+	_, err := path.stats.stat(sidecar)
 	if err == nil {
 		logs.GetLogger().Debug().Str("path", path.Location).
-			Msg("checksum file present")
+			Msg(desc + " present")
 		return true, err
 	} else if os.IsNotExist(err) {
 		return false, nil
@@ -273,14 +654,12 @@ func HasChecksumFile(path FilePath) (bool, error) {
 	return false, err
 }
 
-// HasStaleChecksumFile returns true if the argument has a checksum file with a
-// timestamp older than the argument file i.e. the argument file appears to
-// have been modified since the checksum file was last modified.
-//
-// If the argument path does not exist, or has no checksum file, this function
-// returns false.
-func HasStaleChecksumFile(path FilePath) (bool, error) {
-	chkInfo, err := os.Stat(path.ChecksumFilename())
+// hasStaleSidecarFile returns true if the file sidecar, belonging to path,
+// exists and has a timestamp older than path. The description desc is used for
+// logging.
+func hasStaleSidecarFile(path FilePath, sidecar string,
+	desc string) (bool, error) {
+	chkInfo, err := path.stats.stat(sidecar)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return false, nil
@@ -293,7 +672,7 @@ func HasStaleChecksumFile(path FilePath) (bool, error) {
 		logs.GetLogger().Debug().
 			Str("path", path.Location).
 			Time("data_time", path.Info.ModTime()).
-			Time("checksum_time", chkInfo.ModTime()).Msg("stale checksum")
+			Time("checksum_time", chkInfo.ModTime()).Msg(desc)
 		return true, nil
 	}
 
@@ -316,6 +695,15 @@ func IsMinKNOWRunDir(path FilePath) (bool, error) {
 	return false, nil
 }
 
+// IsUnderMinKNOWRunDir returns true if its argument is within a MinKNOW run
+// directory i.e. any of its ancestors is named by a MinKNOW run ID (see
+// IsMinKNOWRunID). A run directory is not itself under a run directory. Use
+// this to ignore stray files outside run directories e.g. at the data root.
+func IsUnderMinKNOWRunDir(path FilePath) (bool, error) {
+	_, ok := FindMinKNOWRunID(filepath.Dir(path.Location))
+	return ok, nil
+}
+
 // IsMinKNOWReport returns true if path is a MinKNOW run report file. This
 // file is Markdown that contains a section of JSON metadata describing details
 // of the run.
@@ -331,11 +719,291 @@ func MakeIsOlderThan(duration time.Duration) FilePredicate {
 	}
 }
 
+// MakeIsWrittenInRunWindow returns a predicate that will return true if its
+// argument is a regular file last modified within a window relative to the
+// start time of its run: at or after start plus from and before start plus to.
+// E.g. with from 0 and to one hour, it matches the files written in the first
+// hour of the run. The start time may be taken from the run's MinKNOW report
+// (see MinKNOWReport.StartTime).
+func MakeIsWrittenInRunWindow(start time.Time, from time.Duration,
+	to time.Duration) FilePredicate {
+	begin, end := start.Add(from), start.Add(to)
+
+	return func(path FilePath) (bool, error) {
+		if !path.Info.Mode().IsRegular() {
+			return false, nil
+		}
+
+		mtime := path.Info.ModTime()
+		return !mtime.Before(begin) && mtime.Before(end), nil
+	}
+}
+
+// MakeIsSmallerThan returns a predicate that will return true if its argument
+// is smaller than maxBytes. Only regular files are tested; any other argument
+// e.g. a directory, returns true. A file of maxBytes or more is logged as a
+// warning, so that it may be reviewed by an operator.
+func MakeIsSmallerThan(maxBytes int64) FilePredicate {
+	return func(path FilePath) (bool, error) {
+		if !path.Info.Mode().IsRegular() || path.Info.Size() < maxBytes {
+			return true, nil
+		}
+
+		logs.GetLogger().Warn().Str("path", path.Location).
+			Int64("size", path.Info.Size()).
+			Int64("max_size", maxBytes).
+			Msg("file is too large; skipping it pending review")
+
+		return false, nil
+	}
+}
+
 // MakeRequiresRemoval returns a predicate that will return true if its argument
 // is a run directory that may be removed because it is older than the specified
 // duration.
 func MakeRequiresRemoval(duration time.Duration) FilePredicate {
-	return And(IsMinKNOWRunDir, MakeIsOlderThan(duration))
+	return MakeRequiresRemovalSetting(NewDurationSetting(duration))
+}
+
+// MakeRequiresRemovalSetting behaves in the same way as MakeRequiresRemoval,
+// except that the duration is the current value of delay whenever the
+// predicate is called.
+func MakeRequiresRemovalSetting(delay *DurationSetting) FilePredicate {
+	return And(IsMinKNOWRunDir, func(path FilePath) (bool, error) {
+		return MakeIsOlderThan(delay.Get())(path)
+	})
+}
+
+// MakeIsInRuns returns a predicate that will return true if its argument is,
+// or is within, a MinKNOW run directory whose run ID is one of runIDs. The run
+// directory is the nearest path element that is a MinKNOW run ID (see
+// IsMinKNOWRunID).
+func MakeIsInRuns(runIDs []string) FilePredicate {
+	allowed := make(map[string]bool, len(runIDs))
+	for _, id := range runIDs {
+		allowed[id] = true
+	}
+
+	return func(path FilePath) (bool, error) {
+		id, ok := FindMinKNOWRunID(path.Location)
+		return ok && allowed[id], nil
+	}
+}
+
+// MakeHasSentinel returns a predicate that will return true if its argument has
+// a sentinel file, named by appending suffix to its path, e.g. a reads.fastq
+// file has a sentinel reads.fastq.done when suffix is ".done". A writer may
+// create a sentinel once it has finished writing a file.
+func MakeHasSentinel(suffix string) FilePredicate {
+	return func(path FilePath) (bool, error) {
+		return hasSidecarFile(path, path.Location+suffix, "sentinel file")
+	}
+}
+
+// FindMinKNOWRunID returns the nearest element of path, starting with its
+// base, that is a MinKNOW run ID and true, or the empty string and false if
+// there is none.
+func FindMinKNOWRunID(path string) (string, bool) {
+	dir, ok := FindMinKNOWRunDir(path)
+	if !ok {
+		return "", false
+	}
+	return filepath.Base(dir), true
+}
+
+// FindMinKNOWRunDir returns the nearest of path and its ancestors that is
+// named by a MinKNOW run ID and true, or the empty string and false if there
+// is none.
+func FindMinKNOWRunDir(path string) (string, bool) {
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		if IsMinKNOWRunID(filepath.Base(p)) {
+			return p, true
+		}
+		if p == filepath.Dir(p) {
+			return "", false
+		}
+	}
+}
+
+// DefaultActiveRunWindow is the default period within which a run directory
+// must have been modified to be considered active (see MakeIsInActiveRun).
+const DefaultActiveRunWindow = 24 * time.Hour
+
+// MakeIsInActiveRun returns a predicate that will return true if its argument
+// is, or is within, a MinKNOW run directory that appears to be the run that
+// MinKNOW is writing. This is the run directory with the newest modification
+// time among those of its experiment (i.e. in any of the sample directories of
+// its experiment directory), provided that it has been modified within window.
+//
+// This is a heuristic to complement the detection of completed runs, for
+// instruments that do not reliably write a final summary.
+func MakeIsInActiveRun(window time.Duration) FilePredicate {
+	return func(path FilePath) (bool, error) {
+		runDir, ok := FindMinKNOWRunDir(path.Location)
+		if !ok {
+			return false, nil
+		}
+		return isActiveRunDir(runDir, window)
+	}
+}
+
+// isActiveRunDir returns true if runDir has been modified within window and
+// no other run directory of its experiment has been modified more recently.
+func isActiveRunDir(runDir string, window time.Duration) (bool, error) {
+	info, err := os.Stat(runDir)
+	if err != nil {
+		return false, err
+	}
+	if time.Since(info.ModTime()) > window {
+		return false, nil
+	}
+
+	exptDir := filepath.Dir(filepath.Dir(runDir))
+	sampleDirs, err := os.ReadDir(exptDir)
+	if err != nil {
+		return false, err
+	}
+
+	for _, sampleDir := range sampleDirs {
+		if !sampleDir.IsDir() {
+			continue
+		}
+
+		entries, err := os.ReadDir(filepath.Join(exptDir, sampleDir.Name()))
+		if err != nil {
+			return false, err
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() || !IsMinKNOWRunID(entry.Name()) {
+				continue
+			}
+
+			other, err := entry.Info()
+			if os.IsNotExist(err) {
+				continue // Removed since being listed
+			}
+			if err != nil {
+				return false, err
+			}
+			if other.ModTime().After(info.ModTime()) {
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// RemoteState describes the state of a data object in relation to the local
+// file it archives.
+type RemoteState int
+
+const (
+	RemoteAbsent           RemoteState = iota // The data object does not exist
+	RemoteUnverifiable                        // The file has no valid checksum file
+	RemoteMetadataMismatch                    // The md5 metadata does not match
+	RemotePartial                             // The data object is a truncated copy
+	RemoteMismatch                            // The data object checksum does not match
+	RemoteComplete                            // The data object is a confirmed copy
+)
+
+func (s RemoteState) String() string {
+	switch s {
+	case RemoteAbsent:
+		return "absent"
+	case RemoteUnverifiable:
+		return "unverifiable"
+	case RemoteMetadataMismatch:
+		return "metadata mismatch"
+	case RemotePartial:
+		return "partial"
+	case RemoteMismatch:
+		return "checksum mismatch"
+	case RemoteComplete:
+		return "complete"
+	default:
+		return fmt.Sprintf("RemoteState(%d)", int(s))
+	}
+}
+
+// RemoteStateFunc returns the state of the archived copy of the file at path.
+type RemoteStateFunc func(path FilePath) (RemoteState, error)
+
+// MakeRemoteState returns a RemoteStateFunc that will return the state of the
+// copy of its argument made from localBase to remoteBase. This allows a file
+// that has not yet been archived (RemoteAbsent) to be distinguished from one
+// whose archived copy is incorrect (RemoteMetadataMismatch, RemotePartial or
+// RemoteMismatch).
+//
+// The criteria for each state are those described for MakeIsCopied and are
+// tested in the same order. A data object whose checksum does not match, but
+// whose checksum metadata do, and which is smaller than the local file is
+// taken to be the result of an interrupted transfer (RemotePartial). The
+// checksum file of the argument is named as described by cf.
+func MakeRemoteState(localBase string, remoteBase string,
+	cPool *ex.ClientPool, alg ChecksumAlgorithm,
+	cf ChecksumFiles) RemoteStateFunc {
+
+	return func(path FilePath) (state RemoteState, err error) { // NRV
+		defer func() {
+			if err != nil {
+				err = errors.Wrap(err, "RemoteState")
+			}
+		}()
+
+		var dest string
+		dest, err = translatePath(localBase, remoteBase, path)
+		if err != nil {
+			return RemoteAbsent, err
+		}
+
+		client, err := getClient(cPool)
+		if err != nil {
+			return RemoteAbsent, err
+		}
+
+		defer func() {
+			err = returnClient(cPool, client, err)
+		}()
+
+		log := logs.GetLogger()
+		obj := ex.NewDataObject(client, dest)
+
+		var exists bool
+		exists, err = obj.Exists()
+		if err != nil || !exists {
+			log.Debug().Str("path", path.Location).
+				Str("to", obj.RodsPath()).
+				Msg("copy NOT confirmed")
+			return RemoteAbsent, err
+		}
+
+		state, err = ObjChecksumState(path, obj, alg, cf)
+		if err != nil {
+			return state, err
+		}
+
+		switch state {
+		case RemoteMismatch:
+			var item ex.RodsItem
+			item, err = client.ListItem(ex.Args{Size: true}, *obj.RodsItem)
+			if err != nil {
+				return state, err
+			}
+			if path.Info != nil &&
+				isPartialObject(path.Info.Size(), item.ISize) {
+				state = RemotePartial
+			}
+		case RemoteComplete:
+			log.Debug().Str("path", path.Location).
+				Str("to", obj.RodsPath()).
+				Str("checksum", obj.Checksum()).
+				Msg("copy confirmed")
+		}
+
+		return state, err
+	}
 }
 
 // MakeIsCopied returns a predicate that will return true if its argument has
@@ -349,58 +1017,208 @@ func MakeRequiresRemoval(duration time.Duration) FilePredicate {
 //
 // 2. The data object exists in the archive.
 //
-// 3. The checksum of the data object in the archive matches the expected
+// 3. The data object has metadata under the "md5" key whose value matches the
 //    checksum.
 //
-// 4. The data object has metadata under the "md5" key whose value matches the
-//    checksum.
+// 4. The checksum of the data object in the archive matches the expected
+//    checksum, calculated locally with the archive's checksum algorithm alg.
+//
+// A data object whose checksum does not match is logged as an error because
+// the archive may be corrupt. Use MakeRemoteState to distinguish the reasons
+// for a file not being copied.
 func MakeIsCopied(localBase string, remoteBase string,
-	cPool *ex.ClientPool) FilePredicate {
+	cPool *ex.ClientPool, alg ChecksumAlgorithm, cf ChecksumFiles) FilePredicate {
+	remoteState := MakeRemoteState(localBase, remoteBase, cPool, alg, cf)
+
+	return func(path FilePath) (bool, error) {
+		state, err := remoteState(path)
+		if err != nil {
+			return false, errors.Wrap(err, "IsCopied")
+		}
+
+		if state == RemoteMismatch {
+			logs.GetLogger().Error().Str("path", path.Location).
+				Str("state", state.String()).
+				Msg("archived data object does not match the local file")
+		}
+
+		return state == RemoteComplete, nil
+	}
+}
+
+// MakeIsChecksumMismatch returns a predicate that will return true if its
+// argument has a data object copied from localBase to remoteBase, whose
+// checksum metadata match the checksum file of the argument, but whose
+// checksum does not (RemoteMismatch). As the metadata show that the content
+// archived was that of the file, the data object may have been corrupted
+// since. A data object left partial by an interrupted transfer is not a
+// mismatch.
+//
+// The criteria are those described for MakeRemoteState.
+func MakeIsChecksumMismatch(localBase string, remoteBase string,
+	cPool *ex.ClientPool, alg ChecksumAlgorithm, cf ChecksumFiles) FilePredicate {
+	remoteState := MakeRemoteState(localBase, remoteBase, cPool, alg, cf)
+
+	return func(path FilePath) (bool, error) {
+		state, err := remoteState(path)
+		if err != nil {
+			return false, errors.Wrap(err, "IsChecksumMismatch")
+		}
+
+		return state == RemoteMismatch, nil
+	}
+}
+
+// MakeIsCopiedByMetadata returns a predicate that will return true if its
+// argument has been copied from localBase to remoteBase and its checksum file
+// has since been removed, and no errors occur while confirming this. In place
+// of the checksum file, the checksum metadata of the data object are trusted.
+// This is only meaningful for an archive using MD5 checksums.
+//
+// The criteria for copied state are:
+//
+// 1. The file has no checksum file, named as described by cf. Where it has
+//    one, use MakeIsCopied.
+//
+// 2. The data object exists in the archive.
+//
+// 3. The size of the data object matches the size of the file.
+//
+// 4. The data object has metadata under the "md5" key whose value matches the
+//    checksum of the data object.
+//
+// 5. The file has not been modified since it was archived i.e. its
+//    modification time is no later than that recorded in the metadata of the
+//    data object (see SourceModifiedTimeMetadata) or, where none is recorded,
+//    than the modification time of the data object.
+//
+// As the file is not read, a change to its content that preserves both its
+// size and its modification time will not be detected. Such a confirmation is
+// not sufficient for the file to be removed.
+func MakeIsCopiedByMetadata(localBase string, remoteBase string,
+	cPool *ex.ClientPool, cf ChecksumFiles) FilePredicate {
 
 	return func(path FilePath) (ok bool, err error) { // NRV
 		defer func() {
 			if err != nil {
-				err = errors.Wrap(err, "IsCopied")
+				err = errors.Wrap(err, "IsCopiedByMetadata")
 			}
 		}()
 
+		var hasChecksum bool
+		if hasChecksum, err = cf.HasChecksumFile(path); err != nil ||
+			hasChecksum {
+			return false, err
+		}
+
 		var dest string
 		dest, err = translatePath(localBase, remoteBase, path)
 		if err != nil {
 			return false, err
 		}
 
-		client, err := cPool.Get()
+		client, err := getClient(cPool)
 		if err != nil {
 			return false, err
 		}
 
 		defer func() {
-			err = utilities.CombineErrors(err, cPool.Return(client))
+			err = returnClient(cPool, client, err)
 		}()
 
-		log := logs.GetLogger()
 		obj := ex.NewDataObject(client, dest)
-		ok, err = obj.Exists()
-		if err != nil || !ok {
+
+		var exists bool
+		if exists, err = obj.Exists(); err != nil || !exists {
+			return false, err
+		}
+
+		item, err := client.ListItem(ex.Args{AVU: true, Checksum: true,
+			Size: true, Timestamp: true}, *obj.RodsItem)
+		if err != nil {
+			return false, err
+		}
+
+		ok = isCopyByMetadata(path.Info.Size(), path.Info.ModTime(),
+			item.ISize, item.IChecksum, item.ITimestamps, item.IAVUs)
+
+		log := logs.GetLogger()
+		if ok {
 			log.Debug().Str("path", path.Location).
 				Str("to", obj.RodsPath()).
-				Msg("copy NOT confirmed")
-			return false, err
+				Str("checksum", item.IChecksum).
+				Msg("copy confirmed by metadata")
+		} else {
+			log.Debug().Str("path", path.Location).
+				Str("to", obj.RodsPath()).
+				Msg("copy NOT confirmed by metadata")
 		}
 
-		ok, err = validateObjChecksum(path, obj)
-		if !ok || err != nil {
-			return ok, err
+		return ok, err
+	}
+}
+
+// isCopyByMetadata returns true if a data object of size remoteSize, with
+// checksum remoteChecksum, timestamps and metadata avus, is taken to be a copy
+// of a local file of size localSize, last modified at localModTime, without
+// reference to a local checksum file.
+func isCopyByMetadata(localSize int64, localModTime time.Time,
+	remoteSize uint64, remoteChecksum string, timestamps []ex.Timestamp,
+	avus []ex.AVU) bool {
+	if localSize < 0 || remoteSize != uint64(localSize) ||
+		remoteChecksum == "" {
+		return false
+	}
+
+	var hasChecksum bool
+	for _, avu := range avus {
+		if avu.Attr == ex.ChecksumAttr && avu.Value == remoteChecksum {
+			hasChecksum = true
+			break
 		}
+	}
+	if !hasChecksum {
+		return false
+	}
 
-		log.Debug().Str("path", path.Location).
-			Str("to", obj.RodsPath()).
-			Str("checksum", obj.Checksum()).
-			Msg("copy confirmed")
+	copied, ok := archivedModTime(timestamps, avus)
+	if !ok {
+		return false
+	}
 
-		return true, err
+	// Recorded times have a resolution of one second
+	return !localModTime.Truncate(time.Second).After(copied)
+}
+
+// archivedModTime returns the modification time of the file from which a data
+// object was archived, as recorded in its metadata avus (see
+// SourceModifiedTimeMetadata), and true. Where none is recorded, it returns
+// the earliest modification time of the data object's replicates in
+// timestamps, and true. If neither is available, or the recorded time is
+// invalid, it returns false.
+func archivedModTime(timestamps []ex.Timestamp,
+	avus []ex.AVU) (time.Time, bool) {
+	attr := ex.AVU{Attr: SourceModifiedTimeAttr}.
+		WithNamespace(ValetNamespace).Attr
+
+	for _, avu := range avus {
+		if avu.Attr == attr {
+			t, err := time.Parse(time.RFC3339, avu.Value)
+			return t, err == nil
+		}
 	}
+
+	var earliest time.Time
+	for _, ts := range timestamps {
+		if ts.Modified.IsZero() {
+			continue
+		}
+		if earliest.IsZero() || ts.Modified.Before(earliest) {
+			earliest = ts.Modified
+		}
+	}
+
+	return earliest, !earliest.IsZero()
 }
 
 // MakeIsAnnotated returns a predicate that will return true if its argument has
@@ -417,8 +1235,11 @@ func MakeIsCopied(localBase string, remoteBase string,
 // Note that is not testing for the presence of a specific data object e.g. the
 // report file that contained the metadata. That is achieved using the IsCopied
 // predicate.
+//
+// Reports are parsed, and their metadata made, as configured by rc.
 func MakeIsAnnotated(localBase string, remoteBase string,
-	cPool *ex.ClientPool) FilePredicate {
+	cPool *ex.ClientPool, rc ReportConfig) FilePredicate {
+	rc = rc.orDefault()
 
 	return func(path FilePath) (ok bool, err error) { // NRV
 		defer func() {
@@ -434,13 +1255,13 @@ func MakeIsAnnotated(localBase string, remoteBase string,
 		}
 
 		var client *ex.Client
-		client, err = cPool.Get()
+		client, err = getClient(cPool)
 		if err != nil {
 			return false, err
 		}
 
 		defer func() {
-			err = utilities.CombineErrors(err, cPool.Return(client))
+			err = returnClient(cPool, client, err)
 		}()
 
 		var isReport bool
@@ -456,13 +1277,13 @@ func MakeIsAnnotated(localBase string, remoteBase string,
 			return false, err
 		}
 
-		report, err := ParseMinKNOWReport(path.Location)
+		report, err := ParseCompleteMinKNOWReport(path.Location, rc)
 		if err != nil {
 			return false, err
 		}
 
 		obj := ex.NewDataObject(client, dest)
-		ok, err = HasValidReportAnnotation(obj, report)
+		ok, err = HasValidReportAnnotation(obj, report, rc)
 		if !ok || err != nil {
 			return false, err
 		}
@@ -471,9 +1292,176 @@ func MakeIsAnnotated(localBase string, remoteBase string,
 	}
 }
 
+// MakeHasCollection returns a predicate that will return true if its argument,
+// a local directory under localBase, has a corresponding collection under
+// remoteBase, and no errors occur while confirming this.
+func MakeHasCollection(localBase string, remoteBase string,
+	cPool *ex.ClientPool) FilePredicate {
+
+	return func(path FilePath) (ok bool, err error) { // NRV
+		defer func() {
+			if err != nil {
+				err = errors.Wrap(err, "HasCollection")
+			}
+		}()
+
+		var dest string
+		if dest, err = translatePath(localBase, remoteBase, path); err != nil {
+			return false, err
+		}
+
+		var client *ex.Client
+		if client, err = getClient(cPool); err != nil {
+			return false, err
+		}
+
+		defer func() {
+			err = returnClient(cPool, client, err)
+		}()
+
+		return ex.NewCollection(client, dest).Exists()
+	}
+}
+
+// MakeHasParentCollection returns a predicate that will return true if the
+// parent directory of its argument, a local file under localBase, has a
+// corresponding collection under remoteBase, and no errors occur while
+// confirming this e.g. where some of a run has already been archived.
+func MakeHasParentCollection(localBase string, remoteBase string,
+	cPool *ex.ClientPool) FilePredicate {
+	hasCollection := MakeHasCollection(localBase, remoteBase, cPool)
+
+	return func(path FilePath) (bool, error) {
+		parent, err := NewFilePathNoStat(filepath.Dir(path.Location))
+		if err != nil {
+			return false, errors.Wrap(err, "HasParentCollection")
+		}
+
+		return hasCollection(parent)
+	}
+}
+
+// MakeHasReplicaOn returns a predicate that will return true if the archived
+// copy of its argument, a local file under localBase, has a valid replica on
+// one of resources, and no errors occur while confirming this. This is used
+// to wait for an archive's own replication to a resource before deleting
+// local files. Each resource is compared with the resource of each replica
+// and, where iRODS reports a resource hierarchy, with each resource in it.
+func MakeHasReplicaOn(localBase string, remoteBase string,
+	cPool *ex.ClientPool, resources []string) FilePredicate {
+
+	return func(path FilePath) (ok bool, err error) { // NRV
+		defer func() {
+			if err != nil {
+				err = errors.Wrap(err, "HasReplicaOn")
+			}
+		}()
+
+		var dest string
+		if dest, err = translatePath(localBase, remoteBase, path); err != nil {
+			return false, err
+		}
+
+		var client *ex.Client
+		if client, err = getClient(cPool); err != nil {
+			return false, err
+		}
+
+		defer func() {
+			err = returnClient(cPool, client, err)
+		}()
+
+		var reps []ex.Replicate
+		if reps, err = ex.NewDataObject(client, dest).FetchReplicates(); err != nil {
+			return false, err
+		}
+
+		if ok = hasValidReplicaOn(reps, resources); !ok {
+			logs.GetLogger().Debug().Str("path", path.Location).
+				Str("to", dest).
+				Str("resources", strings.Join(resources, ",")).
+				Msg("awaiting a valid replica")
+		}
+
+		return ok, nil
+	}
+}
+
+// hasValidReplicaOn returns true if any of reps is valid and on one of
+// resources.
+func hasValidReplicaOn(reps []ex.Replicate, resources []string) bool {
+	for _, rep := range reps {
+		if !rep.Valid {
+			continue
+		}
+		for _, resc := range strings.Split(rep.Resource, ";") {
+			for _, want := range resources {
+				if resc == want {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// MakeRequiresRunDirAnnotation returns a predicate that will return true if its
+// argument, a MinKNOW run directory under localBase, has a corresponding
+// collection under remoteBase without any report metadata, and no errors occur
+// while confirming this. Such a run is annotated with metadata derived from its
+// directory (see RunDirMetadata) e.g. where its report failed to be archived,
+// or is missing. Report metadata are those in the report namespace of rc.
+func MakeRequiresRunDirAnnotation(localBase string, remoteBase string,
+	cPool *ex.ClientPool, rc ReportConfig) FilePredicate {
+	rc = rc.orDefault()
+
+	return func(path FilePath) (ok bool, err error) { // NRV
+		defer func() {
+			if err != nil {
+				err = errors.Wrap(err, "RequiresRunDirAnnotation")
+			}
+		}()
+
+		var dest string
+		if dest, err = translatePath(localBase, remoteBase, path); err != nil {
+			return false, err
+		}
+
+		var client *ex.Client
+		if client, err = getClient(cPool); err != nil {
+			return false, err
+		}
+
+		defer func() {
+			err = returnClient(cPool, client, err)
+		}()
+
+		// Until some of the run has been archived, there is nothing to
+		// annotate
+		coll := ex.NewCollection(client, dest)
+		var exists bool
+		if exists, err = coll.Exists(); err != nil || !exists {
+			return false, err
+		}
+
+		var current []ex.AVU
+		if current, err = coll.FetchMetadata(); err != nil {
+			return false, err
+		}
+
+		return !hasReportMetadata(current, rc), nil
+	}
+}
+
 // HasValidReportAnnotation returns true if the metadata in report, which has
-// been archived as obj, is up-to-date in the remote archive.
-func HasValidReportAnnotation(obj *ex.DataObject, report MinKNOWReport) (bool, error) {
+// been archived as obj, is up-to-date in the remote archive. The metadata are
+// not up-to-date if any are missing, or if there are any stale report AVUs
+// e.g. an earlier value of an attribute, alongside the current value. The
+// metadata are made as configured by rc.
+func HasValidReportAnnotation(obj *ex.DataObject, report MinKNOWReport,
+	rc ReportConfig) (bool, error) {
+	rc = rc.orDefault()
 	log := logs.GetLogger()
 
 	// The metadata to check is on the collection containing the file in
@@ -484,20 +1472,24 @@ func HasValidReportAnnotation(obj *ex.DataObject, report MinKNOWReport) (bool, e
 		return false, err
 	}
 
-	metadata, err := report.AsEnhancedMetadata()
+	metadata, err := report.AsEnhancedMetadata(rc)
 	if err != nil {
 		log.Error().Err(err).
 			Str("path", coll.RodsPath()).
 			Msg("report metadata invalid")
 	}
 
-	if !coll.HasAllMetadata(metadata) {
-		for _, avu := range metadata {
-			if !coll.HasMetadatum(avu) {
-				log.Debug().Str("path", coll.RodsPath()).
-					Str("attr", avu.Attr).
-					Str("value", avu.Value).Msg("missing this AVU")
-			}
+	stale, missing := reportAnnotationDiff(coll.Metadata(), metadata, rc)
+	if len(stale) > 0 || len(missing) > 0 {
+		for _, avu := range missing {
+			log.Debug().Str("path", coll.RodsPath()).
+				Str("attr", avu.Attr).
+				Str("value", avu.Value).Msg("missing this AVU")
+		}
+		for _, avu := range stale {
+			log.Debug().Str("path", coll.RodsPath()).
+				Str("attr", avu.Attr).
+				Str("value", avu.Value).Msg("stale AVU")
 		}
 
 		log.Debug().Str("path", report.Path).
@@ -529,48 +1521,71 @@ func makeCompFilePredicate(regex *regexp.Regexp) func(path FilePath) (bool, erro
 	}
 }
 
-// validateObjChecksum checks that the data file at path has a corresponding
+// ValidateObjChecksum checks that the data file at path has a corresponding
 // checksum file, that the checksum in that file is the same as that recorded
 // for the corresponding data object in iRODS, and that the data object has the
 // same checksum present in its metadata.
-func validateObjChecksum(path FilePath, obj *ex.DataObject) (bool, error) {
+//
+// The data object's checksum is expected to have been made with algorithm alg.
+// If alg is not MD5, the matching local checksum is calculated from the file,
+// but only once the cheaper checksum metadata comparison has succeeded. The
+// checksum file is named as described by cf.
+func ValidateObjChecksum(path FilePath, obj *ex.DataObject,
+	alg ChecksumAlgorithm, cf ChecksumFiles) (bool, error) {
+	state, err := ObjChecksumState(path, obj, alg, cf)
+
+	return state == RemoteComplete, err
+}
+
+// ObjChecksumState returns the state of the existing data object obj as a
+// copy of the data file at path, making the same checks as
+// ValidateObjChecksum. It returns RemoteComplete if all the checks pass. It
+// does not distinguish RemotePartial from RemoteMismatch (see
+// MakeRemoteState).
+func ObjChecksumState(path FilePath, obj *ex.DataObject,
+	alg ChecksumAlgorithm, cf ChecksumFiles) (RemoteState, error) {
 	log := logs.GetLogger()
 
-	chkFile, err := NewFilePath(path.ChecksumFilename())
+	chkFile, err := NewFilePathNoStat(cf.ChecksumFilename(path))
 	if err != nil {
-		return false, err
+		return RemoteUnverifiable, err
 	}
 
-	ok, err := HasValidChecksumFile(path)
+	ok, err := Not(cf.HasStaleChecksumFile)(path)
 	if err != nil || !ok {
 		log.Debug().Str("path", path.Location).
 			Msg("valid checksum file NOT present")
-		return false, err
+		return RemoteUnverifiable, err
 	}
 
 	checksum, err := ReadMD5ChecksumFile(chkFile)
 	if err != nil {
 		log.Debug().Str("path", path.Location).
 			Msg("checksum file NOT readable")
-		return false, err
+		return RemoteUnverifiable, err
 	}
 
 	chk := string(checksum)
-	ok, err = obj.HasValidChecksum(chk)
+	ok, err = obj.HasValidChecksumMetadata(chk)
 	if err != nil || !ok {
 		log.Debug().Str("path", path.Location).
-			Str("expected_checksum", chk).
-			Str("checksum", obj.Checksum()).
-			Msg("checksum NOT confirmed")
-		return false, err
+			Msg("checksum metadata NOT confirmed")
+		return RemoteMetadataMismatch, err
 	}
 
-	ok, err = obj.HasValidChecksumMetadata(chk)
+	expected, err := alg.RemoteChecksum(path.Location, chk)
+	if err != nil {
+		return RemoteUnverifiable, err
+	}
+
+	ok, err = obj.HasValidChecksum(expected)
 	if err != nil || !ok {
 		log.Debug().Str("path", path.Location).
-			Msg("checksum metadata NOT confirmed")
-		return false, err
+			Str("expected_checksum", expected).
+			Str("checksum", obj.Checksum()).
+			Msg("checksum NOT confirmed")
+		return RemoteMismatch, err
 	}
 
-	return true, nil
+	return RemoteComplete, nil
 }
@@ -21,13 +21,18 @@
 package valet
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	ex "github.com/wtsi-npg/extendo/v2"
 
 	"github.com/wtsi-npg/valet/utilities"
 )
@@ -46,6 +51,32 @@ func TestIsDir(t *testing.T) {
 	}
 }
 
+func TestIsEmptyDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	emptyDir := filepath.Join(tmpDir, "fast5_fail")
+	if !assert.NoError(t, os.Mkdir(emptyDir, 0755)) {
+		return
+	}
+
+	d, _ := NewFilePath(emptyDir)
+	ok, err := IsEmptyDir(d)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected true for an empty directory")
+	}
+
+	d, _ = NewFilePath(tmpDir)
+	ok, err = IsEmptyDir(d)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected false for a non-empty directory")
+	}
+
+	f, _ := NewFilePath("./testdata/valet/1/reads/fastq/reads1.fastq")
+	ok, err = IsEmptyDir(f)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected false for a file")
+	}
+}
+
 func TestIsRegular(t *testing.T) {
 	f, _ := NewFilePath("./testdata/valet/1/reads/fastq/reads1.fastq")
 	ok, err := IsRegular(f)
@@ -60,6 +91,103 @@ func TestIsRegular(t *testing.T) {
 	}
 }
 
+func TestIsOwnedByCurrentUser(t *testing.T) {
+	own := filepath.Join(t.TempDir(), "reads1.fast5")
+	if !assert.NoError(t, os.WriteFile(own, []byte("reads1"), 0644)) {
+		return
+	}
+
+	fp, err := NewFilePath(own)
+	if assert.NoError(t, err) {
+		ok, err := IsOwnedByCurrentUser(fp)
+		if assert.NoError(t, err) {
+			assert.True(t, ok, "expected true for a file of the current user")
+		}
+	}
+
+	// The root directory is owned by root. When running as root, a file is
+	// given to another user instead.
+	other := "/"
+	if os.Geteuid() == 0 {
+		if !assert.NoError(t, os.Chown(own, 65534, 65534)) {
+			return
+		}
+		other = own
+	}
+
+	fp, err = NewFilePath(other)
+	if assert.NoError(t, err) {
+		ok, err := IsOwnedByCurrentUser(fp)
+		if assert.NoError(t, err) {
+			assert.False(t, ok, "expected false for a file of another user")
+		}
+	}
+}
+
+func TestIsSpecial(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	fifo := filepath.Join(tmpDir, "reads1.fast5")
+	if !assert.NoError(t, syscall.Mkfifo(fifo, 0644)) {
+		return
+	}
+
+	sock := filepath.Join(tmpDir, "reads2.fast5")
+	listener, err := net.Listen("unix", sock)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer listener.Close()
+
+	regular := filepath.Join(tmpDir, "reads3.fast5")
+	if !assert.NoError(t, os.WriteFile(regular, []byte("reads3"), 0644)) {
+		return
+	}
+
+	for _, c := range []struct {
+		path                 string
+		fifo, socket, device bool
+	}{
+		{fifo, true, false, false},
+		{sock, false, true, false},
+		{"/dev/null", false, false, true},
+		{regular, false, false, false},
+	} {
+		fp, ferr := NewFilePath(c.path)
+		if !assert.NoError(t, ferr) {
+			continue
+		}
+
+		for _, pc := range []struct {
+			pred     FilePredicate
+			expected bool
+		}{
+			{IsFIFO, c.fifo},
+			{IsSocket, c.socket},
+			{IsDevice, c.device},
+			{IsSpecial, c.fifo || c.socket || c.device},
+		} {
+			ok, perr := pc.pred(fp)
+			if assert.NoError(t, perr) {
+				assert.Equal(t, pc.expected, ok, "for %s", c.path)
+			}
+		}
+	}
+
+	// Special files are rejected even though their names match
+	match := And(Not(IsSpecial), RequiresCopying)
+	paths, errs := FindFiles(context.Background(), tmpDir, match, IsFalse)
+
+	var found []string
+	for p := range paths {
+		found = append(found, p.Location)
+	}
+	for ferr := range errs {
+		assert.NoError(t, ferr)
+	}
+	assert.Equal(t, []string{regular}, found)
+}
+
 func TestIsFast5Match(t *testing.T) {
 	f5, _ := NewFilePath("./testdata/valet/1/reads/fast5/reads1.fast5")
 	ok, err := IsFast5(f5)
@@ -88,6 +216,34 @@ func TestIsPOD5Match(t *testing.T) {
 	}
 }
 
+func TestIsBLOW5Match(t *testing.T) {
+	b5, _ := NewFilePath("./testdata/valet/1/reads/slow5/reads1.blow5")
+	ok, err := IsBLOW5(b5)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected true for a blow5 file")
+	}
+
+	f5, _ := NewFilePath("./testdata/valet/1/reads/fast5/reads1.fast5")
+	ok, err = IsBLOW5(f5)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected false for a non-blow5 file")
+	}
+}
+
+func TestIsSLOW5Match(t *testing.T) {
+	s5, _ := NewFilePath("./testdata/valet/1/reads/slow5/reads1.slow5")
+	ok, err := IsSLOW5(s5)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected true for a slow5 file")
+	}
+
+	b5, _ := NewFilePath("./testdata/valet/1/reads/slow5/reads1.blow5")
+	ok, err = IsSLOW5(b5)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected false for a non-slow5 file")
+	}
+}
+
 func TestIsFastqMatch(t *testing.T) {
 	fq, _ := NewFilePath("./testdata/valet/1/reads/fastq/reads1.fastq")
 	ok, err := IsFastq(fq)
@@ -172,6 +328,144 @@ func TestIsGzipCSVMatch(t *testing.T) {
 	}
 }
 
+func TestIsIncludedSuffix(t *testing.T) {
+	vcf := FilePath{FileResource: FileResource{
+		Location: "./testdata/valet/1/calls/calls1.vcf"}}
+	f5, _ := NewFilePath("./testdata/valet/1/reads/fast5/reads1.fast5")
+
+	ok, err := builtIn.IsIncludedSuffix(vcf)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected false with no included suffixes")
+	}
+	ok, err = RequiresCopying(vcf)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected false for an unrecognised type")
+	}
+
+	sel, err := MakeSelection(SelectParams{
+		IncludedSuffixes: []string{".VCF", "tbi"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ok, err = sel.IsIncludedSuffix(vcf)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected true for an included suffix")
+	}
+	ok, err = sel.RequiresCopying(vcf)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected true for an included suffix")
+	}
+
+	// Built-in types are unaffected
+	ok, err = sel.RequiresCopying(f5)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected true for a fast5 file")
+	}
+
+	// Checksum files of an included type are not copied
+	md5 := FilePath{FileResource: FileResource{
+		Location: vcf.Location + "." + MD5Suffix}}
+	ok, err = sel.RequiresCopying(md5)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected false for a checksum file")
+	}
+
+	_, err = MakeSelection(SelectParams{IncludedSuffixes: []string{""}})
+	assert.Error(t, err)
+	_, err = MakeSelection(SelectParams{IncludedSuffixes: []string{"a/b"}})
+	assert.Error(t, err)
+}
+
+func TestSelectionOrBuiltIn(t *testing.T) {
+	var empty Selection
+	sel := empty.OrBuiltIn()
+	assert.NotNil(t, sel.RequiresCopying)
+	assert.NotNil(t, sel.RequiresChecksum)
+
+	f5, err := NewFilePath("./testdata/valet/1/reads/fast5/reads1.fast5")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The methods of the zero value use the built-in Selection
+	ok, err := empty.IsIncludedSuffix(f5)
+	if assert.NoError(t, err) {
+		assert.False(t, ok)
+	}
+	_, err = empty.IsAwaitingChecksum(f5)
+	assert.NoError(t, err)
+	_, err = empty.MakeRequiresRemoteChecksum(SHA256Checksum)(f5)
+	assert.NoError(t, err)
+}
+
+func TestMakeSuffixMatchFunc(t *testing.T) {
+	path := func(location string) FilePath {
+		return FilePath{FileResource: FileResource{Location: location}}
+	}
+
+	match, err := MakeSuffixMatchFunc(".VCF", "tbi", "g.vcf")
+	if !assert.NoError(t, err) {
+		return
+	}
+	compMatch, err := MakeCompSuffixMatchFunc(".VCF", "tbi", "g.vcf")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, tc := range []struct {
+		location string
+		match    bool
+		comp     bool
+	}{
+		{"/data/calls1.vcf", true, true},
+		{"/data/calls1.VCF", true, true},
+		{"/data/calls1.Vcf.tbi", true, true},
+		{"/data/calls1.g.vcf", true, true},
+		{"/data/calls1.vcf.gz", false, true},
+		{"/data/calls1.VCF.gz", false, true},
+		{"/data/calls1.tbi.gz", false, true},
+		{"/data/calls1.gz", false, false},
+		{"/data/calls1vcf", false, false},
+		{"/data/calls1.vcf.md5", false, false},
+		{"/data/calls1.bcf", false, false},
+	} {
+		ok, err := match(path(tc.location))
+		if assert.NoError(t, err) {
+			assert.Equal(t, tc.match, ok, "uncompressed match of %s",
+				tc.location)
+		}
+
+		ok, err = compMatch(path(tc.location))
+		if assert.NoError(t, err) {
+			assert.Equal(t, tc.comp, ok, "compressed match of %s",
+				tc.location)
+		}
+	}
+
+	// A compressed suffix may itself be given
+	gzMatch, err := MakeSuffixMatchFunc("vcf.gz")
+	if assert.NoError(t, err) {
+		ok, err := gzMatch(path("/data/calls1.VCF.GZ"))
+		if assert.NoError(t, err) {
+			assert.True(t, ok)
+		}
+	}
+
+	none, err := MakeSuffixMatchFunc()
+	if assert.NoError(t, err) {
+		ok, err := none(path("/data/calls1.vcf"))
+		if assert.NoError(t, err) {
+			assert.False(t, ok, "expected false with no suffixes")
+		}
+	}
+
+	_, err = MakeSuffixMatchFunc("vcf", "")
+	assert.Error(t, err)
+	_, err = MakeCompSuffixMatchFunc("a/b")
+	assert.Error(t, err)
+}
+
 func TestIsCompressed(t *testing.T) {
 	fq1, _ := NewFilePath("./testdata/valet/1/reads/fastq/reads1.fastq")
 	ok1, err1 := IsCompressed(fq1)
@@ -223,27 +517,96 @@ func TestRequiresCompression(t *testing.T) {
 	}
 }
 
+func TestMinCompressSize(t *testing.T) {
+	const minSize = 4096
+
+	tmpDir := t.TempDir()
+	files := make(map[int64]FilePath)
+	for _, size := range []int64{0, minSize - 1, minSize, minSize + 1} {
+		file := filepath.Join(tmpDir, fmt.Sprintf("%d.txt", size))
+		if !assert.NoError(t, os.WriteFile(file, make([]byte, size), 0644)) {
+			return
+		}
+		fp, err := NewFilePath(file)
+		if !assert.NoError(t, err) {
+			return
+		}
+		files[size] = fp
+	}
+
+	// By default, files of any size are compressed
+	for size, fp := range files {
+		ok, err := RequiresCompression(fp)
+		if assert.NoError(t, err) {
+			assert.True(t, ok, "expected compression of %d bytes", size)
+		}
+		ok, err = RequiresCopying(fp)
+		if assert.NoError(t, err) {
+			assert.False(t, ok, "expected no copying of %d bytes", size)
+		}
+	}
+
+	sel, err := MakeSelection(SelectParams{MinCompressSize: minSize})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Files below the minimum size are copied uncompressed
+	for size, below := range map[int64]bool{
+		0:           true,
+		minSize - 1: true,
+		minSize:     false,
+		minSize + 1: false,
+	} {
+		ok, err := sel.RequiresCompression(files[size])
+		if assert.NoError(t, err) {
+			assert.Equal(t, !below, ok, "compression of %d bytes", size)
+		}
+		ok, err = sel.RequiresCopying(files[size])
+		if assert.NoError(t, err) {
+			assert.Equal(t, below, ok, "copying of %d bytes", size)
+		}
+	}
+
+	// A small file that has already been compressed is not copied uncompressed
+	fq2, _ := NewFilePath("./testdata/valet/1/reads/fastq/reads2.fastq")
+	ok, err := sel.RequiresCopying(fq2)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected false for a file with a gzipped version")
+	}
+
+	// Other types are unaffected
+	f5, _ := NewFilePath("./testdata/valet/1/reads/fast5/reads1.fast5")
+	ok, err = sel.RequiresCopying(f5)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected true for a fast5 file")
+	}
+
+	_, err = MakeSelection(SelectParams{MinCompressSize: -1})
+	assert.Error(t, err)
+}
+
 func TestHasChecksumFile(t *testing.T) {
 	f5With, _ := NewFilePath("./testdata/valet/1/reads/fast5/reads1.fast5")
-	ok, err := HasChecksumFile(f5With)
+	ok, err := defaultChecksums.HasChecksumFile(f5With)
 	if assert.NoError(t, err) {
 		assert.True(t, ok, "expected true for a fast5 file with checksum")
 	}
 
 	f5Without, _ := NewFilePath("./testdata/valet/1/reads/fast5/reads2.fast5")
-	ok, err = HasChecksumFile(f5Without)
+	ok, err = defaultChecksums.HasChecksumFile(f5Without)
 	if assert.NoError(t, err) {
 		assert.False(t, ok, "expected false for a fast5 file without checksum")
 	}
 
 	fqWith, _ := NewFilePath("./testdata/valet/1/reads/fastq/reads1.fastq")
-	ok, err = HasChecksumFile(fqWith)
+	ok, err = defaultChecksums.HasChecksumFile(fqWith)
 	if assert.NoError(t, err) {
 		assert.True(t, ok, "expected true for a fastq file with checksum")
 	}
 
 	fqWithout, _ := NewFilePath("./testdata/valet/1/reads/fastq/reads2.fastq")
-	ok, err = HasChecksumFile(fqWithout)
+	ok, err = defaultChecksums.HasChecksumFile(fqWithout)
 	if assert.NoError(t, err) {
 		assert.False(t, ok, "expected false for a fastq file without checksum")
 	}
@@ -271,17 +634,38 @@ func TestHasStaleChecksumFile(t *testing.T) {
 	assert.NoError(t, err)
 
 	f5With, _ := NewFilePath(dataFile)
-	ok, err := HasChecksumFile(f5With)
+	ok, err := defaultChecksums.HasChecksumFile(f5With)
 	if assert.NoError(t, err) {
 		assert.True(t, ok, "expected true for a fast5 file with checksum")
 	}
 
-	ok, err = HasStaleChecksumFile(f5With)
+	ok, err = defaultChecksums.HasStaleChecksumFile(f5With)
 	if assert.NoError(t, err) {
 		assert.True(t, ok, "expected true for a fast5 file with stale checksum")
 	}
 }
 
+func TestIsAwaitingChecksum(t *testing.T) {
+	f5With, _ := NewFilePath("./testdata/valet/1/reads/fast5/reads1.fast5")
+	ok, err := builtIn.IsAwaitingChecksum(f5With)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected false for a fast5 file with checksum")
+	}
+
+	f5Without, _ := NewFilePath("./testdata/valet/1/reads/fast5/reads2.fast5")
+	ok, err = builtIn.IsAwaitingChecksum(f5Without)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected true for a fast5 file without checksum")
+	}
+
+	// Not archived, so never requires a checksum
+	fqWithout, _ := NewFilePath("./testdata/valet/1/reads/fastq/reads2.fastq")
+	ok, err = builtIn.IsAwaitingChecksum(fqWithout)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected false for an uncompressed fastq file")
+	}
+}
+
 func TestIsMinKNOWRunDir(t *testing.T) {
 	gridionRunDir :=
 		"testdata/platform/ont/minknow/gridion/66/DN585561I_A1/" +
@@ -304,6 +688,86 @@ func TestIsMinKNOWRunDir(t *testing.T) {
 	}
 }
 
+func TestMakeIsInActiveRun(t *testing.T) {
+	exptDir := filepath.Join(t.TempDir(), "66")
+	oldRun := filepath.Join(exptDir, "DN585561I_A1",
+		"20190904_1514_GA20000_FAL01979_43578c8f")
+	newRun := filepath.Join(exptDir, "DN585561I_B1",
+		"20190905_1514_GA20000_FAL01980_43578c90")
+	for _, dir := range []string{oldRun, newRun} {
+		if !assert.NoError(t, os.MkdirAll(filepath.Join(dir, "fast5_pass"),
+			0700)) {
+			return
+		}
+	}
+
+	then := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(oldRun, then, then))
+
+	f5 := filepath.Join(newRun, "fast5_pass", "reads1.fast5")
+	if !assert.NoError(t, os.WriteFile(f5, []byte("111\n"), 0600)) {
+		return
+	}
+
+	isActive := MakeIsInActiveRun(time.Hour)
+	for _, c := range []struct {
+		path     string
+		expected bool
+	}{
+		{newRun, true},
+		{f5, true},
+		{oldRun, false},
+		{filepath.Join(oldRun, "fast5_pass"), false},
+		{exptDir, false},
+	} {
+		fp, _ := NewFilePath(c.path)
+		ok, err := isActive(fp)
+		if assert.NoError(t, err) {
+			assert.Equal(t, c.expected, ok, "for %s", c.path)
+		}
+	}
+
+	// Not modified within the window
+	assert.NoError(t, os.Chtimes(newRun, then, then))
+	fp, _ := NewFilePath(newRun)
+	ok, err := MakeIsInActiveRun(time.Hour)(fp)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected false outside the window")
+	}
+	ok, err = MakeIsInActiveRun(3 * time.Hour)(fp)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected true within a wider window")
+	}
+}
+
+func TestIsUnderMinKNOWRunDir(t *testing.T) {
+	gridionRunDir :=
+		"testdata/platform/ont/minknow/gridion/66/DN585561I_A1/" +
+			"20190904_1514_GA20000_FAL01979_43578c8f"
+
+	for path, expected := range map[string]bool{
+		filepath.Join(gridionRunDir, "duty_time.csv"): true,
+		filepath.Join(gridionRunDir, "fast5_pass"):    true,
+		gridionRunDir: false,
+		"testdata/platform/ont/minknow/gridion/66":  false,
+		"testdata/valet/1/reads/fastq/reads1.fastq": false,
+	} {
+		fp, nerr := NewFilePath(path)
+		if assert.NoError(t, nerr) {
+			ok, err := IsUnderMinKNOWRunDir(fp)
+			if assert.NoError(t, err) {
+				assert.Equal(t, expected, ok, "for %s", path)
+			}
+		}
+	}
+
+	fp, _ := NewFilePath(filepath.Join(gridionRunDir, "duty_time.csv"))
+	ok, err := And(IsRegular, IsUnderMinKNOWRunDir)(fp)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected true when composed")
+	}
+}
+
 func TestRequiresRemoval(t *testing.T) {
 	pred := MakeRequiresRemoval(time.Millisecond * 100)
 
@@ -319,3 +783,259 @@ func TestRequiresRemoval(t *testing.T) {
 		}
 	}
 }
+
+func TestRequiresRemovalSetting(t *testing.T) {
+	delay := NewDurationSetting(time.Hour * 24 * 365 * 100)
+	pred := MakeRequiresRemovalSetting(delay)
+
+	gridionRunDir :=
+		"testdata/platform/ont/minknow/gridion/66/DN585561I_A1/" +
+			"20190904_1514_GA20000_FAL01979_43578c8f"
+
+	fp, nerr := NewFilePath(gridionRunDir)
+	if !assert.NoError(t, nerr) {
+		return
+	}
+
+	ok, err := pred(fp)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected GridION run directory to be retained")
+	}
+
+	delay.Set(time.Millisecond * 100)
+	assert.Equal(t, time.Millisecond*100, delay.Get())
+
+	ok, err = pred(fp)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected GridION run directory to be removable "+
+			"once the delay was changed")
+	}
+}
+
+func TestMakeIsInRuns(t *testing.T) {
+	gridionRunDir :=
+		"testdata/platform/ont/minknow/gridion/66/DN585561I_A1/" +
+			"20190904_1514_GA20000_FAL01979_43578c8f"
+	promethionDir :=
+		"testdata/platform/ont/minknow/promethion/DN467851H_Multiplex_Pool_1/" +
+			"DN467851H_B2_C2_E2_F2/20190820_1538_2-E7-H7_PAD71219_a4a384ec"
+
+	pred := MakeIsInRuns([]string{"20190904_1514_GA20000_FAL01979_43578c8f"})
+
+	for path, expected := range map[string]bool{
+		gridionRunDir: true,
+		filepath.Join(gridionRunDir, "duty_time.csv"): true,
+		filepath.Join(gridionRunDir, "fast5_pass"):    true,
+		promethionDir: false,
+		"testdata/platform/ont/minknow/gridion/66": false,
+	} {
+		fp, nerr := NewFilePath(path)
+		if assert.NoError(t, nerr) {
+			ok, err := pred(fp)
+			if assert.NoError(t, err) {
+				assert.Equal(t, expected, ok, "for %s", path)
+			}
+		}
+	}
+}
+
+func TestMakeIsSmallerThan(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	name := filepath.Join(tmpDir, "reads1.fastq")
+	if !assert.NoError(t, os.WriteFile(name, make([]byte, 100), 0600)) {
+		return
+	}
+
+	fq, _ := NewFilePath(name)
+	for _, c := range []struct {
+		maxBytes int64
+		expected bool
+	}{
+		{101, true},
+		{100, false},
+		{99, false},
+		{0, false},
+	} {
+		ok, err := MakeIsSmallerThan(c.maxBytes)(fq)
+		if assert.NoError(t, err) {
+			assert.Equal(t, c.expected, ok, "max size %d", c.maxBytes)
+		}
+	}
+
+	// Directories are not tested
+	dir, _ := NewFilePath(tmpDir)
+	ok, err := MakeIsSmallerThan(0)(dir)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected true for a directory")
+	}
+
+	ok, err = And(IsFastq, MakeIsSmallerThan(101))(fq)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected true when composed")
+	}
+}
+
+func TestMakeIsWrittenInRunWindow(t *testing.T) {
+	tmpDir := t.TempDir()
+	start := time.Date(2022, 6, 1, 10, 15, 30, 0, time.UTC)
+
+	var files []FilePath
+	for i, offset := range []time.Duration{
+		-time.Minute, 0, 30 * time.Minute, time.Hour, 2 * time.Hour} {
+		name := filepath.Join(tmpDir, fmt.Sprintf("reads%d.fastq", i))
+		mtime := start.Add(offset)
+		if !assert.NoError(t, os.WriteFile(name, []byte{}, 0600)) ||
+			!assert.NoError(t, os.Chtimes(name, mtime, mtime)) {
+			return
+		}
+		fq, _ := NewFilePath(name)
+		files = append(files, fq)
+	}
+
+	firstHour := MakeIsWrittenInRunWindow(start, 0, time.Hour)
+	secondHour := MakeIsWrittenInRunWindow(start, time.Hour, 2*time.Hour)
+	for i, expected := range []struct{ first, second bool }{
+		{false, false},
+		{true, false},
+		{true, false},
+		{false, true},
+		{false, false},
+	} {
+		ok, err := firstHour(files[i])
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected.first, ok, "first hour %d", i)
+		}
+		ok, err = secondHour(files[i])
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected.second, ok, "second hour %d", i)
+		}
+	}
+
+	// Directories are not matched
+	dir, _ := NewFilePath(tmpDir)
+	ok, err := MakeIsWrittenInRunWindow(time.Time{},
+		0, 1000000*time.Hour)(dir)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected false for a directory")
+	}
+}
+
+func TestMakeHasSentinel(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	with := filepath.Join(tmpDir, "reads1.fastq")
+	without := filepath.Join(tmpDir, "reads2.fastq")
+	for _, name := range []string{with, without, with + ".done"} {
+		if !assert.NoError(t, os.WriteFile(name, []byte{}, 0600)) {
+			return
+		}
+	}
+
+	hasSentinel := MakeHasSentinel(".done")
+
+	fq1, _ := NewFilePath(with)
+	ok, err := hasSentinel(fq1)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected true for a file with a sentinel")
+	}
+
+	fq2, _ := NewFilePath(without)
+	ok, err = hasSentinel(fq2)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected false for a file without a sentinel")
+	}
+
+	ok, err = And(IsFastq, hasSentinel)(fq1)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected true when composed")
+	}
+
+	ok, err = MakeHasSentinel(".other")(fq1)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected false for a different suffix")
+	}
+}
+
+func TestRemoteStateString(t *testing.T) {
+	for state, expected := range map[RemoteState]string{
+		RemoteAbsent:           "absent",
+		RemoteUnverifiable:     "unverifiable",
+		RemoteMetadataMismatch: "metadata mismatch",
+		RemotePartial:          "partial",
+		RemoteMismatch:         "checksum mismatch",
+		RemoteComplete:         "complete",
+		RemoteState(99):        "RemoteState(99)",
+	} {
+		assert.Equal(t, expected, state.String())
+	}
+}
+
+func TestIsCopyByMetadata(t *testing.T) {
+	checksum := "b1946ac92492d2347c6235b4d2611184"
+	other := "d41d8cd98f00b204e9800998ecf8427e"
+	avus := []ex.AVU{
+		{Attr: "ont:run_id", Value: checksum},
+		{Attr: ex.ChecksumAttr, Value: checksum},
+	}
+
+	archived := time.Date(2019, 9, 4, 15, 14, 0, 0, time.UTC)
+	timestamps := []ex.Timestamp{
+		{Modified: archived.Add(time.Hour), Replicates: 1},
+		{Modified: archived, Replicates: 0},
+	}
+	before := archived.Add(-time.Minute)
+	after := archived.Add(time.Minute)
+
+	assert.True(t, isCopyByMetadata(100, before, 100, checksum, timestamps,
+		avus))
+	assert.True(t, isCopyByMetadata(100, archived.Add(time.Millisecond), 100,
+		checksum, timestamps, avus),
+		"expected a time within the resolution of the archive to be accepted")
+	assert.False(t, isCopyByMetadata(100, before, 50, checksum, timestamps,
+		avus), "expected a size mismatch to be rejected")
+	assert.False(t, isCopyByMetadata(100, before, 100, other, timestamps,
+		avus), "expected a checksum metadata mismatch to be rejected")
+	assert.False(t, isCopyByMetadata(100, before, 100, "", timestamps, avus),
+		"expected an object without a checksum to be rejected")
+	assert.False(t, isCopyByMetadata(100, before, 100, checksum, timestamps,
+		avus[:1]),
+		"expected an object without checksum metadata to be rejected")
+	assert.False(t, isCopyByMetadata(100, after, 100, checksum, timestamps,
+		avus), "expected a file modified since archiving to be rejected")
+	assert.False(t, isCopyByMetadata(100, before, 100, checksum, nil, avus),
+		"expected an object without a modification time to be rejected")
+
+	// The recorded modification time of the source file takes precedence
+	recorded := ex.AVU{Attr: SourceModifiedTimeAttr,
+		Value: before.Add(-time.Minute).Format(time.RFC3339)}.
+		WithNamespace(ValetNamespace)
+	withSource := append(append([]ex.AVU{}, avus...), recorded)
+	assert.False(t, isCopyByMetadata(100, before, 100, checksum, timestamps,
+		withSource), "expected the recorded modification time to be used")
+	assert.True(t, isCopyByMetadata(100, before.Add(-time.Minute), 100,
+		checksum, nil, withSource))
+
+	invalid := append(append([]ex.AVU{}, avus...),
+		ex.AVU{Attr: recorded.Attr, Value: "yesterday"})
+	assert.False(t, isCopyByMetadata(100, before, 100, checksum, timestamps,
+		invalid), "expected an invalid recorded time to be rejected")
+}
+
+func TestHasValidReplicaOn(t *testing.T) {
+	reps := []ex.Replicate{
+		{Resource: "cache", Number: 0, Valid: true},
+		{Resource: "archive", Number: 1, Valid: false},
+		{Resource: "root;repl;disk2", Number: 2, Valid: true},
+	}
+
+	assert.True(t, hasValidReplicaOn(reps, []string{"cache"}))
+	assert.False(t, hasValidReplicaOn(reps, []string{"archive"}),
+		"expected an invalid replica to be rejected")
+	assert.True(t, hasValidReplicaOn(reps, []string{"archive", "disk2"}),
+		"expected any of the resources to be accepted")
+	assert.True(t, hasValidReplicaOn(reps, []string{"repl"}),
+		"expected a resource within a hierarchy to be accepted")
+	assert.False(t, hasValidReplicaOn(reps, []string{"disk"}))
+	assert.False(t, hasValidReplicaOn(nil, []string{"cache"}))
+}
@@ -0,0 +1,321 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file publish.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	logs "github.com/wtsi-npg/logshim"
+)
+
+// DefaultEventBufferSize is the default number of events an EventPublisher
+// holds while waiting to send them.
+const DefaultEventBufferSize = 1024
+
+// DefaultEventMaxAttempts is the default number of attempts an EventPublisher
+// makes to send each event.
+const DefaultEventMaxAttempts = 3
+
+// DefaultEventRetryDelay is the default delay before an EventPublisher's first
+// retry, which is doubled for each subsequent retry.
+const DefaultEventRetryDelay = time.Second
+
+// ArchiveEvent describes a file that has been archived.
+type ArchiveEvent struct {
+	Path        string            `json:"path"`                   // The local path of the file
+	RemotePath  string            `json:"remote_path"`            // The path of the data object
+	Size        int64             `json:"size"`                   // The size of the file
+	Checksum    string            `json:"checksum"`               // The MD5 checksum of the file
+	RunID       string            `json:"run_id,omitempty"`       // The MinKNOW run ID, if any
+	RunMetadata map[string]string `json:"run_metadata,omitempty"` // Metadata from the run directory, if any
+	Time        time.Time         `json:"time"`                   // The time the file was archived
+}
+
+// EventSender sends one event to a message queue.
+type EventSender func(ctx context.Context, event ArchiveEvent) error
+
+// EventPublisher publishes ArchiveEvents from a bounded buffer, using a
+// single goroutine, so that archiving never waits for the message queue. An
+// event that cannot be sent is retried a bounded number of times and then
+// dropped with a warning, as is an event published while the buffer is full.
+//
+// The methods of a nil *EventPublisher do nothing, so that publishing may be
+// disabled by using nil.
+type EventPublisher struct {
+	send        EventSender
+	events      chan ArchiveEvent
+	maxAttempts int
+	retryDelay  time.Duration
+	ctx         context.Context
+	cancel      context.CancelFunc
+	closeOnce   sync.Once
+	done        chan struct{}
+}
+
+// NewEventPublisher returns a new EventPublisher that sends events using
+// send, holding up to bufferSize events and making up to maxAttempts attempts
+// to send each, with a delay of retryDelay before the first retry, doubling
+// thereafter. It starts the publisher's goroutine, which runs until Close is
+// called.
+func NewEventPublisher(send EventSender, bufferSize int, maxAttempts int,
+	retryDelay time.Duration) *EventPublisher {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &EventPublisher{
+		send:        send,
+		events:      make(chan ArchiveEvent, bufferSize),
+		maxAttempts: maxAttempts,
+		retryDelay:  retryDelay,
+		ctx:         ctx,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+	go p.run()
+
+	return p
+}
+
+// Publish queues event to be sent, without waiting. If the buffer is full,
+// the event is dropped with a warning.
+func (p *EventPublisher) Publish(event ArchiveEvent) {
+	if p == nil {
+		return
+	}
+
+	select {
+	case p.events <- event:
+	default:
+		logs.GetLogger().Warn().Str("path", event.Path).
+			Int("buffer_size", cap(p.events)).
+			Msg("event buffer full, dropping the archive event")
+	}
+}
+
+// Close stops accepting events and waits up to timeout for those already
+// queued to be sent. Any remaining are then dropped. Publish must not be
+// called after Close.
+func (p *EventPublisher) Close(timeout time.Duration) {
+	if p == nil {
+		return
+	}
+
+	p.closeOnce.Do(func() {
+		close(p.events)
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-p.done:
+		case <-timer.C:
+			p.cancel()
+			<-p.done
+		}
+		p.cancel()
+	})
+}
+
+func (p *EventPublisher) run() {
+	defer close(p.done)
+
+	log := logs.GetLogger()
+	for event := range p.events {
+		if p.ctx.Err() != nil {
+			log.Warn().Str("path", event.Path).
+				Msg("publisher closed, dropping the archive event")
+			continue
+		}
+
+		if err := p.sendWithRetry(event); err != nil {
+			log.Warn().Err(err).Str("path", event.Path).
+				Int("attempts", p.maxAttempts).
+				Msg("failed to publish, dropping the archive event")
+		}
+	}
+}
+
+func (p *EventPublisher) sendWithRetry(event ArchiveEvent) (err error) {
+	log := logs.GetLogger()
+	delay := p.retryDelay
+
+	for attempt := 1; attempt <= p.maxAttempts; attempt++ {
+		if err = p.send(p.ctx, event); err == nil {
+			log.Debug().Str("path", event.Path).Msg("published archive event")
+			return nil
+		}
+		if attempt == p.maxAttempts {
+			break
+		}
+
+		log.Error().Err(err).Str("path", event.Path).Int("attempt", attempt).
+			Dur("retry_in", delay).Msg("failed to publish the archive event")
+
+		select {
+		case <-time.After(delay):
+		case <-p.ctx.Done():
+			return p.ctx.Err()
+		}
+		delay *= 2
+	}
+
+	return err
+}
+
+// MakeKafkaRESTSender returns an EventSender that sends each event as a JSON
+// record to topic, using the v2 API of a Kafka REST proxy at baseURL
+// e.g. http://kafka-rest:8082. Each request is abandoned after timeout.
+func MakeKafkaRESTSender(baseURL string, topic string,
+	timeout time.Duration) (EventSender, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid message queue URL '%s'", baseURL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("invalid message queue URL '%s': "+
+			"the scheme must be http or https", baseURL)
+	}
+	if topic == "" {
+		return nil, errors.New("a message queue topic is required")
+	}
+
+	endpoint := u.JoinPath("topics", topic).String()
+	client := &http.Client{Timeout: timeout}
+
+	return func(ctx context.Context, event ArchiveEvent) error {
+		type record struct {
+			Value ArchiveEvent `json:"value"`
+		}
+		body, err := json.Marshal(struct {
+			Records []record `json:"records"`
+		}{[]record{{event}}})
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint,
+			bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		_, _ = io.Copy(io.Discard, resp.Body)
+
+		if resp.StatusCode/100 != 2 {
+			return errors.Errorf("message queue responded '%s' to %s",
+				resp.Status, endpoint)
+		}
+
+		return nil
+	}, nil
+}
+
+// MakeEventPublishing returns a WorkFunc that does the work of fn, which is
+// expected to archive its file under remoteBase, and then publishes an
+// ArchiveEvent for the file using publisher. Nothing is published if fn
+// returns an error. The event includes the file's MD5 checksum, from its
+// checksum file named as described by cf, and its run ID and run directory
+// metadata, if it is within a MinKNOW run directory (see RunDirMetadata), in
+// the report namespace of rc.
+func MakeEventPublishing(localBase string, remoteBase string, fn WorkFunc,
+	publisher *EventPublisher, cf ChecksumFiles, rc ReportConfig) WorkFunc {
+	if publisher == nil {
+		return fn
+	}
+
+	return func(path FilePath) error {
+		if err := fn(path); err != nil {
+			return err
+		}
+
+		event, err := newArchiveEvent(localBase, remoteBase, path, cf, rc)
+		if err != nil {
+			// The file has been archived, so this is not an error of the work
+			logs.GetLogger().Warn().Err(err).Str("path", path.Location).
+				Msg("failed to describe the archived file, not publishing")
+			return nil
+		}
+		publisher.Publish(event)
+
+		return nil
+	}
+}
+
+func newArchiveEvent(localBase string, remoteBase string, path FilePath,
+	cf ChecksumFiles, rc ReportConfig) (ArchiveEvent, error) {
+	dst, err := translatePath(localBase, remoteBase, path)
+	if err != nil {
+		return ArchiveEvent{}, err
+	}
+
+	chkFile, err := NewFilePathNoStat(cf.ChecksumFilename(path))
+	if err != nil {
+		return ArchiveEvent{}, err
+	}
+	checksum, err := ReadMD5ChecksumFile(chkFile)
+	if err != nil {
+		return ArchiveEvent{}, err
+	}
+
+	event := ArchiveEvent{
+		Path:       path.Location,
+		RemotePath: dst,
+		Checksum:   string(checksum),
+		Time:       time.Now().UTC(),
+	}
+	if path.Info != nil {
+		event.Size = path.Info.Size()
+	}
+
+	if runDir, ok := FindMinKNOWRunDir(path.Location); ok {
+		event.RunID = filepath.Base(runDir)
+
+		// A run directory outside the expected hierarchy has no metadata
+		if avus, err := RunDirMetadata(runDir, rc); err == nil {
+			event.RunMetadata = make(map[string]string)
+			for _, avu := range avus {
+				event.RunMetadata[avu.Attr] = avu.Value
+			}
+		}
+	}
+
+	return event, nil
+}
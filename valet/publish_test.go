@@ -0,0 +1,204 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file publish_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventPublisherRetries(t *testing.T) {
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	var sent []string
+
+	// a fails once, b always fails
+	send := func(_ context.Context, event ArchiveEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts[event.Path]++
+		if event.Path == "b" || attempts[event.Path] == 1 && event.Path == "a" {
+			return errors.New("broker unavailable")
+		}
+		sent = append(sent, event.Path)
+		return nil
+	}
+
+	p := NewEventPublisher(send, 10, 3, time.Millisecond)
+	for _, path := range []string{"a", "b", "c"} {
+		p.Publish(ArchiveEvent{Path: path})
+	}
+	p.Close(10 * time.Second)
+
+	assert.ElementsMatch(t, []string{"a", "c"}, sent)
+	assert.Equal(t, map[string]int{"a": 2, "b": 3, "c": 1}, attempts)
+}
+
+func TestEventPublisherNeverBlocks(t *testing.T) {
+	release := make(chan struct{})
+	send := func(ctx context.Context, event ArchiveEvent) error {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil
+	}
+
+	p := NewEventPublisher(send, 2, 1, time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			p.Publish(ArchiveEvent{Path: "a"})
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "Publish blocked on a full buffer")
+	}
+
+	close(release)
+	p.Close(10 * time.Second)
+}
+
+func TestEventPublisherNil(t *testing.T) {
+	var p *EventPublisher
+	p.Publish(ArchiveEvent{Path: "a"})
+	p.Close(time.Second)
+}
+
+func TestMakeKafkaRESTSender(t *testing.T) {
+	var received struct {
+		Records []struct {
+			Value ArchiveEvent `json:"value"`
+		} `json:"records"`
+	}
+	var reqPath, contentType string
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			reqPath = r.URL.Path
+			contentType = r.Header.Get("Content-Type")
+			_ = json.NewDecoder(r.Body).Decode(&received)
+			w.WriteHeader(http.StatusOK)
+		}))
+	defer server.Close()
+
+	send, err := MakeKafkaRESTSender(server.URL, "archived", time.Second)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	event := ArchiveEvent{Path: "/data/reads1.fast5", Size: 10,
+		Checksum: "1181c1834012245d785120e3505ed169"}
+	assert.NoError(t, send(context.Background(), event))
+	assert.Equal(t, "/topics/archived", reqPath)
+	assert.Equal(t, "application/vnd.kafka.json.v2+json", contentType)
+	if assert.Len(t, received.Records, 1) {
+		assert.Equal(t, event.Path, received.Records[0].Value.Path)
+		assert.Equal(t, event.Checksum, received.Records[0].Value.Checksum)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+	defer failing.Close()
+
+	send, err = MakeKafkaRESTSender(failing.URL, "archived", time.Second)
+	if assert.NoError(t, err) {
+		assert.Error(t, send(context.Background(), event))
+	}
+
+	_, err = MakeKafkaRESTSender("kafka:9092", "archived", time.Second)
+	assert.Error(t, err)
+	_, err = MakeKafkaRESTSender(server.URL, "", time.Second)
+	assert.Error(t, err)
+}
+
+func TestMakeEventPublishing(t *testing.T) {
+	tmpDir := t.TempDir()
+	runDir := filepath.Join(tmpDir, "expt", "sample",
+		"20190904_1514_GA20000_FAL01979_43578c8f")
+	if !assert.NoError(t, os.MkdirAll(runDir, 0755)) {
+		return
+	}
+
+	file := filepath.Join(runDir, "reads1.fast5")
+	assert.NoError(t, os.WriteFile(file, []byte("12345"), 0644))
+	assert.NoError(t, os.WriteFile(file+".md5",
+		[]byte("827ccb0eea8a706c4c34a16891f84e7b\n"), 0644))
+
+	var mu sync.Mutex
+	var events []ArchiveEvent
+	send := func(_ context.Context, event ArchiveEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+		return nil
+	}
+	p := NewEventPublisher(send, 10, 1, time.Millisecond)
+
+	var fail bool
+	work := func(path FilePath) error {
+		if fail {
+			return errors.New("failed to archive")
+		}
+		return nil
+	}
+	publishing := MakeEventPublishing(tmpDir, "/zone/archive", work, p,
+		defaultChecksums, ReportConfig{})
+
+	fp, err := NewFilePath(file)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, publishing(fp))
+	fail = true
+	assert.Error(t, publishing(fp))
+	p.Close(10 * time.Second)
+
+	if assert.Len(t, events, 1) {
+		event := events[0]
+		assert.Equal(t, file, event.Path)
+		assert.Equal(t, "/zone/archive/expt/sample/"+
+			"20190904_1514_GA20000_FAL01979_43578c8f/reads1.fast5",
+			event.RemotePath)
+		assert.Equal(t, int64(5), event.Size)
+		assert.Equal(t, "827ccb0eea8a706c4c34a16891f84e7b", event.Checksum)
+		assert.Equal(t, "20190904_1514_GA20000_FAL01979_43578c8f", event.RunID)
+		assert.Equal(t, "FAL01979", event.RunMetadata["ont:flowcell_id"])
+	}
+}
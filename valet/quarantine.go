@@ -0,0 +1,258 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file quarantine.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	logs "github.com/wtsi-npg/logshim"
+
+	"github.com/wtsi-npg/valet/utilities"
+)
+
+// QuarantineEntry records a file that has been quarantined after repeated
+// failures.
+type QuarantineEntry struct {
+	Path          string    `json:"path"`           // The path of the file
+	Failures      int       `json:"failures"`       // The number of consecutive failures
+	LastError     string    `json:"last_error"`     // The error of the last failure
+	QuarantinedAt time.Time `json:"quarantined_at"` // When the file was quarantined
+}
+
+// Quarantine counts the consecutive failures of work on each file. Once work on
+// a file has failed a maximum number of times in succession, the file is
+// quarantined and is not worked on again until it is cleared from the
+// quarantine. The failure counts are held in memory; the quarantined files are
+// optionally persisted to a file, so that they remain quarantined when valet is
+// restarted.
+//
+// The methods of a nil *Quarantine do nothing, so that a quarantine may be
+// disabled by using nil.
+type Quarantine struct {
+	file        string // The file to persist to, or empty
+	maxFailures int    // The number of consecutive failures to quarantine after
+
+	mu          sync.Mutex
+	failures    map[string]int
+	quarantined map[string]QuarantineEntry
+}
+
+// NewQuarantine returns a new Quarantine which quarantines a file after
+// maxFailures consecutive failures. If file is not empty, the quarantined files
+// are read from it, if it exists, and are written to it when changed.
+func NewQuarantine(file string, maxFailures int) (*Quarantine, error) {
+	q := &Quarantine{
+		file:        file,
+		maxFailures: maxFailures,
+		failures:    make(map[string]int),
+		quarantined: make(map[string]QuarantineEntry),
+	}
+
+	entries, err := ReadQuarantineFile(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		q.quarantined[e.Path] = e
+	}
+
+	return q, nil
+}
+
+// IsQuarantined returns true if path is quarantined. It is a FilePredicate.
+func (q *Quarantine) IsQuarantined(path FilePath) (bool, error) {
+	if q == nil {
+		return false, nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, ok := q.quarantined[path.Location]
+	return ok, nil
+}
+
+// RecordFailure records that work on path failed with err. It returns true if
+// this failure caused path to be quarantined.
+func (q *Quarantine) RecordFailure(path FilePath, err error) bool {
+	if q == nil || q.maxFailures <= 0 {
+		return false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.quarantined[path.Location]; ok {
+		return false
+	}
+
+	q.failures[path.Location]++
+	n := q.failures[path.Location]
+	if n < q.maxFailures {
+		return false
+	}
+
+	entry := QuarantineEntry{
+		Path:          path.Location,
+		Failures:      n,
+		QuarantinedAt: time.Now(),
+	}
+	if err != nil {
+		entry.LastError = err.Error()
+	}
+	q.quarantined[path.Location] = entry
+	delete(q.failures, path.Location)
+
+	log := logs.GetLogger()
+	log.Error().Str("path", path.Location).Int("failures", n).
+		Msg("quarantined file after repeated failures; it will not be " +
+			"worked on until cleared from the quarantine")
+
+	if werr := q.write(); werr != nil {
+		log.Error().Err(werr).Str("file", q.file).
+			Msg("failed to write the quarantine file")
+	}
+
+	return true
+}
+
+// RecordSuccess records that work on path succeeded, resetting its count of
+// consecutive failures.
+func (q *Quarantine) RecordSuccess(path FilePath) {
+	if q == nil {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.failures, path.Location)
+}
+
+// write writes the quarantined files to the quarantine file, if there is one.
+// The caller must hold the lock.
+func (q *Quarantine) write() error {
+	if q.file == "" {
+		return nil
+	}
+
+	entries := make([]QuarantineEntry, 0, len(q.quarantined))
+	for _, e := range q.quarantined {
+		entries = append(entries, e)
+	}
+
+	return WriteQuarantineFile(q.file, entries)
+}
+
+// ReadQuarantineFile returns the entries of the quarantine file, sorted by
+// path. A file that does not exist, or an empty file name, has no entries.
+func ReadQuarantineFile(file string) ([]QuarantineEntry, error) {
+	if file == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var entries []QuarantineEntry
+	if err = json.Unmarshal(content, &entries); err != nil {
+		return nil, err
+	}
+	sortQuarantineEntries(entries)
+
+	return entries, nil
+}
+
+// WriteQuarantineFile replaces the content of the quarantine file with entries,
+// sorted by path. The file is replaced atomically, by renaming.
+func WriteQuarantineFile(file string, entries []QuarantineEntry) (err error) { // NRV
+	sortQuarantineEntries(entries)
+
+	var content []byte
+	if content, err = json.MarshalIndent(entries, "", "  "); err != nil {
+		return err
+	}
+
+	var tmp *os.File
+	if tmp, err = os.CreateTemp(filepath.Dir(file),
+		filepath.Base(file)+".tmp"); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			err = utilities.CombineErrors(err, os.Remove(tmp.Name()))
+		}
+	}()
+
+	_, err = tmp.Write(append(content, '\n'))
+	if err = utilities.CombineErrors(err, tmp.Close()); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
+
+// ClearQuarantineFile removes the entries for paths from the quarantine file,
+// or all entries if paths is empty. It returns the entries removed.
+func ClearQuarantineFile(file string,
+	paths []string) ([]QuarantineEntry, error) {
+	entries, err := ReadQuarantineFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	toClear := make(map[string]bool)
+	for _, p := range paths {
+		toClear[p] = true
+	}
+
+	kept := []QuarantineEntry{}
+	var cleared []QuarantineEntry
+	for _, e := range entries {
+		if len(paths) == 0 || toClear[e.Path] {
+			cleared = append(cleared, e)
+		} else {
+			kept = append(kept, e)
+		}
+	}
+
+	if len(cleared) == 0 {
+		return nil, nil
+	}
+
+	return cleared, WriteQuarantineFile(file, kept)
+}
+
+func sortQuarantineEntries(entries []QuarantineEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+}
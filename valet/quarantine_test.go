@@ -0,0 +1,148 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file quarantine_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuarantine(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "quarantine.json")
+
+	q, err := NewQuarantine(file, 2)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	p1 := FilePath{FileResource: FileResource{Location: "/data/p1"}}
+	p2 := FilePath{FileResource: FileResource{Location: "/data/p2"}}
+	failed := errors.New("failed")
+
+	// A success resets the count of consecutive failures
+	assert.False(t, q.RecordFailure(p1, failed))
+	q.RecordSuccess(p1)
+	assert.False(t, q.RecordFailure(p1, failed))
+	assert.True(t, q.RecordFailure(p1, failed))
+
+	isQ, err := q.IsQuarantined(p1)
+	if assert.NoError(t, err) {
+		assert.True(t, isQ)
+	}
+	isQ, err = q.IsQuarantined(p2)
+	if assert.NoError(t, err) {
+		assert.False(t, isQ)
+	}
+
+	// Quarantined files are persisted
+	q, err = NewQuarantine(file, 2)
+	if assert.NoError(t, err) {
+		isQ, _ = q.IsQuarantined(p1)
+		assert.True(t, isQ)
+	}
+
+	entries, err := ReadQuarantineFile(file)
+	if assert.NoError(t, err) && assert.Len(t, entries, 1) {
+		assert.Equal(t, "/data/p1", entries[0].Path)
+		assert.Equal(t, 2, entries[0].Failures)
+		assert.Equal(t, "failed", entries[0].LastError)
+	}
+
+	cleared, err := ClearQuarantineFile(file, []string{"/data/p2"})
+	if assert.NoError(t, err) {
+		assert.Empty(t, cleared)
+	}
+	cleared, err = ClearQuarantineFile(file, nil)
+	if assert.NoError(t, err) && assert.Len(t, cleared, 1) {
+		assert.Equal(t, "/data/p1", cleared[0].Path)
+	}
+
+	entries, err = ReadQuarantineFile(file)
+	if assert.NoError(t, err) {
+		assert.Empty(t, entries)
+	}
+}
+
+func TestQuarantineNil(t *testing.T) {
+	var q *Quarantine
+	p := FilePath{FileResource: FileResource{Location: "/data/p"}}
+
+	assert.False(t, q.RecordFailure(p, errors.New("failed")))
+	q.RecordSuccess(p)
+
+	isQ, err := q.IsQuarantined(p)
+	if assert.NoError(t, err) {
+		assert.False(t, isQ)
+	}
+
+	entries, err := ReadQuarantineFile(filepath.Join(t.TempDir(), "missing"))
+	if assert.NoError(t, err) {
+		assert.Empty(t, entries)
+	}
+}
+
+func TestDoProcessFilesQuarantine(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "bad")
+	if !assert.NoError(t, os.WriteFile(p, []byte("bad"), 0644)) {
+		return
+	}
+	fp, err := NewFilePath(p)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	q, err := NewQuarantine("", 2)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var numRuns int
+	plan := WorkPlan{
+		WorkMatch{
+			pred: IsTrue,
+			work: Work{WorkFunc: func(path FilePath) error {
+				numRuns++
+				return errors.New("failed")
+			}},
+		},
+	}
+
+	for i := 0; i < 3; i++ {
+		ch := make(chan FilePath, 1)
+		ch <- fp
+		close(ch)
+
+		err = DoProcessFiles(context.Background(), ch,
+			ProcessParams{Plan: plan, MaxProc: 1, Quarantine: q})
+		if i < 2 {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err, "expected the quarantined file to be skipped")
+		}
+	}
+
+	assert.Equal(t, 2, numRuns)
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file quota.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	ex "github.com/wtsi-npg/extendo/v2"
+	logs "github.com/wtsi-npg/logshim"
+)
+
+// DefaultQuotaHoldMinDelay is the default time for which archiving is held
+// once the archive's quota is found to be exhausted.
+const DefaultQuotaHoldMinDelay = time.Minute
+
+// DefaultQuotaHoldMaxDelay is the default maximum time for which archiving is
+// held, as the hold is doubled each time the quota is found to be exhausted
+// again.
+const DefaultQuotaHoldMaxDelay = 30 * time.Minute
+
+// sysRescQuotaExceeded is the iRODS error code SYS_RESC_QUOTA_EXCEEDED.
+const sysRescQuotaExceeded int32 = -110000
+
+// IsQuotaError returns true if err shows that the archive has no room for more
+// data, either because a quota has been exceeded, or because its storage is
+// full.
+func IsQuotaError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if code, cerr := ex.RodsErrorCode(err); cerr == nil && isQuotaCode(code) {
+		return true
+	}
+
+	return strings.Contains(strings.ToLower(err.Error()), "quota exceeded")
+}
+
+// isQuotaCode returns true if the iRODS error code is SYS_RESC_QUOTA_EXCEEDED,
+// or an error whose system error (the last three digits of the code) is
+// ENOSPC or EDQUOT.
+func isQuotaCode(code int32) bool {
+	if code == sysRescQuotaExceeded {
+		return true
+	}
+
+	errno := syscall.Errno(-code % 1000)
+	return code < 0 && (errno == syscall.ENOSPC || errno == syscall.EDQUOT)
+}
+
+// QuotaHold holds archiving while the archive's quota is exhausted, so that
+// files wait, rather than every one failing in turn against an archive that
+// cannot accept them. Once tripped, the hold lasts for a delay that doubles
+// each time it is tripped again, up to a maximum, and is reset once a file is
+// archived successfully.
+//
+// The methods of a nil *QuotaHold do nothing, so that holding may be disabled
+// by using nil.
+type QuotaHold struct {
+	ctx      context.Context
+	minDelay time.Duration
+	maxDelay time.Duration
+
+	mu    sync.Mutex
+	delay time.Duration // The delay of the next hold
+	until time.Time     // The time at which the current hold ends
+	held  bool          // True if tripped since the last success
+}
+
+// NewQuotaHold returns a new QuotaHold whose delay starts at minDelay and
+// doubles up to maxDelay. Waiting on the hold ends early if ctx is cancelled.
+func NewQuotaHold(ctx context.Context, minDelay time.Duration,
+	maxDelay time.Duration) *QuotaHold {
+	if maxDelay < minDelay {
+		maxDelay = minDelay
+	}
+
+	return &QuotaHold{ctx: ctx, minDelay: minDelay, maxDelay: maxDelay,
+		delay: minDelay}
+}
+
+// wait blocks while the hold is in effect. It returns an error if the hold's
+// context is cancelled while waiting.
+func (h *QuotaHold) wait() error {
+	if h == nil {
+		return nil
+	}
+
+	for {
+		h.mu.Lock()
+		remaining := time.Until(h.until)
+		h.mu.Unlock()
+
+		if remaining <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-timer.C:
+		case <-h.ctx.Done():
+			timer.Stop()
+			return h.ctx.Err()
+		}
+	}
+}
+
+// trip starts a hold because err showed the quota to be exhausted, unless a
+// hold is already in effect, as when several files fail at once.
+func (h *QuotaHold) trip(err error) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(h.until) {
+		return
+	}
+
+	h.until = now.Add(h.delay)
+	h.held = true
+
+	logs.GetLogger().Warn().Err(err).Dur("hold", h.delay).
+		Msg("the archive's quota is exhausted, holding archiving")
+
+	if h.delay *= 2; h.delay > h.maxDelay {
+		h.delay = h.maxDelay
+	}
+}
+
+// clear resets the hold after a file has been archived successfully.
+func (h *QuotaHold) clear() {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.held {
+		logs.GetLogger().Info().
+			Msg("the archive accepted data again, resuming archiving")
+	}
+	h.held = false
+	h.delay = h.minDelay
+}
+
+// MakeQuotaHolding returns a WorkFunc that does the work of fn, which is
+// expected to archive its file, once any hold on archiving has ended. If fn
+// fails because the archive's quota is exhausted (see IsQuotaError), a hold is
+// started, so that the following files wait rather than fail. If hold is nil,
+// fn is returned.
+func MakeQuotaHolding(fn WorkFunc, hold *QuotaHold) WorkFunc {
+	if hold == nil {
+		return fn
+	}
+
+	return func(path FilePath) error {
+		if err := hold.wait(); err != nil {
+			return err
+		}
+
+		err := fn(path)
+		switch {
+		case err == nil:
+			hold.clear()
+		case IsQuotaError(err):
+			hold.trip(err)
+		}
+
+		return err
+	}
+}
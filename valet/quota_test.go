@@ -0,0 +1,93 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file quota_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsQuotaError(t *testing.T) {
+	assert.False(t, IsQuotaError(nil))
+	assert.False(t, IsQuotaError(errors.New("connection refused")))
+	assert.True(t, IsQuotaError(errors.Wrap(
+		errors.New("SYS_RESC_QUOTA_EXCEEDED: Quota Exceeded"), "put")))
+
+	for code, expected := range map[int32]bool{
+		-110000: true,  // SYS_RESC_QUOTA_EXCEEDED
+		-513028: true,  // UNIX_FILE_WRITE_ERR, ENOSPC
+		-511122: true,  // UNIX_FILE_CREATE_ERR, EDQUOT
+		-513005: false, // UNIX_FILE_WRITE_ERR, EIO
+		-808000: false, // CAT_NO_ROWS_FOUND
+	} {
+		assert.Equal(t, expected, isQuotaCode(code), "for code %d", code)
+	}
+}
+
+func TestMakeQuotaHolding(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hold := NewQuotaHold(ctx, 50*time.Millisecond, 100*time.Millisecond)
+
+	var fail bool
+	var calls int
+	work := MakeQuotaHolding(func(path FilePath) error {
+		calls++
+		if fail {
+			return errors.New("Quota exceeded")
+		}
+		return nil
+	}, hold)
+
+	path, err := NewFilePathNoStat("/data/reads1.fast5")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// A quota failure holds the following work
+	fail = true
+	assert.Error(t, work(path))
+
+	fail = false
+	start := time.Now()
+	assert.NoError(t, work(path))
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+	assert.Equal(t, 2, calls)
+
+	// which is done at once after a success
+	start = time.Now()
+	assert.NoError(t, work(path))
+	assert.Less(t, time.Since(start), 40*time.Millisecond)
+
+	// Waiting on a hold ends when cancelled
+	fail = true
+	assert.Error(t, work(path))
+	cancel()
+	assert.ErrorIs(t, work(path), context.Canceled)
+	assert.Equal(t, 4, calls)
+
+	assert.Equal(t, hold.maxDelay, hold.delay)
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file repair.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	ex "github.com/wtsi-npg/extendo/v2"
+	logs "github.com/wtsi-npg/logshim"
+)
+
+// ChecksumMetadataState describes the checksum metadata of an archived data
+// object, relative to its checksum in the iRODS catalogue.
+type ChecksumMetadataState string
+
+const (
+	// The checksum metadata match the checksum, or there are none to compare.
+	ChecksumMetadataCorrect ChecksumMetadataState = "correct"
+	// The checksum metadata do not match the MD5 checksum.
+	ChecksumMetadataIncorrect ChecksumMetadataState = "incorrect"
+	// The data object has no MD5 checksum against which to compare them.
+	ChecksumMetadataUncomparable ChecksumMetadataState = "uncomparable"
+)
+
+// RepairSummary summarises a repair of the checksum metadata of an archive.
+type RepairSummary struct {
+	NumObjects    uint64 // The number of data objects examined
+	NumRepaired   uint64 // The number repaired, or that would be on a dry run
+	NumUncompared uint64 // The number with no MD5 checksum to compare
+	NumErrors     uint64 // The number that could not be examined or repaired
+}
+
+// CompareChecksumMetadata compares the checksum metadata (under the "md5" key)
+// of a data object with its checksum, given its item listed with its checksum
+// and AVUs. Only an MD5 checksum may be compared, because the checksum metadata
+// are always MD5. A data object with no checksum metadata is not incorrect; it
+// has not been archived completely and is left for valet to archive again.
+func CompareChecksumMetadata(item ex.RodsItem) ChecksumMetadataState {
+	if !MD5Checksum.HasRemoteFormat(item.IChecksum) {
+		return ChecksumMetadataUncomparable
+	}
+
+	state := ChecksumMetadataCorrect
+	for _, avu := range item.IAVUs {
+		if avu.Attr != ex.ChecksumAttr {
+			continue
+		}
+		if avu.Value == item.IChecksum {
+			return ChecksumMetadataCorrect
+		}
+		state = ChecksumMetadataIncorrect
+	}
+
+	return state
+}
+
+// RepairChecksumMetadata lists every data object in the archive under
+// remoteBase and replaces any checksum metadata that do not match its MD5
+// checksum (see CompareChecksumMetadata) with the checksum. Up to maxProc data
+// objects are examined concurrently. Each repair is logged. If dryRun is true,
+// the repairs that would be made are logged, but no changes are made.
+//
+// Before a data object is repaired, its checksum is recalculated by the server
+// and the repair is refused, as an error, if it differs from the checksum in
+// the catalogue. The repair trusts that the data object's content is that of
+// the file from which it was archived. A data object that cannot be examined or
+// repaired is logged and counted as an error, rather than stopping the repair.
+func RepairChecksumMetadata(ctx context.Context, remoteBase string,
+	cPool *ex.ClientPool, maxProc int,
+	dryRun bool) (summary RepairSummary, err error) { // NRV
+	log := logs.GetLogger()
+
+	var items []ex.RodsItem
+	items, err = listDataObjects(cPool, remoteBase)
+	if err != nil {
+		return summary, err
+	}
+
+	var mu sync.Mutex
+	forEachDataObject(ctx, items, maxProc, func(item ex.RodsItem) {
+		state, rerr := repairItem(cPool, item, dryRun)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		summary.NumObjects++
+		switch {
+		case rerr != nil:
+			summary.NumErrors++
+			log.Error().Err(rerr).Str("path", item.RodsPath()).
+				Msg("failed to repair checksum metadata")
+		case state == ChecksumMetadataIncorrect:
+			summary.NumRepaired++
+		case state == ChecksumMetadataUncomparable:
+			summary.NumUncompared++
+		}
+	})
+
+	return summary, ctx.Err()
+}
+
+// repairItem repairs the checksum metadata of the data object item, if they
+// are incorrect, and returns their state before any repair.
+func repairItem(cPool *ex.ClientPool, item ex.RodsItem,
+	dryRun bool) (state ChecksumMetadataState, err error) { // NRV
+	var client *ex.Client
+	if client, err = getClient(cPool); err != nil {
+		return state, err
+	}
+	defer func() {
+		err = returnClient(cPool, client, err)
+	}()
+
+	var listed ex.RodsItem
+	if listed, err = client.ListItem(ex.Args{AVU: true, Checksum: true},
+		item); err != nil {
+		return state, err
+	}
+
+	state = CompareChecksumMetadata(listed)
+	if state != ChecksumMetadataIncorrect {
+		return state, nil
+	}
+
+	var incorrect []string
+	for _, avu := range listed.IAVUs {
+		if avu.Attr == ex.ChecksumAttr {
+			incorrect = append(incorrect, avu.Value)
+		}
+	}
+
+	log := logs.GetLogger()
+	if dryRun {
+		log.Info().Str("path", listed.RodsPath()).
+			Str("incorrect", strings.Join(incorrect, ",")).Str("checksum", listed.IChecksum).
+			Msg("would repair checksum metadata")
+		return state, nil
+	}
+
+	obj := ex.NewDataObject(client, listed.RodsPath())
+
+	var chk string
+	if chk, err = obj.CalculateChecksum(); err != nil {
+		return state, err
+	}
+	if chk != listed.IChecksum {
+		return state, errors.Errorf("refusing to repair the checksum "+
+			"metadata of '%s' because its recalculated checksum '%s' does "+
+			"not match its catalogue checksum '%s'", listed.RodsPath(), chk,
+			listed.IChecksum)
+	}
+
+	if err = obj.ReplaceMetadata([]ex.AVU{
+		ex.MakeAVU(ex.ChecksumAttr, chk)}); err != nil {
+		return state, err
+	}
+	log.Info().Str("path", listed.RodsPath()).
+		Str("incorrect", strings.Join(incorrect, ",")).Str("checksum", chk).
+		Msg("repaired checksum metadata")
+
+	return state, nil
+}
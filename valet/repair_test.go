@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file repair_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ex "github.com/wtsi-npg/extendo/v2"
+)
+
+func TestCompareChecksumMetadata(t *testing.T) {
+	md5 := "1181c1834012245d785120e3505ed169"
+	other := "348bd3ce10ec00ecc29d31ec97cd5839"
+	sha256 := "sha2:Tv1hPRcdvmRZZC/lEQMmFLkLUnQDmlBOvyL/6DHzrm4="
+
+	for name, tc := range map[string]struct {
+		item     ex.RodsItem
+		expected ChecksumMetadataState
+	}{
+		"correct": {
+			item: ex.RodsItem{IChecksum: md5,
+				IAVUs: []ex.AVU{{Attr: ex.ChecksumAttr, Value: md5}}},
+			expected: ChecksumMetadataCorrect,
+		},
+		"incorrect": {
+			item: ex.RodsItem{IChecksum: md5,
+				IAVUs: []ex.AVU{{Attr: ex.ChecksumAttr, Value: other}}},
+			expected: ChecksumMetadataIncorrect,
+		},
+		"one of several correct": {
+			item: ex.RodsItem{IChecksum: md5,
+				IAVUs: []ex.AVU{{Attr: ex.ChecksumAttr, Value: other},
+					{Attr: ex.ChecksumAttr, Value: md5}}},
+			expected: ChecksumMetadataCorrect,
+		},
+		"no metadata": {
+			item: ex.RodsItem{IChecksum: md5,
+				IAVUs: []ex.AVU{{Attr: "experiment_name", Value: "66"}}},
+			expected: ChecksumMetadataCorrect,
+		},
+		"no checksum": {
+			item: ex.RodsItem{
+				IAVUs: []ex.AVU{{Attr: ex.ChecksumAttr, Value: other}}},
+			expected: ChecksumMetadataUncomparable,
+		},
+		"sha256 checksum": {
+			item: ex.RodsItem{IChecksum: sha256,
+				IAVUs: []ex.AVU{{Attr: ex.ChecksumAttr, Value: other}}},
+			expected: ChecksumMetadataUncomparable,
+		},
+	} {
+		assert.Equal(t, tc.expected, CompareChecksumMetadata(tc.item),
+			"for %s", name)
+	}
+}
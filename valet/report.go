@@ -23,96 +23,304 @@ package valet
 
 import (
 	"encoding/json"
+	"io"
 	"os"
-	"regexp"
-	"strconv"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	ex "github.com/wtsi-npg/extendo/v2"
+	logs "github.com/wtsi-npg/logshim"
 )
 
-const dutyTimeField = "Duty Time"
 const trackingIDField = "Tracking ID"
 
+// DefaultReportParseAttempts is the default number of attempts made to parse a
+// MinKNOW report that is incomplete (see ParseCompleteMinKNOWReport).
+const DefaultReportParseAttempts = 3
+
+// DefaultReportParseDelay is the default delay between attempts to parse an
+// incomplete MinKNOW report.
+const DefaultReportParseDelay = 2 * time.Second
+
+// ErrIncompleteReport is the cause of an error reporting a MinKNOW report that
+// lacks its Tracking ID heading, or the end of the JSON object following it,
+// as does a report that MinKNOW is still writing. This is distinct from a
+// complete report whose content is malformed.
+var ErrIncompleteReport = errors.New("incomplete report")
+
+// ReportParams describe how MinKNOW reports are parsed, how the metadata made
+// from them are named and which instrument slots they map to (see
+// MakeReportConfig). The zero value uses the defaults.
+type ReportParams struct {
+	// The namespace of the AVUs made from reports, which are used both to
+	// annotate the archive and to confirm the annotation. Any trailing colon
+	// is ignored. The default is OxfordNanoporeNamespace.
+	Namespace string
+
+	// The mapping of device IDs to instrument slots (see AsEnhancedMetadata).
+	// The default is DefaultSlotMapping.
+	SlotMapping SlotMapping
+
+	// The number of attempts made to parse an incomplete report (see
+	// ParseCompleteMinKNOWReport). The default is DefaultReportParseAttempts.
+	ParseAttempts int
+
+	// The delay between attempts to parse an incomplete report. The default
+	// is DefaultReportParseDelay.
+	ParseDelay time.Duration
+}
+
+// ReportConfig is the configuration with which MinKNOW reports are parsed and
+// annotated, made from ReportParams. The zero value is the default
+// configuration.
+type ReportConfig struct {
+	namespace     string
+	slotMapping   SlotMapping
+	parseAttempts int
+	parseDelay    time.Duration
+}
+
+// defaultReport is the default ReportConfig.
+var defaultReport = mustMakeReportConfig(ReportParams{})
+
+// MakeReportConfig returns the ReportConfig described by params, with the
+// defaults in place of any zero values.
+func MakeReportConfig(params ReportParams) (ReportConfig, error) {
+	rc := ReportConfig{
+		namespace:     OxfordNanoporeNamespace,
+		slotMapping:   params.SlotMapping,
+		parseAttempts: params.ParseAttempts,
+		parseDelay:    params.ParseDelay,
+	}
+
+	if params.Namespace != "" {
+		namespace := strings.TrimSuffix(params.Namespace, ":")
+		if namespace == "" {
+			return ReportConfig{}, errors.New("the report namespace may " +
+				"not be empty")
+		}
+		if strings.ContainsAny(namespace, ": \t\n") {
+			return ReportConfig{}, errors.Errorf("the report namespace '%s' "+
+				"may not contain a colon or whitespace", namespace)
+		}
+		rc.namespace = namespace
+	}
+
+	if params.ParseAttempts < 0 {
+		return ReportConfig{}, errors.Errorf("the number of report parse "+
+			"attempts %d may not be negative", params.ParseAttempts)
+	}
+	if params.ParseDelay < 0 {
+		return ReportConfig{}, errors.Errorf("the report parse delay %s "+
+			"may not be negative", params.ParseDelay)
+	}
+
+	if rc.slotMapping == nil {
+		rc.slotMapping = DefaultSlotMapping()
+	}
+	if rc.parseAttempts == 0 {
+		rc.parseAttempts = DefaultReportParseAttempts
+	}
+	if rc.parseDelay == 0 {
+		rc.parseDelay = DefaultReportParseDelay
+	}
+
+	return rc, nil
+}
+
+func mustMakeReportConfig(params ReportParams) ReportConfig {
+	rc, err := MakeReportConfig(params)
+	if err != nil {
+		panic(err)
+	}
+
+	return rc
+}
+
+// orDefault returns rc, or the default ReportConfig if rc is the zero value.
+func (rc ReportConfig) orDefault() ReportConfig {
+	if rc.namespace == "" {
+		return defaultReport
+	}
+
+	return rc
+}
+
+// Namespace returns the namespace of the AVUs made from MinKNOW reports.
+func (rc ReportConfig) Namespace() string {
+	return rc.orDefault().namespace
+}
+
 type MinKNOWReport struct {
-	Path                string // The path of the report
-	DeviceID            string `json:"device_id"`            // The device ID (flowcell position)
-	DeviceType          string `json:"device_type"`          // The device type e.g. promethion
-	DistributionVersion string `json:"distribution_version"` // The MinKNOW version
-	FlowcellID          string `json:"flow_cell_id"`         // The flowcell ID
-	GuppyVersion        string `json:"guppy_version"`        // The Guppy basecaller version
-	Hostname            string `json:"hostname"`             // The sequencing instrument hostname
-	ProtocolGroupID     string `json:"protocol_group_id"`    // The user-supplied experiment name
-	RunID               string `json:"run_id"`               // The automatically generated run ID
-	SampleID            string `json:"sample_id"`            // The user-supplied sample ID
-}
-
-var gridionDeviceIDRegex = regexp.MustCompile(`^(?:GA|X)(\d)`)
-
-var promethion24DeviceIDMap = map[string]int{
-	"1A": 1,
-	"1B": 2,
-	"1C": 3,
-	"1D": 4,
-	"1E": 5,
-	"1F": 6,
-	"1G": 7,
-	"1H": 8,
-	"2A": 9,
-	"2B": 10,
-	"2C": 11,
-	"2D": 12,
-	"2E": 13,
-	"2F": 14,
-	"2G": 15,
-	"2H": 16,
-	"3A": 17,
-	"3B": 18,
-	"3C": 19,
-	"3D": 20,
-	"3E": 21,
-	"3F": 22,
-	"3G": 23,
-	"3H": 24,
+	Path                string // The path or name of the report
+	DeviceID            string `json:"device_id"`              // The device ID (flowcell position)
+	DeviceType          string `json:"device_type"`            // The device type e.g. promethion
+	DistributionVersion string `json:"distribution_version"`   // The MinKNOW version
+	FlowcellID          string `json:"flow_cell_id"`           // The flowcell ID
+	FlowcellProductCode string `json:"flow_cell_product_code"` // The flowcell product code e.g. FLO-PRO002
+	GuppyVersion        string `json:"guppy_version"`          // The Guppy basecaller version
+	Hostname            string `json:"hostname"`               // The sequencing instrument hostname
+	ProtocolGroupID     string `json:"protocol_group_id"`      // The user-supplied experiment name
+	RunID               string `json:"run_id"`                 // The automatically generated run ID
+	SampleID            string `json:"sample_id"`              // The user-supplied sample ID
+	StartedAt           string `json:"exp_start_time"`         // The run start time
 }
 
 // ParseMinKNOWReport parses a file at path and extracts MinKNOW run metadata
-// from it.
+// from it. See ParseMinKNOWReportReader.
 func ParseMinKNOWReport(path string) (MinKNOWReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return MinKNOWReport{}, err
+	}
+	defer f.Close()
+
+	return ParseMinKNOWReportReader(f, path)
+}
+
+// ParseCompleteMinKNOWReport parses a file at path as ParseMinKNOWReport does,
+// but if the report is incomplete (see ErrIncompleteReport), e.g. because it
+// was detected while MinKNOW was still writing it, the report is parsed again
+// after the delay of rc, up to its number of attempts (see ReportParams). A
+// malformed report is not parsed again. If the report remains incomplete, the
+// error has the cause ErrIncompleteReport.
+func ParseCompleteMinKNOWReport(path string,
+	rc ReportConfig) (MinKNOWReport, error) {
+	rc = rc.orDefault()
+	log := logs.GetLogger()
+
+	for attempt := 1; ; attempt++ {
+		report, err := ParseMinKNOWReport(path)
+		if err == nil || !errors.Is(err, ErrIncompleteReport) {
+			if err != nil {
+				log.Error().Err(err).Str("path", path).
+					Msg("report is malformed, not retrying")
+			}
+			return report, err
+		}
+
+		if attempt >= rc.parseAttempts {
+			log.Error().Err(err).Str("path", path).Int("attempts", attempt).
+				Msg("report is still incomplete, giving up")
+			return report, errors.WithMessagef(err,
+				"still incomplete after %d attempts", attempt)
+		}
+
+		log.Warn().Err(err).Str("path", path).Int("attempt", attempt).
+			Dur("retry_in", rc.parseDelay).
+			Msg("report is incomplete, it may still be being written")
+		time.Sleep(rc.parseDelay)
+	}
+}
+
+// ParseMinKNOWReportReader parses a report read from r and extracts MinKNOW
+// run metadata from it. The metadata are read from the first JSON object
+// following the "Tracking ID" heading, which is located by brace matching. Any
+// markdown decoration around the object is ignored and trailing commas within
+// it are tolerated. If the heading, or the end of the object, is not found,
+// the error has the cause ErrIncompleteReport. The name identifies the report in errors and is used as
+// the Path of the returned report e.g. the path of a local file or of a data
+// object in the archive.
+func ParseMinKNOWReportReader(r io.Reader, name string) (MinKNOWReport, error) {
 	var report MinKNOWReport
 
-	bytes, err := os.ReadFile(path)
+	bytes, err := io.ReadAll(r)
 	if err != nil {
-		return report, err
+		return report, errors.Wrapf(err, "failed to read report %s", name)
 	}
 
 	text := string(bytes)
 	ti := strings.Index(text, trackingIDField)
 	if ti < 0 {
-		return report, errors.Errorf("failed to find %s in report file %s",
-			trackingIDField, path)
+		return report, errors.Wrapf(ErrIncompleteReport,
+			"failed to find %s in report %s", trackingIDField, name)
 	}
 
-	di := strings.Index(text, dutyTimeField)
-	if di < 0 {
-		return report, errors.Errorf("failed to find %s in report file %s",
-			dutyTimeField, path)
+	object, err := extractJSONObject(text[ti+len(trackingIDField):])
+	if err != nil {
+		return report, errors.Wrapf(ErrIncompleteReport, "%v in report %s",
+			err, name)
 	}
 
-	targetRegion := text[ti+len(trackingIDField) : di]
-	targetRegion = strings.ReplaceAll(targetRegion, "=", "")
-
-	if err = json.Unmarshal([]byte(targetRegion), &report); err != nil {
-		return MinKNOWReport{}, err
+	if err = json.Unmarshal([]byte(object), &report); err != nil {
+		return MinKNOWReport{}, errors.Wrapf(err, "in report %s", name)
 	}
-	report.Path = path
+	report.Path = name
 
 	return report, nil
 }
 
-// AsMetadata returns the report content as iRODS AVUs.
-func (report MinKNOWReport) AsMetadata() []ex.AVU {
+// extractJSONObject returns the first JSON object in text, located by matching
+// its opening and closing braces. Braces within JSON strings are ignored.
+// Trailing commas before a closing brace or bracket are removed from the
+// returned object.
+func extractJSONObject(text string) (string, error) {
+	start := strings.Index(text, "{")
+	if start < 0 {
+		return "", errors.New("failed to find the start of a JSON object")
+	}
+
+	var obj strings.Builder
+	depth := 0
+	inString, escaped := false, false
+	pendingComma := -1 // Index in obj of a comma that may be trailing
+
+	for _, r := range text[start:] {
+		if inString {
+			obj.WriteRune(r)
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\':
+				escaped = true
+			case r == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch r {
+		case '"':
+			inString = true
+			pendingComma = -1
+		case ',':
+			pendingComma = obj.Len()
+		case '{', '[':
+			depth++
+			pendingComma = -1
+		case '}', ']':
+			if pendingComma >= 0 {
+				// Drop the trailing comma, keeping whatever followed it
+				s := obj.String()
+				obj.Reset()
+				obj.WriteString(s[:pendingComma])
+				obj.WriteString(s[pendingComma+1:])
+				pendingComma = -1
+			}
+			depth--
+		case ' ', '\t', '\r', '\n':
+		default:
+			pendingComma = -1
+		}
+		obj.WriteRune(r)
+
+		if depth == 0 {
+			return obj.String(), nil
+		}
+	}
+
+	return "", errors.New("failed to find the end of a JSON object")
+}
+
+// AsMetadata returns the report content as iRODS AVUs in the report namespace
+// of rc (see ReportParams). The flowcell product code and start time are
+// optional and are omitted if absent from the report. The start time is
+// normalised to RFC3339 in UTC and is omitted, with a warning, if it cannot be
+// parsed.
+func (report MinKNOWReport) AsMetadata(rc ReportConfig) []ex.AVU {
+	rc = rc.orDefault()
 	avus := []ex.AVU{
 		{Attr: "device_id", Value: report.DeviceID},
 		{Attr: "device_type", Value: report.DeviceType},
@@ -125,13 +333,166 @@ func (report MinKNOWReport) AsMetadata() []ex.AVU {
 		{Attr: "sample_id", Value: report.SampleID},
 	}
 
+	if report.FlowcellProductCode != "" {
+		avus = append(avus, ex.AVU{Attr: "flowcell_product_code",
+			Value: report.FlowcellProductCode})
+	}
+
+	if report.StartedAt != "" {
+		startedAt, err := report.NormalisedStartedAt()
+		if err != nil {
+			logs.GetLogger().Warn().Err(err).Str("path", report.Path).
+				Msg("ignoring invalid run start time")
+		} else {
+			avus = append(avus, ex.AVU{Attr: "started_at", Value: startedAt})
+		}
+	}
+
 	for i := range avus {
-		avus[i] = avus[i].WithNamespace(OxfordNanoporeNamespace)
+		avus[i] = avus[i].WithNamespace(rc.namespace)
 	}
 
 	return avus
 }
 
+// reportAttrs are the attributes, without namespace, of all the AVUs that may
+// be made from a MinKNOW report by AsEnhancedMetadata.
+var reportAttrs = map[string]bool{
+	"device_id":             true,
+	"device_type":           true,
+	"distribution_version":  true,
+	"experiment_name":       true,
+	"flowcell_id":           true,
+	"flowcell_product_code": true,
+	"guppy_version":         true,
+	"hostname":              true,
+	"instrument_slot":       true,
+	"protocol_group_id":     true,
+	"run_id":                true,
+	"sample_id":             true,
+	"started_at":            true,
+}
+
+// isReportAttr returns true if attr is the attribute of an AVU that may be
+// made from a MinKNOW report, in the report namespace of rc.
+func isReportAttr(attr string, rc ReportConfig) bool {
+	name, ok := strings.CutPrefix(attr, rc.namespace+":")
+	return ok && reportAttrs[name]
+}
+
+// hasReportMetadata returns true if any of avus may be made from a MinKNOW
+// report, in the report namespace of rc.
+func hasReportMetadata(avus []ex.AVU, rc ReportConfig) bool {
+	for _, avu := range avus {
+		if isReportAttr(avu.Attr, rc) {
+			return true
+		}
+	}
+	return false
+}
+
+// RunDirMetadata returns the run metadata that may be derived from the path of
+// the MinKNOW run directory runDir, as iRODS AVUs in the report namespace of
+// rc. These are used to annotate a run that has no archived report (see
+// MakeRunDirAnnotator).
+//
+// A run directory is located within an experiment and a sample directory and
+// is named with the run identifier, e.g.
+//
+// <experiment>/<sample>/20190701_1522_GA10000_FAK83493_3bba1763
+//
+// from which the metadata are derived as follows:
+//
+//	protocol_group_id  the experiment directory name
+//	experiment_name    the experiment directory name
+//	sample_id          the sample directory name
+//	device_id          the device ID from the run identifier e.g. GA10000
+//	flowcell_id        the flowcell ID from the run identifier e.g. FAK83493
+//
+// The start time in the run identifier is local to the instrument, and its
+// final part is only an abbreviation of the run ID, so neither is used. The
+// metadata are a subset of those made from a report, which replace them once
+// the report is archived and annotated.
+func RunDirMetadata(runDir string, rc ReportConfig) ([]ex.AVU, error) {
+	rc = rc.orDefault()
+	runDir = filepath.Clean(runDir)
+	name := filepath.Base(runDir)
+	if !IsMinKNOWRunID(name) {
+		return nil, errors.Errorf("'%s' is not a MinKNOW run directory",
+			runDir)
+	}
+
+	sampleDir := filepath.Dir(runDir)
+	exptDir := filepath.Dir(sampleDir)
+	sample, expt := filepath.Base(sampleDir), filepath.Base(exptDir)
+	if sampleDir == exptDir || exptDir == filepath.Dir(exptDir) {
+		return nil, errors.Errorf("MinKNOW run directory '%s' is not "+
+			"within an experiment and a sample directory", runDir)
+	}
+
+	// The device ID is all that remains between the start time and the
+	// flowcell ID
+	parts := strings.Split(name, "_")
+	n := len(parts)
+	deviceID := strings.Join(parts[2:n-2], "_")
+	flowcellID := parts[n-2]
+
+	avus := []ex.AVU{
+		{Attr: "device_id", Value: deviceID},
+		{Attr: "experiment_name", Value: expt},
+		{Attr: "flowcell_id", Value: flowcellID},
+		{Attr: "protocol_group_id", Value: expt},
+		{Attr: "sample_id", Value: sample},
+	}
+
+	for i := range avus {
+		avus[i] = avus[i].WithNamespace(rc.namespace)
+	}
+
+	return avus, nil
+}
+
+// reportAnnotationDiff returns the AVUs to remove from, and to add to, the
+// metadata current, such that its report metadata become exactly metadata.
+// AVUs in current that may be made from a report, but which are not in
+// metadata, are stale e.g. a value that has changed since a run was
+// re-basecalled, or an optional value no longer in the report. Other AVUs in
+// current, including those outside the report namespace of rc, are not
+// removed.
+func reportAnnotationDiff(current []ex.AVU, metadata []ex.AVU,
+	rc ReportConfig) (toRemove []ex.AVU, toAdd []ex.AVU) {
+	var reportCurrent []ex.AVU
+	for _, avu := range current {
+		if isReportAttr(avu.Attr, rc) {
+			reportCurrent = append(reportCurrent, avu)
+		}
+	}
+
+	return ex.SetDiffAVUs(reportCurrent, metadata),
+		ex.SetDiffAVUs(metadata, current)
+}
+
+// StartTime returns the run start time of the report.
+func (report MinKNOWReport) StartTime() (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, report.StartedAt)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "StartTime")
+	}
+
+	return t, nil
+}
+
+// NormalisedStartedAt returns the run start time of the report in RFC3339
+// format, in UTC.
+func (report MinKNOWReport) NormalisedStartedAt() (string, error) {
+	t, err := report.StartTime()
+	if err != nil {
+		return "", errors.Wrap(err, "NormalisedStartedAt")
+	}
+
+	return t.UTC().Format(time.RFC3339), nil
+}
+
 // AsEnhancedMetadata returns the report as iRODS AVUs. It returns all the AVUs
 // of AsMetadata with some additional members:
 //
@@ -149,37 +510,30 @@ func (report MinKNOWReport) AsMetadata() []ex.AVU {
 //
 // For the PromethION-24 we are following the column-major order used by ONT's
 // MinKNOW API i.e. 1A - 1H, 2A - 2H, 3A - 3H.
-func (report MinKNOWReport) AsEnhancedMetadata() ([]ex.AVU, error) {
-	avus := report.AsMetadata()
-
-	if report.DeviceType == "gridion" {
-		deviceID := report.DeviceID
-		idMatch := gridionDeviceIDRegex.FindStringSubmatch(deviceID)
-		if idMatch == nil {
-			return avus, errors.Errorf("Failed to parse device ID '%s'",
-				deviceID)
-		}
+//
+// For the PromethION beta, which has no ordinal slot numbering, the device ID
+// (e.g. "2-E1-H1") is used as the slot unchanged.
+//
+// The slot is found using the SlotMapping of rc (see ReportParams), which by
+// default supports the devices above. Other device types have no slot.
+func (report MinKNOWReport) AsEnhancedMetadata(rc ReportConfig) ([]ex.AVU,
+	error) {
+	rc = rc.orDefault()
+	avus := report.AsMetadata(rc)
 
-		slot := ex.AVU{Attr: "instrument_slot", Value: idMatch[1]}.
-			WithNamespace(OxfordNanoporeNamespace)
-		avus = append(avus, slot)
+	slotValue, ok, err := rc.slotMapping.Slot(report.DeviceType,
+		report.DeviceID)
+	if err != nil {
+		return avus, err
 	}
-
-	if report.DeviceType == "promethion" {
-		deviceID := report.DeviceID
-		id, ok := promethion24DeviceIDMap[deviceID]
-		if !ok {
-			return avus, errors.Errorf("Failed to parse device ID '%s'",
-				deviceID)
-		}
-
-		slot := ex.AVU{Attr: "instrument_slot", Value: strconv.Itoa(id)}.
-			WithNamespace(OxfordNanoporeNamespace)
+	if ok {
+		slot := ex.AVU{Attr: "instrument_slot", Value: slotValue}.
+			WithNamespace(rc.namespace)
 		avus = append(avus, slot)
 	}
 
 	expt := ex.AVU{Attr: "experiment_name", Value: report.ProtocolGroupID}.
-		WithNamespace(OxfordNanoporeNamespace)
+		WithNamespace(rc.namespace)
 
 	avus = append(avus, expt)
 
@@ -21,9 +21,12 @@
 package valet
 
 import (
+	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	ex "github.com/wtsi-npg/extendo/v2"
@@ -60,10 +63,289 @@ func TestParseGridIONReport(t *testing.T) {
 	}
 }
 
+func TestParseReportDecoratedValues(t *testing.T) {
+	// Values contain "=" and braces and the JSON has a trailing comma
+	path := "./testdata/report/report_PAH48449_20220301_1200_5e1f0a3c.md"
+	report, err := ParseMinKNOWReport(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1A", report.DeviceID)
+		assert.Equal(t, "promethion", report.DeviceType)
+		assert.Equal(t, "PAH48449", report.FlowcellID)
+		assert.Equal(t, "lambda {p24} = all", report.ProtocolGroupID)
+		assert.Equal(t, "lambda=151221=1", report.SampleID)
+	}
+}
+
+func TestParseMinKNOWReportReader(t *testing.T) {
+	text := `# Report
+
+Tracking ID
+===========
+
+` + "```" + `
+{
+    "device_id": "X2",
+    "device_type": "gridion",
+    "flow_cell_id": "FAK12345",
+    "run_id": "a1b2c3d4",
+    "sample_id": "sample {1}",
+}
+` + "```" + `
+
+Duty Time
+=========
+`
+	name := "/seq/ont/gridion/report_FAK12345.md"
+	report, err := ParseMinKNOWReportReader(strings.NewReader(text), name)
+	if assert.NoError(t, err) {
+		assert.Equal(t, name, report.Path)
+		assert.Equal(t, "X2", report.DeviceID)
+		assert.Equal(t, "gridion", report.DeviceType)
+		assert.Equal(t, "FAK12345", report.FlowcellID)
+		assert.Equal(t, "a1b2c3d4", report.RunID)
+		assert.Equal(t, "sample {1}", report.SampleID)
+	}
+
+	_, err = ParseMinKNOWReportReader(strings.NewReader("no tracking"), name)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), name)
+	}
+
+	_, err = ParseMinKNOWReportReader(strings.NewReader("Tracking ID\n{"),
+		name)
+	assert.ErrorIs(t, err, ErrIncompleteReport)
+
+	_, err = ParseMinKNOWReportReader(strings.NewReader("Tracking ID\n{x}"),
+		name)
+	if assert.Error(t, err) {
+		assert.NotErrorIs(t, err, ErrIncompleteReport)
+	}
+}
+
+func TestParseCompleteMinKNOWReport(t *testing.T) {
+	rc, err := MakeReportConfig(ReportParams{ParseAttempts: 3,
+		ParseDelay: 20 * time.Millisecond})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	content, err := os.ReadFile(
+		"./testdata/valet/report_ABQ808_20200204_1257_e2e93dd1.md")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "report_ABQ808_20200204_1257_e2e93dd1.md")
+	write := func(text string) error {
+		tmp := filepath.Join(tmpDir, "report.tmp")
+		if err := os.WriteFile(tmp, []byte(text), 0644); err != nil {
+			return err
+		}
+		return os.Rename(tmp, path)
+	}
+
+	// A report still being written is parsed once complete
+	if !assert.NoError(t, write(string(content[:len(content)/4]))) {
+		return
+	}
+	done := make(chan error)
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		done <- write(string(content))
+	}()
+
+	report, err := ParseCompleteMinKNOWReport(path, rc)
+	assert.NoError(t, <-done)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "X2", report.DeviceID)
+	}
+
+	// A report that is never completed
+	if !assert.NoError(t, write("# Report\n")) {
+		return
+	}
+	_, err = ParseCompleteMinKNOWReport(path, rc)
+	assert.ErrorIs(t, err, ErrIncompleteReport)
+
+	// A malformed report is not parsed again
+	slow, err := MakeReportConfig(ReportParams{ParseDelay: time.Hour})
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, write("Tracking ID\n{x}")) {
+		return
+	}
+	_, err = ParseCompleteMinKNOWReport(path, slow)
+	if assert.Error(t, err) {
+		assert.NotErrorIs(t, err, ErrIncompleteReport)
+	}
+}
+
+func TestExtractJSONObject(t *testing.T) {
+	obj, err := extractJSONObject("\n===\n\n{\"a\": {\"b\": \"}\"}}\n===\n{}")
+	if assert.NoError(t, err) {
+		assert.Equal(t, `{"a": {"b": "}"}}`, obj)
+	}
+
+	obj, err = extractJSONObject(`{"a": ["x", "y",], "b": "\",}",}`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, `{"a": ["x", "y"], "b": "\",}"}`, obj)
+	}
+
+	_, err = extractJSONObject("no object")
+	assert.Error(t, err)
+
+	_, err = extractJSONObject(`{"a": "b"`)
+	assert.Error(t, err)
+}
+
+func TestParseReportProductCodeStartTime(t *testing.T) {
+	path := "./testdata/report/report_FAT12345_20220601_1115_7c3d9e21.md"
+	report, err := ParseMinKNOWReport(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "FLO-MIN114", report.FlowcellProductCode)
+		assert.Equal(t, "2022-06-01T11:15:30.123456+01:00", report.StartedAt)
+
+		start, err := report.StartTime()
+		if assert.NoError(t, err) {
+			assert.True(t, start.Equal(
+				time.Date(2022, 6, 1, 10, 15, 30, 123456000, time.UTC)))
+		}
+
+		metadata := report.AsMetadata(ReportConfig{})
+		assert.Contains(t, metadata,
+			ex.AVU{Attr: "ont:flowcell_product_code", Value: "FLO-MIN114"})
+		// Normalised to UTC, without fractional seconds
+		assert.Contains(t, metadata,
+			ex.AVU{Attr: "ont:started_at", Value: "2022-06-01T10:15:30Z"})
+	}
+}
+
+func TestReportMetadataOptionalFields(t *testing.T) {
+	report := MinKNOWReport{DeviceID: "X1", DeviceType: "gridion"}
+	for _, avu := range report.AsMetadata(ReportConfig{}) {
+		assert.NotEqual(t, "ont:flowcell_product_code", avu.Attr)
+		assert.NotEqual(t, "ont:started_at", avu.Attr)
+	}
+
+	report.StartedAt = "not a time"
+	for _, avu := range report.AsMetadata(ReportConfig{}) {
+		assert.NotEqual(t, "ont:started_at", avu.Attr)
+	}
+}
+
+func TestReportAnnotationDiff(t *testing.T) {
+	metadata := []ex.AVU{
+		{Attr: "ont:guppy_version", Value: "6.0.1"},
+		{Attr: "ont:run_id", Value: "a1b2c3d4"},
+	}
+
+	current := []ex.AVU{
+		{Attr: "ont:guppy_version", Value: "5.0.7"},
+		{Attr: "ont:run_id", Value: "a1b2c3d4"},
+		{Attr: "ont:started_at", Value: "2022-06-01T10:15:30Z"},
+		{Attr: "ont:other", Value: "x"},
+		{Attr: "user:study_id", Value: "1234"},
+	}
+
+	// A changed value and an optional value no longer in the report are
+	// stale; other AVUs are left alone
+	toRemove, toAdd := reportAnnotationDiff(current, metadata, defaultReport)
+	assert.ElementsMatch(t, []ex.AVU{
+		{Attr: "ont:guppy_version", Value: "5.0.7"},
+		{Attr: "ont:started_at", Value: "2022-06-01T10:15:30Z"},
+	}, toRemove)
+	assert.ElementsMatch(t, []ex.AVU{
+		{Attr: "ont:guppy_version", Value: "6.0.1"},
+	}, toAdd)
+
+	toRemove, toAdd = reportAnnotationDiff(
+		append(metadata, ex.AVU{Attr: "user:study_id", Value: "1234"}),
+		metadata, defaultReport)
+	assert.Empty(t, toRemove)
+	assert.Empty(t, toAdd)
+
+	toRemove, toAdd = reportAnnotationDiff(nil, metadata, defaultReport)
+	assert.Empty(t, toRemove)
+	assert.ElementsMatch(t, metadata, toAdd)
+}
+
+func TestRunDirMetadata(t *testing.T) {
+	metadata, err := RunDirMetadata(
+		"/data/expt1/sample1/20190701_1522_GA10000_FAK83493_3bba1763/", ReportConfig{})
+	if assert.NoError(t, err) {
+		assert.ElementsMatch(t, []ex.AVU{
+			{Attr: "ont:device_id", Value: "GA10000"},
+			{Attr: "ont:experiment_name", Value: "expt1"},
+			{Attr: "ont:flowcell_id", Value: "FAK83493"},
+			{Attr: "ont:protocol_group_id", Value: "expt1"},
+			{Attr: "ont:sample_id", Value: "sample1"},
+		}, metadata)
+
+		// Directory metadata are replaced by those of a report
+		assert.True(t, hasReportMetadata(metadata, defaultReport))
+	}
+
+	// A device ID may itself contain an underscore
+	metadata, err = RunDirMetadata(
+		"/data/expt1/sample1/20211215_1420_1_A1_PAH48449_227842f4", ReportConfig{})
+	if assert.NoError(t, err) {
+		assert.Contains(t, metadata,
+			ex.AVU{Attr: "ont:device_id", Value: "1_A1"})
+		assert.Contains(t, metadata,
+			ex.AVU{Attr: "ont:flowcell_id", Value: "PAH48449"})
+	}
+
+	_, err = RunDirMetadata("/data/expt1/sample1/reads", ReportConfig{})
+	assert.Error(t, err, "expected an error for a non-run directory")
+
+	_, err = RunDirMetadata("/20190701_1522_GA10000_FAK83493_3bba1763",
+		ReportConfig{})
+	assert.Error(t, err, "expected an error for a run outside an experiment")
+
+	assert.False(t, hasReportMetadata([]ex.AVU{
+		{Attr: "user:study_id", Value: "1234"}}, defaultReport))
+}
+
+func TestReportNamespace(t *testing.T) {
+	report := MinKNOWReport{DeviceID: "X1", DeviceType: "gridion",
+		ProtocolGroupID: "expt"}
+
+	assert.Equal(t, OxfordNanoporeNamespace, ReportConfig{}.Namespace())
+
+	rc, err := MakeReportConfig(ReportParams{Namespace: "acme:"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "acme", rc.Namespace())
+
+		metadata, err := report.AsEnhancedMetadata(rc)
+		if assert.NoError(t, err) {
+			for _, avu := range metadata {
+				assert.Regexp(t, "^acme:", avu.Attr)
+			}
+			assert.Contains(t, metadata,
+				ex.AVU{Attr: "acme:instrument_slot", Value: "1"})
+		}
+	}
+
+	for _, namespace := range []string{":", "a:b", "a b"} {
+		_, err = MakeReportConfig(ReportParams{Namespace: namespace})
+		assert.Error(t, err, "expected an error for '%s'", namespace)
+	}
+}
+
+func TestMakeReportConfigInvalid(t *testing.T) {
+	_, err := MakeReportConfig(ReportParams{ParseAttempts: -1})
+	assert.Error(t, err)
+
+	_, err = MakeReportConfig(ReportParams{ParseDelay: -time.Second})
+	assert.Error(t, err)
+}
+
 func TestEnhancedPromethION24Report(t *testing.T) {
 	path := "./testdata/valet/report_PAH48449_20211215_1420_227842f4.md"
 	report, err := ParseMinKNOWReport(path)
-	metadata, err := report.AsEnhancedMetadata()
+	metadata, err := report.AsEnhancedMetadata(ReportConfig{})
 	if assert.NoError(t, err) {
 		expected := []ex.AVU{
 			{Attr: "ont:device_id", Value: "1A"},
@@ -75,6 +357,8 @@ func TestEnhancedPromethION24Report(t *testing.T) {
 			{Attr: "ont:protocol_group_id", Value: "lambda_p24_all_positions"},
 			{Attr: "ont:run_id", Value: "39ae988ba41499479e0dc1fcae29fa4059701d08"},
 			{Attr: "ont:sample_id", Value: "lambda_151221_1"},
+			{Attr: "ont:flowcell_product_code", Value: "FLO-PRO002"},
+			{Attr: "ont:started_at", Value: "2021-12-15T14:20:11Z"},
 			{Attr: "ont:instrument_slot", Value: "1"},
 			{Attr: "ont:experiment_name", Value: "lambda_p24_all_positions"}}
 
@@ -85,7 +369,7 @@ func TestEnhancedPromethION24Report(t *testing.T) {
 func TestEnhancedGridIONMetadata(t *testing.T) {
 	path := "./testdata/valet/report_ABQ808_20200204_1257_e2e93dd1.md"
 	report, _ := ParseMinKNOWReport(path)
-	metadata, err := report.AsEnhancedMetadata()
+	metadata, err := report.AsEnhancedMetadata(ReportConfig{})
 	if assert.NoError(t, err) {
 		expected := []ex.AVU{
 			{Attr: "ont:device_id", Value: "X2"},
@@ -97,6 +381,8 @@ func TestEnhancedGridIONMetadata(t *testing.T) {
 			{Attr: "ont:protocol_group_id", Value: "85"},
 			{Attr: "ont:run_id", Value: "5531cbcf622d2d98dbff00af0261c6f19f91340f"},
 			{Attr: "ont:sample_id", Value: "DN615089W_B1"},
+			{Attr: "ont:flowcell_product_code", Value: "FLO-FLG001"},
+			{Attr: "ont:started_at", Value: "2020-02-04T12:57:07Z"},
 			{Attr: "ont:instrument_slot", Value: "2"},
 			{Attr: "ont:experiment_name", Value: "85"}}
 
@@ -104,6 +390,22 @@ func TestEnhancedGridIONMetadata(t *testing.T) {
 	}
 }
 
+func TestEnhancedPromethIONBetaMetadata(t *testing.T) {
+	path := "./testdata/report/report_PAE51234_20200212_1021_4b8e0f6a.md"
+	report, err := ParseMinKNOWReport(path)
+	if assert.NoError(t, err) {
+		metadata, err := report.AsEnhancedMetadata(ReportConfig{})
+		if assert.NoError(t, err) {
+			assert.Contains(t, metadata,
+				ex.AVU{Attr: "ont:instrument_slot", Value: "1-A3-D3"})
+		}
+	}
+
+	report.DeviceID = "9Z"
+	_, err = report.AsEnhancedMetadata(ReportConfig{})
+	assert.Error(t, err, "an unrecognised device ID was accepted")
+}
+
 func TestPromethion24InstrumentSlots(t *testing.T) {
 	paths, err := filepath.Glob("./testdata/valet/report_PAH48449_20211215*.md")
 	if assert.NoError(t, err) {
@@ -114,7 +416,7 @@ func TestPromethion24InstrumentSlots(t *testing.T) {
 		// These should have slot values of 1 to 6
 		for i, path := range paths {
 			report, _ := ParseMinKNOWReport(path)
-			metadata, err := report.AsEnhancedMetadata()
+			metadata, err := report.AsEnhancedMetadata(ReportConfig{})
 			if assert.NoError(t, err) {
 				found := false
 				for _, avu := range metadata {
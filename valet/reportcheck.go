@@ -0,0 +1,89 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file reportcheck.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"fmt"
+	"sort"
+
+	logs "github.com/wtsi-npg/logshim"
+)
+
+// ReportFailure describes a MinKNOW report that failed validation.
+type ReportFailure struct {
+	Path string // The path of the report
+	Err  error  // Why the report failed
+}
+
+// String returns a description of the failure suitable for a report.
+func (f ReportFailure) String() string {
+	return fmt.Sprintf("%s: %v", f.Path, f.Err)
+}
+
+// ReportValidation summarises the validation of MinKNOW reports.
+type ReportValidation struct {
+	NumReports uint64          // The number of reports validated
+	Failed     []ReportFailure // The reports that failed, by path
+}
+
+// ValidateReport returns an error if the MinKNOW report at path cannot be
+// parsed, or its metadata cannot be made because its device ID does not map to
+// an instrument slot (see AsEnhancedMetadata). These are the errors that would
+// otherwise be met while annotating the archive with the report, as
+// configured by rc.
+func ValidateReport(path string, rc ReportConfig) error {
+	report, err := ParseMinKNOWReport(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = report.AsEnhancedMetadata(rc)
+	return err
+}
+
+// ValidateReports validates the MinKNOW reports in the paths channel, which is
+// read until closed. Paths that are not reports (see IsMinKNOWReport) are
+// ignored. It neither writes to the filesystem nor contacts the archive. The
+// reports are validated as configured by rc (see ValidateReport).
+func ValidateReports(paths <-chan FilePath, rc ReportConfig) ReportValidation {
+	var validation ReportValidation
+	log := logs.GetLogger()
+
+	for path := range paths {
+		if ok, _ := IsMinKNOWReport(path); !ok {
+			continue
+		}
+
+		validation.NumReports++
+		if err := ValidateReport(path.Location, rc); err != nil {
+			log.Debug().Err(err).Str("path", path.Location).
+				Msg("report failed validation")
+			validation.Failed = append(validation.Failed,
+				ReportFailure{Path: path.Location, Err: err})
+		}
+	}
+
+	sort.Slice(validation.Failed, func(i, j int) bool {
+		return validation.Failed[i].Path < validation.Failed[j].Path
+	})
+
+	return validation
+}
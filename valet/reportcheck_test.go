@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file reportcheck_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateReports(t *testing.T) {
+	content, err := os.ReadFile(
+		"./testdata/valet/report_ABQ808_20200204_1257_e2e93dd1.md")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tmpDir := t.TempDir()
+	good := filepath.Join(tmpDir, "report_ABQ808_20200204_1257_e2e93dd1.md")
+	unmapped := filepath.Join(tmpDir, "report_ABQ809_20200204_1257_e2e93dd2.md")
+	broken := filepath.Join(tmpDir, "report_ABQ810_20200204_1257_e2e93dd3.md")
+
+	for path, text := range map[string]string{
+		good: string(content),
+		// No gridion device has this ID
+		unmapped: strings.Replace(string(content), `"device_id": "X2"`,
+			`"device_id": "Z1"`, 1),
+		broken:                                "# Not a report\n",
+		filepath.Join(tmpDir, "reads1.fast5"): "",
+	} {
+		if !assert.NoError(t, os.WriteFile(path, []byte(text), 0644)) {
+			return
+		}
+	}
+
+	assert.NoError(t, ValidateReport(good, ReportConfig{}))
+
+	paths, errs := FindFiles(context.Background(), tmpDir, IsRegular, IsFalse)
+	go func() {
+		for err := range errs {
+			t.Log(err)
+		}
+	}()
+
+	validation := ValidateReports(paths, ReportConfig{})
+	assert.Equal(t, uint64(3), validation.NumReports)
+	if assert.Len(t, validation.Failed, 2) {
+		assert.Equal(t, unmapped, validation.Failed[0].Path)
+		assert.Contains(t, validation.Failed[0].Err.Error(), "Z1")
+		assert.Equal(t, broken, validation.Failed[1].Path)
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file runlimit.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// RunLimit limits the number of files of any one run worked on at once, so that
+// a run whose files are all detected together, e.g. once it completes, does not
+// occupy every worker and starve the other runs. A file's run is its MinKNOW
+// run directory, or its parent directory if it is not within one.
+//
+// A file of a run at its limit is queued, rather than waited for, and is
+// handed the place of the next file of its run to finish, in the order
+// queued.
+//
+// The methods of a nil *RunLimit do nothing, so that the limit may be disabled
+// by using nil.
+type RunLimit struct {
+	max      int
+	mu       sync.Mutex
+	inFlight map[string]int        // The number of files in flight, by run
+	queued   map[string][]FilePath // The files waiting for a place, by run
+}
+
+// NewRunLimit returns a new RunLimit allowing up to max files of each run to be
+// worked on at once.
+func NewRunLimit(max int) *RunLimit {
+	return &RunLimit{
+		max:      max,
+		inFlight: make(map[string]int),
+		queued:   make(map[string][]FilePath),
+	}
+}
+
+// runOf returns the run of path, which is the key under which its files are
+// counted.
+func (l *RunLimit) runOf(path FilePath) string {
+	if l == nil {
+		return ""
+	}
+
+	if runDir, ok := FindMinKNOWRunDir(path.Location); ok {
+		return runDir
+	}
+
+	return filepath.Dir(path.Location)
+}
+
+// acquireOrQueue takes a place for path in run and returns true or, if run
+// already has the maximum number of files in flight, queues path for the next
+// place to be released and returns false.
+func (l *RunLimit) acquireOrQueue(run string, path FilePath) bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inFlight[run] >= l.max {
+		l.queued[run] = append(l.queued[run], path)
+		return false
+	}
+	l.inFlight[run]++
+
+	return true
+}
+
+// release returns a place taken for a file of run. If a file of run is queued,
+// the place passes to the first one, which is returned with true, for the
+// caller to work on.
+func (l *RunLimit) release(run string) (FilePath, bool) {
+	if l == nil {
+		return FilePath{}, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if queue := l.queued[run]; len(queue) > 0 {
+		next := queue[0]
+		if len(queue) == 1 {
+			delete(l.queued, run)
+		} else {
+			l.queued[run] = queue[1:]
+		}
+		return next, true
+	}
+
+	if l.inFlight[run]--; l.inFlight[run] <= 0 {
+		delete(l.inFlight, run)
+	}
+
+	return FilePath{}, false
+}
@@ -0,0 +1,243 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file runlimit_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunLimit(t *testing.T) {
+	limit := NewRunLimit(2)
+
+	var paths []FilePath
+	for i := 0; i < 5; i++ {
+		fp, err := NewFilePathNoStat(fmt.Sprintf("/data/a/reads%d.fast5", i))
+		if !assert.NoError(t, err) {
+			return
+		}
+		paths = append(paths, fp)
+	}
+
+	assert.True(t, limit.acquireOrQueue("a", paths[0]))
+	assert.True(t, limit.acquireOrQueue("a", paths[1]))
+	assert.False(t, limit.acquireOrQueue("a", paths[2]))
+	assert.False(t, limit.acquireOrQueue("a", paths[3]))
+	assert.True(t, limit.acquireOrQueue("b", paths[4]))
+
+	// Released places pass to the queued files, in the order queued
+	next, ok := limit.release("a")
+	if assert.True(t, ok) {
+		assert.Equal(t, paths[2], next)
+	}
+	next, ok = limit.release("a")
+	if assert.True(t, ok) {
+		assert.Equal(t, paths[3], next)
+	}
+
+	_, ok = limit.release("a")
+	assert.False(t, ok)
+	_, ok = limit.release("a")
+	assert.False(t, ok)
+	assert.True(t, limit.acquireOrQueue("a", paths[0]))
+
+	runDir := "/data/expt/sample/20190904_1514_GA20000_FAL01979_43578c8f"
+	path, err := NewFilePathNoStat(filepath.Join(runDir, "fast5_pass",
+		"reads1.fast5"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, runDir, limit.runOf(path))
+	}
+	path, err = NewFilePathNoStat("/data/other/reads1.fast5")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/data/other", limit.runOf(path))
+	}
+
+	var nilLimit *RunLimit
+	assert.True(t, nilLimit.acquireOrQueue("a", paths[0]))
+	_, ok = nilLimit.release("a")
+	assert.False(t, ok)
+}
+
+func TestDoProcessFilesRunLimit(t *testing.T) {
+	var paths []FilePath
+	for i := 0; i < 6; i++ {
+		fp, err := NewFilePathNoStat(fmt.Sprintf("/data/runA/reads%d.fast5", i))
+		if !assert.NoError(t, err) {
+			return
+		}
+		paths = append(paths, fp)
+	}
+	runB, err := NewFilePathNoStat("/data/runB/reads0.fast5")
+	if !assert.NoError(t, err) {
+		return
+	}
+	paths = append(paths, runB)
+
+	var mu sync.Mutex
+	inFlight := make(map[string]int)
+	maxInFlight := make(map[string]int)
+	runBStarted := make(chan struct{})
+
+	work := func(path FilePath) error {
+		run := filepath.Dir(path.Location)
+
+		mu.Lock()
+		inFlight[run]++
+		if inFlight[run] > maxInFlight[run] {
+			maxInFlight[run] = inFlight[run]
+		}
+		mu.Unlock()
+
+		// The files of run A wait for run B to start, which it can do only
+		// if they leave a worker free
+		if path.Location == runB.Location {
+			close(runBStarted)
+		} else {
+			select {
+			case <-runBStarted:
+			case <-time.After(5 * time.Second):
+			}
+		}
+
+		mu.Lock()
+		inFlight[run]--
+		mu.Unlock()
+		return nil
+	}
+
+	plan := WorkPlan{
+		WorkMatch{
+			pred: func(path FilePath) (bool, error) { return true, nil },
+			work: Work{WorkFunc: work},
+		},
+	}
+
+	ch := make(chan FilePath, len(paths))
+	for _, p := range paths {
+		ch <- p
+	}
+	close(ch)
+
+	start := time.Now()
+	err = DoProcessFiles(context.Background(), ch,
+		ProcessParams{Plan: plan, MaxProc: 3, MaxProcPerRun: 2})
+	if assert.NoError(t, err) {
+		assert.LessOrEqual(t, maxInFlight["/data/runA"], 2)
+		assert.Equal(t, 1, maxInFlight["/data/runB"])
+		assert.Less(t, time.Since(start), 5*time.Second)
+	}
+}
+
+func TestDoProcessFilesRunLimitQueue(t *testing.T) {
+	first, err := NewFilePathNoStat("/data/runA/reads0.fast5")
+	if !assert.NoError(t, err) {
+		return
+	}
+	queued, err := NewFilePathNoStat("/data/runA/reads1.fast5")
+	if !assert.NoError(t, err) {
+		return
+	}
+	other, err := NewFilePathNoStat("/data/runB/reads0.fast5")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, cancelled := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var mu sync.Mutex
+		worked := make(map[string]int)
+		started := make(chan struct{})
+		otherStarted := make(chan struct{})
+		proceed := make(chan struct{})
+
+		work := func(path FilePath) error {
+			mu.Lock()
+			worked[path.Location]++
+			mu.Unlock()
+
+			switch path.Location {
+			case first.Location:
+				close(started)
+				<-proceed
+			case other.Location:
+				close(otherStarted)
+			}
+			return nil
+		}
+
+		plan := WorkPlan{
+			WorkMatch{
+				pred: func(path FilePath) (bool, error) { return true, nil },
+				work: Work{WorkFunc: work},
+			},
+		}
+
+		ch := make(chan FilePath)
+		done := make(chan error, 1)
+		go func() {
+			done <- DoProcessFiles(ctx, ch,
+				ProcessParams{Plan: plan, MaxProc: 3, MaxProcPerRun: 1})
+		}()
+
+		ch <- first
+		<-started
+
+		// The queued file is marked as running, so its duplicates are skipped
+		for i := 0; i < 3; i++ {
+			ch <- queued
+		}
+
+		// Files are dispatched in order, so the duplicates have been skipped
+		// once the file of the other run has started
+		ch <- other
+		<-otherStarted
+		close(ch)
+
+		if cancelled {
+			cancel()
+		}
+		close(proceed)
+
+		select {
+		case err = <-done:
+			assert.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "timed out waiting for processing")
+		}
+		cancel()
+
+		assert.Equal(t, 1, worked[first.Location])
+		if cancelled {
+			assert.Equal(t, 0, worked[queued.Location],
+				"expected the queued file skipped once cancelled")
+		} else {
+			assert.Equal(t, 1, worked[queued.Location],
+				"expected the queued file worked on once")
+		}
+	}
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file setting.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DurationSetting is a duration that may be changed while it is in use, e.g.
+// when the configuration is reloaded, without restarting processing.
+type DurationSetting struct {
+	value atomic.Int64
+}
+
+// NewDurationSetting returns a new DurationSetting with initial value d.
+func NewDurationSetting(d time.Duration) *DurationSetting {
+	s := &DurationSetting{}
+	s.Set(d)
+	return s
+}
+
+// Get returns the current value.
+func (s *DurationSetting) Get() time.Duration {
+	return time.Duration(s.value.Load())
+}
+
+// Set changes the value to d.
+func (s *DurationSetting) Set(d time.Duration) {
+	s.value.Store(int64(d))
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file slots.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// The built-in slot mapping for GridION and PromethION instruments.
+//
+//go:embed slots.json
+var defaultSlotMappingJSON []byte
+
+// SlotRule maps device IDs to instrument slots. A rule has either a Pattern,
+// a regular expression which, if it matches a device ID, is expanded with Slot
+// (where $0 is the whole match and $1 etc. are submatches), or a Map from
+// device ID to slot.
+type SlotRule struct {
+	Pattern string            `json:"pattern,omitempty"` // A device ID regular expression
+	Slot    string            `json:"slot,omitempty"`    // A template for the slot
+	Map     map[string]string `json:"map,omitempty"`     // Device IDs to slots
+
+	regex *regexp.Regexp
+}
+
+// SlotTable holds the rules mapping device IDs to instrument slots for the
+// device types matching DeviceType, a glob pattern e.g. "promethion*".
+type SlotTable struct {
+	DeviceType string     `json:"device_type"` // A device type glob pattern
+	Rules      []SlotRule `json:"rules"`       // Rules tried in order
+}
+
+// SlotMapping is a series of SlotTables, each for a device type. The first
+// table whose DeviceType matches a device type is used for it.
+type SlotMapping []SlotTable
+
+// ParseSlotMapping parses a SlotMapping from JSON read from r, checking that
+// its patterns are valid.
+func ParseSlotMapping(r io.Reader) (SlotMapping, error) {
+	var mapping SlotMapping
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&mapping); err != nil {
+		return nil, errors.Wrap(err, "invalid slot mapping")
+	}
+
+	for i := range mapping {
+		table := &mapping[i]
+		if _, err := path.Match(table.DeviceType, ""); err != nil ||
+			table.DeviceType == "" {
+			return nil, errors.Errorf("invalid slot mapping device type "+
+				"pattern '%s'", table.DeviceType)
+		}
+
+		for j := range table.Rules {
+			rule := &table.Rules[j]
+			if (rule.Pattern == "") == (rule.Map == nil) {
+				return nil, errors.Errorf("slot mapping rule %d for device "+
+					"type '%s' must have one of a pattern or a map",
+					j, table.DeviceType)
+			}
+			if rule.Pattern == "" {
+				continue
+			}
+
+			regex, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid slot mapping "+
+					"pattern for device type '%s'", table.DeviceType)
+			}
+			rule.regex = regex
+		}
+	}
+
+	return mapping, nil
+}
+
+// LoadSlotMapping reads a SlotMapping from the JSON file at path.
+func LoadSlotMapping(path string) (SlotMapping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mapping, err := ParseSlotMapping(f)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "in %s", path)
+	}
+
+	return mapping, nil
+}
+
+// DefaultSlotMapping returns the built-in SlotMapping, which supports the
+// GridION, PromethION-24 and PromethION beta.
+func DefaultSlotMapping() SlotMapping {
+	return mustParseSlotMapping(defaultSlotMappingJSON)
+}
+
+// Slot returns the instrument slot of the device deviceID of type deviceType.
+// It returns false if the mapping has no table for deviceType and an error if
+// it has a table, but no rule in it matches deviceID.
+func (m SlotMapping) Slot(deviceType string,
+	deviceID string) (string, bool, error) {
+	for _, table := range m {
+		if ok, _ := path.Match(table.DeviceType, deviceType); !ok {
+			continue
+		}
+
+		for _, rule := range table.Rules {
+			if rule.regex == nil {
+				if slot, ok := rule.Map[deviceID]; ok {
+					return slot, true, nil
+				}
+				continue
+			}
+
+			if match := rule.regex.FindStringSubmatchIndex(deviceID); match != nil {
+				slot := rule.regex.ExpandString(nil, rule.Slot, deviceID, match)
+				return string(slot), true, nil
+			}
+		}
+
+		return "", true, errors.Errorf("Failed to parse device ID '%s'",
+			deviceID)
+	}
+
+	return "", false, nil
+}
+
+func mustParseSlotMapping(data []byte) SlotMapping {
+	mapping, err := ParseSlotMapping(bytes.NewReader(data))
+	if err != nil {
+		panic(err)
+	}
+
+	return mapping
+}
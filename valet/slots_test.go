@@ -0,0 +1,123 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file slots_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ex "github.com/wtsi-npg/extendo/v2"
+)
+
+func TestDefaultSlotMapping(t *testing.T) {
+	mapping := DefaultSlotMapping()
+
+	for _, c := range []struct {
+		deviceType, deviceID, slot string
+	}{
+		{"gridion", "GA30000", "3"},
+		{"gridion", "X5", "5"},
+		{"promethion", "1A", "1"},
+		{"promethion", "2B", "10"},
+		{"promethion", "3H", "24"},
+		{"promethion", "2-E1-H1", "2-E1-H1"},
+	} {
+		slot, ok, err := mapping.Slot(c.deviceType, c.deviceID)
+		if assert.NoError(t, err) && assert.True(t, ok) {
+			assert.Equal(t, c.slot, slot, "device ID %s", c.deviceID)
+		}
+	}
+
+	_, ok, err := mapping.Slot("gridion", "Z1")
+	assert.True(t, ok)
+	assert.Error(t, err, "an unrecognised device ID was accepted")
+
+	_, ok, err = mapping.Slot("minion", "MN12345")
+	assert.NoError(t, err)
+	assert.False(t, ok, "expected no slot for an unknown device type")
+}
+
+func TestParseSlotMapping(t *testing.T) {
+	mapping, err := ParseSlotMapping(strings.NewReader(`[
+  {"device_type": "p2*",
+   "rules": [{"pattern": "^P2S-\\d+-([AB])$", "slot": "$1"}]},
+  {"device_type": "*",
+   "rules": [{"map": {"a": "1"}}]}
+]`))
+	if assert.NoError(t, err) {
+		slot, ok, err := mapping.Slot("p2_solo", "P2S-01234-B")
+		if assert.NoError(t, err) && assert.True(t, ok) {
+			assert.Equal(t, "B", slot)
+		}
+
+		// The first matching device type is used
+		_, ok, err = mapping.Slot("p2_solo", "a")
+		assert.True(t, ok)
+		assert.Error(t, err)
+
+		slot, ok, err = mapping.Slot("minion", "a")
+		if assert.NoError(t, err) && assert.True(t, ok) {
+			assert.Equal(t, "1", slot)
+		}
+	}
+
+	for _, invalid := range []string{
+		`{}`,
+		`[{"device_type": "", "rules": []}]`,
+		`[{"device_type": "[", "rules": []}]`,
+		`[{"device_type": "x", "rules": [{"slot": "$1"}]}]`,
+		`[{"device_type": "x", "rules": [{"pattern": "(", "slot": "$1"}]}]`,
+		`[{"device_type": "x", "rules": [{"pattern": "a", "map": {}}]}]`,
+		`[{"device_type": "x", "rules": [], "unknown": 1}]`,
+	} {
+		_, err = ParseSlotMapping(strings.NewReader(invalid))
+		assert.Error(t, err, "invalid slot mapping %s was accepted", invalid)
+	}
+}
+
+func TestReportSlotMapping(t *testing.T) {
+	mapping, err := ParseSlotMapping(strings.NewReader(
+		`[{"device_type": "minion", "rules": [{"pattern": "^MN", "slot": "1"}]}]`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	rc, err := MakeReportConfig(ReportParams{SlotMapping: mapping})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	report := MinKNOWReport{DeviceID: "MN12345", DeviceType: "minion"}
+	metadata, err := report.AsEnhancedMetadata(rc)
+	if assert.NoError(t, err) {
+		assert.Contains(t, metadata,
+			ex.AVU{Attr: "ont:instrument_slot", Value: "1"})
+	}
+
+	// GridION is no longer mapped
+	report = MinKNOWReport{DeviceID: "X1", DeviceType: "gridion"}
+	metadata, err = report.AsEnhancedMetadata(rc)
+	if assert.NoError(t, err) {
+		for _, avu := range metadata {
+			assert.NotEqual(t, "ont:instrument_slot", avu.Attr)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file statcache.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// statCache records the results of os.Stat on the sidecar files of a FilePath
+// e.g. its checksum file, and the results of Memoized predicates, for the
+// duration of a single predicate evaluation.
+//
+// The methods of a nil *statCache do not cache, so that a FilePath without a
+// cache stats its sidecar files every time.
+type statCache struct {
+	mu      sync.Mutex
+	results map[string]statResult
+	memos   map[memoKey]memoResult
+}
+
+type statResult struct {
+	info os.FileInfo
+	err  error
+}
+
+// memoKey identifies the result of a Memoized predicate for a file.
+type memoKey struct {
+	id       uint64 // Identifies the Memoized predicate
+	location string // The Location of the file
+}
+
+type memoResult struct {
+	ok  bool
+	err error
+}
+
+// The source of identities for Memoized predicates.
+var memoIDs atomic.Uint64
+
+// WithStatCache returns a predicate that evaluates pred with a new cache of
+// the results of stat-ing the sidecar files of its argument. However many of
+// the component predicates of pred test a sidecar file, it is stat-ed at most
+// once. Similarly, each Memoized component predicate is evaluated at most once
+// per file. The cache is discarded once pred returns, so that each evaluation
+// sees the current state of the filesystem.
+func WithStatCache(pred FilePredicate) FilePredicate {
+	return func(path FilePath) (bool, error) {
+		path.stats = &statCache{
+			results: make(map[string]statResult),
+			memos:   make(map[memoKey]memoResult),
+		}
+		return pred(path)
+	}
+}
+
+// Memoize returns a predicate that evaluates pred once per file, by Location,
+// within a single evaluation of an enclosing WithStatCache predicate, however
+// many times it is used in a composition e.g. where the same costly predicate
+// is a component of several others. Its result, or error, is reused for the
+// rest of that evaluation only; results are never shared between evaluations,
+// or between files, so that each evaluation sees the current state of the
+// filesystem and the archive.
+//
+// Outside WithStatCache, pred is evaluated every time. Memoize should only
+// wrap predicates whose result cannot be changed by the evaluation itself.
+func Memoize(pred FilePredicate) FilePredicate {
+	id := memoIDs.Add(1)
+
+	return func(path FilePath) (bool, error) {
+		c := path.stats
+		if c == nil {
+			return pred(path)
+		}
+
+		key := memoKey{id: id, location: path.Location}
+
+		c.mu.Lock()
+		r, ok := c.memos[key]
+		c.mu.Unlock()
+		if ok {
+			return r.ok, r.err
+		}
+
+		// Not locked while pred is evaluated, because pred may use the cache
+		r.ok, r.err = pred(path)
+
+		c.mu.Lock()
+		c.memos[key] = r
+		c.mu.Unlock()
+
+		return r.ok, r.err
+	}
+}
+
+// stat returns the result of os.Stat on name, from the cache if name has been
+// stat-ed before.
+func (c *statCache) stat(name string) (os.FileInfo, error) {
+	if c == nil {
+		return os.Stat(name)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if r, ok := c.results[name]; ok {
+		return r.info, r.err
+	}
+
+	info, err := os.Stat(name)
+	c.results[name] = statResult{info, err}
+
+	return info, err
+}
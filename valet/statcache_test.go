@@ -0,0 +1,164 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file statcache_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wtsi-npg/valet/utilities"
+)
+
+func TestWithStatCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	dataFile, checksumFile :=
+		filepath.Join(tmpDir, "reads1.fast5"),
+		filepath.Join(tmpDir, "reads1.fast5.md5")
+
+	for src, dst := range map[string]string{
+		"./testdata/valet/1/reads/fast5/reads1.fast5":     dataFile,
+		"./testdata/valet/1/reads/fast5/reads1.fast5.md5": checksumFile,
+	} {
+		if !assert.NoError(t, utilities.CopyFile(src, dst, 0600)) {
+			return
+		}
+	}
+
+	path, _ := NewFilePath(dataFile)
+
+	// The checksum file is removed part way through an evaluation, but the
+	// evaluation continues to see the result of its first stat
+	var before, after bool
+	pred := WithStatCache(func(path FilePath) (bool, error) {
+		var err error
+		if before, err = defaultChecksums.HasChecksumFile(path); err != nil {
+			return false, err
+		}
+		if err = os.Remove(checksumFile); err != nil {
+			return false, err
+		}
+		after, err = defaultChecksums.HasChecksumFile(path)
+		return after, err
+	})
+
+	ok, err := pred(path)
+	if assert.NoError(t, err) {
+		assert.True(t, ok)
+		assert.True(t, before, "expected a checksum file")
+		assert.True(t, after, "expected the cached stat to be used")
+	}
+
+	// A new evaluation sees the current state
+	ok, err = WithStatCache(defaultChecksums.HasChecksumFile)(path)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected the checksum file to be gone")
+	}
+
+	// Without a cache, every test stats the sidecar file
+	ok, err = defaultChecksums.HasChecksumFile(path)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected the checksum file to be gone")
+	}
+}
+
+func TestStatCacheNil(t *testing.T) {
+	var c *statCache
+	_, err := c.stat("./testdata/valet/1/reads/fast5/reads1.fast5")
+	assert.NoError(t, err)
+
+	_, err = c.stat("./testdata/valet/1/reads/fast5/no_such_file")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestMemoize(t *testing.T) {
+	path, err := NewFilePath("./testdata/valet/1/reads/fast5/reads1.fast5")
+	if !assert.NoError(t, err) {
+		return
+	}
+	other, err := NewFilePath("./testdata/valet/1/reads/fastq/reads1.fastq")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var numCalls int
+	counted := Memoize(func(path FilePath) (bool, error) {
+		numCalls++
+		return true, nil
+	})
+
+	// The same sub-predicate is used several times in a composition
+	pred := And(counted, Or(Not(counted), counted), counted)
+
+	ok, err := WithStatCache(pred)(path)
+	if assert.NoError(t, err) {
+		assert.True(t, ok)
+		assert.Equal(t, 1, numCalls, "expected one call per evaluation")
+	}
+
+	// Results are not shared between evaluations
+	_, err = WithStatCache(pred)(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, numCalls)
+	}
+
+	// Nor between files within an evaluation
+	_, err = WithStatCache(func(fp FilePath) (bool, error) {
+		if _, err := counted(fp); err != nil {
+			return false, err
+		}
+		other.stats = fp.stats
+		return counted(other)
+	})(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 4, numCalls)
+	}
+
+	// Without WithStatCache, there is no memoization
+	_, err = pred(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 8, numCalls)
+	}
+}
+
+func TestMemoizeError(t *testing.T) {
+	path, err := NewFilePath("./testdata/valet/1/reads/fast5/reads1.fast5")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var numCalls int
+	failing := Memoize(func(path FilePath) (bool, error) {
+		numCalls++
+		return false, errors.New("predicate failed")
+	})
+
+	// The error is reused, as well as the result
+	_, err = WithStatCache(func(fp FilePath) (bool, error) {
+		_, _ = failing(fp)
+		return failing(fp)
+	})(path)
+	assert.Error(t, err)
+	assert.Equal(t, 1, numCalls)
+}
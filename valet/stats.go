@@ -0,0 +1,68 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file stats.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"sync/atomic"
+)
+
+// ArchiveStats counts the data objects and bytes archived. It is safe for
+// concurrent use by the WorkFuncs of a WorkPlan.
+//
+// The methods of a nil *ArchiveStats do nothing, so that counting may be
+// disabled by using nil.
+type ArchiveStats struct {
+	numObjects atomic.Uint64 // The number of data objects archived
+	numBytes   atomic.Uint64 // The number of bytes archived
+}
+
+// NewArchiveStats returns a new ArchiveStats with zero counts.
+func NewArchiveStats() *ArchiveStats {
+	return &ArchiveStats{}
+}
+
+// Add records that a data object of size bytes has been archived.
+func (s *ArchiveStats) Add(size int64) {
+	if s == nil {
+		return
+	}
+
+	s.numObjects.Add(1)
+	if size > 0 {
+		s.numBytes.Add(uint64(size))
+	}
+}
+
+// NumObjects returns the number of data objects archived.
+func (s *ArchiveStats) NumObjects() uint64 {
+	if s == nil {
+		return 0
+	}
+	return s.numObjects.Load()
+}
+
+// NumBytes returns the number of bytes archived.
+func (s *ArchiveStats) NumBytes() uint64 {
+	if s == nil {
+		return 0
+	}
+	return s.numBytes.Load()
+}
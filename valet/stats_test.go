@@ -0,0 +1,58 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file stats_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveStats(t *testing.T) {
+	stats := NewArchiveStats()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				stats.Add(1024)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, uint64(1000), stats.NumObjects())
+	assert.Equal(t, uint64(1000*1024), stats.NumBytes())
+
+	stats.Add(0)
+	assert.Equal(t, uint64(1001), stats.NumObjects())
+	assert.Equal(t, uint64(1000*1024), stats.NumBytes())
+}
+
+func TestArchiveStatsNil(t *testing.T) {
+	var stats *ArchiveStats
+	stats.Add(1024)
+	assert.Equal(t, uint64(0), stats.NumObjects())
+	assert.Equal(t, uint64(0), stats.NumBytes())
+}
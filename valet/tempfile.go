@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file tempfile.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	logs "github.com/wtsi-npg/logshim"
+
+	"github.com/wtsi-npg/valet/utilities"
+)
+
+// TempFilePrefix is the prefix of the names of the temporary files created by
+// valet e.g. while compressing files.
+const TempFilePrefix = "valet-"
+
+// DefaultTempFileAge is the default age after which a valet temporary file is
+// considered to have been orphaned by an interrupted process.
+const DefaultTempFileAge = 24 * time.Hour
+
+// tempFileRegex matches the names of temporary files created by os.CreateTemp
+// with TempFilePrefix as pattern i.e. the prefix followed by a random number.
+var tempFileRegex = regexp.MustCompile("^" + regexp.QuoteMeta(TempFilePrefix) +
+	`[0-9]+$`)
+
+// createTempFile creates a new valet temporary file in the temp directory.
+func createTempFile() (*os.File, error) {
+	return os.CreateTemp(os.TempDir(), TempFilePrefix)
+}
+
+// FindStaleTempFiles returns the paths of valet temporary files directly
+// within dir which have not been modified for longer than age. Only regular
+// files named by valet (TempFilePrefix followed by a random number) are
+// returned.
+func FindStaleTempFiles(dir string, age time.Duration) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []string
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !tempFileRegex.MatchString(e.Name()) {
+			continue
+		}
+
+		info, ierr := e.Info()
+		if ierr != nil {
+			if os.IsNotExist(ierr) {
+				continue
+			}
+			return stale, ierr
+		}
+
+		if time.Since(info.ModTime()) > age {
+			stale = append(stale, filepath.Join(dir, e.Name()))
+		}
+	}
+
+	return stale, nil
+}
+
+// RemoveStaleTempFiles removes the valet temporary files directly within dir
+// which have not been modified for longer than age (see FindStaleTempFiles).
+// It returns the paths of the files removed.
+func RemoveStaleTempFiles(dir string, age time.Duration) ([]string, error) {
+	stale, err := FindStaleTempFiles(dir, age)
+	if err != nil {
+		return nil, err
+	}
+
+	log := logs.GetLogger()
+
+	var removed []string
+	for _, path := range stale {
+		rerr := os.Remove(path)
+		if rerr != nil {
+			if !os.IsNotExist(rerr) {
+				err = utilities.CombineErrors(err, rerr)
+			}
+			continue
+		}
+
+		log.Info().Str("path", path).Msg("removed stale temporary file")
+		removed = append(removed, path)
+	}
+
+	return removed, err
+}
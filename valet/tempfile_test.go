@@ -0,0 +1,68 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file tempfile_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveStaleTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+
+	stale := filepath.Join(dir, "valet-123456")
+	recent := filepath.Join(dir, "valet-654321")
+	for name, mtime := range map[string]time.Time{
+		stale:                                  old,
+		recent:                                 time.Now(),
+		filepath.Join(dir, "valet-notours"):    old, // Not a valet temp name
+		filepath.Join(dir, "other-123456"):     old, // Another program's prefix
+		filepath.Join(dir, ".valet-archived"):  old,
+		filepath.Join(dir, "valet-123456.md5"): old,
+	} {
+		if !assert.NoError(t, os.WriteFile(name, []byte{}, 0600)) ||
+			!assert.NoError(t, os.Chtimes(name, mtime, mtime)) {
+			return
+		}
+	}
+
+	found, err := FindStaleTempFiles(dir, 24*time.Hour)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{stale}, found)
+	}
+
+	removed, err := RemoveStaleTempFiles(dir, 24*time.Hour)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{stale}, removed)
+		assert.NoFileExists(t, stale)
+		assert.FileExists(t, recent)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if assert.NoError(t, err) {
+		assert.Len(t, entries, 5)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file trace.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+)
+
+// TracerName is the name of the OpenTelemetry tracer that creates valet's
+// spans.
+const TracerName = "github.com/wtsi-npg/valet"
+
+// tracer creates the spans covering the work on each file and on each step of
+// it. Tracing depends on OpenTelemetry only in builds with the otlp tag, where
+// it is enabled by SetTracerProvider.
+type tracer interface {
+	// startFile starts a span covering the work on path, as a child of any
+	// span in ctx.
+	startFile(ctx context.Context, path FilePath) (context.Context, span)
+
+	// startWork starts a child span of ctx covering the work of wm on path.
+	startWork(ctx context.Context, path FilePath, wm WorkMatch) span
+}
+
+// span covers some work, started by a tracer.
+type span interface {
+	// end ends the span, recording err, if not nil.
+	end(err error)
+}
+
+// noopTracer is a tracer whose spans do nothing.
+type noopTracer struct{}
+
+type noopSpan struct{}
+
+func (noopTracer) startFile(ctx context.Context,
+	_ FilePath) (context.Context, span) {
+	return ctx, noopSpan{}
+}
+
+func (noopTracer) startWork(_ context.Context, _ FilePath, _ WorkMatch) span {
+	return noopSpan{}
+}
+
+func (noopSpan) end(_ error) {}
+
+// fileTracer creates the spans covering the work on each file. It is a no-op
+// unless tracing is enabled.
+var fileTracer tracer = noopTracer{}
+
+// startFileSpan starts a span covering the work on path, as a child of any
+// span in ctx.
+func startFileSpan(ctx context.Context, path FilePath) (context.Context, span) {
+	return fileTracer.startFile(ctx, path)
+}
+
+// startWorkSpan starts a child span of ctx covering the work of wm on path.
+func startWorkSpan(ctx context.Context, path FilePath, wm WorkMatch) span {
+	return fileTracer.startWork(ctx, path, wm)
+}
+
+// endSpan ends s, recording err, if not nil.
+func endSpan(s span, err error) {
+	s.end(err)
+}
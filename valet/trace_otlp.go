@@ -0,0 +1,82 @@
+//go:build otlp
+
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file trace_otlp.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// otelTracer is a tracer whose spans are created by an OpenTelemetry tracer.
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+// otelSpan is a span that is an OpenTelemetry span.
+type otelSpan struct {
+	span trace.Span
+}
+
+// SetTracerProvider enables tracing of the work on each file, with spans
+// created by a tracer from tp. It should be called before processing starts.
+//
+// When tracing is enabled, a span is created for each file worked on by
+// DoProcessFiles, with a child span for each WorkFunc of its WorkPlan.
+func SetTracerProvider(tp trace.TracerProvider) {
+	fileTracer = otelTracer{tp.Tracer(TracerName,
+		trace.WithInstrumentationVersion(Version))}
+}
+
+func (t otelTracer) startFile(ctx context.Context,
+	path FilePath) (context.Context, span) {
+	ctx, s := t.tracer.Start(ctx, "process file")
+	if s.IsRecording() {
+		s.SetAttributes(attribute.String("file.path", path.Location),
+			attribute.Int64("file.size", fileSize(path)))
+	}
+
+	return ctx, otelSpan{s}
+}
+
+func (t otelTracer) startWork(ctx context.Context, path FilePath,
+	wm WorkMatch) span {
+	_, s := t.tracer.Start(ctx, wm.workDoc)
+	if s.IsRecording() {
+		s.SetAttributes(attribute.String("file.path", path.Location),
+			attribute.String("valet.work", wm.String()),
+			attribute.Int("valet.rank", int(wm.work.Rank)))
+	}
+
+	return otelSpan{s}
+}
+
+func (s otelSpan) end(err error) {
+	if err != nil && s.span.IsRecording() {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
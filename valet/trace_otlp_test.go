@@ -0,0 +1,90 @@
+//go:build otlp
+
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file trace_otlp_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestDoProcessFilesTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(recorder)))
+	defer SetTracerProvider(noop.NewTracerProvider())
+
+	p := filepath.Join(t.TempDir(), "file")
+	if !assert.NoError(t, os.WriteFile(p, []byte("file"), 0644)) {
+		return
+	}
+	fp, err := NewFilePath(p)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	isTrue := func(path FilePath) (bool, error) { return true, nil }
+	plan := WorkPlan{
+		WorkMatch{pred: isTrue, predDoc: "true", workDoc: "Succeed",
+			work: Work{WorkFunc: func(path FilePath) error { return nil },
+				Rank: 1}},
+		WorkMatch{pred: isTrue, predDoc: "true", workDoc: "Fail",
+			work: Work{WorkFunc: func(path FilePath) error {
+				return errors.New("failed")
+			}, Rank: 2}},
+	}
+
+	ch := make(chan FilePath, 1)
+	ch <- fp
+	close(ch)
+
+	assert.Error(t, DoProcessFiles(context.Background(), ch,
+		ProcessParams{Plan: plan, MaxProc: 1}))
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+
+	// Child spans end before their parent
+	succeed, fail, file := spans[0], spans[1], spans[2]
+	assert.Equal(t, "Succeed", succeed.Name())
+	assert.Equal(t, "Fail", fail.Name())
+	assert.Equal(t, "process file", file.Name())
+
+	for _, span := range []sdktrace.ReadOnlySpan{succeed, fail} {
+		assert.Equal(t, file.SpanContext().SpanID(), span.Parent().SpanID())
+	}
+
+	assert.Equal(t, codes.Unset, succeed.Status().Code)
+	assert.Equal(t, codes.Error, fail.Status().Code)
+	assert.Equal(t, codes.Error, file.Status().Code)
+}
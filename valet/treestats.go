@@ -0,0 +1,189 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file treestats.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"sort"
+	"time"
+
+	logs "github.com/wtsi-npg/logshim"
+)
+
+// OtherFileType is the type of files of none of the recognised types.
+const OtherFileType = "other"
+
+// ChecksumFileType is the type of checksum files.
+const ChecksumFileType = "checksum"
+
+// fileTypes are the recognised types of file, named by their suffixes, in the
+// order in which they are tested, after ChecksumFileType. Compressed files are
+// of the type of their uncompressed content, where that type supports
+// compression.
+var fileTypes = []struct {
+	name string
+	pred FilePredicate
+}{
+	{Fast5Suffix, IsFast5},
+	{POD5Suffix, IsPOD5},
+	{BLOW5Suffix, IsBLOW5},
+	{SLOW5Suffix, IsSLOW5},
+	{FastqSuffix, IsFastq},
+	{BAMSuffix, IsBAM},
+	{BAISuffix, IsBAI},
+	{BEDSuffix, IsBED},
+	{CSVSuffix, IsCSV},
+	{TSVSuffix, IsTSV},
+	{JSONSuffix, IsJSON},
+	{TxtSuffix, IsTxt},
+	{MarkdownSuffix, IsMarkdown},
+	{HTMLSuffix, IsHTML},
+	{PDFSuffix, IsPDF},
+}
+
+// TypeStats counts the files of one type.
+type TypeStats struct {
+	Type     string `json:"type"`      // The type of the files
+	NumFiles uint64 `json:"num_files"` // The number of files
+	NumBytes uint64 `json:"num_bytes"` // The total size of the files
+}
+
+// RunDirStats describes a MinKNOW run directory.
+type RunDirStats struct {
+	Path    string    `json:"path"`     // The path of the run directory
+	ModTime time.Time `json:"mod_time"` // The modification time of the directory
+}
+
+// TreeStats describes the files in a directory tree.
+type TreeStats struct {
+	NumFiles uint64      `json:"num_files"` // The number of regular files
+	NumBytes uint64      `json:"num_bytes"` // The total size of the regular files
+	Types    []TypeStats `json:"types"`     // The counts for each type, by name
+
+	// The numbers of files to be archived (see Selection) with and without an
+	// up-to-date checksum file.
+	NumWithChecksum    uint64 `json:"num_with_checksum"`
+	NumWithoutChecksum uint64 `json:"num_without_checksum"`
+
+	NumRunDirs uint64       `json:"num_run_dirs"` // The number of MinKNOW run directories
+	OldestRun  *RunDirStats `json:"oldest_run"`   // The least recently modified run directory
+	NewestRun  *RunDirStats `json:"newest_run"`   // The most recently modified run directory
+}
+
+// FileType returns the name of the recognised type of path, or OtherFileType.
+// Checksum files are those named as described by cf.
+func FileType(path FilePath, cf ChecksumFiles) string {
+	if ok, _ := cf.IsChecksumFile(path); ok {
+		return ChecksumFileType
+	}
+	for _, t := range fileTypes {
+		if ok, _ := t.pred(path); ok {
+			return t.name
+		}
+	}
+
+	return OtherFileType
+}
+
+// SummariseTree counts the regular files and MinKNOW run directories in the
+// paths channel, which is read until closed. The files to be archived are
+// those selected by sel. It only reads the filesystem, to test for checksum
+// files. Predicate errors are logged at debug level and the file concerned is
+// then counted as lacking a checksum file.
+func SummariseTree(paths <-chan FilePath, sel Selection) TreeStats {
+	sel = sel.OrBuiltIn()
+
+	var stats TreeStats
+	types := make(map[string]*TypeStats)
+
+	cf := sel.checksums
+	hasChecksum := And(cf.HasChecksumFile, Not(cf.HasStaleChecksumFile))
+	log := logs.GetLogger()
+
+	for path := range paths {
+		if path.Info == nil {
+			continue
+		}
+
+		if ok, _ := IsMinKNOWRunDir(path); ok {
+			stats.addRunDir(path)
+			continue
+		}
+		if !path.Info.Mode().IsRegular() {
+			continue
+		}
+
+		size := uint64(path.Info.Size())
+		stats.NumFiles++
+		stats.NumBytes += size
+
+		name := FileType(path, cf)
+		ts, ok := types[name]
+		if !ok {
+			ts = &TypeStats{Type: name}
+			types[name] = ts
+		}
+		ts.NumFiles++
+		ts.NumBytes += size
+
+		target, err := sel.RequiresCopying(path)
+		if err != nil {
+			log.Debug().Err(err).Str("path", path.Location).
+				Msg("failed to test whether the file is to be archived")
+			continue
+		}
+		if !target {
+			continue
+		}
+
+		ok, err = hasChecksum(path)
+		if err != nil {
+			log.Debug().Err(err).Str("path", path.Location).
+				Msg("failed to test for a checksum file")
+		}
+		if ok {
+			stats.NumWithChecksum++
+		} else {
+			stats.NumWithoutChecksum++
+		}
+	}
+
+	stats.Types = []TypeStats{}
+	for _, ts := range types {
+		stats.Types = append(stats.Types, *ts)
+	}
+	sort.Slice(stats.Types, func(i, j int) bool {
+		return stats.Types[i].Type < stats.Types[j].Type
+	})
+
+	return stats
+}
+
+func (s *TreeStats) addRunDir(path FilePath) {
+	s.NumRunDirs++
+
+	run := &RunDirStats{Path: path.Location, ModTime: path.Info.ModTime()}
+	if s.OldestRun == nil || run.ModTime.Before(s.OldestRun.ModTime) {
+		s.OldestRun = run
+	}
+	if s.NewestRun == nil || run.ModTime.After(s.NewestRun.ModTime) {
+		s.NewestRun = run
+	}
+}
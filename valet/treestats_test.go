@@ -0,0 +1,103 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file treestats_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileType(t *testing.T) {
+	for name, expected := range map[string]string{
+		"reads1.fastq":        FastqSuffix,
+		"reads1.fastq.gz":     FastqSuffix,
+		"reads1.fast5":        Fast5Suffix,
+		"alignments1.bam.bai": BAISuffix,
+		"reads1.fastq.md5":    ChecksumFileType,
+		"final_summary.dat":   OtherFileType,
+	} {
+		fp := FilePath{FileResource: FileResource{"/data/" + name}}
+		assert.Equal(t, expected, FileType(fp, defaultChecksums), name)
+	}
+}
+
+func TestSummariseTree(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	oldRun := filepath.Join(tmpDir, "expt", "sample",
+		"20190904_1514_GA20000_FAL01979_43578c8f")
+	newRun := filepath.Join(tmpDir, "expt", "sample",
+		"20190905_1514_GA20000_FAL01980_43578c8f")
+
+	for path, content := range map[string]string{
+		filepath.Join(oldRun, "reads1.fastq"):      "12345",
+		filepath.Join(newRun, "reads1.fast5.md5"):  "0123456789abcdef",
+		filepath.Join(oldRun, "reads2.fastq.gz"):   "123",
+		filepath.Join(newRun, "reads1.fast5"):      "1234567",
+		filepath.Join(newRun, "final_summary.dat"): "12",
+	} {
+		if !assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755)) ||
+			!assert.NoError(t, os.WriteFile(path, []byte(content), 0644)) {
+			return
+		}
+	}
+
+	// Make the checksum file up to date
+	future := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(filepath.Join(newRun, "reads1.fast5.md5"),
+		future, future))
+
+	oldTime := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(oldRun, oldTime, oldTime))
+
+	paths, errs := FindFiles(context.Background(), tmpDir, IsTrue, IsFalse)
+	go func() {
+		for err := range errs {
+			t.Log(err)
+		}
+	}()
+
+	stats := SummariseTree(paths, Selection{})
+
+	assert.Equal(t, uint64(5), stats.NumFiles)
+	assert.Equal(t, uint64(33), stats.NumBytes)
+	assert.Equal(t, []TypeStats{
+		{Type: ChecksumFileType, NumFiles: 1, NumBytes: 16},
+		{Type: Fast5Suffix, NumFiles: 1, NumBytes: 7},
+		{Type: FastqSuffix, NumFiles: 2, NumBytes: 8},
+		{Type: OtherFileType, NumFiles: 1, NumBytes: 2},
+	}, stats.Types)
+
+	// The uncompressed fastq is not archived as it is, but once compressed
+	assert.Equal(t, uint64(1), stats.NumWithChecksum)
+	assert.Equal(t, uint64(1), stats.NumWithoutChecksum)
+
+	assert.Equal(t, uint64(2), stats.NumRunDirs)
+	if assert.NotNil(t, stats.OldestRun) && assert.NotNil(t, stats.NewestRun) {
+		assert.Equal(t, oldRun, stats.OldestRun.Path)
+		assert.Equal(t, newRun, stats.NewestRun.Path)
+	}
+}
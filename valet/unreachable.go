@@ -0,0 +1,86 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file unreachable.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"github.com/pkg/errors"
+	ex "github.com/wtsi-npg/extendo/v2"
+
+	"github.com/wtsi-npg/valet/utilities"
+)
+
+// unreachableError is an error that occurred because the archive could not be
+// reached.
+type unreachableError struct {
+	err error
+}
+
+func (e *unreachableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unreachableError) Unwrap() error {
+	return e.err
+}
+
+// IsUnreachable returns true if err, or any error it wraps, occurred because
+// the archive could not be reached i.e. because no iRODS client could be
+// obtained from a pool (see getClient), or a client stopped during a call
+// (see returnClient). Errors returned by ProcessFiles and DoProcessFiles are
+// unreachable if any of the work errors counted by them were.
+func IsUnreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var e *unreachableError
+	return errors.As(err, &e)
+}
+
+// withUnreachable returns err, marked as unreachable if unreachable is true.
+func withUnreachable(err error, unreachable bool) error {
+	if err == nil || !unreachable {
+		return err
+	}
+
+	return &unreachableError{err}
+}
+
+// getClient returns a client from cPool (see GetClient). If none can be
+// obtained, the error is marked as unreachable.
+func getClient(cPool *ex.ClientPool) (*ex.Client, error) {
+	client, err := GetClient(cPool)
+	if err != nil {
+		return nil, &unreachableError{err}
+	}
+
+	return client, nil
+}
+
+// returnClient returns client to cPool and returns err, the error of the calls
+// made with the client, combined with any error returning it. If the client
+// stopped during those calls, err is marked as unreachable because the calls
+// failed for want of a client, rather than being refused by the archive.
+func returnClient(cPool *ex.ClientPool, client *ex.Client, err error) error {
+	err = withUnreachable(err, !client.IsRunning())
+
+	return utilities.CombineErrors(err, cPool.Return(client))
+}
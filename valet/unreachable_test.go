@@ -0,0 +1,104 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file unreachable_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	ex "github.com/wtsi-npg/extendo/v2"
+)
+
+func TestIsUnreachable(t *testing.T) {
+	assert.False(t, IsUnreachable(nil))
+	assert.False(t, IsUnreachable(errors.New("no such item")))
+
+	// An error that merely reads like that of a ClientPool is not unreachable
+	assert.False(t, IsUnreachable(errors.New("failed to get a client from "+
+		"the pool after 3 tries")))
+
+	// A client cannot be obtained from a closed pool
+	cPool := ex.NewClientPool(ex.DefaultClientPoolParams)
+	cPool.Close()
+	_, err := getClient(cPool)
+	if assert.Error(t, err) {
+		assert.True(t, IsUnreachable(errors.Wrap(err, "IsCopied")))
+	}
+
+	// A call fails because its client has stopped
+	stopped := &ex.Client{}
+	err = returnClient(ex.NewClientPool(ex.DefaultClientPoolParams), stopped,
+		errors.New("receiving failed"))
+	if assert.Error(t, err) {
+		assert.True(t, IsUnreachable(err))
+	}
+
+	marked := withUnreachable(errors.New("encountered 1 errors"), true)
+	assert.True(t, IsUnreachable(marked))
+	assert.True(t, IsUnreachable(errors.Wrap(marked, "processing")))
+	assert.Equal(t, "encountered 1 errors", marked.Error())
+	assert.False(t, IsUnreachable(withUnreachable(
+		errors.New("encountered 1 errors"), false)))
+}
+
+func TestDoProcessFilesUnreachable(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "reads1.fastq")
+	if !assert.NoError(t, os.WriteFile(file, []byte("ACGT"), 0600)) {
+		return
+	}
+
+	process := func(werr error) error {
+		fp, err := NewFilePath(file)
+		if err != nil {
+			return err
+		}
+
+		plan := WorkPlan{
+			WorkMatch{
+				pred: IsTrue,
+				work: Work{WorkFunc: func(path FilePath) error {
+					return werr
+				}},
+			},
+		}
+
+		ch := make(chan FilePath, 1)
+		ch <- fp
+		close(ch)
+
+		return DoProcessFiles(context.Background(), ch,
+			ProcessParams{Plan: plan, MaxProc: 1})
+	}
+
+	err := process(&unreachableError{errors.New("the client pool is closed")})
+	if assert.Error(t, err) {
+		assert.True(t, IsUnreachable(err))
+	}
+
+	err = process(errors.New("failed to archive"))
+	if assert.Error(t, err) {
+		assert.False(t, IsUnreachable(err))
+	}
+}
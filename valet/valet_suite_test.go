@@ -34,6 +34,7 @@ import (
 	ex "github.com/wtsi-npg/extendo/v2"
 
 	"github.com/wtsi-npg/valet/cmd"
+	"github.com/wtsi-npg/valet/utilities"
 	"github.com/wtsi-npg/valet/valet"
 )
 
@@ -73,6 +74,7 @@ var _ = Describe("Find directories", func() {
 			"1/reads/fast5",
 			"1/reads/fastq",
 			"1/reads/pod5",
+			"1/reads/slow5",
 			"testdir",
 		}
 
@@ -127,6 +129,8 @@ var _ = Describe("Find regular files", func() {
 				"1/reads/fastq/reads2.fastq.gz",
 				"1/reads/fastq/reads3.fastq",
 				"1/reads/pod5/reads1.pod5",
+				"1/reads/slow5/reads1.blow5",
+				"1/reads/slow5/reads1.slow5",
 				"report_ABQ808_20200204_1257_e2e93dd1.md",
 				"report_PAE48813_20200130_0940_16917585.md",
 				"report_PAH48449_20211215_1420_227842f4.md",
@@ -318,7 +322,7 @@ var _ = Describe("Find files at intervals", func() {
 		interval := 500 * time.Millisecond
 
 		paths, errs := valet.FindFilesInterval(cancelCtx, dataDir,
-			valet.IsRegular, valet.IsFalse, interval)
+			valet.IsRegular, valet.IsFalse, interval, 0)
 
 		// Find files or timeout and cancel
 		found := make(map[string]valet.FilePath) // FilePaths are not comparable
@@ -348,12 +352,8 @@ var _ = Describe("Find files at intervals", func() {
 
 		wg.Wait()
 
-		for range paths {
-			// Discard any remaining paths to unblock any sending goroutines
-			// started by FindFilesInterval (it can have a number running
-			// because it starts a new one at each interval). This closes the
-			// errs channel too.
-		}
+		// Cancellation stops the sweeps and closes the channels, without
+		// the remaining paths being drained
 		for err := range errs {
 			Expect(err).NotTo(HaveOccurred())
 		}
@@ -601,11 +601,8 @@ var _ = Describe("Find MinKNOW files", func() {
 		cancelCtx, cancel := context.WithCancel(context.Background())
 		paths, errs := valet.FindFiles(cancelCtx, dataDir, valet.IsDir, pruneFn)
 
-		absData, err := filepath.Abs(dataDir)
-		Expect(err).NotTo(HaveOccurred())
-
 		for path := range paths {
-			relPath, err := filepath.Rel(absData, path.Location)
+			relPath, err := path.RelativeTo(dataDir)
 			Expect(err).NotTo(HaveOccurred())
 			foundPaths = append(foundPaths, relPath)
 		}
@@ -628,6 +625,7 @@ var _ = Describe("IsCopied", func() {
 	var (
 		rootColl, workColl, remotePath string
 		isCopied                       valet.FilePredicate
+		remoteState                    valet.RemoteStateFunc
 		path                           valet.FilePath
 
 		clientPool *ex.ClientPool
@@ -668,7 +666,10 @@ var _ = Describe("IsCopied", func() {
 		local, err := filepath.Abs("testdata/valet/1/reads/fast5/")
 		Expect(err).NotTo(HaveOccurred())
 		// The predicate to be tested
-		isCopied = valet.MakeIsCopied(local, workColl, clientPool)
+		isCopied = valet.MakeIsCopied(local, workColl, clientPool,
+			valet.MD5Checksum, valet.ChecksumFiles{})
+		remoteState = valet.MakeRemoteState(local, workColl, clientPool,
+			valet.MD5Checksum, valet.ChecksumFiles{})
 	})
 
 	AfterEach(func() {
@@ -684,6 +685,7 @@ var _ = Describe("IsCopied", func() {
 	When("a data object exists with correct checksum and md5 metadata", func() {
 		It("is archived", func() {
 			Expect(isCopied(path)).To(BeTrue())
+			Expect(remoteState(path)).To(Equal(valet.RemoteComplete))
 		})
 	})
 
@@ -695,6 +697,7 @@ var _ = Describe("IsCopied", func() {
 
 		It("is not archived", func() {
 			Expect(isCopied(path)).To(BeFalse())
+			Expect(remoteState(path)).To(Equal(valet.RemoteAbsent))
 		})
 	})
 
@@ -708,6 +711,7 @@ var _ = Describe("IsCopied", func() {
 
 		It("is not archived", func() {
 			Expect(isCopied(path)).To(BeFalse())
+			Expect(remoteState(path)).To(Equal(valet.RemoteMetadataMismatch))
 		})
 	})
 
@@ -726,6 +730,7 @@ var _ = Describe("IsCopied", func() {
 
 		It("is not copied", func() {
 			Expect(isCopied(path)).To(BeFalse())
+			Expect(remoteState(path)).To(Equal(valet.RemoteMetadataMismatch))
 		})
 	})
 
@@ -738,6 +743,348 @@ var _ = Describe("IsCopied", func() {
 
 		It("is not copied", func() {
 			Expect(isCopied(path)).To(BeFalse())
+			Expect(remoteState(path)).To(Equal(valet.RemoteMismatch))
+		})
+
+		It("is reported, not archived again", func() {
+			local, err := filepath.Abs("testdata/valet/1/reads/fast5/")
+			Expect(err).NotTo(HaveOccurred())
+
+			plan, err := valet.ArchiveFilesWorkPlan(context.Background(),
+				valet.ArchiveParams{LocalBase: local, RemoteBase: workColl,
+					ClientPool: clientPool})
+			Expect(err).NotTo(HaveOccurred())
+
+			absPath, err := valet.NewFilePath(filepath.Join(local,
+				"reads1.fast5"))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = valet.ProcessFile(absPath, plan)
+			Expect(err).To(MatchError(ContainSubstring(
+				"does not match its checksum")))
+
+			// The mismatched data object is left in place
+			Expect(remoteState(path)).To(Equal(valet.RemoteMismatch))
+		})
+	})
+})
+
+var _ = Describe("Preserve modification times", func() {
+	var (
+		workColl, tmpDir string
+		path             valet.FilePath
+		mtime            = time.Date(2019, 9, 4, 15, 14, 0, 0, time.UTC)
+
+		clientPool *ex.ClientPool
+		client     *ex.Client
+	)
+
+	BeforeEach(func() {
+		tmpDir = GinkgoT().TempDir()
+		for _, name := range []string{"reads1.fast5", "reads1.fast5.md5"} {
+			err := utilities.CopyFile(
+				filepath.Join("testdata/valet/1/reads/fast5", name),
+				filepath.Join(tmpDir, name), 0600)
+			Expect(err).NotTo(HaveOccurred())
+			err = os.Chtimes(filepath.Join(tmpDir, name), mtime, mtime)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		var err error
+		path, err = valet.NewFilePath(filepath.Join(tmpDir, "reads1.fast5"))
+		Expect(err).NotTo(HaveOccurred())
+
+		workColl = tmpRodsPath("/testZone/home/irods", "ValetPreserveTimes")
+
+		poolParams := ex.DefaultClientPoolParams
+		poolParams.MaxSize = 2
+		poolParams.GetTimeout = time.Second
+
+		clientPool = ex.NewClientPool(poolParams)
+		client, err = clientPool.Get()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		err := removeTmpCollection(workColl)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = clientPool.Return(client)
+		Expect(err).NotTo(HaveOccurred())
+
+		clientPool.Close()
+	})
+
+	When("a file is archived", func() {
+		It("has the modification time of the file as metadata", func() {
+			copier := valet.MakeCopier(tmpDir, workColl, clientPool,
+				valet.MD5Checksum, nil, nil, nil,
+				valet.CopyOptions{PreserveTimes: true}, valet.ChecksumFiles{})
+			Expect(copier(path)).To(Succeed())
+
+			item, err := client.ListItem(ex.Args{AVU: true},
+				ex.RodsItem{IPath: workColl, IName: "reads1.fast5"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(item.IAVUs).To(ContainElement(ex.AVU{
+				Attr:  "valet:source_mtime",
+				Value: "2019-09-04T15:14:00Z"}))
+		})
+	})
+
+	When("a file is archived without preserving times", func() {
+		It("has no modification time metadata", func() {
+			copier := valet.MakeCopier(tmpDir, workColl, clientPool,
+				valet.MD5Checksum, nil, nil, nil, valet.CopyOptions{},
+				valet.ChecksumFiles{})
+			Expect(copier(path)).To(Succeed())
+
+			item, err := client.ListItem(ex.Args{AVU: true},
+				ex.RodsItem{IPath: workColl, IName: "reads1.fast5"})
+			Expect(err).NotTo(HaveOccurred())
+			for _, avu := range item.IAVUs {
+				Expect(avu.Attr).NotTo(Equal("valet:source_mtime"))
+			}
+		})
+	})
+})
+
+var _ = Describe("Archive bundles", func() {
+	var (
+		workColl, tmpDir, bundleDir string
+		dir                         valet.FilePath
+
+		clientPool *ex.ClientPool
+		client     *ex.Client
+
+		archiveBundle    valet.WorkFunc
+		isBundleArchived valet.FilePredicate
+		removeBundled    valet.WorkFunc
+
+		names = []string{"reads1.fast5", "reads2.fast5", "reads3.fast5"}
+	)
+
+	BeforeEach(func() {
+		tmpDir = GinkgoT().TempDir()
+		bundleDir = filepath.Join(tmpDir, "fast5_pass")
+		Expect(os.Mkdir(bundleDir, 0700)).To(Succeed())
+
+		for _, name := range names {
+			dst := filepath.Join(bundleDir, name)
+			err := utilities.CopyFile(
+				filepath.Join("testdata/valet/1/reads/fast5", name), dst, 0600)
+			Expect(err).NotTo(HaveOccurred())
+
+			fp, err := valet.NewFilePath(dst)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(valet.ChecksumFiles{}.CreateMD5ChecksumFile(fp)).To(Succeed())
+		}
+
+		var err error
+		dir, err = valet.NewFilePath(bundleDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		workColl = tmpRodsPath("/testZone/home/irods", "ValetArchiveBundles")
+
+		poolParams := ex.DefaultClientPoolParams
+		poolParams.MaxSize = 2
+		poolParams.GetTimeout = time.Second
+
+		clientPool = ex.NewClientPool(poolParams)
+		client, err = clientPool.Get()
+		Expect(err).NotTo(HaveOccurred())
+
+		sel, err := valet.MakeSelection(valet.SelectParams{})
+		Expect(err).NotTo(HaveOccurred())
+
+		archiveBundle = valet.MakeTarArchiver(tmpDir, workColl, clientPool,
+			valet.MD5Checksum, nil, nil, nil, valet.CopyOptions{}, sel)
+		isBundleArchived = valet.MakeIsBundleArchived(tmpDir, workColl,
+			clientPool, valet.MD5Checksum, sel)
+		removeBundled = valet.MakeBundledFileRemover(tmpDir, workColl,
+			clientPool, valet.MD5Checksum, sel)
+	})
+
+	AfterEach(func() {
+		err := removeTmpCollection(workColl)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = clientPool.Return(client)
+		Expect(err).NotTo(HaveOccurred())
+
+		clientPool.Close()
+	})
+
+	When("a directory has not been bundled", func() {
+		It("is not archived", func() {
+			Expect(isBundleArchived(dir)).To(BeFalse())
+		})
+
+		It("does not have its files removed", func() {
+			Expect(removeBundled(dir)).NotTo(Succeed())
+			for _, name := range names {
+				Expect(filepath.Join(bundleDir, name)).To(BeAnExistingFile())
+			}
+		})
+	})
+
+	When("a directory is bundled", func() {
+		BeforeEach(func() {
+			Expect(archiveBundle(dir)).To(Succeed())
+		})
+
+		It("is archived as a tar data object with a valid checksum", func() {
+			Expect(isBundleArchived(dir)).To(BeTrue())
+
+			item, err := client.ListItem(ex.Args{AVU: true, Checksum: true},
+				ex.RodsItem{IPath: workColl, IName: "fast5_pass.tar"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(item.IChecksum).NotTo(BeEmpty())
+			Expect(item.IAVUs).To(ContainElement(ex.AVU{
+				Attr:  "valet:num_files",
+				Value: "3"}))
+		})
+
+		It("is not replaced by a bundle with different contents", func() {
+			extra := filepath.Join(bundleDir, "reads4.fast5")
+			err := utilities.CopyFile(
+				filepath.Join("testdata/valet/1/reads/fast5", "reads1.fast5"),
+				extra, 0600)
+			Expect(err).NotTo(HaveOccurred())
+			fp, err := valet.NewFilePath(extra)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(valet.ChecksumFiles{}.CreateMD5ChecksumFile(fp)).To(Succeed())
+
+			Expect(isBundleArchived(dir)).To(BeFalse())
+			Expect(archiveBundle(dir)).NotTo(Succeed())
+		})
+
+		It("has its bundled files removed", func() {
+			Expect(removeBundled(dir)).To(Succeed())
+			for _, name := range names {
+				file := filepath.Join(bundleDir, name)
+				Expect(file).NotTo(BeAnExistingFile())
+				Expect(file + ".md5").NotTo(BeAnExistingFile())
+			}
+		})
+
+		It("keeps files added since it was bundled", func() {
+			extra := filepath.Join(bundleDir, "reads4.fast5")
+			err := utilities.CopyFile(
+				filepath.Join("testdata/valet/1/reads/fast5", "reads1.fast5"),
+				extra, 0600)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(removeBundled(dir)).NotTo(Succeed())
+			Expect(extra).To(BeAnExistingFile())
+			for _, name := range names {
+				Expect(filepath.Join(bundleDir, name)).To(BeAnExistingFile())
+			}
+		})
+
+		It("keeps files changed since they were bundled", func() {
+			changed := filepath.Join(bundleDir, "reads1.fast5")
+			Expect(os.WriteFile(changed, []byte("changed"), 0600)).
+				To(Succeed())
+
+			Expect(removeBundled(dir)).NotTo(Succeed())
+			Expect(changed).To(BeAnExistingFile())
+		})
+	})
+})
+
+var _ = Describe("ChecksumBackfiller", func() {
+	var (
+		tmpDir, workColl, remotePath string
+		backfill                     valet.WorkFunc
+		path                         valet.FilePath
+
+		clientPool *ex.ClientPool
+		client     *ex.Client
+
+		localPath = "testdata/valet/1/reads/fast5/reads1.fast5"
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "ValetChecksumBackfiller")
+		Expect(err).NotTo(HaveOccurred())
+
+		dataFile := filepath.Join(tmpDir, "reads1.fast5")
+		err = utilities.CopyFile(localPath, dataFile, 0600)
+		Expect(err).NotTo(HaveOccurred())
+
+		path, err = valet.NewFilePath(dataFile)
+		Expect(err).NotTo(HaveOccurred())
+
+		workColl = tmpRodsPath("/testZone/home/irods", "ValetBackfill")
+		remotePath = filepath.Join(workColl, "reads1.fast5")
+
+		poolParams := ex.DefaultClientPoolParams
+		poolParams.MaxSize = 2
+		poolParams.GetTimeout = time.Second
+
+		clientPool = ex.NewClientPool(poolParams)
+		client, err = clientPool.Get()
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = ex.MakeCollection(client, workColl)
+		Expect(err).NotTo(HaveOccurred())
+
+		backfill = valet.MakeChecksumBackfiller(tmpDir, workColl, clientPool,
+			valet.MD5Checksum, valet.ChecksumFiles{})
+	})
+
+	AfterEach(func() {
+		err := removeTmpCollection(workColl)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = clientPool.Return(client)
+		Expect(err).NotTo(HaveOccurred())
+
+		clientPool.Close()
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	When("a data object exists with correct checksum and md5 metadata", func() {
+		BeforeEach(func() {
+			obj, err := ex.PutDataObject(client, localPath, remotePath)
+			Expect(err).NotTo(HaveOccurred())
+			err = obj.AddMetadata([]ex.AVU{{
+				Attr:  "md5",
+				Value: "1181c1834012245d785120e3505ed169"}})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("creates the checksum file", func() {
+			Expect(backfill(path)).To(Succeed())
+
+			chkFile, err := valet.NewFilePath(
+				valet.ChecksumFiles{}.ChecksumFilename(path))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(valet.ReadMD5ChecksumFile(chkFile)).
+				To(Equal([]byte("1181c1834012245d785120e3505ed169")))
+		})
+	})
+
+	When("a data object does not exist", func() {
+		It("skips the file", func() {
+			Expect(backfill(path)).To(Succeed())
+			Expect(valet.ChecksumFiles{}.ChecksumFilename(path)).
+				NotTo(BeAnExistingFile())
+		})
+	})
+
+	When("a data object exists, but has a mismatched checksum", func() {
+		BeforeEach(func() {
+			wrongFile := "testdata/valet/1/reads/fast5/reads2.fast5"
+			_, err := ex.PutDataObject(client, wrongFile, remotePath)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("fails without creating the checksum file", func() {
+			Expect(backfill(path)).NotTo(Succeed())
+			Expect(valet.ChecksumFiles{}.ChecksumFilename(path)).
+				NotTo(BeAnExistingFile())
 		})
 	})
 })
@@ -787,19 +1134,22 @@ var _ = Describe("IsAnnotated", func() {
 			{Attr: "ont:distribution_version", Value: "19.12.2"},
 			{Attr: "ont:experiment_name", Value: "85"},
 			{Attr: "ont:flowcell_id", Value: "ABQ808"},
+			{Attr: "ont:flowcell_product_code", Value: "FLO-FLG001"},
 			{Attr: "ont:guppy_version", Value: "3.2.8+bd67289"},
 			{Attr: "ont:hostname", Value: "GXB02004"},
 			{Attr: "ont:instrument_slot", Value: "2"},
 			{Attr: "ont:protocol_group_id", Value: "85"},
 			{Attr: "ont:run_id", Value: "5531cbcf622d2d98dbff00af0261c6f19f91340f"},
 			{Attr: "ont:sample_id", Value: "DN615089W_B1"},
+			{Attr: "ont:started_at", Value: "2020-02-04T12:57:07Z"},
 		})
 		Expect(err).NotTo(HaveOccurred())
 
 		local, err := filepath.Abs("testdata/valet/")
 		Expect(err).NotTo(HaveOccurred())
 		// The predicate to be tested
-		isAnnotated = valet.MakeIsAnnotated(local, workColl, clientPool)
+		isAnnotated = valet.MakeIsAnnotated(local, workColl, clientPool,
+			valet.ReportConfig{})
 	})
 
 	AfterEach(func() {
@@ -855,6 +1205,35 @@ var _ = Describe("IsAnnotated", func() {
 			Expect(isAnnotated(path)).To(BeFalse())
 		})
 	})
+
+	When("a metadata AVU value has changed", func() {
+		stale := ex.AVU{Attr: "ont:guppy_version", Value: "3.0.0+1a2b3c4"}
+		other := ex.AVU{Attr: "user:study_id", Value: "1234"}
+
+		BeforeEach(func() {
+			err := coll.AddMetadata([]ex.AVU{stale, other})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("is not annotated", func() {
+			Expect(isAnnotated(path)).To(BeFalse())
+		})
+
+		It("is annotated once annotated again, without the stale AVU", func() {
+			report, err := valet.ParseMinKNOWReport(localPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = valet.AddMinKNOWReportAnnotation(obj, report,
+				valet.ReportConfig{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(isAnnotated(path)).To(BeTrue())
+
+			avus, err := coll.FetchMetadata()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(avus).NotTo(ContainElement(stale))
+			Expect(avus).To(ContainElement(other))
+		})
+	})
 })
 
 var _ = Describe("Archive MinKNOW files", func() {
@@ -867,6 +1246,8 @@ var _ = Describe("Archive MinKNOW files", func() {
 
 		rootColl = "/testZone/home/irods"
 		dataDir  = "testdata/platform/ont/minknow/gridion"
+		userMeta = []ex.AVU{{Attr: "user:study_id", Value: "1234"}}
+		grants   = []ex.ACL{{Owner: "public", Level: "read"}}
 
 		collPath   = "66/DN585561I_A1/20190904_1514_GA20000_FAL01979_43578c8f"
 		bmFailColl = collPath + "/bam_fail"
@@ -985,8 +1366,20 @@ var _ = Describe("Archive MinKNOW files", func() {
 		perr := make(chan error, 1)
 
 		go func() {
-			plan := valet.ArchiveFilesWorkPlan(tmpDir, workColl,
-				clientPool, deleteLocal, cleanup)
+			plan, err := valet.ArchiveFilesWorkPlan(cancelCtx,
+				valet.ArchiveParams{
+					LocalBase:    tmpDir,
+					RemoteBase:   workColl,
+					ClientPool:   clientPool,
+					DeleteLocal:  deleteLocal,
+					CleanupDelay: cleanup,
+					Metadata:     userMeta,
+					ACLs:         grants,
+				})
+			if err != nil {
+				perr <- err
+				return
+			}
 
 			matchFn := valet.Or(
 				valet.RequiresCopying,
@@ -1080,6 +1473,73 @@ var _ = Describe("Archive MinKNOW files", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Expect(remaining).To(BeEmpty())
 		})
+
+		It("should add user metadata to archived files", func() {
+			poolParams := ex.DefaultClientPoolParams
+			poolParams.MaxSize = 1
+			poolParams.GetTimeout = time.Second
+			clientPool := ex.NewClientPool(poolParams)
+
+			client, err := clientPool.Get()
+			Expect(err).NotTo(HaveOccurred())
+
+			obj := ex.NewDataObject(client, filepath.Join(workColl, collPath,
+				"report_FAL01979_20190904_1514_43578c8f.pdf"))
+			avus, err := obj.FetchMetadata()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(avus).To(ContainElements(userMeta))
+			Expect(avus).To(ContainElement(
+				WithTransform(func(avu ex.AVU) string { return avu.Attr },
+					Equal(ex.ChecksumAttr))))
+		})
+
+		It("should add provenance metadata to archived files", func() {
+			poolParams := ex.DefaultClientPoolParams
+			poolParams.MaxSize = 1
+			poolParams.GetTimeout = time.Second
+			clientPool := ex.NewClientPool(poolParams)
+
+			client, err := clientPool.Get()
+			Expect(err).NotTo(HaveOccurred())
+
+			provenance, err := valet.ProvenanceMetadata()
+			Expect(err).NotTo(HaveOccurred())
+
+			obj := ex.NewDataObject(client, filepath.Join(workColl, collPath,
+				"report_FAL01979_20190904_1514_43578c8f.pdf"))
+			avus, err := obj.FetchMetadata()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(avus).To(ContainElements(provenance))
+		})
+
+		It("should add ACLs to archived files and their collections", func() {
+			poolParams := ex.DefaultClientPoolParams
+			poolParams.MaxSize = 1
+			poolParams.GetTimeout = time.Second
+			clientPool := ex.NewClientPool(poolParams)
+
+			client, err := clientPool.Get()
+			Expect(err).NotTo(HaveOccurred())
+
+			ownerLevel := func(acl ex.ACL) string {
+				return acl.Owner + ":" + acl.Level
+			}
+
+			obj := ex.NewDataObject(client, filepath.Join(workColl, collPath,
+				"report_FAL01979_20190904_1514_43578c8f.pdf"))
+			acls, err := obj.FetchACLs()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(acls).To(ContainElement(WithTransform(ownerLevel,
+				Equal("public:read"))))
+
+			for _, path := range []string{collPath, "66"} {
+				coll := ex.NewCollection(client, filepath.Join(workColl, path))
+				acls, err = coll.FetchACLs()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(acls).To(ContainElement(WithTransform(ownerLevel,
+					Equal("public:read"))))
+			}
+		})
 	})
 })
 
@@ -1243,11 +1703,15 @@ var _ = Describe("Count files without a checksum", func() {
 
 	var (
 		numFilesFound    uint64
-		numFilesExpected uint64 = 15
+		numFilesExpected uint64 = 17
 	)
 
 	BeforeEach(func() {
-		n, err := cmd.CountFilesWithoutChecksum("testdata/valet", []string{})
+		sel, err := valet.MakeSelection(valet.SelectParams{})
+		Expect(err).NotTo(HaveOccurred())
+
+		n, err := cmd.CountFilesWithoutChecksum("testdata/valet", []string{},
+			sel)
 		Expect(err).NotTo(HaveOccurred())
 		numFilesFound = n
 	})
@@ -0,0 +1,118 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file window.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WorkWindow is a daily window of time, in a particular time zone, during
+// which Windowed Work may be done e.g. 20:00-06:00 for overnight. Outside the
+// window, DoProcessFiles skips Windowed Work, while doing any other Work.
+//
+// The methods of a nil *WorkWindow behave as if the window is always open, so
+// that the window may be disabled by using nil.
+type WorkWindow struct {
+	start time.Duration  // The time of day the window opens
+	end   time.Duration  // The time of day the window closes
+	loc   *time.Location // The time zone of start and end
+	now   func() time.Time
+}
+
+// ParseWorkWindow parses a window of the form HH:MM-HH:MM, whose times are in
+// the time zone loc. The window closes at the end time on the following day,
+// if that is earlier than the start time.
+func ParseWorkWindow(spec string, loc *time.Location) (*WorkWindow, error) {
+	from, to, found := strings.Cut(spec, "-")
+	if !found {
+		return nil, errors.Errorf("invalid window '%s': expected "+
+			"HH:MM-HH:MM", spec)
+	}
+	if loc == nil {
+		return nil, errors.Errorf("invalid window '%s': no time zone", spec)
+	}
+
+	start, err := parseTimeOfDay(from)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid window '%s'", spec)
+	}
+	end, err := parseTimeOfDay(to)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid window '%s'", spec)
+	}
+	if start == end {
+		return nil, errors.Errorf("invalid window '%s': the start and end "+
+			"times are the same", spec)
+	}
+
+	return &WorkWindow{start: start, end: end, loc: loc, now: time.Now}, nil
+}
+
+// parseTimeOfDay parses a time of day of the form HH:MM and returns it as the
+// duration since midnight.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, errors.Errorf("invalid time of day '%s': expected HH:MM", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute, nil
+}
+
+// IsOpen returns true if the window is open now.
+func (w *WorkWindow) IsOpen() bool {
+	if w == nil {
+		return true
+	}
+
+	return w.isOpenAt(w.now())
+}
+
+// isOpenAt returns true if the window is open at t.
+func (w *WorkWindow) isOpenAt(t time.Time) bool {
+	t = t.In(w.loc)
+	tod := time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+
+	if w.start < w.end {
+		return tod >= w.start && tod < w.end
+	}
+
+	return tod >= w.start || tod < w.end // The window spans midnight
+}
+
+func (w *WorkWindow) String() string {
+	if w == nil {
+		return "always"
+	}
+
+	format := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+
+	return fmt.Sprintf("%s-%s %s", format(w.start), format(w.end), w.loc)
+}
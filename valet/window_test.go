@@ -0,0 +1,143 @@
+/*
+ * Copyright (C) 2026. Genome Research Ltd. All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License,
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * @file window_test.go
+ * @author Keith James <kdj@sanger.ac.uk>
+ */
+
+package valet
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWorkWindow(t *testing.T) {
+	w, err := ParseWorkWindow("20:00-06:30", time.UTC)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "20:00-06:30 UTC", w.String())
+	}
+
+	for _, spec := range []string{"", "20:00", "20:00-", "8pm-6am",
+		"25:00-06:00", "20:00-20:00"} {
+		_, err = ParseWorkWindow(spec, time.UTC)
+		assert.Error(t, err, "expected an error for '%s'", spec)
+	}
+
+	_, err = ParseWorkWindow("20:00-06:00", nil)
+	assert.Error(t, err, "expected an error for no time zone")
+}
+
+func TestWorkWindowIsOpen(t *testing.T) {
+	day := func(hour int, min int) time.Time {
+		return time.Date(2026, 10, 16, hour, min, 0, 0, time.UTC)
+	}
+
+	overnight, err := ParseWorkWindow("20:00-06:00", time.UTC)
+	if !assert.NoError(t, err) {
+		return
+	}
+	daytime, err := ParseWorkWindow("09:00-17:00", time.UTC)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for at, expected := range map[time.Time][2]bool{ // overnight, daytime
+		day(0, 0):   {true, false},
+		day(5, 59):  {true, false},
+		day(6, 0):   {false, false},
+		day(9, 0):   {false, true},
+		day(16, 59): {false, true},
+		day(17, 0):  {false, false},
+		day(19, 59): {false, false},
+		day(20, 0):  {true, false},
+		day(23, 59): {true, false},
+	} {
+		assert.Equal(t, expected[0], overnight.isOpenAt(at),
+			"overnight at %s", at)
+		assert.Equal(t, expected[1], daytime.isOpenAt(at), "daytime at %s", at)
+	}
+
+	// The window is in its own time zone, whatever that of the time
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if !assert.NoError(t, err) {
+		return
+	}
+	inTokyo, err := ParseWorkWindow("20:00-06:00", tokyo)
+	if assert.NoError(t, err) {
+		assert.True(t, inTokyo.isOpenAt(day(12, 0)), "21:00 in Tokyo")
+		assert.False(t, inTokyo.isOpenAt(day(0, 0)), "09:00 in Tokyo")
+	}
+
+	var always *WorkWindow
+	assert.True(t, always.IsOpen())
+	assert.Equal(t, "always", always.String())
+}
+
+func TestMakeWorkWindowed(t *testing.T) {
+	path, err := NewFilePath("./testdata/valet/1/reads/fastq/reads1.fastq")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var numHeavy, numLight atomic.Int32
+	plan := WorkPlan{
+		WorkMatch{
+			pred: IsTrue,
+			work: Work{WorkFunc: func(path FilePath) error {
+				numHeavy.Add(1)
+				return nil
+			}, Rank: 1, Windowed: true},
+		},
+		WorkMatch{
+			pred: IsTrue,
+			work: Work{WorkFunc: func(path FilePath) error {
+				numLight.Add(1)
+				return nil
+			}, Rank: 2},
+		},
+	}
+
+	window, err := ParseWorkWindow("20:00-06:00", time.UTC)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	window.now = func() time.Time {
+		return time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	}
+	work, err := makeWork(context.Background(), path, plan, nil, window)
+	if assert.NoError(t, err) && assert.NoError(t, work.WorkFunc(path)) {
+		assert.Equal(t, int32(0), numHeavy.Load(),
+			"expected windowed work to be skipped outside the window")
+		assert.Equal(t, int32(1), numLight.Load(),
+			"expected other work to be done outside the window")
+	}
+
+	window.now = func() time.Time {
+		return time.Date(2026, 10, 16, 22, 0, 0, 0, time.UTC)
+	}
+	work, err = makeWork(context.Background(), path, plan, nil, window)
+	if assert.NoError(t, err) && assert.NoError(t, work.WorkFunc(path)) {
+		assert.Equal(t, int32(1), numHeavy.Load(),
+			"expected windowed work to be done within the window")
+		assert.Equal(t, int32(2), numLight.Load())
+	}
+}
@@ -24,14 +24,18 @@ package valet
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/md5"
+	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/klauspost/pgzip"
@@ -46,13 +50,35 @@ import (
 // WorkFunc is a worker function used by DoProcessFiles.
 type WorkFunc func(path FilePath) error
 
+// ContextWorkFunc is a worker function that is also passed the context of the
+// work on the file, which is cancelled if that work is abandoned (see
+// DoProcessFiles).
+type ContextWorkFunc func(ctx context.Context, path FilePath) error
+
 // Work describes a function to be executed and the rank of the execution. When
 // there is a choice of Work to be executed, Work with the smallest Rank value
-// (i.e. the highest rank) is performed first. In the case of a tie, either Work
-// may be selected for execution.
+// (i.e. the highest rank) is performed first. In the case of a tie, Work is
+// performed in the order in which it appears in its WorkPlan.
+//
+// CPU-bound Work, such as compression or checksumming, may be limited
+// separately from other Work by DoProcessFiles.
 type Work struct {
 	WorkFunc WorkFunc // A WorkFunc to execute
 	Rank     uint16   // The rank of the work
+	CPUBound bool     // The work is CPU-bound, rather than IO-bound
+	Windowed bool     // The work is only done while the WorkWindow is open
+
+	// A ContextWorkFunc to execute in place of WorkFunc, for work that may
+	// be abandoned part way through (optional).
+	ContextFunc ContextWorkFunc
+}
+
+// do executes the work on path, passing ctx to its ContextFunc, if it has one.
+func (w Work) do(ctx context.Context, path FilePath) error {
+	if w.ContextFunc != nil {
+		return w.ContextFunc(ctx, path)
+	}
+	return w.WorkFunc(path)
 }
 
 // WorkArr is a series of Work to be executed in ascending rank order.
@@ -77,22 +103,55 @@ func (s WorkArr) IsEmpty() bool {
 // WorkMatch is an association between a FilePredicate and Work to be done. If
 // the predicate returns true then the work will be done.
 type WorkMatch struct {
-	pred    FilePredicate // Predicate to match against candidate FilePath
-	work    Work          // Work to be executed on a matching FilePath
-	predDoc string        // A short description of the match criteria
-	workDoc string        // A short description of the work
+	pred     FilePredicate // Predicate to match against candidate FilePath
+	work     Work          // Work to be executed on a matching FilePath
+	predDoc  string        // A short description of the match criteria
+	workDoc  string        // A short description of the work
+	decision Decision      // What a verifying dry-run reports of the work
 }
 
 const OxfordNanoporeNamespace string = "ont"
 
+// ValetNamespace is the namespace of iRODS metadata added by valet itself.
+const ValetNamespace string = "valet"
+
+// CompressProgressSize is the minimum size of file for which CompressFile will
+// log its progress.
+const CompressProgressSize int64 = 512 * 1024 * 1024
+
+// CompressProgressInterval is the interval at which CompressFile will log its
+// progress.
+const CompressProgressInterval = time.Minute
+
 // String returns a descriptive string for the WorkMatch which includes the
 // predicate and work documentation strings.
 func (m WorkMatch) String() string {
 	return fmt.Sprintf("%s => %s", m.predDoc, m.workDoc)
 }
 
+// MarshalJSON returns a JSON description of the WorkMatch, comprising the
+// predicate and work documentation strings and the rank and properties of the
+// work, so that a WorkPlan may be rendered or compared by other tools. The
+// functions themselves are not described.
+func (m WorkMatch) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) // The descriptions of predicates include "&&"
+
+	err := enc.Encode(struct {
+		Predicate string `json:"predicate"`
+		Work      string `json:"work"`
+		Rank      uint16 `json:"rank"`
+		CPUBound  bool   `json:"cpu_bound"`
+		Windowed  bool   `json:"windowed"`
+	}{m.predDoc, m.workDoc, m.work.Rank, m.work.CPUBound, m.work.Windowed})
+
+	return bytes.TrimSpace(buf.Bytes()), err
+}
+
 // WorkPlan is a slice of WorkMatches. Where more than one Work is matched,
-// they will be done in rank order.
+// they will be done in rank order and, where ranks are equal, in the order of
+// the WorkPlan.
 type WorkPlan []WorkMatch
 
 func (p WorkPlan) Len() int {
@@ -134,19 +193,72 @@ func DryRunWorkPlan() WorkPlan {
 		workDoc: "Do Nothing"}}
 }
 
-// CreateChecksumWorkPlan manages checksum files.
-func CreateChecksumWorkPlan() WorkPlan {
+// CreateChecksumWorkPlan manages checksum files for the files selected by sel.
+func CreateChecksumWorkPlan(sel Selection) WorkPlan {
+	sel = sel.OrBuiltIn()
+
 	return []WorkMatch{{
-		pred:    RequiresChecksum,
+		pred:    sel.RequiresChecksum,
 		predDoc: "Requires Local Checksum File",
-		work:    Work{WorkFunc: CreateOrUpdateMD5ChecksumFile},
+		work: Work{WorkFunc: sel.checksums.CreateOrUpdateMD5ChecksumFile,
+			CPUBound: true},
 		workDoc: "Create Or Update Local MD5 Checksum File"}}
 }
 
-// ChecksumStateWorkPlan counts files that do not have a checksum.
-func ChecksumStateWorkPlan(countFunc WorkFunc) WorkPlan {
+// CreateRawChecksumWorkPlan manages checksum files for the uncompressed content
+// of compressed files selected by sel.
+func CreateRawChecksumWorkPlan(sel Selection) WorkPlan {
+	sel = sel.OrBuiltIn()
+
+	return []WorkMatch{{
+		pred:    sel.RequiresRawChecksum,
+		predDoc: "Requires Local Raw Checksum File",
+		work: Work{WorkFunc: sel.checksums.CreateOrUpdateRawMD5ChecksumFile,
+			CPUBound: true},
+		workDoc: "Create Or Update Local Raw MD5 Checksum File"}}
+}
+
+// CreateRemoteChecksumWorkPlan manages checksum files holding the checksums of
+// the files selected by sel as made by the remote algorithm alg, so that they
+// may be compared directly with the checksums of data objects. The plan is
+// empty for MD5, because the local checksum files are already MD5.
+func CreateRemoteChecksumWorkPlan(alg ChecksumAlgorithm,
+	sel Selection) WorkPlan {
+	if alg.IsMD5() {
+		return nil
+	}
+
+	sel = sel.OrBuiltIn()
+
 	return []WorkMatch{{
-		pred:    RequiresChecksum,
+		pred:    sel.MakeRequiresRemoteChecksum(alg),
+		predDoc: "Requires Local Remote Checksum File",
+		work: Work{WorkFunc: MakeRemoteChecksumFileCreator(alg,
+			sel.checksums), CPUBound: true},
+		workDoc: fmt.Sprintf("Create Or Update Local %s Checksum File",
+			strings.ToUpper(string(alg)))}}
+}
+
+// BackfillChecksumWorkPlan creates missing or stale checksum files for files
+// selected by sel that have been archived from localBase to remoteBase, using
+// the archived copies to confirm the checksums (see MakeChecksumBackfiller).
+func BackfillChecksumWorkPlan(localBase string, remoteBase string,
+	cPool *ex.ClientPool, alg ChecksumAlgorithm, sel Selection) WorkPlan {
+	sel = sel.OrBuiltIn()
+
+	return []WorkMatch{{
+		pred:    sel.RequiresChecksum,
+		predDoc: "Requires Local Checksum File",
+		work: Work{WorkFunc: MakeChecksumBackfiller(localBase, remoteBase,
+			cPool, alg, sel.checksums)},
+		workDoc: "Create Local MD5 Checksum File From Archive"}}
+}
+
+// ChecksumStateWorkPlan counts files selected by sel that do not have a
+// checksum.
+func ChecksumStateWorkPlan(countFunc WorkFunc, sel Selection) WorkPlan {
+	return []WorkMatch{{
+		pred:    sel.OrBuiltIn().RequiresChecksum,
 		predDoc: "Requires Local Checksum File",
 		work:    Work{WorkFunc: countFunc},
 		workDoc: "Count File"}}
@@ -163,42 +275,334 @@ func RemoveDirectoryWorkPlan(duration time.Duration) WorkPlan {
 	}}
 }
 
+// ArchiveParams describe how ArchiveFilesWorkPlan archives files.
+type ArchiveParams struct {
+	LocalBase    string         // The local root directory
+	RemoteBase   string         // The remote root collection
+	ClientPool   *ex.ClientPool // The iRODS client pool
+	DeleteLocal  bool           // Delete local files once archived
+	CleanupDelay time.Duration  // The delay before empty run directories are removed
+	Bundle       BundleParams   // Directories to archive as single tar objects
+	Selection    Selection      // The files to archive (optional, see MakeSelection)
+	Report       ReportConfig   // How MinKNOW reports are annotated (optional, see MakeReportConfig)
+	Metadata     []ex.AVU       // Additional metadata for every archived data object
+	NoProvenance bool           // Omit the provenance metadata (see ProvenanceMetadata)
+	ACLs         []ex.ACL       // ACLs to add to every archived data object (optional)
+	MirrorEmpty  bool           // Create collections for empty directories
+	Stats        *ArchiveStats  // Counts of the data archived (optional)
+
+	// Publishes an event for each file archived individually (optional).
+	Events *EventPublisher
+
+	// Holds the archiving of files while the archive's quota is exhausted
+	// (optional).
+	QuotaHold *QuotaHold
+
+	// The delay before empty run directories are removed, in place of
+	// CleanupDelay, so that it may be changed while archiving (optional).
+	CleanupDelaySetting *DurationSetting
+
+	// Checksum files are created by a separate process, rather than by the
+	// archiving WorkPlan.
+	ExternalChecksum bool
+
+	// The modification time of each file archived individually is recorded as
+	// metadata of its data object (see SourceModifiedTimeMetadata).
+	PreserveTimes bool
+
+	// The collections created while archiving have inheritance enabled, so
+	// that their contents inherit their ACLs. Collections that already exist
+	// are left unchanged.
+	InheritNewCollections bool
+
+	// Compressed files are verified before replacing the originals (see
+	// CompressAndVerifyFile).
+	VerifyCompression bool
+
+	// Local checksum files are removed once the checksum is confirmed as
+	// metadata of the archived copy. Thereafter, the archived copy of a file
+	// without a checksum file is confirmed by its metadata alone (see
+	// MakeIsCopiedByMetadata). Requires the MD5 RemoteChecksum and may not be
+	// used with ExternalChecksum. Has no effect with DeleteLocal, because a
+	// file is only removed once its checksum is confirmed in full.
+	ChecksumMetadataOnly bool
+
+	// The checksum algorithm used by the archive. Defaults to MD5.
+	RemoteChecksum ChecksumAlgorithm
+
+	// Resources, any of which must hold a valid replica of an archived data
+	// object before its file is considered archived (optional). Files are
+	// not copied again while awaiting replication.
+	RequireReplica []string
+
+	// Further remote root collections to which every file is also archived
+	// e.g. in another zone (optional). A file is considered archived only once
+	// it is archived to RemoteBase and to each of these. Each is reached
+	// through its own client pool, or through ClientPool if it has none. May
+	// not be used with Bundle or RequireReplica.
+	Mirrors []RemoteRoot
+
+	// Files are archived again, overwriting any archived copies, e.g. to
+	// recover from a corrupted archive. Each file has its checksum file
+	// recalculated and is archived once, and is considered archived only
+	// after that and once the new copy is verified. Requires ForceArchiveID
+	// and may not be used with Bundle or ExternalChecksum.
+	ForceArchive bool
+
+	// Identifies the recovery for which files are archived by force. Each
+	// data object archived by force is annotated with it (see
+	// ForceArchivedMetadata), so that its file is not archived by force again
+	// for the same recovery, even after a restart.
+	ForceArchiveID string
+}
+
 // ArchiveFilesWorkPlan copies files and metadata to iRODS via the following
 // steps:
 //
 // 1. Compresses local files where needed
-// 2. Creates or updated checksum files
-// 3. Copies files to iRODS
-// 4. Annotates metadata in iRODS
+// 2. Creates or updated checksum files, unless params.ExternalChecksum is true
+// 3. Copies files to iRODS, or bundles directories to iRODS (if enabled)
+// 4. Annotates metadata in iRODS, from MinKNOW reports or run directories
+// 5. Marks run directories with no remaining un-archived files as archived
 //
-// Additional steps are done if deleteLocal is true:
+// Additional steps are done if params.DeleteLocal is true:
 //
-// 5. Uncompressed copies of local compressed files are removed
-// 6. Successfully archived local files are removed
-// 7. Redundant local checksum files are removed
-// 8. Empty run directories are removed, after a delay
-func ArchiveFilesWorkPlan(localBase string, remoteBase string,
-	cPool *ex.ClientPool, deleteLocal bool, cleanup time.Duration) WorkPlan {
+// 6. Uncompressed copies of local compressed files are removed
+// 7. Successfully archived local files are removed
+// 8. Redundant local checksum files are removed
+// 9. Empty run directories are removed, after a delay
+//
+// Archived data objects have provenance metadata (see ProvenanceMetadata),
+// unless params.NoProvenance is true. Any params.ACLs are added to archived
+// data objects and their parent collections (see MakeCopier).
+//
+// If params.MirrorEmpty is true, empty local directories are archived as
+// empty collections (step 3), so that the archive mirrors the local layout.
+//
+// If params.ChecksumMetadataOnly is true, but params.DeleteLocal is not, local
+// checksum files are removed once their archived file is confirmed as copied
+// (step 8). Files without checksum files are not given new ones if their
+// archived copy is confirmed by its metadata. With params.DeleteLocal, copies
+// are confirmed by checksum only, so that no file is removed on the strength
+// of its metadata alone.
+//
+// If params.Mirrors are given, steps 3 and 4 are done for RemoteBase and
+// for each of them in turn, skipping any where already done. A file is
+// considered copied, to be marked or removed, only once copied to every one.
+//
+// If params.ForceArchive is true, every file is copied in step 3 whether or
+// not it is already archived, overwriting the archived copy, after its
+// checksum file is recalculated. Until then, it is not considered archived,
+// so is neither marked (step 5) nor removed (step 7). A file whose archived
+// copy is annotated as archived by force for params.ForceArchiveID is not
+// copied again.
+//
+// Long-running work (compression) is abandoned if ctx is cancelled.
+func ArchiveFilesWorkPlan(ctx context.Context,
+	params ArchiveParams) (WorkPlan, error) {
+	plan, _, err := archiveFilesWorkPlan(ctx, params)
+	return plan, err
+}
 
-	copyFile := MakeCopier(localBase, remoteBase, cPool)
-	isCopied := MakeIsCopied(localBase, remoteBase, cPool)
+// archiveFilesWorkPlan returns the WorkPlan described for ArchiveFilesWorkPlan,
+// together with the predicate it uses to decide whether a file is archived.
+func archiveFilesWorkPlan(ctx context.Context,
+	params ArchiveParams) (WorkPlan, FilePredicate, error) {
+	localBase, remoteBase, cPool := params.LocalBase, params.RemoteBase,
+		params.ClientPool
+	alg := params.RemoteChecksum
+	sel := params.Selection.OrBuiltIn()
+
+	remoteRoots := []RemoteRoot{{Base: remoteBase, ClientPool: cPool}}
+	for _, mirror := range params.Mirrors {
+		if mirror.ClientPool == nil {
+			mirror.ClientPool = cPool
+		}
+		remoteRoots = append(remoteRoots, mirror)
+	}
+	if len(remoteRoots) > 1 {
+		if params.Bundle.IsEnabled() || len(params.RequireReplica) > 0 {
+			return nil, nil, errors.New("archiving to more than one " +
+				"remote base may not be used with bundling or required replicas")
+		}
 
-	annotateFile := MakeAnnotator(localBase, remoteBase, cPool)
-	isAnnotated := MakeIsAnnotated(localBase, remoteBase, cPool)
+		seen := make(map[string]bool)
+		for _, root := range remoteRoots {
+			base := filepath.Clean(root.Base)
+			if seen[base] {
+				return nil, nil, errors.Errorf("remote base '%s' is given "+
+					"more than once", base)
+			}
+			seen[base] = true
+		}
+	}
+
+	if params.ForceArchive {
+		if params.Bundle.IsEnabled() || params.ExternalChecksum {
+			return nil, nil, errors.New("archiving by force may not be used " +
+				"with bundling or external checksums")
+		}
+		if strings.TrimSpace(params.ForceArchiveID) == "" {
+			return nil, nil, errors.New("archiving by force requires an ID " +
+				"for the recovery")
+		}
+	}
+
+	if params.ChecksumMetadataOnly {
+		if !alg.IsMD5() {
+			return nil, nil, errors.Errorf("checksum metadata alone may only be "+
+				"trusted by an MD5 archive, not '%s'", alg)
+		}
+		if params.ExternalChecksum {
+			return nil, nil, errors.New("checksum metadata alone may not be " +
+				"trusted with external checksums")
+		}
+	}
+
+	cf := sel.checksums
+	compressFile := makeContextCompressor(ctx, params.VerifyCompression,
+		sel.minCompressRatio, cf)
+
+	meta := params.Metadata
+	if !params.NoProvenance {
+		provenance, err := ProvenanceMetadata()
+		if err != nil {
+			return nil, nil, err
+		}
+		meta = append(append([]ex.AVU{}, params.Metadata...), provenance...)
+	}
+	if params.ForceArchive {
+		meta = append(append([]ex.AVU{}, meta...),
+			ForceArchivedMetadata(params.ForceArchiveID))
+	}
+
+	// Without its checksum file, a file can only be confirmed as copied by
+	// the metadata of its archived copy. That is not enough for the file to
+	// be removed, which requires its checksum file to be recreated.
+	trustMetadata := params.ChecksumMetadataOnly && !params.DeleteLocal
+
+	isCopiedTo := func(root RemoteRoot) FilePredicate {
+		isCopied := MakeIsCopied(localBase, root.Base, root.ClientPool, alg,
+			cf)
+		if trustMetadata {
+			return Or(MakeIsCopiedByMetadata(localBase, root.Base,
+				root.ClientPool, cf), isCopied)
+		}
+		return isCopied
+	}
+	isCopied := forAllBases(remoteRoots, isCopiedTo)
+
+	// An archived copy whose checksum does not match, although its checksum
+	// metadata do, may be corrupt. It is reported rather than overwritten, so
+	// that the corruption is not hidden. Archiving by force overwrites it.
+	var isChecksumMismatch FilePredicate
+	if !params.ForceArchive {
+		isChecksumMismatch = forAnyBase(remoteRoots,
+			func(root RemoteRoot) FilePredicate {
+				return MakeIsChecksumMismatch(localBase, root.Base,
+					root.ClientPool, alg, cf)
+			})
+	}
+
+	var isCopiedByMetadata FilePredicate = IsFalse
+	if trustMetadata {
+		isCopiedByMetadata = forAllBases(remoteRoots,
+			func(root RemoteRoot) FilePredicate {
+				return MakeIsCopiedByMetadata(localBase, root.Base,
+					root.ClientPool, cf)
+			})
+	}
+
+	// Archiving by force copies to every remote base, whether or not the
+	// file is already copied there
+	isCopiedToOrForced := isCopiedTo
+	if params.ForceArchive {
+		isCopiedToOrForced = func(RemoteRoot) FilePredicate { return IsFalse }
+	}
+
+	copyOpts := CopyOptions{
+		PreserveTimes:         params.PreserveTimes,
+		InheritNewCollections: params.InheritNewCollections,
+	}
+	copyFile := MakeEventPublishing(localBase, remoteBase,
+		MakeQuotaHolding(forEachBase(remoteRoots,
+			func(root RemoteRoot) WorkFunc {
+				return MakeCopier(localBase, root.Base, root.ClientPool, alg,
+					meta, params.ACLs, params.Stats, copyOpts, cf)
+			}, isCopiedToOrForced), params.QuotaHold), params.Events, cf,
+		params.Report)
+
+	isAnnotatedIn := func(root RemoteRoot) FilePredicate {
+		return MakeIsAnnotated(localBase, root.Base, root.ClientPool,
+			params.Report)
+	}
+	annotateFile := forEachBase(remoteRoots, func(root RemoteRoot) WorkFunc {
+		return MakeAnnotator(localBase, root.Base, root.ClientPool,
+			params.Report)
+	}, isAnnotatedIn)
+	isAnnotated := forAllBases(remoteRoots, isAnnotatedIn)
+
+	// Files in directories that are to be bundled are not copied individually
+	var isInBundleDir FilePredicate = IsFalse
+	if params.Bundle.IsEnabled() {
+		var err error
+		if isInBundleDir, err = MakeIsInBundleDir(params.Bundle, sel); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// A copy is only safe, for local files to be removed, once any required
+	// replica has been made. Until then, it is not copied again.
+	isSafe := isCopied
+	if len(params.RequireReplica) > 0 {
+		isSafe = And(isCopied, MakeHasReplicaOn(localBase, remoteBase, cPool,
+			params.RequireReplica))
+	}
+
+	// When archiving by force, an existing copy is not trusted until it has
+	// been replaced, so that no local file is removed before then
+	var forced *forcedCopies
+	if params.ForceArchive {
+		forced = newForcedCopies(forAllBases(remoteRoots,
+			func(root RemoteRoot) FilePredicate {
+				return makeIsForceArchived(localBase, root.Base, root.ClientPool,
+					params.ForceArchiveID)
+			}))
+		copyFile = forced.makeForceCopier(copyFile, cf)
+		isSafe = And(forced.isForceCopied, isSafe)
+	}
 
 	// The isCopied test expects an MD5 file to be present and will raise an
 	// error if not (and MD5 is essential). The RequiresCopying test is applied
 	// first to avoid errors on files that are just being compressed by this
 	// plan, prior to a later call to this same WorkPlan to do the archiving.
 	isArchived := Or(
-		And(RequiresCopying, isCopied, And(RequiresAnnotation, isAnnotated)),
-		And(RequiresCopying, isCopied, Not(RequiresAnnotation)))
+		And(sel.RequiresCopying, isSafe, And(RequiresAnnotation, isAnnotated)),
+		And(sel.RequiresCopying, isSafe, Not(RequiresAnnotation)))
 
 	hasRedundantChecksumFile := Or(
-		And(Not(RequiresCopying), HasChecksumFile), // E.g. fastq
-		And(RequiresCopying, isCopied, HasChecksumFile))
+		And(Not(sel.RequiresCopying), cf.HasChecksumFile), // E.g. fastq
+		And(sel.RequiresCopying, isSafe, cf.HasChecksumFile))
 
-	requiresRemoval := MakeRequiresRemoval(cleanup)
+	requiresRemoval := MakeRequiresRemoval(params.CleanupDelay)
+	if params.CleanupDelaySetting != nil {
+		requiresRemoval = MakeRequiresRemovalSetting(params.CleanupDelaySetting)
+	}
+
+	requiresCopying := And(sel.RequiresCopying, Not(isInBundleDir), Not(isCopied))
+	requiresCopyingDoc := "Requires Copying && Is Not In Bundle && Is Not Copied"
+	if params.ForceArchive {
+		requiresCopying = And(sel.RequiresCopying, Not(isInBundleDir),
+			Not(forced.isForceCopied))
+		requiresCopyingDoc = "Requires Copying && Is Not In Bundle && " +
+			"Is Not Archived By Force"
+	}
+	if params.ExternalChecksum {
+		// Copying requires a checksum file, which only the separate process
+		// may create
+		requiresCopying = And(Not(sel.IsAwaitingChecksum), requiresCopying)
+		requiresCopyingDoc = "Is Not Awaiting Checksum && " + requiresCopyingDoc
+	}
 
 	// Currently the entire processing pipeline is launched with a single
 	// WorkPlan as a parameter. All files passing the filters are operated on
@@ -208,63 +612,283 @@ func ArchiveFilesWorkPlan(localBase string, remoteBase string,
 
 	plan := []WorkMatch{
 		{
-			pred:    RequiresCompression,
+			pred:    sel.RequiresCompression,
 			predDoc: "Requires Compression Locally",
-			work:    Work{WorkFunc: CompressFile, Rank: 1},
-			workDoc: "Compress Local File",
+			work: Work{ContextFunc: compressFile, Rank: 1, CPUBound: true,
+				Windowed: true},
+			workDoc:  "Compress Local File",
+			decision: WouldCompress,
 		},
-		{
-			pred:    RequiresChecksum,
+	}
+
+	if trustMetadata {
+		plan = append(plan, WorkMatch{
+			pred:    And(sel.RequiresChecksum, Not(isCopiedByMetadata)),
+			predDoc: "Requires Local Checksum File && Is Not Copied By Metadata",
+			work: Work{WorkFunc: cf.CreateOrUpdateMD5ChecksumFile, Rank: 2,
+				CPUBound: true},
+			workDoc:  "Create Or Update Local MD5 Checksum File",
+			decision: WouldChecksum,
+		})
+	} else if !params.ExternalChecksum {
+		plan = append(plan, WorkMatch{
+			pred:    sel.RequiresChecksum,
 			predDoc: "Requires Local Checksum File",
-			work:    Work{WorkFunc: CreateOrUpdateMD5ChecksumFile, Rank: 2},
-			workDoc: "Create Or Update Local MD5 Checksum File",
-		},
-		{
-			pred:    And(RequiresCopying, Not(isCopied)),
-			predDoc: "Requires Copying && Is Not Copied",
-			work:    Work{WorkFunc: copyFile, Rank: 3},
-			workDoc: "Archive",
-		},
-		{
-			pred:    And(RequiresAnnotation, Not(isAnnotated)),
-			predDoc: "Requires Annotation && Is Not Annotated",
-			work:    Work{WorkFunc: annotateFile, Rank: 4},
-			workDoc: "Archive",
+			work: Work{WorkFunc: cf.CreateOrUpdateMD5ChecksumFile, Rank: 2,
+				CPUBound: true},
+			workDoc:  "Create Or Update Local MD5 Checksum File",
+			decision: WouldChecksum,
+		})
+	}
+
+	// A report rewritten in place e.g. to correct a sample ID, is
+	// re-annotated before it is copied again, so that the correction reaches
+	// an archived run even if the copy fails or is deferred. A report of a
+	// run yet to be archived is annotated once copied.
+	hasParentCollection := forAllBases(remoteRoots,
+		func(root RemoteRoot) FilePredicate {
+			return MakeHasParentCollection(localBase, root.Base,
+				root.ClientPool)
+		})
+
+	plan = append(plan, WorkMatch{
+		pred: And(RequiresAnnotation, hasParentCollection,
+			Not(isAnnotated)),
+		predDoc: "Requires Annotation && Has Archived Run && " +
+			"Is Not Annotated",
+		work:     Work{WorkFunc: annotateFile, Rank: 3},
+		workDoc:  "Re-annotate Archived Run",
+		decision: WouldAnnotate,
+	})
+	plan = append(plan, copySteps(requiresCopying, requiresCopyingDoc,
+		isChecksumMismatch, copyFile)...)
+	plan = append(plan,
+		WorkMatch{
+			pred:     And(RequiresAnnotation, Not(isAnnotated)),
+			predDoc:  "Requires Annotation && Is Not Annotated",
+			work:     Work{WorkFunc: annotateFile, Rank: 4},
+			workDoc:  "Archive",
+			decision: WouldAnnotate,
 		},
+		runDirAnnotationStep(localBase, remoteRoots, params.Report))
+
+	if params.MirrorEmpty {
+		hasCollectionIn := func(root RemoteRoot) FilePredicate {
+			return MakeHasCollection(localBase, root.Base, root.ClientPool)
+		}
+		hasCollection := forAllBases(remoteRoots, hasCollectionIn)
+
+		plan = append(plan, WorkMatch{
+			pred:    And(IsEmptyDir, Not(hasCollection)),
+			predDoc: "Is Empty Directory && Has No Collection",
+			work: Work{
+				WorkFunc: forEachBase(remoteRoots,
+					func(root RemoteRoot) WorkFunc {
+						return MakeCollectionCreator(localBase, root.Base,
+							root.ClientPool, params.ACLs, copyOpts)
+					}, hasCollectionIn),
+				Rank:     3,
+				Windowed: true,
+			},
+			workDoc:  "Archive Empty Directory",
+			decision: WouldArchive,
+		})
 	}
 
-	if deleteLocal {
+	var requiresBundling, isBundleDir FilePredicate
+	var isBundleArchived FilePredicate = IsFalse
+	if params.Bundle.IsEnabled() {
+		var err error
+		if requiresBundling, err = MakeRequiresBundling(params.Bundle, sel); err != nil {
+			return nil, nil, err
+		}
+		if isBundleDir, err = MakeIsBundleDir(params.Bundle); err != nil {
+			return nil, nil, err
+		}
+		isBundleArchived = MakeIsBundleArchived(localBase, remoteBase, cPool,
+			alg, sel)
+
+		plan = append(plan, WorkMatch{
+			pred:    And(requiresBundling, Not(isBundleArchived)),
+			predDoc: "Requires Bundling && Is Not Bundled",
+			work: Work{
+				WorkFunc: MakeTarArchiver(localBase, remoteBase, cPool,
+					alg, meta, params.ACLs, params.Stats, copyOpts, sel),
+				Rank:     3,
+				Windowed: true,
+			},
+			workDoc:  "Archive Bundle",
+			decision: WouldArchive,
+		})
+	}
+
+	isRunArchived := MakeIsRunArchived(isArchived, isInBundleDir,
+		isBundleArchived, sel)
+
+	plan = append(plan, WorkMatch{
+		pred:     And(IsMinKNOWRunDir, Not(IsRunArchivedMarked), isRunArchived),
+		predDoc:  "Is Run Directory && Is Not Marked && Is Run Archived",
+		work:     Work{WorkFunc: MakeArchivedMarkerWriter(sel), Rank: 5},
+		workDoc:  "Mark Run Directory Archived",
+		decision: WouldMark,
+	})
+
+	if params.DeleteLocal {
 		plan = append(plan,
 			WorkMatch{
-				pred:    HasCompressedVersion,
-				predDoc: "Has Local Compressed Version",
-				work:    Work{WorkFunc: RemoveFile, Rank: 5},
-				workDoc: "Remove Local Uncompressed Version",
+				pred:     HasCompressedVersion,
+				predDoc:  "Has Local Compressed Version",
+				work:     Work{WorkFunc: RemoveFile, Rank: 6},
+				workDoc:  "Remove Local Uncompressed Version",
+				decision: WouldDelete,
 			},
 			WorkMatch{
-				pred:    isArchived,
-				predDoc: "Requires Archiving && Is Archived",
-				work:    Work{WorkFunc: RemoveFile, Rank: 6},
-				workDoc: "Remove Local File",
+				// The file is confirmed to be unchanged and its archived copy
+				// verified again immediately before removal, in case either
+				// has changed since isArchived was evaluated
+				pred:     isArchived,
+				predDoc:  "Requires Archiving && Is Archived",
+				work:     Work{WorkFunc: MakeVerifiedRemover(isSafe), Rank: 7},
+				workDoc:  "Verify And Remove Local File",
+				decision: WouldDelete,
 			},
 			WorkMatch{
 				// A checksum file for a file that has been archived
 				// successfully or a file that is not to be being archived can
 				// be cleaned up.
-				pred:    hasRedundantChecksumFile,
-				predDoc: "Has Local Checksum File No Longer Needed",
-				work:    Work{WorkFunc: RemoveMD5ChecksumFile, Rank: 7},
-				workDoc: "Remove Local MD5 Checksum File",
+				pred:     hasRedundantChecksumFile,
+				predDoc:  "Has Local Checksum File No Longer Needed",
+				work:     Work{WorkFunc: cf.RemoveMD5ChecksumFile, Rank: 8},
+				workDoc:  "Remove Local MD5 Checksum File",
+				decision: WouldDeleteChecksum,
 			},
 			WorkMatch{
-				pred:    requiresRemoval,
-				predDoc: "Requires Removal",
-				work:    Work{WorkFunc: RemoveDirectory, Rank: 8},
-				workDoc: "Remove Old Run Directory",
+				pred:     requiresRemoval,
+				predDoc:  "Requires Removal",
+				work:     Work{WorkFunc: RemoveDirectory, Rank: 9},
+				workDoc:  "Remove Old Run Directory",
+				decision: WouldDelete,
+			})
+
+		if params.Bundle.IsEnabled() {
+			plan = append(plan, WorkMatch{
+				pred:    And(isBundleDir, isBundleArchived),
+				predDoc: "Is Bundle Directory && Is Bundled",
+				work: Work{
+					WorkFunc: MakeBundledFileRemover(localBase, remoteBase,
+						cPool, alg, sel),
+					Rank: 7,
+				},
+				workDoc:  "Remove Local Bundled Files",
+				decision: WouldDelete,
 			})
+		}
+	} else if params.ChecksumMetadataOnly {
+		plan = append(plan, WorkMatch{
+			// The checksum is confirmed as metadata of the archived copy
+			// by isCopied, so the checksum file is no longer needed
+			pred:     And(sel.RequiresCopying, cf.HasChecksumFile, isCopied),
+			predDoc:  "Requires Copying && Has Local Checksum File && Is Copied",
+			work:     Work{WorkFunc: cf.RemoveMD5ChecksumFile, Rank: 8},
+			workDoc:  "Remove Local MD5 Checksum File",
+			decision: WouldDeleteChecksum,
+		})
+	}
+
+	return plan, isArchived, nil
+}
+
+// copySteps returns the steps of an archiving WorkPlan that copy the files
+// matching requiresCopying using copyFile, except for those matching
+// isChecksumMismatch, whose archived copies do not match their checksums (see
+// MakeIsChecksumMismatch). Such a file is not copied again, which would
+// overwrite the evidence of corruption in the archive. Instead, its step fails
+// with an error each time it is tried, until it is quarantined. If
+// isChecksumMismatch is nil, as when archiving by force, every file matching
+// requiresCopying is copied.
+func copySteps(requiresCopying FilePredicate, requiresCopyingDoc string,
+	isChecksumMismatch FilePredicate, copyFile WorkFunc) []WorkMatch {
+	if isChecksumMismatch == nil {
+		return []WorkMatch{{
+			pred:     requiresCopying,
+			predDoc:  requiresCopyingDoc,
+			work:     Work{WorkFunc: copyFile, Rank: 3, Windowed: true},
+			workDoc:  "Archive",
+			decision: WouldArchive,
+		}}
+	}
+
+	return []WorkMatch{
+		{
+			pred:     And(requiresCopying, isChecksumMismatch),
+			predDoc:  requiresCopyingDoc + " && Is Checksum Mismatch",
+			work:     Work{WorkFunc: reportChecksumMismatch, Rank: 3},
+			workDoc:  "Report Mismatched Archived Copy",
+			decision: WouldReportMismatch,
+		},
+		{
+			pred:     And(requiresCopying, Not(isChecksumMismatch)),
+			predDoc:  requiresCopyingDoc + " && Is Not Checksum Mismatch",
+			work:     Work{WorkFunc: copyFile, Rank: 3, Windowed: true},
+			workDoc:  "Archive",
+			decision: WouldArchive,
+		},
+	}
+}
+
+// reportChecksumMismatch returns an error reporting that the archived copy of
+// path does not match its checksum.
+func reportChecksumMismatch(path FilePath) error {
+	return errors.Errorf("the archived copy of '%s' does not match its "+
+		"checksum and may be corrupt; not archiving it again (archive by "+
+		"force to overwrite it)", path.Location)
+}
+
+// AnnotateOnlyWorkPlan annotates iRODS with metadata for local files that
+// have already been archived from localBase to remoteBase, e.g. by another
+// tool. Unlike ArchiveFilesWorkPlan, it does no other work; local files are
+// not compressed, checksummed, copied or removed. Archived runs without report
+// metadata are annotated with metadata derived from their run directories.
+// Reports are parsed and annotated as configured by rc.
+func AnnotateOnlyWorkPlan(localBase string, remoteBase string,
+	cPool *ex.ClientPool, rc ReportConfig) WorkPlan {
+	isAnnotated := MakeIsAnnotated(localBase, remoteBase, cPool, rc)
+
+	return []WorkMatch{
+		{
+			pred:    And(RequiresAnnotation, Not(isAnnotated)),
+			predDoc: "Requires Annotation && Is Not Annotated",
+			work: Work{WorkFunc: MakeAnnotator(localBase, remoteBase, cPool,
+				rc), Rank: 4},
+			workDoc: "Annotate",
+		},
+		runDirAnnotationStep(localBase,
+			[]RemoteRoot{{Base: remoteBase, ClientPool: cPool}}, rc),
 	}
+}
 
-	return plan
+// runDirAnnotationStep returns a WorkMatch annotating archived run
+// directories that have no report metadata with metadata derived from the
+// directory (see MakeRunDirAnnotator), under each of remoteRoots.
+func runDirAnnotationStep(localBase string, remoteRoots []RemoteRoot,
+	rc ReportConfig) WorkMatch {
+	requiresIn := func(root RemoteRoot) FilePredicate {
+		return MakeRequiresRunDirAnnotation(localBase, root.Base,
+			root.ClientPool, rc)
+	}
+	annotate := forEachBase(remoteRoots, func(root RemoteRoot) WorkFunc {
+		return MakeRunDirAnnotator(localBase, root.Base, root.ClientPool, rc)
+	}, func(root RemoteRoot) FilePredicate {
+		return Not(requiresIn(root))
+	})
+
+	return WorkMatch{
+		pred:     And(IsMinKNOWRunDir, forAnyBase(remoteRoots, requiresIn)),
+		predDoc:  "Is Run Directory && Requires Run Directory Annotation",
+		work:     Work{WorkFunc: annotate, Rank: 4},
+		workDoc:  "Annotate Run From Directory",
+		decision: WouldAnnotate,
+	}
 }
 
 // DoNothing does nothing apart from log at debug level that it has been
@@ -281,25 +905,25 @@ func DoNothing(path FilePath) error {
 // checksum file is stale (its last modified time is older than the last
 // modified time of path). If the checksum file is stale this function deletes
 // it before creating a new one.
-func CreateOrUpdateMD5ChecksumFile(path FilePath) error {
+func (cf ChecksumFiles) CreateOrUpdateMD5ChecksumFile(path FilePath) error {
 	fn := "CreateOrUpdateMD5ChecksumFile"
 
-	staleFile, err := HasStaleChecksumFile(path)
+	staleFile, err := cf.HasStaleChecksumFile(path)
 	if err != nil {
 		return errors.Wrap(err, fn)
 	}
 
 	if staleFile {
-		return UpdateMD5ChecksumFile(path)
+		return cf.UpdateMD5ChecksumFile(path)
 	}
 
-	hasFile, err := HasChecksumFile(path)
+	hasFile, err := cf.HasChecksumFile(path)
 	if err != nil {
 		return errors.Wrap(err, fn)
 	}
 
 	if !hasFile {
-		err = CreateMD5ChecksumFile(path)
+		err = cf.CreateMD5ChecksumFile(path)
 		if err != nil {
 			return errors.Wrap(err, fn)
 		}
@@ -311,20 +935,20 @@ func CreateOrUpdateMD5ChecksumFile(path FilePath) error {
 // CreateMD5ChecksumFile calculates a checksum file for the data file at path
 // with contents as a hex-encoded string. It raises an error if the checksum
 // file already exists.
-func CreateMD5ChecksumFile(path FilePath) error {
+func (cf ChecksumFiles) CreateMD5ChecksumFile(path FilePath) error {
 	md5sum, err := CalculateFileMD5(path)
 	if err != nil {
 		return errors.Wrap(err, "CreateMD5ChecksumFile")
 	}
 
-	return createMD5File(path.ChecksumFilename(), md5sum)
+	return createMD5File(cf.ChecksumFilename(path), md5sum)
 }
 
 // UpdateMD5ChecksumFile removes the existing checksum file, if it exists and
 // creates a new one.
-func UpdateMD5ChecksumFile(path FilePath) error {
+func (cf ChecksumFiles) UpdateMD5ChecksumFile(path FilePath) error {
 	fn := "UpdateMD5ChecksumFile"
-	if rerr := RemoveMD5ChecksumFile(path); rerr != nil {
+	if rerr := cf.RemoveMD5ChecksumFile(path); rerr != nil {
 		return errors.Wrap(rerr, fn)
 	}
 
@@ -332,7 +956,7 @@ func UpdateMD5ChecksumFile(path FilePath) error {
 	log.Debug().Str("path", path.Location).
 		Msg("removed stale MD5 file")
 
-	if cerr := CreateMD5ChecksumFile(path); cerr != nil {
+	if cerr := cf.CreateMD5ChecksumFile(path); cerr != nil {
 		log.Error().Err(cerr).
 			Str("path", path.Location).
 			Msg("failed to create a new MD5 file")
@@ -342,22 +966,206 @@ func UpdateMD5ChecksumFile(path FilePath) error {
 	return nil
 }
 
-// RemoveMD5ChecksumFile removes the MD5 checksum file corresponding to path.
-// If the file does not exist by the time removal is attempted, no error is
+// CreateOrUpdateRawMD5ChecksumFile calculates a checksum for the uncompressed
+// content of the compressed file at path and writes it to the checksum file
+// named by RawChecksumFilename, replacing any existing one.
+func (cf ChecksumFiles) CreateOrUpdateRawMD5ChecksumFile(path FilePath) error {
+	md5sum, err := CalculateUncompressedMD5(path)
+	if err != nil {
+		return errors.Wrap(err, "CreateOrUpdateRawMD5ChecksumFile")
+	}
+
+	return createMD5File(cf.RawChecksumFilename(path), md5sum)
+}
+
+// MakeRemoteChecksumFileCreator returns a WorkFunc that calculates the checksum
+// of its argument using the remote algorithm alg and writes it, formatted as
+// the remote data store reports it, to the checksum file named by
+// RemoteChecksumFilename of cf, replacing any existing one.
+func MakeRemoteChecksumFileCreator(alg ChecksumAlgorithm,
+	cf ChecksumFiles) WorkFunc {
+	return func(path FilePath) error {
+		checksum, err := alg.RemoteChecksum(path.Location, "")
+		if err != nil {
+			return errors.Wrap(err, "RemoteChecksumFileCreator")
+		}
+
+		return createChecksumFile(cf.RemoteChecksumFilename(path, alg),
+			checksum)
+	}
+}
+
+// MakeChecksumBackfiller returns a WorkFunc that will create a checksum file
+// for its argument, if the argument has been archived from localBase to
+// remoteBase. This reconciles the checksum files with the archive without
+// copying the data again, e.g. after restoring data that lost its checksum
+// files.
+//
+// The checksum file is created only once the local content is confirmed to
+// match the archived copy: the checksum of the data object, made with the
+// archive's checksum algorithm alg, and its checksum metadata must both match
+// the local file. A mismatch is an error. A file that has not been archived is
+// skipped. The checksum file is named as described by cf.
+func MakeChecksumBackfiller(localBase string, remoteBase string,
+	cPool *ex.ClientPool, alg ChecksumAlgorithm, cf ChecksumFiles) WorkFunc {
+
+	return func(path FilePath) (err error) { // NRV
+		defer func() {
+			if err != nil {
+				err = errors.Wrap(err, "ChecksumBackfiller")
+			}
+		}()
+
+		var dest string
+		if dest, err = translatePath(localBase, remoteBase, path); err != nil {
+			return
+		}
+
+		var client *ex.Client
+		if client, err = getClient(cPool); err != nil {
+			return
+		}
+
+		defer func() {
+			err = returnClient(cPool, client, err)
+		}()
+
+		log := logs.GetLogger()
+		obj := ex.NewDataObject(client, dest)
+
+		var exists bool
+		if exists, err = obj.Exists(); err != nil {
+			return
+		}
+		if !exists {
+			log.Info().Str("path", path.Location).
+				Str("to", obj.RodsPath()).
+				Msg("not archived, skipping")
+			return
+		}
+
+		var md5sum []byte
+		if md5sum, err = CalculateFileMD5(path); err != nil {
+			return
+		}
+		checksum := fmt.Sprintf("%x", md5sum)
+
+		var expected string
+		if expected, err = alg.RemoteChecksum(path.Location, checksum); err != nil {
+			return
+		}
+
+		var ok bool
+		if ok, err = obj.HasValidChecksum(expected); err != nil {
+			return
+		}
+		if !ok {
+			return errors.Errorf("local content of %s does not match "+
+				"the archived copy %s: expected checksum %s but found %s",
+				path.Location, obj.RodsPath(), expected, obj.Checksum())
+		}
+
+		if ok, err = obj.HasValidChecksumMetadata(checksum); err != nil {
+			return
+		}
+		if !ok {
+			return errors.Errorf("local content of %s does not match "+
+				"the checksum metadata of the archived copy %s",
+				path.Location, obj.RodsPath())
+		}
+
+		log.Info().Str("path", path.Location).
+			Str("to", obj.RodsPath()).
+			Str("checksum", checksum).
+			Msg("confirmed against archive, creating checksum file")
+
+		return createMD5File(cf.ChecksumFilename(path), md5sum)
+	}
+}
+
+// RemoveMD5ChecksumFile removes the MD5 checksum file corresponding to path,
+// any checksum file for its uncompressed content, any checksum file made
+// with a remote algorithm and any marker recording that it is incompressible.
+// If the files do not exist by the time removal is attempted, no error is
 // raised.
-func RemoveMD5ChecksumFile(path FilePath) error {
-	err := os.Remove(path.ChecksumFilename())
-	if os.IsNotExist(err) {
-		return nil
+func (cf ChecksumFiles) RemoveMD5ChecksumFile(path FilePath) error {
+	var err error
+	for _, name := range []string{cf.ChecksumFilename(path),
+		cf.RawChecksumFilename(path),
+		cf.RemoteChecksumFilename(path, SHA256Checksum),
+		cf.IncompressibleFilename(path)} {
+		if rerr := os.Remove(name); !os.IsNotExist(rerr) {
+			err = utilities.CombineErrors(err, rerr)
+		}
 	}
+
 	return errors.Wrap(err, "RemoveMD5ChecksumFile")
 }
 
+// MakeCompressor returns a WorkFunc that compresses files using CompressFile,
+// or CompressAndVerifyFile if verify is true, abandoning any compression in
+// progress if ctx is cancelled. A compressed file that achieves less than the
+// minimum compression ratio of sel is discarded and the original marked as
+// incompressible (see SelectParams).
+func MakeCompressor(ctx context.Context, verify bool, sel Selection) WorkFunc {
+	sel = sel.OrBuiltIn()
+
+	return func(path FilePath) error {
+		return compressFile(ctx, path, verify, sel.minCompressRatio,
+			sel.checksums)
+	}
+}
+
+// makeContextCompressor returns a ContextWorkFunc that compresses files as
+// MakeCompressor does, abandoning any compression in progress if either ctx
+// or the per-file context is cancelled.
+func makeContextCompressor(ctx context.Context, verify bool,
+	minRatio float64, cf ChecksumFiles) ContextWorkFunc {
+	return func(fileCtx context.Context, path FilePath) error {
+		fileCtx, cancel := context.WithCancel(fileCtx)
+		defer cancel()
+
+		stop := context.AfterFunc(ctx, cancel)
+		defer stop()
+
+		return compressFile(fileCtx, path, verify, minRatio, cf)
+	}
+}
+
 // CompressFile compresses the target file using gzip. While doing so, it tee's
 // both the uncompressed data and compressed data to make MD5 checksums of
-// these and writes checksum files for the original, uncompressed file and the
-// new compressed file.
-func CompressFile(path FilePath) (err error) { // NRV
+// these and writes checksum files, named as described by cf, for the original,
+// uncompressed file and the new compressed file.
+//
+// Files of at least CompressProgressSize bytes have their progress logged
+// every CompressProgressInterval. If ctx is cancelled during compression, the
+// compression is abandoned, leaving the original file in place, and the
+// context's error is returned.
+//
+// The compressed file is kept whatever the ratio it achieves. Use
+// MakeCompressor to discard compression that is not worthwhile.
+func CompressFile(ctx context.Context, path FilePath, cf ChecksumFiles) error {
+	return compressFile(ctx, path, false, 0, cf)
+}
+
+// CompressAndVerifyFile behaves in the same way as CompressFile, except that
+// the compressed file is verified before it is put in place. It is read back
+// through an independent gzip decompressor to confirm that the MD5 checksum
+// of its uncompressed content matches that of the original file. If not, an
+// error is returned and the original file is left in place, without a
+// compressed version, so that it is not eligible for removal.
+func CompressAndVerifyFile(ctx context.Context, path FilePath,
+	cf ChecksumFiles) error {
+	return compressFile(ctx, path, true, 0, cf)
+}
+
+// compressFile compresses path as described for CompressFile. If minRatio is
+// not 0 and the compressed file does not achieve it, the compressed file is
+// discarded and only the checksum file for the original is written, together
+// with a marker recording the ratio achieved (see IncompressibleFilename). The
+// original is then archived uncompressed (see Selection.IsIncompressible).
+func compressFile(ctx context.Context, path FilePath, verify bool,
+	minRatio float64, cf ChecksumFiles) (err error) { // NRV
 	defer func() {
 		if err != nil {
 			err = errors.Wrap(err, "CompressFile")
@@ -376,7 +1184,7 @@ func CompressFile(path FilePath) (err error) { // NRV
 	// We use temp file and rename to add the compressed file to the data
 	// directory
 	var tmp *os.File
-	if tmp, err = os.CreateTemp(os.TempDir(), "valet-"); err != nil {
+	if tmp, err = createTempFile(); err != nil {
 		return
 	}
 
@@ -399,7 +1207,14 @@ func CompressFile(path FilePath) (err error) { // NRV
 	hRaw := md5.New()
 	mwRaw := io.MultiWriter(hRaw, gzw) // Write to MD5 and compressor
 
-	if _, err = io.Copy(mwRaw, in); err != nil {
+	src := &progressReader{ctx: ctx, r: in}
+	if path.Info != nil && path.Info.Size() >= CompressProgressSize {
+		done := make(chan token)
+		defer close(done)
+		go logProgress(path, src, CompressProgressInterval, done)
+	}
+
+	if _, err = copyBuffered(mwRaw, src); err != nil {
 		return
 	}
 	if err = gzw.Close(); err != nil {
@@ -408,6 +1223,34 @@ func CompressFile(path FilePath) (err error) { // NRV
 	if err = tmp.Close(); err != nil {
 		return
 	}
+
+	md5Raw := hRaw.Sum(nil)
+
+	// Compression that achieves too little is abandoned, leaving the file
+	// to be archived uncompressed, with a checksum file as for any other
+	if worthwhile, ratio := isCompressionWorthwhile(src.n.Load(),
+		tmp.Name(), minRatio); !worthwhile {
+		log.Info().Str("path", path.Location).
+			Msgf("compression ratio %.3f is below the minimum %.3f, "+
+				"archiving uncompressed", ratio, minRatio)
+
+		if err = createMD5File(cf.ChecksumFilename(path), md5Raw); err != nil {
+			return
+		}
+
+		// Written last, so that it is not older than the checksum file
+		return createChecksumFile(cf.IncompressibleFilename(path),
+			strconv.FormatFloat(ratio, 'f', 3, 64))
+	}
+
+	if verify {
+		if err = verifyCompressedFile(tmp.Name(), md5Raw); err != nil {
+			return
+		}
+		log.Debug().Str("src", path.Location).
+			Str("to", outPath).Msg("verified compressed file")
+	}
+
 	if err = os.Rename(tmp.Name(), outPath); err != nil {
 		return
 	}
@@ -417,13 +1260,12 @@ func CompressFile(path FilePath) (err error) { // NRV
 	var outFile FilePath
 	outFile, err = NewFilePath(outPath)
 	md5Cmp := hCmp.Sum(nil)
-	if err = createMD5File(outFile.ChecksumFilename(), md5Cmp); err != nil {
+	if err = createMD5File(cf.ChecksumFilename(outFile), md5Cmp); err != nil {
 		return
 	}
 
 	// We can also make a checksum file for the raw data
-	md5Raw := hRaw.Sum(nil)
-	if err = createMD5File(path.ChecksumFilename(), md5Raw); err != nil {
+	if err = createMD5File(cf.ChecksumFilename(path), md5Raw); err != nil {
 		return
 	}
 
@@ -435,6 +1277,152 @@ func CompressFile(path FilePath) (err error) { // NRV
 	return
 }
 
+// isCompressionWorthwhile returns true if compressing rawSize bytes to the
+// file name achieves at least minRatio, or if minRatio is 0, and the ratio
+// achieved. If the size of the compressed file cannot be found, compression is
+// assumed to be worthwhile.
+func isCompressionWorthwhile(rawSize int64, name string,
+	minRatio float64) (bool, float64) {
+	if minRatio == 0 {
+		return true, 0
+	}
+
+	info, err := os.Stat(name)
+	if err != nil || info.Size() == 0 {
+		return true, 0
+	}
+	ratio := float64(rawSize) / float64(info.Size())
+
+	return ratio >= minRatio, ratio
+}
+
+// readCompressionRatio returns the compression ratio recorded in the marker
+// file name (see IncompressibleFilename).
+func readCompressionRatio(name string) (float64, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return 0, err
+	}
+
+	ratio, err := strconv.ParseFloat(string(bytes.TrimSpace(b)), 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid incompressible marker '%s'",
+			name)
+	}
+
+	return ratio, nil
+}
+
+// ErrTruncatedGzip is the cause of an error reporting a gzip-compressed file
+// whose stream ends before it is complete, e.g. one whose compression by
+// another tool was interrupted. Such a file is structurally broken, which is
+// distinct from a complete file whose content fails to match a checksum.
+var ErrTruncatedGzip = errors.New("truncated gzip stream")
+
+// checkTruncated returns an error having the cause ErrTruncatedGzip if err
+// shows that the gzip stream of the file name ended prematurely, otherwise it
+// returns err.
+func checkTruncated(name string, err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return errors.Wrapf(ErrTruncatedGzip, "compressed file %s", name)
+	}
+
+	return err
+}
+
+// verifyCompressedFile returns an error unless the gzip-compressed file name
+// decompresses to content having the MD5 checksum md5sum. The file is read
+// with the standard library's gzip decompressor, rather than the one used to
+// compress it, so that a fault in the compressor is not repeated. If the file
+// is truncated, the error has the cause ErrTruncatedGzip.
+func verifyCompressedFile(name string, md5sum []byte) (err error) { // NRV
+	var f *os.File
+	if f, err = os.Open(name); err != nil {
+		return
+	}
+
+	defer func() {
+		err = utilities.CombineErrors(err, f.Close())
+	}()
+
+	var gzr *gzip.Reader
+	if gzr, err = gzip.NewReader(bufio.NewReader(f)); err != nil {
+		return errors.Wrapf(checkTruncated(name, err),
+			"failed to verify compressed file %s", name)
+	}
+
+	defer func() {
+		err = utilities.CombineErrors(err, gzr.Close())
+	}()
+
+	h := md5.New()
+	if _, err = copyBuffered(h, gzr); err != nil {
+		return errors.Wrapf(checkTruncated(name, err),
+			"failed to verify compressed file %s", name)
+	}
+
+	if sum := h.Sum(nil); !bytes.Equal(sum, md5sum) {
+		return errors.Errorf("compressed file %s does not match the "+
+			"original: uncompressed MD5 %x, expected %x", name, sum, md5sum)
+	}
+
+	return
+}
+
+// progressReader is an io.Reader that counts the bytes read through it. It
+// stops reading, returning the context's error, once its context is cancelled.
+type progressReader struct {
+	ctx context.Context
+	r   io.Reader
+	n   atomic.Int64
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	if err := pr.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := pr.r.Read(p)
+	pr.n.Add(int64(n))
+
+	return n, err
+}
+
+// logProgress logs the number of bytes read from pr every interval, until
+// done is closed.
+func logProgress(path FilePath, pr *progressReader, interval time.Duration,
+	done <-chan token) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	start := time.Now()
+	size := path.Info.Size()
+	log := logs.GetLogger()
+
+	for {
+		select {
+		case now := <-tick.C:
+			n := pr.n.Load()
+			elapsed := now.Sub(start)
+
+			var rate int64
+			if secs := int64(elapsed.Seconds()); secs > 0 {
+				rate = n / secs
+			}
+
+			log.Info().Str("path", path.Location).
+				Int64("bytes", n).
+				Int64("size", size).
+				Int64("percent", 100*n/size).
+				Int64("bytes_per_sec", rate).
+				Dur("elapsed", elapsed).
+				Msg("compressing")
+		case <-done:
+			return
+		}
+	}
+}
+
 // CalculateFileMD5 returns the MD5 checksum of the file at path.
 func CalculateFileMD5(path FilePath) (md5sum []byte, err error) { // NRV
 	var f *os.File
@@ -447,13 +1435,44 @@ func CalculateFileMD5(path FilePath) (md5sum []byte, err error) { // NRV
 	}()
 
 	h := md5.New()
-	if _, err = io.Copy(h, f); err != nil {
+	if _, err = copyBuffered(h, f); err != nil {
 		return
 	}
 	md5sum = h.Sum(nil)
 	return
 }
 
+// CalculateUncompressedMD5 calculates the MD5 checksum of the uncompressed
+// content of the gzip-compressed file at path, by streaming it through a
+// decompressor. If the file is truncated, the error has the cause
+// ErrTruncatedGzip.
+func CalculateUncompressedMD5(path FilePath) (md5sum []byte, err error) { // NRV
+	var f *os.File
+	if f, err = os.Open(path.Location); err != nil {
+		return
+	}
+
+	defer func() {
+		err = utilities.CombineErrors(err, f.Close())
+	}()
+
+	var gzr *pgzip.Reader
+	if gzr, err = pgzip.NewReader(bufio.NewReader(f)); err != nil {
+		return nil, checkTruncated(path.Location, err)
+	}
+
+	defer func() {
+		err = utilities.CombineErrors(err, gzr.Close())
+	}()
+
+	h := md5.New()
+	if _, err = io.Copy(h, gzr); err != nil {
+		return nil, checkTruncated(path.Location, err)
+	}
+	md5sum = h.Sum(nil)
+	return
+}
+
 // ReadMD5ChecksumFile reads and returns a checksum from a local file created by
 // CreateMD5ChecksumFile. It trims any whitespace (including any newline) from
 // the beginning and end of the checksum.
@@ -477,14 +1496,58 @@ func ReadMD5ChecksumFile(path FilePath) (md5sum []byte, err error) { // NRV
 }
 
 // AddMinKNOWReportAnnotation adds annotation from report to the parent
-// collection of the archived report obj.
-func AddMinKNOWReportAnnotation(obj *ex.DataObject, report MinKNOWReport) error {
-	meta, err := report.AsEnhancedMetadata()
+// collection of the archived report obj. Only the AVUs that differ from the
+// existing annotation are changed, so annotating again is idempotent. Any
+// stale report AVUs are removed before the current ones are added e.g. where
+// a value has changed since a run was re-basecalled. The metadata are made as
+// configured by rc.
+func AddMinKNOWReportAnnotation(obj *ex.DataObject, report MinKNOWReport,
+	rc ReportConfig) error {
+	rc = rc.orDefault()
+	meta, err := report.AsEnhancedMetadata(rc)
 	if err != nil {
 		return err
 	}
 
-	return obj.Parent().ReplaceMetadata(meta)
+	coll := obj.Parent()
+	current, err := coll.FetchMetadata()
+	if err != nil {
+		return err
+	}
+
+	toRemove, toAdd := reportAnnotationDiff(current, meta, rc)
+
+	log := logs.GetLogger()
+	if len(toRemove) > 0 {
+		for _, avu := range toRemove {
+			log.Info().Str("path", coll.RodsPath()).
+				Str("attr", avu.Attr).
+				Str("value", avu.Value).Msg("removing stale AVU")
+		}
+
+		if err = coll.RemoveMetadata(toRemove); err != nil {
+			return err
+		}
+	}
+
+	if len(toAdd) > 0 {
+		if err = coll.AddMetadata(toAdd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CopyOptions are the options of copying files into the archive.
+type CopyOptions struct {
+	// The modification time of each file is recorded as metadata of its data
+	// object (see SourceModifiedTimeMetadata).
+	PreserveTimes bool
+
+	// The collections created to hold data objects have inheritance enabled,
+	// so that their contents inherit their ACLs.
+	InheritNewCollections bool
 }
 
 // MakeCopier returns a WorkFunc capable of copying files to iRODS. Each
@@ -504,18 +1567,53 @@ func AddMinKNOWReportAnnotation(obj *ex.DataObject, report MinKNOWReport) error
 //
 // Any leading iRODS collections will be created by the WorkFunc as required.
 //
+// The checksum calculated by iRODS is verified against the local checksum. If
+// the archive uses a checksum algorithm alg other than MD5, the local checksum
+// is calculated with alg before copying.
+//
+// The data object's metadata are replaced by the creation metadata, including
+// the checksum, and any additional metadata meta (see ParseMetadata).
+//
+// Any ACLs acls (see ParseACL) are added to the data object and to the parent
+// collections between it and remoteBase. If acls is empty, permissions are
+// left unchanged.
+//
+// Any existing data object is overwritten. One left partially written by an
+// interrupted transfer is reported distinctly from one whose content differs
+// (see InspectRemoteObject).
+//
+// Immediately before copying, the checksum file is re-confirmed to be up to
+// date with the file. If the file has been modified since its checksum file
+// was written, the checksum file is updated and an error is returned instead
+// of copying, so that the file may be archived on a later pass.
+//
+// Each file archived successfully is counted in stats, if not nil.
+//
+// If opts.PreserveTimes is true, the modification time of the file is added
+// to the metadata of its data object (see SourceModifiedTimeMetadata).
+//
 // WorkFunc prerequisites: CreateOrUpdateMD5ChecksumFile
 //
-// i.e. files for copying are expected to have an MD5 checksum file.
+// i.e. files for copying are expected to have an MD5 checksum file, named as
+// described by cf.
 func MakeCopier(localBase string, remoteBase string,
-	cPool *ex.ClientPool) WorkFunc {
+	cPool *ex.ClientPool, alg ChecksumAlgorithm, meta []ex.AVU,
+	acls []ex.ACL, stats *ArchiveStats, opts CopyOptions,
+	cf ChecksumFiles) WorkFunc {
+	granter := newACLGranter(remoteBase, acls)
 
 	return func(path FilePath) (err error) { // NRV
 		var dst string
-		dst, err = translatePath(localBase, remoteBase, path)
+		if dst, err = translatePath(localBase, remoteBase, path); err != nil {
+			return
+		}
+
+		if path, err = confirmChecksumFile(path, cf); err != nil {
+			return
+		}
 
 		var chkFile FilePath
-		chkFile, err = NewFilePath(path.ChecksumFilename())
+		chkFile, err = NewFilePathNoStat(cf.ChecksumFilename(path))
 		if err != nil {
 			return
 		}
@@ -528,31 +1626,189 @@ func MakeCopier(localBase string, remoteBase string,
 			Str("checksum", string(checksum)).Msg("archiving")
 
 		var client *ex.Client
-		if client, err = cPool.Get(); err != nil {
+		if client, err = getClient(cPool); err != nil {
 			return
 		}
 
 		defer func() {
-			err = utilities.CombineErrors(err, cPool.Return(client))
+			err = returnClient(cPool, client, err)
 		}()
 
-		coll := ex.NewCollection(client, filepath.Dir(dst))
-		if err = coll.Ensure(); err != nil {
+		if err = ensureCollection(client, filepath.Dir(dst),
+			opts.InheritNewCollections); err != nil {
 			return
 		}
 
 		chk := string(checksum)
-		if _, err = ex.ArchiveDataObject(client, path.Location, dst, chk,
-			ex.MakeCreationMetadata(chk)); err != nil {
+		var expected string
+		if expected, err = alg.RemoteChecksum(path.Location, chk); err != nil {
+			return
+		}
+
+		var state RemoteState
+		if state, err = InspectRemoteObject(client, path, dst,
+			expected); err != nil {
 			return
 		}
+		logRemoteState(path, dst, state)
+
+		objMeta := meta
+		if opts.PreserveTimes {
+			objMeta = append(append([]ex.AVU{}, meta...),
+				SourceModifiedTimeMetadata(path))
+		}
+
+		if _, err = ex.ArchiveDataObject(client, path.Location, dst, expected,
+			ex.MakeCreationMetadata(chk), objMeta); err != nil {
+			return
+		}
+
+		if err = granter.grantObject(client, dst); err != nil {
+			return
+		}
+
+		stats.Add(path.Info.Size())
 
 		log.Debug().Str("path", path.Location).Str("to", dst).
+			Int64("size", path.Info.Size()).
 			Str("checksum", string(checksum)).Msg("archived")
 		return
 	}
 }
 
+// MakeCollectionCreator returns a WorkFunc capable of creating the collection
+// corresponding to a local directory under localBase, under remoteBase. It is
+// used to mirror empty directories, which otherwise have no representation in
+// the archive. Any acls are added to the collection and its parent
+// collections. If opts.InheritNewCollections is true, the collections created
+// have inheritance enabled.
+func MakeCollectionCreator(localBase string, remoteBase string,
+	cPool *ex.ClientPool, acls []ex.ACL, opts CopyOptions) WorkFunc {
+	granter := newACLGranter(remoteBase, acls)
+
+	return func(path FilePath) (err error) { // NRV
+		var dst string
+		if dst, err = translatePath(localBase, remoteBase, path); err != nil {
+			return
+		}
+
+		var client *ex.Client
+		if client, err = getClient(cPool); err != nil {
+			return
+		}
+
+		defer func() {
+			err = returnClient(cPool, client, err)
+		}()
+
+		if err = ensureCollection(client, dst,
+			opts.InheritNewCollections); err != nil {
+			return
+		}
+
+		if err = granter.grantCollection(client, dst); err != nil {
+			return
+		}
+
+		logs.GetLogger().Debug().Str("path", path.Location).Str("to", dst).
+			Msg("created collection")
+		return
+	}
+}
+
+// confirmChecksumFile returns a FilePath for path with up-to-date file
+// information, if its checksum file is not stale. If the file has been
+// modified since its checksum file was written, it updates the checksum file
+// and returns an error.
+func confirmChecksumFile(path FilePath, cf ChecksumFiles) (FilePath, error) {
+	current, err := NewFilePath(path.Location)
+	if err != nil {
+		return path, err
+	}
+
+	stale, err := cf.HasStaleChecksumFile(current)
+	if err != nil || !stale {
+		return current, err
+	}
+
+	logs.GetLogger().Warn().Str("path", path.Location).
+		Msg("file modified since checksum; updating checksum and deferring " +
+			"archiving")
+
+	if err = cf.UpdateMD5ChecksumFile(current); err != nil {
+		return current, err
+	}
+
+	return current, errors.Errorf("checksum file for '%s' was stale at "+
+		"archiving time", path.Location)
+}
+
+// InspectRemoteObject returns the state of the data object at remotePath in
+// relation to the local file at path, whose checksum, as calculated by the
+// remote data store, is expected. A data object whose checksum does not match
+// and which is smaller than the local file is taken to be the result of an
+// interrupted transfer (RemotePartial), as distinct from a data object with
+// different content (RemoteMismatch).
+func InspectRemoteObject(client *ex.Client, path FilePath, remotePath string,
+	expected string) (RemoteState, error) {
+	obj := ex.NewDataObject(client, remotePath)
+
+	exists, err := obj.Exists()
+	if err != nil || !exists {
+		return RemoteAbsent, err
+	}
+
+	item, err := client.ListItem(ex.Args{Checksum: true, Size: true},
+		*obj.RodsItem)
+	if err != nil {
+		return RemoteAbsent, err
+	}
+
+	return classifyRemoteObject(path.Info.Size(), item.ISize,
+		item.IChecksum, expected), nil
+}
+
+func classifyRemoteObject(localSize int64, remoteSize uint64,
+	remoteChecksum string, expected string) RemoteState {
+	switch {
+	case remoteChecksum != "" && remoteChecksum == expected:
+		return RemoteComplete
+	case isPartialObject(localSize, remoteSize):
+		return RemotePartial
+	default:
+		return RemoteMismatch
+	}
+}
+
+// isPartialObject returns true if a data object of remoteSize, whose checksum
+// does not match the local file of localSize, is smaller than the file and so
+// taken to be the result of an interrupted transfer.
+func isPartialObject(localSize int64, remoteSize uint64) bool {
+	return localSize > 0 && remoteSize < uint64(localSize)
+}
+
+// logRemoteState logs the state of an existing data object that is about to be
+// replaced by archiving the file at path. iRODS does not support resuming a
+// transfer, so a partial data object is overwritten from the start.
+func logRemoteState(path FilePath, remotePath string, state RemoteState) {
+	log := logs.GetLogger()
+
+	switch state {
+	case RemotePartial:
+		log.Warn().Str("path", path.Location).Str("to", remotePath).
+			Msg("found a partial data object from an interrupted " +
+				"transfer; overwriting it")
+	case RemoteMismatch:
+		log.Warn().Str("path", path.Location).Str("to", remotePath).
+			Msg("found a data object whose checksum does not match; " +
+				"overwriting it")
+	case RemoteComplete:
+		log.Info().Str("path", path.Location).Str("to", remotePath).
+			Msg("found a complete data object without valid metadata; " +
+				"replacing it")
+	}
+}
+
 // MakeAnnotator returns a WorkFunc that will add to iRODS any annotation
 // associated with local files. Each file passed to the WorkFunc will be
 // examined to see if has associated metadata e.g. it might contain metadata
@@ -565,21 +1821,25 @@ func MakeCopier(localBase string, remoteBase string,
 // -  MinKNOW report files.
 //
 //	The metadata contained in MinKNOW report files is parsed abd added to the
-//	collection containing the report data object in iRODS.
+//	collection containing the report data object in iRODS, as configured by
+//	rc.
 func MakeAnnotator(localBase string, remoteBase string,
-	cPool *ex.ClientPool) WorkFunc {
+	cPool *ex.ClientPool, rc ReportConfig) WorkFunc {
+	rc = rc.orDefault()
 
 	return func(path FilePath) (err error) { // NRV
 		var dst string
-		dst, err = translatePath(localBase, remoteBase, path)
+		if dst, err = translatePath(localBase, remoteBase, path); err != nil {
+			return
+		}
 
 		var client *ex.Client
-		if client, err = cPool.Get(); err != nil {
+		if client, err = getClient(cPool); err != nil {
 			return
 		}
 
 		defer func() {
-			err = utilities.CombineErrors(err, cPool.Return(client))
+			err = returnClient(cPool, client, err)
 		}()
 
 		var isReport bool
@@ -590,13 +1850,13 @@ func MakeAnnotator(localBase string, remoteBase string,
 
 		if isReport {
 			var report MinKNOWReport
-			report, err = ParseMinKNOWReport(path.Location)
+			report, err = ParseCompleteMinKNOWReport(path.Location, rc)
 			if err != nil {
 				return
 			}
 
 			obj := ex.NewDataObject(client, dst)
-			err = AddMinKNOWReportAnnotation(obj, report)
+			err = AddMinKNOWReportAnnotation(obj, report, rc)
 			if err != nil {
 				return
 			}
@@ -605,6 +1865,60 @@ func MakeAnnotator(localBase string, remoteBase string,
 	}
 }
 
+// MakeRunDirAnnotator returns a WorkFunc capable of annotating the collection
+// corresponding to a MinKNOW run directory under localBase, under remoteBase,
+// with metadata derived from the directory (see RunDirMetadata). This is a
+// fallback for runs without an archived report. If the collection already has
+// report metadata, it is left unchanged. The metadata are in the report
+// namespace of rc.
+func MakeRunDirAnnotator(localBase string, remoteBase string,
+	cPool *ex.ClientPool, rc ReportConfig) WorkFunc {
+	rc = rc.orDefault()
+
+	return func(path FilePath) (err error) { // NRV
+		var dst string
+		if dst, err = translatePath(localBase, remoteBase, path); err != nil {
+			return
+		}
+
+		var meta []ex.AVU
+		if meta, err = RunDirMetadata(path.Location, rc); err != nil {
+			return
+		}
+
+		var client *ex.Client
+		if client, err = getClient(cPool); err != nil {
+			return
+		}
+
+		defer func() {
+			err = returnClient(cPool, client, err)
+		}()
+
+		coll := ex.NewCollection(client, dst)
+
+		var current []ex.AVU
+		if current, err = coll.FetchMetadata(); err != nil {
+			return
+		}
+
+		log := logs.GetLogger()
+		if hasReportMetadata(current, rc) {
+			log.Debug().Str("path", path.Location).Str("to", dst).
+				Msg("run already annotated, not annotating from directory")
+			return
+		}
+
+		if err = coll.AddMetadata(meta); err != nil {
+			return
+		}
+
+		log.Info().Str("path", path.Location).Str("to", dst).
+			Msg("annotated run from its directory, in the absence of a report")
+		return
+	}
+}
+
 // RemoveFile removes the specified file.
 func RemoveFile(path FilePath) error {
 	log := logs.GetLogger()
@@ -621,8 +1935,54 @@ func RemoveFile(path FilePath) error {
 	return err
 }
 
+// MakeVerifiedRemover returns a WorkFunc that removes a local file only once
+// it has confirmed, immediately before removal, both that the file's size and
+// modification time are those of path, which were recorded when the file was
+// found, and that isCopied is still true for the file as it is now. This
+// closes the window between the evaluation of the predicates of a WorkPlan,
+// e.g. that the file has been archived, and the work of a later step, during
+// which the file or its archived copy may have changed. If either check fails,
+// the file is not removed and an error is returned.
+func MakeVerifiedRemover(isCopied FilePredicate) WorkFunc {
+	return func(path FilePath) error {
+		if path.Info == nil {
+			return errors.Errorf("refusing to delete '%s' because it was not "+
+				"found with file information", path.Location)
+		}
+
+		current, err := NewFilePath(path.Location)
+		if os.IsNotExist(err) {
+			logs.GetLogger().Warn().Str("path", path.Location).
+				Msg("had gone before deletion")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		sig := fileSignature{size: path.Info.Size(), modTime: path.Info.ModTime()}
+		if !sig.matches(current.Info) {
+			return errors.Errorf("refusing to delete '%s' because it has "+
+				"changed since it was found to be archived", path.Location)
+		}
+
+		ok, err := isCopied(current)
+		if err != nil {
+			return errors.Wrapf(err, "failed to verify the archived copy "+
+				"of '%s' before deletion", path.Location)
+		}
+		if !ok {
+			return errors.Errorf("refusing to delete '%s' because its "+
+				"archived copy is no longer verified", path.Location)
+		}
+
+		return RemoveFile(current)
+	}
+}
+
 // RemoveDirectory removes directories under a root, recursively. It skips any
-// that contain files, or whose descendants contain files.
+// that contain files, or whose descendants contain files. An ArchivedMarkerName
+// marker file does not prevent removal of the directory containing it.
 func RemoveDirectory(path FilePath) error {
 	log := logs.GetLogger()
 	log.Info().Str("path", path.Location).Msg("safe deleting recursively")
@@ -633,6 +1993,13 @@ func RemoveDirectory(path FilePath) error {
 	}
 
 	safeRemoveDir := func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			// A marker file removed with its directory is still visited
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
 		if !info.IsDir() {
 			return nil
 		}
@@ -642,7 +2009,12 @@ func RemoveDirectory(path FilePath) error {
 			return err
 		}
 
+		var marker string
 		for _, e := range contents {
+			if e.Name() == ArchivedMarkerName && e.Type().IsRegular() {
+				marker = filepath.Join(p, e.Name())
+				continue
+			}
 			if !e.IsDir() {
 				log.Warn().
 					Str("path", p).
@@ -650,7 +2022,11 @@ func RemoveDirectory(path FilePath) error {
 			}
 		}
 
-		if len(contents) != 0 {
+		if marker != "" && len(contents) == 1 {
+			if err = os.Remove(marker); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		} else if len(contents) != 0 {
 			return nil
 		}
 
@@ -673,31 +2049,67 @@ func RemoveDirectory(path FilePath) error {
 //
 // All predicates are evaluated as any work is done, therefore if some
 // predicates are true only after earlier work in the WorkPlan is complete,
-// they will pass, provided work is ranked in the appropriate order.
-func makeWork(path FilePath, plan WorkPlan) (Work, error) {
+// they will pass, provided work is ranked in the appropriate order. Work of
+// equal rank is done in the order of the WorkPlan.
+//
+// Each WorkFunc called waits for a slot of the appropriate kind in slots, if
+// not nil (see workLimits).
+//
+// Windowed Work is skipped, rather than waited for, while window is closed, so
+// that other Work for the file continues. The skipped work is done when the
+// file is next found while the window is open.
+//
+// Each WorkFunc called is passed ctx, if it takes a context (see Work). If ctx
+// is cancelled, no further WorkFuncs are called and its error is returned.
+//
+// If tracing is enabled, each WorkFunc called is covered by a child span of
+// the span in ctx.
+func makeWork(ctx context.Context, path FilePath, plan WorkPlan,
+	slots *fileSlots, window *WorkWindow) (Work, error) {
 	if plan.IsEmpty() {
 		return Work{WorkFunc: DoNothing}, nil
 	}
 
-	workFunc := func(fp FilePath) error {
-		wp := plan
-		sort.Sort(wp)
+	// Sort a copy because the plan is shared by concurrent work. The sort is
+	// stable so that ties in rank are broken by the order of the plan
+	wp := make(WorkPlan, len(plan))
+	copy(wp, plan)
+	sort.Stable(wp)
 
+	workFunc := func(fp FilePath) error {
 		log := logs.GetLogger()
 
 		for _, wm := range wp {
-			ok, err := wm.pred(fp)
+			// Abandoned work does not go on to its remaining steps
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			// Each predicate is evaluated with its own stat cache because
+			// the preceding work may have changed the sidecar files
+			ok, err := WithStatCache(wm.pred)(fp)
 			if err != nil {
 				return err
 			}
 
-			if ok {
+			if ok && wm.work.Windowed && !window.IsOpen() {
+				log.Info().Str("path", fp.Location).
+					Str("desc", wm.String()).
+					Uint64("rank", uint64(wm.work.Rank)).
+					Str("window", window.String()).
+					Msg("outside the work window, deferring work")
+			} else if ok {
 				log.Info().Str("path", fp.Location).
 					Str("desc", wm.String()).
 					Uint64("rank", uint64(wm.work.Rank)).
 					Msg("working")
 
-				if err := wm.work.WorkFunc(fp); err != nil {
+				release := slots.acquire(wm.work)
+				span := startWorkSpan(ctx, fp, wm)
+				err := wm.work.do(ctx, fp)
+				endSpan(span, err)
+				release()
+				if err != nil {
 					return err
 				}
 			} else {
@@ -714,13 +2126,17 @@ func makeWork(path FilePath, plan WorkPlan) (Work, error) {
 	return Work{WorkFunc: workFunc}, nil
 }
 
-func createMD5File(path string, md5sum []byte) (err error) { // NRV
+func createMD5File(path string, md5sum []byte) error {
+	return createChecksumFile(path, fmt.Sprintf("%x", md5sum))
+}
+
+func createChecksumFile(path string, checksum string) (err error) { // NRV
 	var f *os.File
-	if f, err = ioutil.TempFile(os.TempDir(), "valet-"); err != nil {
+	if f, err = createTempFile(); err != nil {
 		return
 	}
 
-	_, err = f.WriteString(fmt.Sprintf("%x\n", md5sum))
+	_, err = f.WriteString(checksum + "\n")
 	if err = f.Close(); err != nil {
 		return
 	}
@@ -737,10 +2153,31 @@ func createMD5File(path string, md5sum []byte) (err error) { // NRV
 	return
 }
 
+// translatePath returns the destination of path in the archive, by replacing
+// its local base lBase with the remote base rBase. As a safeguard against
+// archiving anywhere else, it returns an error if the destination is not
+// rBase itself or within it. The local base itself, e.g. a run directory
+// being annotated, translates to rBase.
 func translatePath(lBase string, rBase string, path FilePath) (string, error) {
 	src, err := filepath.Rel(lBase, path.Location)
 	if err != nil {
 		return "", err
 	}
-	return filepath.Clean(filepath.Join(rBase, src)), err
+
+	dest := filepath.Clean(filepath.Join(rBase, src))
+	if dest == filepath.Clean(rBase) {
+		return dest, nil
+	}
+
+	var ok bool
+	if ok, err = utilities.IsDescendantPath(rBase, dest); err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", errors.Errorf("refusing to translate '%s' from '%s' "+
+			"to '%s', which is outside the archive root '%s'",
+			path.Location, lBase, dest, rBase)
+	}
+
+	return dest, nil
 }
@@ -22,9 +22,13 @@
 package valet
 
 import (
+	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/md5"
+	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -75,13 +79,49 @@ func TestCreateMD5ChecksumFile(t *testing.T) {
 	time.Sleep(1 * time.Second)
 
 	path, _ := NewFilePath(dataFile)
-	err = CreateMD5ChecksumFile(path)
+	err = defaultChecksums.CreateMD5ChecksumFile(path)
 
 	if assert.NoError(t, err) {
 		assert.FileExists(t, checkSumFile)
 	}
 }
 
+func TestConfirmChecksumFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	dataFile, checkSumFile :=
+		filepath.Join(tmpDir, "reads1.fast5"),
+		filepath.Join(tmpDir, "reads1.fast5.md5")
+
+	err := utilities.CopyFile("./testdata/valet/1/reads/fast5/reads1.fast5",
+		dataFile, 0600)
+	assert.NoError(t, err)
+	err = utilities.CopyFile("./testdata/valet/1/reads/fast5/reads1.fast5.md5",
+		checkSumFile, 0600)
+	assert.NoError(t, err)
+
+	then := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(dataFile, then, then))
+
+	path, _ := NewFilePath(dataFile)
+	_, err = confirmChecksumFile(path, defaultChecksums)
+	assert.NoError(t, err)
+
+	// Modify the file after it was found and checksummed
+	assert.NoError(t, os.WriteFile(dataFile, []byte("modified\n"), 0600))
+	now := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(dataFile, now, now))
+
+	_, err = confirmChecksumFile(path, defaultChecksums)
+	assert.Error(t, err, "expected a stale checksum file to be detected")
+
+	chkFile, _ := NewFilePath(checkSumFile)
+	md5sum, err := ReadMD5ChecksumFile(chkFile)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "d2508118d0d39e198d1129d87d692d59", string(md5sum),
+			"expected the checksum file to be updated")
+	}
+}
+
 func TestReadMD5ChecksumFile(t *testing.T) {
 	f, err := NewFilePath("testdata/valet/1/reads/fast5/reads1.fast5.md5")
 	assert.NoError(t, err)
@@ -111,7 +151,7 @@ func TestRemoveMD5ChecksumFile(t *testing.T) {
 	time.Sleep(1 * time.Second)
 
 	path, _ := NewFilePath(dataFile)
-	err = RemoveMD5ChecksumFile(path)
+	err = defaultChecksums.RemoveMD5ChecksumFile(path)
 
 	if assert.NoError(t, err) {
 		assert.FileExists(t, dataFile)
@@ -122,6 +162,53 @@ func TestRemoveMD5ChecksumFile(t *testing.T) {
 	}
 }
 
+func TestMakeVerifiedRemover(t *testing.T) {
+	tmpDir := t.TempDir()
+	dataFile := filepath.Join(tmpDir, "reads1.fast5")
+
+	err := utilities.CopyFile("./testdata/valet/1/reads/fast5/reads1.fast5",
+		dataFile, 0600)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	copied := true
+	var verified []string
+	isCopied := func(path FilePath) (bool, error) {
+		verified = append(verified, path.Location)
+		return copied, nil
+	}
+	remove := MakeVerifiedRemover(isCopied)
+
+	path, _ := NewFilePath(dataFile)
+
+	// Modified since it was found
+	later := path.Info.ModTime().Add(time.Minute)
+	if !assert.NoError(t, os.Chtimes(dataFile, later, later)) {
+		return
+	}
+	err = remove(path)
+	assert.Error(t, err, "expected deletion to be refused")
+	assert.FileExists(t, dataFile)
+
+	// Unchanged since it was found, but the archived copy is no longer verified
+	path, _ = NewFilePath(dataFile)
+	copied = false
+	err = remove(path)
+	assert.Error(t, err, "expected deletion to be refused")
+	assert.FileExists(t, dataFile)
+	assert.Equal(t, []string{dataFile}, verified)
+
+	// Unchanged since it was found and the archived copy verified
+	copied = true
+	if assert.NoError(t, remove(path)) {
+		assert.NoFileExists(t, dataFile)
+	}
+
+	// Already gone
+	assert.NoError(t, remove(path))
+}
+
 func TestCalculateFileMD5(t *testing.T) {
 	path, _ := NewFilePath("./testdata/valet/1/reads/fastq/reads1.fastq")
 
@@ -134,6 +221,353 @@ func TestCalculateFileMD5(t *testing.T) {
 	}
 }
 
+func TestCalculateUncompressedMD5(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "TestCalculateUncompressedMD5")
+	defer os.RemoveAll(tmpDir)
+	assert.NoError(t, err)
+
+	dataFile := filepath.Join(tmpDir, "reads1.fastq")
+	err = utilities.CopyFile("./testdata/valet/1/reads/fastq/reads1.fastq",
+		dataFile, 0600)
+	assert.NoError(t, err)
+
+	uncomp, _ := NewFilePath(dataFile)
+	assert.NoError(t, CompressFile(context.Background(), uncomp,
+		defaultChecksums))
+
+	comp, _ := NewFilePath(uncomp.CompressedFilename())
+	md5sum, err := CalculateUncompressedMD5(comp)
+	if assert.NoError(t, err) {
+		encoded := make([]byte, hex.EncodedLen(len(md5sum)))
+		hex.Encode(encoded, md5sum)
+		assert.Equal(t, string(encoded), "5c9597f3c8245907ea71a89d9d39d08e")
+	}
+
+	notComp, _ := NewFilePath("./testdata/valet/1/reads/fastq/reads1.fastq")
+	_, err = CalculateUncompressedMD5(notComp)
+	assert.Error(t, err, "expected an error for an uncompressed file")
+}
+
+func TestCreateOrUpdateRawMD5ChecksumFile(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "TestCreateOrUpdateRawMD5ChecksumFile")
+	defer os.RemoveAll(tmpDir)
+	assert.NoError(t, err)
+
+	dataFile := filepath.Join(tmpDir, "reads1.fastq")
+	err = utilities.CopyFile("./testdata/valet/1/reads/fastq/reads1.fastq",
+		dataFile, 0600)
+	assert.NoError(t, err)
+
+	uncomp, _ := NewFilePath(dataFile)
+	assert.NoError(t, CompressFile(context.Background(), uncomp,
+		defaultChecksums))
+
+	time.Sleep(1 * time.Second)
+
+	path, _ := NewFilePath(uncomp.CompressedFilename())
+	ok, err := RequiresRawChecksum(path)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected to require a raw checksum")
+	}
+
+	err = defaultChecksums.CreateOrUpdateRawMD5ChecksumFile(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, filepath.Join(tmpDir, "reads1.fastq.gz.raw.md5"),
+			defaultChecksums.RawChecksumFilename(path))
+
+		checksumFile, _ := NewFilePath(defaultChecksums.RawChecksumFilename(path))
+		md5sum, err := ReadMD5ChecksumFile(checksumFile)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "5c9597f3c8245907ea71a89d9d39d08e", string(md5sum))
+		}
+
+		ok, err = RequiresRawChecksum(path)
+		if assert.NoError(t, err) {
+			assert.False(t, ok, "expected not to require a raw checksum")
+		}
+
+		assert.NoError(t, defaultChecksums.RemoveMD5ChecksumFile(path))
+		assert.NoFileExists(t, defaultChecksums.RawChecksumFilename(path))
+	}
+}
+
+func TestMakeWorkRankTies(t *testing.T) {
+	path, _ := NewFilePath("./testdata/valet/1/reads/fastq/reads1.fastq")
+
+	var order []string
+	record := func(name string) WorkFunc {
+		return func(path FilePath) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	plan := WorkPlan{
+		{pred: IsTrue, work: Work{WorkFunc: record("c"), Rank: 2}},
+		{pred: IsTrue, work: Work{WorkFunc: record("a"), Rank: 1}},
+		{pred: IsTrue, work: Work{WorkFunc: record("d"), Rank: 2}},
+		{pred: IsTrue, work: Work{WorkFunc: record("b"), Rank: 1}},
+		{pred: IsTrue, work: Work{WorkFunc: record("e"), Rank: 2}},
+	}
+
+	for i := 0; i < 100; i++ {
+		order = nil
+
+		work, err := makeWork(context.Background(), path, plan, nil, nil)
+		if assert.NoError(t, err) && assert.NoError(t, work.WorkFunc(path)) {
+			assert.Equal(t, []string{"a", "b", "c", "d", "e"}, order,
+				"expected ties in rank to be done in plan order")
+		}
+	}
+}
+
+func TestWorkPlanMarshalJSON(t *testing.T) {
+	plan := WorkPlan{
+		{pred: IsTrue, predDoc: "Is True && Is True",
+			work:    Work{WorkFunc: DoNothing, Rank: 2, CPUBound: true},
+			workDoc: "Do Nothing"},
+		{pred: IsFalse, predDoc: "Is False",
+			work:    Work{WorkFunc: DoNothing, Rank: 1, Windowed: true},
+			workDoc: "Do Nothing"},
+	}
+
+	b, err := json.Marshal(plan)
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `[
+  {"predicate": "Is True && Is True", "work": "Do Nothing", "rank": 2,
+   "cpu_bound": true, "windowed": false},
+  {"predicate": "Is False", "work": "Do Nothing", "rank": 1,
+   "cpu_bound": false, "windowed": true}
+]`, string(b))
+	}
+}
+
+func TestArchiveFilesWorkPlanExternalChecksum(t *testing.T) {
+	steps := func(plan WorkPlan) []string {
+		var s []string
+		for _, m := range plan {
+			s = append(s, m.workDoc)
+		}
+		return s
+	}
+
+	params := ArchiveParams{LocalBase: "./testdata/valet",
+		RemoteBase: "/testZone/home/irods"}
+
+	plan, err := ArchiveFilesWorkPlan(context.Background(), params)
+	if assert.NoError(t, err) {
+		assert.Contains(t, steps(plan),
+			"Create Or Update Local MD5 Checksum File")
+	}
+
+	params.ExternalChecksum = true
+	plan, err = ArchiveFilesWorkPlan(context.Background(), params)
+	if assert.NoError(t, err) {
+		assert.NotContains(t, steps(plan),
+			"Create Or Update Local MD5 Checksum File")
+
+		for _, m := range plan {
+			if m.work.Rank == 3 && m.workDoc == "Archive" {
+				assert.Equal(t, "Is Not Awaiting Checksum && Requires Copying "+
+					"&& Is Not In Bundle && Is Not Copied "+
+					"&& Is Not Checksum Mismatch", m.predDoc)
+
+				// Awaiting its checksum, so the archive is not consulted
+				path, _ := NewFilePath(
+					"./testdata/valet/1/reads/fast5/reads2.fast5")
+				ok, err := m.pred(path)
+				if assert.NoError(t, err) {
+					assert.False(t, ok)
+				}
+			}
+		}
+	}
+}
+
+func TestCopyStepsChecksumMismatch(t *testing.T) {
+	path, err := NewFilePath("./testdata/valet/1/reads/fast5/reads1.fast5")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var copied int
+	copyFile := func(path FilePath) error {
+		copied++
+		return nil
+	}
+
+	// A file whose archived copy does not match is not uploaded again
+	plan := WorkPlan(copySteps(IsTrue, "Requires Copying", IsTrue, copyFile))
+	results, err := ProcessFile(path, plan)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "does not match its checksum")
+	}
+	assert.Equal(t, 0, copied)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, StepFailed, results[0].Outcome)
+		assert.Equal(t, "Report Mismatched Archived Copy",
+			results[0].Match.workDoc)
+	}
+
+	plan = copySteps(IsTrue, "Requires Copying", IsFalse, copyFile)
+	_, err = ProcessFile(path, plan)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, copied)
+
+	// Archiving by force does not look for a mismatch
+	plan = copySteps(IsTrue, "Requires Copying", nil, copyFile)
+	if assert.Len(t, plan, 1) {
+		_, err = ProcessFile(path, plan)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, copied)
+	}
+}
+
+func TestArchiveFilesWorkPlanChecksumMetadataOnly(t *testing.T) {
+	params := ArchiveParams{LocalBase: "./testdata/valet",
+		RemoteBase: "/testZone/home/irods", ChecksumMetadataOnly: true}
+
+	plan, err := ArchiveFilesWorkPlan(context.Background(), params)
+	if assert.NoError(t, err) {
+		var descs []string
+		for _, m := range plan {
+			descs = append(descs, m.String())
+		}
+
+		assert.Contains(t, descs, "Requires Local Checksum File && "+
+			"Is Not Copied By Metadata => "+
+			"Create Or Update Local MD5 Checksum File")
+		assert.Contains(t, descs, "Requires Copying && "+
+			"Has Local Checksum File && Is Copied => "+
+			"Remove Local MD5 Checksum File")
+	}
+
+	// A file is only removed once its checksum is confirmed in full
+	deleting := params
+	deleting.DeleteLocal = true
+	plan, err = ArchiveFilesWorkPlan(context.Background(), deleting)
+	if assert.NoError(t, err) {
+		var descs []string
+		for _, m := range plan {
+			descs = append(descs, m.String())
+		}
+
+		assert.Contains(t, descs, "Requires Local Checksum File => "+
+			"Create Or Update Local MD5 Checksum File")
+		assert.NotContains(t, descs, "Requires Local Checksum File && "+
+			"Is Not Copied By Metadata => "+
+			"Create Or Update Local MD5 Checksum File")
+	}
+
+	// Only an MD5 archive has checksum metadata that may be trusted alone
+	params.RemoteChecksum = SHA256Checksum
+	_, err = ArchiveFilesWorkPlan(context.Background(), params)
+	assert.Error(t, err)
+
+	params.RemoteChecksum = MD5Checksum
+	params.ExternalChecksum = true
+	_, err = ArchiveFilesWorkPlan(context.Background(), params)
+	assert.Error(t, err)
+}
+
+func TestArchiveFilesWorkPlanMirrorEmpty(t *testing.T) {
+	params := ArchiveParams{LocalBase: "./testdata/valet",
+		RemoteBase: "/testZone/home/irods"}
+	desc := "Is Empty Directory && Has No Collection => " +
+		"Archive Empty Directory"
+
+	descs := func(plan WorkPlan) []string {
+		var s []string
+		for _, m := range plan {
+			s = append(s, m.String())
+		}
+		return s
+	}
+
+	plan, err := ArchiveFilesWorkPlan(context.Background(), params)
+	if assert.NoError(t, err) {
+		assert.NotContains(t, descs(plan), desc)
+	}
+
+	params.MirrorEmpty = true
+	plan, err = ArchiveFilesWorkPlan(context.Background(), params)
+	if assert.NoError(t, err) {
+		assert.Contains(t, descs(plan), desc)
+
+		// Not an empty directory, so the archive is not consulted
+		for _, m := range plan {
+			if m.workDoc == "Archive Empty Directory" {
+				path, _ := NewFilePath("./testdata/valet/1/reads")
+				ok, err := m.pred(path)
+				if assert.NoError(t, err) {
+					assert.False(t, ok)
+				}
+			}
+		}
+	}
+}
+
+func TestArchiveFilesWorkPlanReannotate(t *testing.T) {
+	params := ArchiveParams{LocalBase: "./testdata/valet",
+		RemoteBase: "/testZone/home/irods"}
+
+	plan, err := ArchiveFilesWorkPlan(context.Background(), params)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var descs []string
+	for _, m := range plan {
+		if m.work.Rank == 3 {
+			descs = append(descs, m.workDoc)
+		}
+	}
+
+	// Re-annotation precedes the copy of the same rank, in plan order
+	if assert.NotEmpty(t, descs) {
+		assert.Equal(t, "Re-annotate Archived Run", descs[0])
+		assert.Contains(t, descs, "Archive")
+	}
+
+	// Not a report, so the archive is not consulted
+	for _, m := range plan {
+		if m.workDoc == "Re-annotate Archived Run" {
+			path, _ := NewFilePath("./testdata/valet/1/reads/fast5/reads1.fast5")
+			ok, err := m.pred(path)
+			if assert.NoError(t, err) {
+				assert.False(t, ok)
+			}
+		}
+	}
+}
+
+func TestAnnotateOnlyWorkPlan(t *testing.T) {
+	plan := AnnotateOnlyWorkPlan("./testdata/valet", "/testZone/home/irods",
+		nil, ReportConfig{})
+	if assert.Len(t, plan, 2) {
+		assert.Equal(t, "Requires Annotation && Is Not Annotated => Annotate",
+			plan[0].String())
+		assert.Equal(t, "Is Run Directory && Requires Run Directory "+
+			"Annotation => Annotate Run From Directory", plan[1].String())
+
+		// Files other than reports, and directories other than runs, are
+		// never annotated, so the archive is not consulted for them
+		for _, p := range []string{
+			"./testdata/valet/1/reads/fastq/reads1.fastq",
+			"./testdata/valet/1/reads/fast5/reads1.fast5",
+			"./testdata/valet/testdir",
+		} {
+			path, _ := NewFilePath(p)
+			for _, m := range plan {
+				ok, err := m.pred(path)
+				if assert.NoError(t, err) {
+					assert.False(t, ok, "expected %s not to match", p)
+				}
+			}
+		}
+	}
+}
+
 func TestCompressFile(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "TestCompressFile")
 	defer os.RemoveAll(tmpDir)
@@ -151,17 +585,17 @@ func TestCompressFile(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Calculates the MD5 of the uncompressed file
-	err = CreateMD5ChecksumFile(randFile)
+	err = defaultChecksums.CreateMD5ChecksumFile(randFile)
 	assert.NoError(t, err)
 
-	checksumFile, err := NewFilePath(randFile.ChecksumFilename())
+	checksumFile, err := NewFilePath(defaultChecksums.ChecksumFilename(randFile))
 	assert.NoError(t, err)
 
 	expectedMD5, err := ReadMD5ChecksumFile(checksumFile)
 	assert.NoError(t, err)
 
 	// Compress and check result
-	err = CompressFile(randFile)
+	err = CompressFile(context.Background(), randFile, defaultChecksums)
 	assert.NoError(t, err)
 
 	compFile, err := NewFilePath(randFile.CompressedFilename())
@@ -171,6 +605,171 @@ func TestCompressFile(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestCompressAndVerifyFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	dataFile := filepath.Join(tmpDir, "reads1.fastq")
+	err := utilities.CopyFile("./testdata/valet/1/reads/fastq/reads1.fastq",
+		dataFile, 0600)
+	assert.NoError(t, err)
+
+	path, err := NewFilePath(dataFile)
+	assert.NoError(t, err)
+
+	rawMD5, err := CalculateFileMD5(path)
+	assert.NoError(t, err)
+	expectedMD5 := []byte(hex.EncodeToString(rawMD5))
+
+	if assert.NoError(t, CompressAndVerifyFile(context.Background(), path,
+		defaultChecksums)) {
+		assert.FileExists(t, path.CompressedFilename())
+
+		compFile, err := NewFilePath(path.CompressedFilename())
+		assert.NoError(t, err)
+		assert.NoError(t, compressedFileMatches(compFile.Location,
+			expectedMD5))
+	}
+}
+
+func TestCompressFileMinRatio(t *testing.T) {
+	sel, err := MakeSelection(SelectParams{MinCompressRatio: 1.1})
+	if !assert.NoError(t, err) {
+		return
+	}
+	compress := MakeCompressor(context.Background(), false, sel)
+
+	tmpDir := t.TempDir()
+
+	// Random data compress to no less than their own size, while repeated
+	// data compress well
+	random := make([]byte, 64*1024)
+	_, err = rand.Read(random)
+	assert.NoError(t, err)
+
+	for name, content := range map[string][]byte{
+		"random.txt":   random,
+		"repeated.txt": bytes.Repeat([]byte("ACGT"), 16*1024),
+	} {
+		if !assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, name),
+			content, 0644)) {
+			return
+		}
+	}
+
+	randPath, err := NewFilePath(filepath.Join(tmpDir, "random.txt"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, compress(randPath))
+	assert.NoFileExists(t, randPath.CompressedFilename())
+	assert.FileExists(t, defaultChecksums.ChecksumFilename(randPath))
+	assert.FileExists(t, defaultChecksums.IncompressibleFilename(randPath))
+
+	// The marker is read by any Selection with the same ratio, as it would be
+	// after a restart
+	restarted, err := MakeSelection(SelectParams{MinCompressRatio: 1.1})
+	if !assert.NoError(t, err) {
+		return
+	}
+	ok, err := restarted.RequiresCompression(randPath)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expected no further compression")
+	}
+	ok, err = restarted.RequiresCopying(randPath)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected copying uncompressed")
+	}
+
+	// Without a minimum ratio, the marker is ignored
+	ok, err = RequiresCompression(randPath)
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "expected compression without a minimum ratio")
+	}
+
+	// Once changed, the file is a candidate for compression again
+	assert.NoError(t, os.WriteFile(randPath.Location, random[:1024], 0644))
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(randPath.Location, later, later))
+	changed, err := NewFilePath(randPath.Location)
+	if assert.NoError(t, err) {
+		ok, err = restarted.RequiresCompression(changed)
+		if assert.NoError(t, err) {
+			assert.True(t, ok, "expected a changed file to be compressed")
+		}
+	}
+
+	repPath, err := NewFilePath(filepath.Join(tmpDir, "repeated.txt"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, compress(repPath))
+	assert.FileExists(t, repPath.CompressedFilename())
+	assert.NoFileExists(t, defaultChecksums.IncompressibleFilename(repPath))
+
+	_, err = MakeSelection(SelectParams{MinCompressRatio: 0.5})
+	assert.Error(t, err)
+}
+
+func TestVerifyCompressedFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	content := []byte("ACGT\n")
+	rawMD5 := md5.Sum(content)
+
+	compressed := filepath.Join(tmpDir, "reads1.fastq.gz")
+	f, err := os.Create(compressed)
+	if !assert.NoError(t, err) {
+		return
+	}
+	gzw := gzip.NewWriter(f)
+	_, err = gzw.Write(content)
+	assert.NoError(t, err)
+	assert.NoError(t, gzw.Close())
+	assert.NoError(t, f.Close())
+
+	assert.NoError(t, verifyCompressedFile(compressed, rawMD5[:]))
+
+	otherMD5 := md5.Sum([]byte("TGCA\n"))
+	assert.Error(t, verifyCompressedFile(compressed, otherMD5[:]),
+		"expected a checksum mismatch to fail")
+
+	// Truncating the compressed data makes it unreadable
+	info, err := os.Stat(compressed)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Truncate(compressed, info.Size()-4))
+	assert.Error(t, verifyCompressedFile(compressed, rawMD5[:]),
+		"expected a truncated file to fail")
+
+	notCompressed := filepath.Join(tmpDir, "reads2.fastq.gz")
+	assert.NoError(t, os.WriteFile(notCompressed, content, 0600))
+	assert.Error(t, verifyCompressedFile(notCompressed, rawMD5[:]),
+		"expected an uncompressed file to fail")
+}
+
+func TestCompressFileCancelled(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "TestCompressFileCancelled")
+	defer os.RemoveAll(tmpDir)
+	assert.NoError(t, err)
+
+	dataFile := filepath.Join(tmpDir, "reads1.fastq")
+	err = utilities.CopyFile("./testdata/valet/1/reads/fastq/reads1.fastq",
+		dataFile, 0600)
+	assert.NoError(t, err)
+
+	path, err := NewFilePath(dataFile)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = CompressFile(ctx, path, defaultChecksums)
+	if assert.Error(t, err) {
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.FileExists(t, dataFile)
+		assert.NoFileExists(t, path.CompressedFilename())
+	}
+}
+
 func compressedFileMatches(path string, md5sum []byte) error {
 	f, err := os.Open(path)
 	if err != nil {
@@ -200,3 +799,115 @@ func compressedFileMatches(path string, md5sum []byte) error {
 
 	return err
 }
+
+func TestTranslatePath(t *testing.T) {
+	fp := func(location string) FilePath {
+		return FilePath{FileResource: FileResource{Location: location}}
+	}
+
+	dest, err := translatePath("/data", "/zone/archive",
+		fp("/data/run/reads1.fastq"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/zone/archive/run/reads1.fastq", dest)
+	}
+
+	dest, err = translatePath("/data/", "/zone/x/../archive/",
+		fp("/data/run/reads1.fastq"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/zone/archive/run/reads1.fastq", dest)
+	}
+
+	// Outside the local base, so would be outside the archive root
+	_, err = translatePath("/data", "/zone/archive",
+		fp("/data/../other/reads1.fastq"))
+	assert.Error(t, err)
+
+	_, err = translatePath("/data/run", "/zone/archive",
+		fp("/other/run/reads1.fastq"))
+	assert.Error(t, err)
+
+	_, err = translatePath("/data/run", "/zone/archive",
+		fp("/data/reads1.fastq"))
+	assert.Error(t, err)
+
+	// The local root translates to the archive root
+	dest, err = translatePath("/data", "/zone/archive", fp("/data"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/zone/archive", dest)
+	}
+
+	dest, err = translatePath("/data/", "/zone/archive/", fp("/data"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/zone/archive", dest)
+	}
+
+	// A relative path cannot be made relative to an absolute base
+	_, err = translatePath("/data", "/zone/archive", fp("run/reads1.fastq"))
+	assert.Error(t, err)
+}
+
+func TestClassifyRemoteObject(t *testing.T) {
+	expected := "b1946ac92492d2347c6235b4d2611184"
+	other := "d41d8cd98f00b204e9800998ecf8427e"
+
+	assert.Equal(t, RemoteComplete,
+		classifyRemoteObject(100, 100, expected, expected))
+	assert.Equal(t, RemotePartial,
+		classifyRemoteObject(100, 50, other, expected))
+	assert.Equal(t, RemotePartial,
+		classifyRemoteObject(100, 0, "", expected),
+		"an empty object without a checksum is partial")
+	assert.Equal(t, RemoteMismatch,
+		classifyRemoteObject(100, 100, other, expected))
+	assert.Equal(t, RemoteMismatch,
+		classifyRemoteObject(100, 200, other, expected))
+}
+
+func TestTruncatedGzip(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	content := bytes.Repeat([]byte("ACGT"), 16*1024)
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	_, err := gzw.Write(content)
+	assert.NoError(t, err)
+	assert.NoError(t, gzw.Close())
+	md5sum := md5.Sum(content)
+
+	complete := filepath.Join(tmpDir, "complete.fastq.gz")
+	truncated := filepath.Join(tmpDir, "truncated.fastq.gz")
+	empty := filepath.Join(tmpDir, "empty.fastq.gz")
+	for name, data := range map[string][]byte{
+		complete:  buf.Bytes(),
+		truncated: buf.Bytes()[:buf.Len()/2],
+		empty:     {},
+	} {
+		if !assert.NoError(t, os.WriteFile(name, data, 0644)) {
+			return
+		}
+	}
+
+	assert.NoError(t, verifyCompressedFile(complete, md5sum[:]))
+
+	// A complete file with the wrong content is a mismatch, not truncated
+	err = verifyCompressedFile(complete, make([]byte, md5.Size))
+	if assert.Error(t, err) {
+		assert.False(t, errors.Is(err, ErrTruncatedGzip))
+	}
+
+	for _, name := range []string{truncated, empty} {
+		err = verifyCompressedFile(name, md5sum[:])
+		if assert.Error(t, err) {
+			assert.True(t, errors.Is(err, ErrTruncatedGzip), name)
+		}
+
+		fp, err := NewFilePath(name)
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = CalculateUncompressedMD5(fp)
+		if assert.Error(t, err) {
+			assert.True(t, errors.Is(err, ErrTruncatedGzip), name)
+		}
+	}
+}